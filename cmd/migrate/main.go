@@ -0,0 +1,213 @@
+// Command migrate moves messages that are still embedded in chat documents into the
+// messages collection, removes the embedded array from the chats and records the latest
+// message as the chat's preview. It also gives direct chats the key that keeps two users from
+// having more than one. Users registered before email verification existed are marked as
+// verified, so they can keep starting chats.
+//
+// It can be run repeatedly: messages keep their original IDs, so ones that were already
+// copied by an interrupted run are skipped instead of duplicated, and chats that already
+// have a key are left alone.
+package main
+
+import (
+	"Real-Time-Chat-Application/domain"
+	"Real-Time-Chat-Application/infrastructure"
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// legacyChat is the shape chats had while messages were embedded in them
+type legacyChat struct {
+	ChatID   primitive.ObjectID `bson:"_id"`
+	Messages []legacyMessage    `bson:"messages"`
+}
+
+type legacyMessage struct {
+	MessageID primitive.ObjectID `bson:"message_id"`
+	SenderID  primitive.ObjectID `bson:"sender_id"`
+	Content   string             `bson:"content"`
+	Time      time.Time          `bson:"time"`
+	Edited    bool               `bson:"edited"`
+}
+
+func main() {
+	config := infrastructure.LoadConfig()
+	ctx := context.Background()
+
+	client, err := infrastructure.ConnectMongo(ctx, config.MongoURI)
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer client.Disconnect(ctx)
+
+	database := client.Database(config.DatabaseName)
+
+	if err := infrastructure.EnsureIndexes(ctx, database); err != nil {
+		log.Fatalf("Failed to create indexes: %v", err)
+	}
+
+	chats, messages, err := migrateMessages(ctx, database)
+	if err != nil {
+		log.Fatalf("Migration failed: %v", err)
+	}
+
+	log.Printf("Migrated %d messages from %d chats", messages, chats)
+
+	keyed, duplicates, err := migrateDirectKeys(ctx, database)
+	if err != nil {
+		log.Fatalf("Migration failed: %v", err)
+	}
+
+	log.Printf("Keyed %d direct chats, %d duplicates left unkeyed", keyed, duplicates)
+
+	verified, err := migrateEmailVerified(ctx, database)
+	if err != nil {
+		log.Fatalf("Migration failed: %v", err)
+	}
+
+	log.Printf("Marked %d existing users as verified", verified)
+}
+
+func migrateMessages(ctx context.Context, database *mongo.Database) (int, int, error) {
+	chatCollection := database.Collection("chats")
+	messageCollection := database.Collection("messages")
+
+	cursor, err := chatCollection.Find(ctx, bson.M{"messages": bson.M{"$exists": true}})
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to fetch chats: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	chatCount, messageCount := 0, 0
+	for cursor.Next(ctx) {
+		var chat legacyChat
+		if err := cursor.Decode(&chat); err != nil {
+			return chatCount, messageCount, fmt.Errorf("failed to decode chat: %w", err)
+		}
+
+		update := bson.M{"$unset": bson.M{"messages": ""}}
+		if len(chat.Messages) > 0 {
+			var latest domain.Message
+			documents := make([]interface{}, 0, len(chat.Messages))
+			for _, legacy := range chat.Messages {
+				messageID := legacy.MessageID
+				if messageID.IsZero() {
+					messageID = primitive.NewObjectIDFromTimestamp(legacy.Time)
+				}
+				message := domain.Message{
+					MessageID: messageID,
+					ChatID:    chat.ChatID,
+					SenderID:  legacy.SenderID,
+					Content:   legacy.Content,
+					Time:      legacy.Time,
+					Edited:    legacy.Edited,
+				}
+				if !message.Time.Before(latest.Time) {
+					latest = message
+				}
+				documents = append(documents, message)
+			}
+
+			// the chat list previews the latest message from the chat document
+			update["$set"] = bson.M{"last_message": domain.NewMessagePreview(latest)}
+
+			// unordered so a message copied by an earlier run does not stop the rest
+			_, err := messageCollection.InsertMany(ctx, documents, options.InsertMany().SetOrdered(false))
+			if err != nil && !onlyDuplicateKeyErrors(err) {
+				return chatCount, messageCount, fmt.Errorf("failed to copy messages of chat %s: %w", chat.ChatID.Hex(), err)
+			}
+			messageCount += len(documents)
+		}
+
+		_, err := chatCollection.UpdateOne(ctx, bson.M{"_id": chat.ChatID}, update)
+		if err != nil {
+			return chatCount, messageCount, fmt.Errorf("failed to update chat %s: %w", chat.ChatID.Hex(), err)
+		}
+		chatCount++
+	}
+	if err := cursor.Err(); err != nil {
+		return chatCount, messageCount, fmt.Errorf("cursor error: %w", err)
+	}
+
+	return chatCount, messageCount, nil
+}
+
+// migrateDirectKeys sets direct_key on the direct chats created before it existed. When two
+// users already have several chats, the oldest one gets the key and the others keep working
+// as they are but are no longer returned when the users open a chat.
+func migrateDirectKeys(ctx context.Context, database *mongo.Database) (int, int, error) {
+	chatCollection := database.Collection("chats")
+
+	filter := bson.M{
+		"direct_key":   bson.M{"$exists": false},
+		"type":         bson.M{"$ne": domain.ChatTypeGroup},
+		"participants": bson.M{"$size": 2},
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}}).
+		SetProjection(bson.M{"participants": 1})
+
+	cursor, err := chatCollection.Find(ctx, filter, opts)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to fetch chats: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	keyed, duplicates := 0, 0
+	for cursor.Next(ctx) {
+		var chat domain.Chat
+		if err := cursor.Decode(&chat); err != nil {
+			return keyed, duplicates, fmt.Errorf("failed to decode chat: %w", err)
+		}
+
+		key := domain.DirectChatKey(chat.Participants[0], chat.Participants[1])
+		_, err := chatCollection.UpdateOne(ctx, bson.M{"_id": chat.ChatID}, bson.M{"$set": bson.M{"type": domain.ChatTypeDirect, "direct_key": key}})
+		if mongo.IsDuplicateKeyError(err) {
+			duplicates++
+			continue
+		}
+		if err != nil {
+			return keyed, duplicates, fmt.Errorf("failed to update chat %s: %w", chat.ChatID.Hex(), err)
+		}
+		keyed++
+	}
+	if err := cursor.Err(); err != nil {
+		return keyed, duplicates, fmt.Errorf("cursor error: %w", err)
+	}
+
+	return keyed, duplicates, nil
+}
+
+// migrateEmailVerified marks the users stored before email verification existed as verified.
+// Users registered since always have the field, so they are left alone.
+func migrateEmailVerified(ctx context.Context, database *mongo.Database) (int64, error) {
+	result, err := database.Collection("users").UpdateMany(ctx,
+		bson.M{"email_verified": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"email_verified": true}})
+	if err != nil {
+		return 0, fmt.Errorf("failed to update users: %w", err)
+	}
+	return result.ModifiedCount, nil
+}
+
+// onlyDuplicateKeyErrors reports whether every write in a bulk insert failed because the
+// document was already there
+func onlyDuplicateKeyErrors(err error) bool {
+	bulkErr, ok := err.(mongo.BulkWriteException)
+	if !ok || bulkErr.WriteConcernError != nil {
+		return false
+	}
+	for _, writeErr := range bulkErr.WriteErrors {
+		if !mongo.IsDuplicateKeyError(writeErr) {
+			return false
+		}
+	}
+	return true
+}
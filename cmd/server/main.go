@@ -0,0 +1,117 @@
+package main
+
+import (
+	"Real-Time-Chat-Application/controller"
+	"Real-Time-Chat-Application/domain"
+	"Real-Time-Chat-Application/infrastructure"
+	"Real-Time-Chat-Application/repository"
+	"Real-Time-Chat-Application/router"
+	"Real-Time-Chat-Application/usecase"
+	"Real-Time-Chat-Application/websocket"
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"os/signal"
+	"syscall"
+)
+
+func main() {
+	config := infrastructure.LoadConfig()
+	if config.JWTSecret == "" {
+		log.Fatal("JWT_SECRET must be set")
+	}
+	if config.WSPingInterval >= config.WSPongWait {
+		log.Fatal("WS_PING_INTERVAL must be shorter than WS_PONG_WAIT")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	client, err := infrastructure.ConnectMongo(ctx, config.MongoURI)
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer client.Disconnect(context.Background())
+
+	database := client.Database(config.DatabaseName)
+	userCollection := infrastructure.NewMongoCollection(database.Collection("users"))
+	chatCollection := infrastructure.NewMongoCollection(database.Collection("chats"))
+	messageCollection := infrastructure.NewMongoCollection(database.Collection("messages"))
+	userTokenCollection := infrastructure.NewMongoCollection(database.Collection("user_tokens"))
+	sessionCollection := infrastructure.NewMongoCollection(database.Collection("sessions"))
+
+	if err := infrastructure.EnsureIndexes(ctx, database); err != nil {
+		log.Fatalf("Failed to create indexes: %v", err)
+	}
+
+	// Repositories
+	userRepository := repository.NewUserRepository(userCollection)
+	chatRepository := repository.NewChatRepository(chatCollection)
+	messageRepository := repository.NewMessageRepository(messageCollection, chatCollection)
+	userTokenRepository := repository.NewUserTokenRepository(userTokenCollection)
+	sessionRepository := repository.NewSessionRepository(sessionCollection)
+
+	tokenService := infrastructure.NewJWTService(config.JWTSecret, config.AccessTokenTTL, config.RefreshTokenTTL)
+	passwordHasher := infrastructure.NewBcryptHasher(config.BcryptCost)
+	totp := infrastructure.NewTOTPGenerator(domain.TwoFactorIssuer, nil)
+
+	var mailer domain.Mailer = infrastructure.NewSMTPMailer(config.SMTPHost, config.SMTPPort, config.SMTPUsername, config.SMTPPassword, config.MailFrom)
+	if config.SMTPHost == "" {
+		log.Println("SMTP_HOST is not set, mails are written to the log instead of being sent")
+		mailer = infrastructure.NewLogMailer()
+	}
+
+	// Usecases
+	userUsecase := usecase.NewUserUsecase(userRepository, userTokenRepository, sessionRepository, passwordHasher, mailer, config.ContextTimeout)
+	authUsecase := usecase.NewAuthUsecase(userRepository, userTokenRepository, sessionRepository, tokenService, passwordHasher, totp, mailer, config.ContextTimeout)
+	chatUsecase := usecase.NewChatUsecase(chatRepository, messageRepository, userRepository, config.ContextTimeout)
+	messageUsecase := usecase.NewMessageUsecase(messageRepository, chatRepository, config.ContextTimeout)
+
+	// Websocket hub
+	hub := websocket.NewHub(chatUsecase, messageUsecase, userUsecase)
+	hub.PingInterval = config.WSPingInterval
+	hub.PongWait = config.WSPongWait
+	hub.WriteWait = config.WSWriteWait
+	hub.MaxMessageSize = config.WSMaxMessage
+	go hub.Run()
+
+	// Controllers
+	userController := controller.NewUserController(userUsecase, authUsecase, hub)
+	chatController := controller.NewChatController(chatUsecase, hub)
+	messageController := controller.NewMessageController(messageUsecase, hub)
+
+	handler := router.NewRouter(tokenService, authUsecase, userController, chatController, messageController)
+	if err := handler.SetTrustedProxies(config.TrustedProxies); err != nil {
+		log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+	}
+
+	server := &http.Server{
+		Addr:    config.ServerAddress,
+		Handler: handler,
+	}
+
+	go func() {
+		log.Printf("Server listening on %s", config.ServerAddress)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Server failed: %v", err)
+		}
+	}()
+
+	<-ctx.Done()
+	log.Println("Shutting down server...")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), config.ShutdownTimeout)
+	defer cancel()
+
+	// Stop accepting new requests first, then close the websocket connections, which
+	// http.Server.Shutdown does not track once they have been hijacked
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Server shutdown error: %v", err)
+	}
+	if err := hub.Stop(shutdownCtx); err != nil {
+		log.Printf("Websocket hub shutdown error: %v", err)
+	}
+
+	log.Println("Server stopped")
+}
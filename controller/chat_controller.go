@@ -1,6 +1,7 @@
 package controller
 import (
 	"Real-Time-Chat-Application/domain"
+	"Real-Time-Chat-Application/httperr"
 	"Real-Time-Chat-Application/websocket"
 	"net/http"
 
@@ -20,54 +21,136 @@ func NewChatController(chatUsecase domain.ChatUsecase, hub *websocket.Hub) *Chat
 	}
 }
 
-// CreateChat handles creation of a new chat
+// CreateChat handles creation of a new chat. A request listing member_ids creates a group
+// of the caller and those members; otherwise it opens the direct chat with receiver_id,
+// answering 201 when it was created and 200 when it already existed.
 func (cc *ChatController) CreateChat(c *gin.Context) {
 	var chatRequest struct {
-		SenderID   primitive.ObjectID `json:"sender_id"`
-		ReceiverID primitive.ObjectID `json:"receiver_id"`
+		SenderID   primitive.ObjectID   `json:"sender_id"`
+		ReceiverID primitive.ObjectID   `json:"receiver_id"`
+		MemberIDs  []primitive.ObjectID `json:"member_ids"`
+		Title      string               `json:"title"`
+		Avatar     string               `json:"avatar"`
 	}
 	if err := c.ShouldBindJSON(&chatRequest); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		badRequest(c, err.Error())
 		return
 	}
 
-	chatID, err := cc.chatUsecase.CreateChat(c.Request.Context(), chatRequest.SenderID, chatRequest.ReceiverID)
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	// The caller can only start chats on their own behalf
+	if chatRequest.SenderID.IsZero() {
+		chatRequest.SenderID = userID
+	}
+	if chatRequest.SenderID != userID {
+		forbidden(c, "Cannot create a chat on behalf of another user")
+		return
+	}
+
+	if len(chatRequest.MemberIDs) > 0 {
+		cc.createGroupChat(c, userID, chatRequest.MemberIDs, chatRequest.Title, chatRequest.Avatar)
+		return
+	}
+
+	chatID, created, err := cc.chatUsecase.CreateChat(c.Request.Context(), chatRequest.SenderID, chatRequest.ReceiverID)
+	if err != nil {
+		httperr.Respond(c, err)
+		return
+	}
+
+	// Connections only follow the chats their user had when they connected, so both users'
+	// open connections start following the chat here
+	for _, participant := range []primitive.ObjectID{chatRequest.SenderID, chatRequest.ReceiverID} {
+		cc.hub.SubscribeUser(participant.Hex(), chatID.Hex())
+	}
+
+	// Asking again for the same direct chat returns the one that exists
+	status := http.StatusCreated
+	if !created {
+		status = http.StatusOK
+	}
+	c.JSON(status, gin.H{"chat_id": chatID})
+}
+
+// createGroupChat creates a group, subscribes the members' connections to it and announces it
+func (cc *ChatController) createGroupChat(c *gin.Context, userID primitive.ObjectID, memberIDs []primitive.ObjectID, title, avatar string) {
+	chat, message, err := cc.chatUsecase.CreateGroupChat(c.Request.Context(), userID, memberIDs, title, avatar)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		httperr.Respond(c, err)
 		return
 	}
 
-	c.JSON(http.StatusCreated, gin.H{"chat_id": chatID})
+	for _, participant := range chat.Participants {
+		cc.hub.SubscribeUser(participant.Hex(), chat.ChatID.Hex())
+	}
+	cc.hub.BroadcastToChat(chat.ChatID.Hex(), websocket.EventMessageCreated, message)
+
+	c.JSON(http.StatusCreated, chat)
 }
 
 // GetChat retrieves a specific chat
 func (cc *ChatController) GetChat(c *gin.Context) {
 	chatID, err := primitive.ObjectIDFromHex(c.Param("chat_id"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid chat ID"})
+		badRequest(c, "Invalid chat ID")
+		return
+	}
+
+	userID, ok := currentUserID(c)
+	if !ok {
 		return
 	}
 
-	chat, err := cc.chatUsecase.GetChat(c.Request.Context(), chatID)
+	chat, err := cc.chatUsecase.GetChat(c.Request.Context(), userID, chatID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		httperr.Respond(c, err)
 		return
 	}
 
 	c.JSON(http.StatusOK, chat)
 }
 
+// ListChats returns the caller's chat list: the other participants, a preview of the latest
+// message and the unread count of every chat, most recently active first
+func (cc *ChatController) ListChats(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	chats, err := cc.chatUsecase.ListChats(c.Request.Context(), userID)
+	if err != nil {
+		httperr.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, chats)
+}
+
 // GetUserChats retrieves all chats for a user
 func (cc *ChatController) GetUserChats(c *gin.Context) {
 	userID, err := primitive.ObjectIDFromHex(c.Param("user_id"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		badRequest(c, "Invalid user ID")
+		return
+	}
+
+	callerID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	if callerID != userID {
+		forbidden(c, "Cannot list the chats of another user")
 		return
 	}
 
 	chats, err := cc.chatUsecase.GetChatsByUserID(c.Request.Context(), userID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		httperr.Respond(c, err)
 		return
 	}
 
@@ -78,13 +161,18 @@ func (cc *ChatController) GetUserChats(c *gin.Context) {
 func (cc *ChatController) DeleteChat(c *gin.Context) {
 	chatID, err := primitive.ObjectIDFromHex(c.Param("chat_id"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid chat ID"})
+		badRequest(c, "Invalid chat ID")
 		return
 	}
 
-	err = cc.chatUsecase.DeleteChat(c.Request.Context(), chatID)
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	err = cc.chatUsecase.DeleteChat(c.Request.Context(), userID, chatID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		httperr.Respond(c, err)
 		return
 	}
 
@@ -95,19 +183,24 @@ func (cc *ChatController) DeleteChat(c *gin.Context) {
 func (cc *ChatController) UpdateChat(c *gin.Context) {
 	chatID, err := primitive.ObjectIDFromHex(c.Param("chat_id"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid chat ID"})
+		badRequest(c, "Invalid chat ID")
+		return
+	}
+
+	var settings domain.ChatSettings
+	if err := c.ShouldBindJSON(&settings); err != nil {
+		badRequest(c, err.Error())
 		return
 	}
 
-	var chat domain.Chat
-	if err := c.ShouldBindJSON(&chat); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	userID, ok := currentUserID(c)
+	if !ok {
 		return
 	}
 
-	err = cc.chatUsecase.UpdateChat(c.Request.Context(), chatID, &chat)
+	chat, err := cc.chatUsecase.UpdateChat(c.Request.Context(), userID, chatID, settings)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		httperr.Respond(c, err)
 		return
 	}
 
@@ -117,23 +210,210 @@ func (cc *ChatController) UpdateChat(c *gin.Context) {
 func (cc *ChatController) GetChatByParticipants(c *gin.Context) {
 	SenderID, err := primitive.ObjectIDFromHex(c.Param("sender_id"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid sender ID"})
+		badRequest(c, "Invalid sender ID")
 		return
 	}
 
 	ReceiverID, err := primitive.ObjectIDFromHex(c.Param("receiver_id"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid receiver ID"})
+		badRequest(c, "Invalid receiver ID")
+		return
+	}
+
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	if userID != SenderID && userID != ReceiverID {
+		forbidden(c, "Cannot look up a chat you are not part of")
 		return
 	}
 
 	chat, err := cc.chatUsecase.GetChatByParticipants(c.Request.Context(), SenderID, ReceiverID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		httperr.Respond(c, err)
 		return
 	}
 
 	c.JSON(http.StatusOK, chat)
 }
 
+// MarkRead moves the caller's read marker of a chat to a message and tells the chat about it
+func (cc *ChatController) MarkRead(c *gin.Context) {
+	chatID, err := primitive.ObjectIDFromHex(c.Param("chat_id"))
+	if err != nil {
+		badRequest(c, "Invalid chat ID")
+		return
+	}
+
+	var readRequest struct {
+		MessageID primitive.ObjectID `json:"message_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&readRequest); err != nil {
+		badRequest(c, err.Error())
+		return
+	}
+
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	marker, advanced, err := cc.chatUsecase.MarkRead(c.Request.Context(), userID, chatID, readRequest.MessageID)
+	if err != nil {
+		httperr.Respond(c, err)
+		return
+	}
+
+	// Reading an older message changes nothing, so there is nothing to tell
+	if advanced {
+		cc.hub.BroadcastToChat(chatID.Hex(), websocket.EventReceipt, websocket.NewReceiptPayload(userID, marker))
+	}
+
+	c.JSON(http.StatusOK, marker)
+}
+
+// AddMembers adds users to a group. Their connections follow the group before the system
+// message is broadcast, so they receive it too.
+func (cc *ChatController) AddMembers(c *gin.Context) {
+	chatID, err := primitive.ObjectIDFromHex(c.Param("chat_id"))
+	if err != nil {
+		badRequest(c, "Invalid chat ID")
+		return
+	}
+
+	var membersRequest struct {
+		UserIDs []primitive.ObjectID `json:"user_ids" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&membersRequest); err != nil {
+		badRequest(c, err.Error())
+		return
+	}
+
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	message, err := cc.chatUsecase.AddMembers(c.Request.Context(), userID, chatID, membersRequest.UserIDs)
+	if err != nil {
+		httperr.Respond(c, err)
+		return
+	}
+
+	// Everyone was already a member
+	if message == nil {
+		c.JSON(http.StatusOK, gin.H{"message": "No members added"})
+		return
+	}
+
+	for _, memberID := range message.System.UserIDs {
+		cc.hub.SubscribeUser(memberID.Hex(), chatID.Hex())
+	}
+	cc.hub.BroadcastToChat(chatID.Hex(), websocket.EventMessageCreated, message)
+
+	c.JSON(http.StatusOK, message)
+}
+
+// RemoveMember removes a user from a group. The removed user still receives the system
+// message before their connections stop following the group.
+func (cc *ChatController) RemoveMember(c *gin.Context) {
+	chatID, err := primitive.ObjectIDFromHex(c.Param("chat_id"))
+	if err != nil {
+		badRequest(c, "Invalid chat ID")
+		return
+	}
+
+	memberID, err := primitive.ObjectIDFromHex(c.Param("user_id"))
+	if err != nil {
+		badRequest(c, "Invalid user ID")
+		return
+	}
+
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
 
+	message, err := cc.chatUsecase.RemoveMember(c.Request.Context(), userID, chatID, memberID)
+	if err != nil {
+		httperr.Respond(c, err)
+		return
+	}
+
+	cc.membershipEnded(chatID, memberID, message)
+	c.JSON(http.StatusOK, gin.H{"message": "Member removed successfully"})
+}
+
+// LeaveChat takes the caller out of a group
+func (cc *ChatController) LeaveChat(c *gin.Context) {
+	chatID, err := primitive.ObjectIDFromHex(c.Param("chat_id"))
+	if err != nil {
+		badRequest(c, "Invalid chat ID")
+		return
+	}
+
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	message, err := cc.chatUsecase.LeaveChat(c.Request.Context(), userID, chatID)
+	if err != nil {
+		httperr.Respond(c, err)
+		return
+	}
+
+	cc.membershipEnded(chatID, userID, message)
+	c.JSON(http.StatusOK, gin.H{"message": "Left the chat successfully"})
+}
+
+// SetMemberRole lets the owner of a group change the role of a member, or hand the group over
+// by giving the owner role
+func (cc *ChatController) SetMemberRole(c *gin.Context) {
+	chatID, err := primitive.ObjectIDFromHex(c.Param("chat_id"))
+	if err != nil {
+		badRequest(c, "Invalid chat ID")
+		return
+	}
+
+	memberID, err := primitive.ObjectIDFromHex(c.Param("user_id"))
+	if err != nil {
+		badRequest(c, "Invalid user ID")
+		return
+	}
+
+	var roleRequest struct {
+		Role string `json:"role" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&roleRequest); err != nil {
+		badRequest(c, err.Error())
+		return
+	}
+
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	message, err := cc.chatUsecase.SetMemberRole(c.Request.Context(), userID, chatID, memberID, roleRequest.Role)
+	if err != nil {
+		httperr.Respond(c, err)
+		return
+	}
+
+	if message != nil {
+		cc.hub.BroadcastToChat(chatID.Hex(), websocket.EventMessageCreated, message)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"user_id": memberID, "role": roleRequest.Role})
+}
+
+// membershipEnded broadcasts the system message, if the group still exists, and then stops
+// the former member's connections from following the group
+func (cc *ChatController) membershipEnded(chatID, memberID primitive.ObjectID, message *domain.Message) {
+	if message != nil {
+		cc.hub.BroadcastToChat(chatID.Hex(), websocket.EventMessageCreated, message)
+	}
+	cc.hub.UnsubscribeUser(memberID.Hex(), chatID.Hex())
+}
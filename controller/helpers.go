@@ -0,0 +1,42 @@
+package controller
+
+import (
+	"Real-Time-Chat-Application/domain"
+	"Real-Time-Chat-Application/httperr"
+	"Real-Time-Chat-Application/middleware"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// currentUserID returns the authenticated caller, responding with 401 when there is none
+func currentUserID(c *gin.Context) (primitive.ObjectID, bool) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		httperr.Respond(c, domain.NewError(domain.ErrUnauthorized, "Unauthorized"))
+		return primitive.NilObjectID, false
+	}
+	return userID, true
+}
+
+// currentSessionID returns the session of the authenticated caller, or the nil ID when the
+// middleware did not set one
+func currentSessionID(c *gin.Context) primitive.ObjectID {
+	sessionID, _ := middleware.GetSessionID(c)
+	return sessionID
+}
+
+// deviceInfo describes the device a request comes from, with the name the client gave it
+func deviceInfo(c *gin.Context, name string) domain.DeviceInfo {
+	return domain.DeviceInfo{Name: name, IP: c.ClientIP(), UserAgent: c.Request.UserAgent()}
+}
+
+// badRequest responds with 400 for a request the controller itself could not make sense of
+func badRequest(c *gin.Context, message string) {
+	httperr.Respond(c, domain.NewError(domain.ErrValidation, message))
+}
+
+// forbidden responds with 403 for a request the controller itself refuses
+func forbidden(c *gin.Context, message string) {
+	httperr.Respond(c, domain.NewError(domain.ErrForbidden, message))
+}
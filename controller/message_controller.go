@@ -2,8 +2,10 @@ package controller
 
 import (
 	"Real-Time-Chat-Application/domain"
+	"Real-Time-Chat-Application/httperr"
 	"Real-Time-Chat-Application/websocket"
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -21,78 +23,140 @@ func NewMessageController(messageUsecase domain.MessageUsecase, hub *websocket.H
 	}
 }
 
-// HandleWebSocket handles websocket connections for real-time messaging
+// HandleWebSocket handles websocket connections for real-time messaging.
+// The connection is bound to the user authenticated by the websocket auth middleware.
 func (mc *MessageController) HandleWebSocket(c *gin.Context) {
-	websocket.HandleWebSocket(c, mc.hub)
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var sessionID string
+	if id := currentSessionID(c); !id.IsZero() {
+		sessionID = id.Hex()
+	}
+
+	websocket.HandleWebSocket(c, mc.hub, userID.Hex(), sessionID)
 }
 
 // SendMessage handles sending a new message
 func (mc *MessageController) SendMessage(c *gin.Context) {
 	var message domain.Message
 	if err := c.ShouldBindJSON(&message); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		badRequest(c, err.Error())
 		return
 	}
 
 	chatID, err := primitive.ObjectIDFromHex(c.Param("chat_id"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid chat ID"})
+		badRequest(c, "Invalid chat ID")
 		return
 	}
 
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	// The sender is always the authenticated caller, whatever the body claims
+	message.SenderID = userID
+
 	err = mc.messageUsecase.SendMessage(c.Request.Context(), chatID, &message)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		httperr.Respond(c, err)
 		return
 	}
 
 	// Broadcast the message through websocket
-	broadcastMsg := struct {
-		ChatID  string         `json:"chat_id"`
-		Message domain.Message `json:"message"`
-	}{
-		ChatID:  chatID.Hex(),
-		Message: message,
-	}
-	mc.hub.BroadcastToChat(chatID.Hex(), []byte(broadcastMsg.Message.Content))
+	mc.hub.BroadcastToChat(chatID.Hex(), websocket.EventMessageCreated, message)
 
 	c.JSON(http.StatusOK, message)
 }
 
-// GetMessages retrieves all messages for a chat
+// GetMessages retrieves the messages of a chat.
+// Without query parameters the whole history is returned. With ?before=<cursor>, ?after=<cursor>
+// or ?limit=<n> a single page is returned instead; a cursor is a message ID or an RFC 3339 timestamp.
 func (mc *MessageController) GetMessages(c *gin.Context) {
 	chatID, err := primitive.ObjectIDFromHex(c.Param("chat_id"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid chat ID"})
+		badRequest(c, "Invalid chat ID")
 		return
 	}
 
-	messages, err := mc.messageUsecase.GetMessages(c.Request.Context(), chatID)
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	before, hasBefore := c.GetQuery("before")
+	after, hasAfter := c.GetQuery("after")
+	limitParam, hasLimit := c.GetQuery("limit")
+
+	if !hasBefore && !hasAfter && !hasLimit {
+		messages, err := mc.messageUsecase.GetMessages(c.Request.Context(), userID, chatID)
+		if err != nil {
+			httperr.Respond(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, messages)
+		return
+	}
+
+	if hasBefore && hasAfter {
+		badRequest(c, "Only one of before and after can be given")
+		return
+	}
+	if hasAfter && after == "" {
+		badRequest(c, "Invalid cursor")
+		return
+	}
+
+	limit := 0
+	if hasLimit {
+		limit, err = strconv.Atoi(limitParam)
+		if err != nil || limit <= 0 {
+			badRequest(c, "Invalid limit")
+			return
+		}
+	}
+
+	var page domain.MessagePage
+	if hasAfter {
+		page, err = mc.messageUsecase.GetMessagesAfter(c.Request.Context(), userID, chatID, after, limit)
+	} else {
+		page, err = mc.messageUsecase.GetMessagesBefore(c.Request.Context(), userID, chatID, before, limit)
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		httperr.Respond(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, messages)
+	c.JSON(http.StatusOK, page)
 }
 
 // GetMessage retrieves a specific message
 func (mc *MessageController) GetMessage(c *gin.Context) {
 	chatID, err := primitive.ObjectIDFromHex(c.Param("chat_id"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid chat ID"})
+		badRequest(c, "Invalid chat ID")
 		return
 	}
 
 	messageID, err := primitive.ObjectIDFromHex(c.Param("message_id"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid message ID"})
+		badRequest(c, "Invalid message ID")
+		return
+	}
+
+	userID, ok := currentUserID(c)
+	if !ok {
 		return
 	}
 
-	message, err := mc.messageUsecase.GetMessage(c.Request.Context(), chatID, messageID)
+	message, err := mc.messageUsecase.GetMessage(c.Request.Context(), userID, chatID, messageID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		httperr.Respond(c, err)
 		return
 	}
 
@@ -103,22 +167,30 @@ func (mc *MessageController) GetMessage(c *gin.Context) {
 func (mc *MessageController) DeleteMessage(c *gin.Context) {
 	chatID, err := primitive.ObjectIDFromHex(c.Param("chat_id"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid chat ID"})
+		badRequest(c, "Invalid chat ID")
 		return
 	}
 
 	messageID, err := primitive.ObjectIDFromHex(c.Param("message_id"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid message ID"})
+		badRequest(c, "Invalid message ID")
 		return
 	}
 
-	err = mc.messageUsecase.DeleteMessage(c.Request.Context(), chatID, messageID)
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	err = mc.messageUsecase.DeleteMessage(c.Request.Context(), userID, chatID, messageID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		httperr.Respond(c, err)
 		return
 	}
 
+	// Let open clients drop the message
+	mc.hub.BroadcastToChat(chatID.Hex(), websocket.EventMessageDeleted, websocket.MessageDeletedPayload{MessageID: messageID.Hex()})
+
 	c.JSON(http.StatusOK, gin.H{"message": "Message deleted successfully"})
 }
 
@@ -126,13 +198,13 @@ func (mc *MessageController) DeleteMessage(c *gin.Context) {
 func (mc *MessageController) UpdateMessage(c *gin.Context) {
 	chatID, err := primitive.ObjectIDFromHex(c.Param("chat_id"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid chat ID"})
+		badRequest(c, "Invalid chat ID")
 		return
 	}
 
 	messageID, err := primitive.ObjectIDFromHex(c.Param("message_id"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid message ID"})
+		badRequest(c, "Invalid message ID")
 		return
 	}
 
@@ -140,15 +212,23 @@ func (mc *MessageController) UpdateMessage(c *gin.Context) {
 		Content string `json:"content"`
 	}
 	if err := c.ShouldBindJSON(&updateReq); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		badRequest(c, err.Error())
 		return
 	}
 
-	err = mc.messageUsecase.UpdateMessage(c.Request.Context(), chatID, messageID, updateReq.Content)
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	message, err := mc.messageUsecase.UpdateMessage(c.Request.Context(), userID, chatID, messageID, updateReq.Content)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		httperr.Respond(c, err)
 		return
 	}
 
+	// Let open clients patch their copy of the message
+	mc.hub.BroadcastToChat(chatID.Hex(), websocket.EventMessageUpdated, message)
+
 	c.JSON(http.StatusOK, gin.H{"message": "Message updated successfully"})
 }
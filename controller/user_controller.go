@@ -2,7 +2,10 @@ package controller
 
 import (
 	"Real-Time-Chat-Application/domain"
+	"Real-Time-Chat-Application/httperr"
+	"Real-Time-Chat-Application/websocket"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -12,25 +15,39 @@ import (
 
 type UserController struct {
 	UserUsecase domain.UserUsecase
+	AuthUsecase domain.AuthUsecase
+	hub         *websocket.Hub
 }
 
-func NewUserController(us domain.UserUsecase) *UserController {
+func NewUserController(us domain.UserUsecase, as domain.AuthUsecase, hub *websocket.Hub) *UserController {
 	return &UserController{
 		UserUsecase: us,
+		AuthUsecase: as,
+		hub:         hub,
 	}
 }
 
+// CreateUser signs a user up. The password is only accepted here, it is never part of a response.
 func (c *UserController) CreateUser(context *gin.Context) {
-	var user domain.User
-	if err := context.ShouldBindJSON(&user); err != nil {
-		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	var request struct {
+		Email    string `json:"email"`
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+	if err := context.ShouldBindJSON(&request); err != nil {
+		badRequest(context, err.Error())
 		return
 	}
+	user := domain.User{
+		Email:    request.Email,
+		Username: request.Username,
+		Password: request.Password,
+	}
 	user.CreatedAt = time.Now()
 	user.UpdatedAt = time.Now()
 	userID, err := c.UserUsecase.CreateUser(context.Request.Context(), &user)
 	if err != nil {
-		context.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		httperr.Respond(context, err)
 		return
 	}
 	
@@ -43,13 +60,13 @@ func (c *UserController) GetUserByID(context *gin.Context) {
 
 	userID, err := primitive.ObjectIDFromHex(params)
 	if err != nil {
-		context.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		badRequest(context, "Invalid user ID")
 		return
 	}
 
 	user, err := c.UserUsecase.GetUserByID(context.Request.Context(), userID)
 	if err != nil {
-		context.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		httperr.Respond(context, err)
 		return
 	}
 
@@ -60,7 +77,7 @@ func (c *UserController) GetUserByEmail(context *gin.Context) {
 
 	user, err := c.UserUsecase.GetUserByEmail(context.Request.Context(), email)
 	if err != nil {
-		context.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		httperr.Respond(context, err)
 		return
 	}
 
@@ -72,25 +89,34 @@ func (c *UserController) GetUserByUsername(context *gin.Context) {
 
 	user, err := c.UserUsecase.GetUserByUsername(context.Request.Context(), username)
 	if err != nil {
-		context.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		httperr.Respond(context, err)
 		return
 	}
 
 	context.JSON(http.StatusOK, user)
 }
 
-
+// UpdateUser updates the caller's account
 func (c *UserController) UpdateUser(context *gin.Context) {
 	params := context.Param("id")
 	userID, err := primitive.ObjectIDFromHex(params)
 	if err != nil {
-		context.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		badRequest(context, "Invalid user ID")
+		return
+	}
+
+	callerID, ok := currentUserID(context)
+	if !ok {
+		return
+	}
+	if callerID != userID {
+		forbidden(context, "Cannot update another user")
 		return
 	}
 
 	var user domain.User
 	if err := context.ShouldBindJSON(&user); err != nil {
-		context.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		badRequest(context, "Invalid request body")
 		return
 	}
 
@@ -99,26 +125,385 @@ func (c *UserController) UpdateUser(context *gin.Context) {
 
 	err = c.UserUsecase.UpdateUser(context.Request.Context(), userID, &user)
 	if err != nil {
-		context.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		httperr.Respond(context, err)
 		return
 	}
 
 	context.JSON(http.StatusOK, gin.H{"message": "User updated successfully"})
 }
 
+// DeleteUser deletes the caller's account and signs it out everywhere
 func (c *UserController) DeleteUser(context *gin.Context) {
 	params := context.Param("id")
 	userID, err := primitive.ObjectIDFromHex(params)
 	if err != nil {
-		context.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		badRequest(context, "Invalid user ID")
+		return
+	}
+
+	callerID, ok := currentUserID(context)
+	if !ok {
+		return
+	}
+	if callerID != userID {
+		forbidden(context, "Cannot delete another user")
 		return
 	}
 
 	err = c.UserUsecase.DeleteUser(context.Request.Context(), userID)
 	if err != nil {
-		context.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		httperr.Respond(context, err)
+		return
+	}
+
+	// The account is gone, so its tokens and open connections must stop working too
+	if err := c.AuthUsecase.RevokeAllSessions(context.Request.Context(), userID); err != nil {
+		httperr.Respond(context, err)
 		return
 	}
+	c.hub.DisconnectUser(userID.Hex())
 
 	context.JSON(http.StatusOK, gin.H{"message": "User deleted successfully"})
 }
+
+// ChangePassword replaces the caller's password, given the current one, and signs the caller's
+// other devices out
+func (c *UserController) ChangePassword(context *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(context.Param("id"))
+	if err != nil {
+		badRequest(context, "Invalid user ID")
+		return
+	}
+
+	callerID, ok := currentUserID(context)
+	if !ok {
+		return
+	}
+	if callerID != userID {
+		forbidden(context, "Cannot change the password of another user")
+		return
+	}
+
+	var request struct {
+		CurrentPassword string `json:"current_password"`
+		NewPassword     string `json:"new_password"`
+	}
+	if err := context.ShouldBindJSON(&request); err != nil {
+		badRequest(context, "Invalid request body")
+		return
+	}
+
+	sessionID := currentSessionID(context)
+	err = c.UserUsecase.ChangePassword(context.Request.Context(), userID, sessionID, request.CurrentPassword, request.NewPassword)
+	if err != nil {
+		httperr.Respond(context, err)
+		return
+	}
+	c.hub.DisconnectOtherSessions(userID.Hex(), sessionID.Hex())
+
+	context.JSON(http.StatusOK, gin.H{"message": "Password changed successfully"})
+}
+
+// ForgotPassword mails a password reset token. It answers 202 whether or not the email has an
+// account, so the endpoint cannot be used to find out who is registered.
+func (c *UserController) ForgotPassword(context *gin.Context) {
+	var request struct {
+		Email string `json:"email" binding:"required"`
+	}
+	if err := context.ShouldBindJSON(&request); err != nil {
+		badRequest(context, err.Error())
+		return
+	}
+
+	if err := c.AuthUsecase.RequestPasswordReset(context.Request.Context(), request.Email); err != nil {
+		httperr.Respond(context, err)
+		return
+	}
+
+	context.JSON(http.StatusAccepted, gin.H{"message": "If the email has an account, a reset token was sent to it"})
+}
+
+// ResetPassword sets a new password given a token from ForgotPassword
+func (c *UserController) ResetPassword(context *gin.Context) {
+	var request struct {
+		Token       string `json:"token"`
+		NewPassword string `json:"new_password"`
+	}
+	if err := context.ShouldBindJSON(&request); err != nil {
+		badRequest(context, "Invalid request body")
+		return
+	}
+
+	userID, err := c.AuthUsecase.ResetPassword(context.Request.Context(), request.Token, request.NewPassword)
+	if err != nil {
+		httperr.Respond(context, err)
+		return
+	}
+	c.hub.DisconnectUser(userID.Hex())
+
+	context.JSON(http.StatusOK, gin.H{"message": "Password reset successfully"})
+}
+
+// VerifyEmail confirms the email of a user with the token mailed to them
+func (c *UserController) VerifyEmail(context *gin.Context) {
+	var request struct {
+		Token string `json:"token"`
+	}
+	if err := context.ShouldBindJSON(&request); err != nil {
+		badRequest(context, "Invalid request body")
+		return
+	}
+
+	if err := c.UserUsecase.VerifyEmail(context.Request.Context(), request.Token); err != nil {
+		httperr.Respond(context, err)
+		return
+	}
+
+	context.JSON(http.StatusOK, gin.H{"message": "Email verified successfully"})
+}
+
+// ResendVerification mails the caller a new verification token
+func (c *UserController) ResendVerification(context *gin.Context) {
+	userID, ok := currentUserID(context)
+	if !ok {
+		return
+	}
+
+	if err := c.UserUsecase.ResendVerification(context.Request.Context(), userID); err != nil {
+		httperr.Respond(context, err)
+		return
+	}
+
+	context.JSON(http.StatusAccepted, gin.H{"message": "Verification mail sent"})
+}
+
+// Login authenticates a user by email and password and returns an access/refresh token pair.
+// The optional device_name labels the session in the caller's list of sessions. Users with
+// two-factor authentication get a challenge token for LoginTwoFactor instead of the tokens.
+func (c *UserController) Login(context *gin.Context) {
+	var credentials struct {
+		Email      string `json:"email" binding:"required"`
+		Password   string `json:"password" binding:"required"`
+		DeviceName string `json:"device_name"`
+	}
+	if err := context.ShouldBindJSON(&credentials); err != nil {
+		badRequest(context, err.Error())
+		return
+	}
+
+	result, err := c.AuthUsecase.Login(context.Request.Context(), credentials.Email, credentials.Password, deviceInfo(context, credentials.DeviceName))
+	if err != nil {
+		httperr.Respond(context, err)
+		return
+	}
+
+	if result.Challenge != "" {
+		context.JSON(http.StatusOK, gin.H{"two_factor_required": true, "challenge_token": result.Challenge})
+		return
+	}
+	context.JSON(http.StatusOK, result.Tokens)
+}
+
+// LoginTwoFactor completes the login of a user with two-factor authentication, given the
+// challenge token of Login and a TOTP or recovery code
+func (c *UserController) LoginTwoFactor(context *gin.Context) {
+	var request struct {
+		ChallengeToken string `json:"challenge_token"`
+		Code           string `json:"code"`
+		DeviceName     string `json:"device_name"`
+	}
+	if err := context.ShouldBindJSON(&request); err != nil {
+		badRequest(context, "Invalid request body")
+		return
+	}
+
+	tokens, err := c.AuthUsecase.LoginTwoFactor(context.Request.Context(), request.ChallengeToken, request.Code, deviceInfo(context, request.DeviceName))
+	if err != nil {
+		httperr.Respond(context, err)
+		return
+	}
+
+	context.JSON(http.StatusOK, tokens)
+}
+
+// SetupTwoFactor starts the caller's two-factor setup and returns the secret to add to an authenticator app
+func (c *UserController) SetupTwoFactor(context *gin.Context) {
+	userID, ok := currentUserID(context)
+	if !ok {
+		return
+	}
+
+	setup, err := c.AuthUsecase.SetupTwoFactor(context.Request.Context(), userID)
+	if err != nil {
+		httperr.Respond(context, err)
+		return
+	}
+
+	context.JSON(http.StatusOK, setup)
+}
+
+// ConfirmTwoFactor enables the caller's two-factor authentication and returns their recovery codes
+func (c *UserController) ConfirmTwoFactor(context *gin.Context) {
+	userID, ok := currentUserID(context)
+	if !ok {
+		return
+	}
+	var request struct {
+		Code string `json:"code"`
+	}
+	if err := context.ShouldBindJSON(&request); err != nil {
+		badRequest(context, "Invalid request body")
+		return
+	}
+
+	codes, err := c.AuthUsecase.ConfirmTwoFactor(context.Request.Context(), userID, request.Code)
+	if err != nil {
+		httperr.Respond(context, err)
+		return
+	}
+
+	context.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+// DisableTwoFactor turns the caller's two-factor authentication off, given a TOTP or recovery code
+func (c *UserController) DisableTwoFactor(context *gin.Context) {
+	userID, ok := currentUserID(context)
+	if !ok {
+		return
+	}
+	var request struct {
+		Code string `json:"code"`
+	}
+	if err := context.ShouldBindJSON(&request); err != nil {
+		badRequest(context, "Invalid request body")
+		return
+	}
+
+	if err := c.AuthUsecase.DisableTwoFactor(context.Request.Context(), userID, request.Code); err != nil {
+		httperr.Respond(context, err)
+		return
+	}
+
+	context.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+}
+
+// GetTwoFactorStatus returns whether a user has two-factor authentication on, to the user or an admin
+func (c *UserController) GetTwoFactorStatus(context *gin.Context) {
+	callerID, ok := currentUserID(context)
+	if !ok {
+		return
+	}
+	userID, err := primitive.ObjectIDFromHex(context.Param("id"))
+	if err != nil {
+		badRequest(context, "Invalid user ID")
+		return
+	}
+
+	status, err := c.AuthUsecase.TwoFactorStatus(context.Request.Context(), callerID, userID)
+	if err != nil {
+		httperr.Respond(context, err)
+		return
+	}
+
+	context.JSON(http.StatusOK, status)
+}
+
+// RefreshToken exchanges a refresh token for a new token pair
+func (c *UserController) RefreshToken(context *gin.Context) {
+	var request struct {
+		RefreshToken string `json:"refresh_token" binding:"required"`
+	}
+	if err := context.ShouldBindJSON(&request); err != nil {
+		badRequest(context, err.Error())
+		return
+	}
+
+	tokens, err := c.AuthUsecase.RefreshToken(context.Request.Context(), request.RefreshToken, deviceInfo(context, ""))
+	if err != nil {
+		httperr.Respond(context, err)
+		return
+	}
+
+	context.JSON(http.StatusOK, tokens)
+}
+
+// ListSessions returns the devices the caller is signed in on
+func (c *UserController) ListSessions(context *gin.Context) {
+	userID, ok := currentUserID(context)
+	if !ok {
+		return
+	}
+
+	sessions, err := c.AuthUsecase.ListSessions(context.Request.Context(), userID, currentSessionID(context))
+	if err != nil {
+		httperr.Respond(context, err)
+		return
+	}
+
+	context.JSON(http.StatusOK, sessions)
+}
+
+// RevokeSession signs one of the caller's devices out and closes its websocket connections
+func (c *UserController) RevokeSession(context *gin.Context) {
+	userID, ok := currentUserID(context)
+	if !ok {
+		return
+	}
+	sessionID, err := primitive.ObjectIDFromHex(context.Param("session_id"))
+	if err != nil {
+		badRequest(context, "Invalid session ID")
+		return
+	}
+
+	if err := c.AuthUsecase.RevokeSession(context.Request.Context(), userID, sessionID); err != nil {
+		httperr.Respond(context, err)
+		return
+	}
+	c.hub.DisconnectSession(sessionID.Hex())
+
+	context.JSON(http.StatusOK, gin.H{"message": "Session revoked successfully"})
+}
+
+// RevokeAllSessions signs the caller out everywhere, this device included, and closes all their
+// websocket connections
+func (c *UserController) RevokeAllSessions(context *gin.Context) {
+	userID, ok := currentUserID(context)
+	if !ok {
+		return
+	}
+
+	if err := c.AuthUsecase.RevokeAllSessions(context.Request.Context(), userID); err != nil {
+		httperr.Respond(context, err)
+		return
+	}
+	c.hub.DisconnectUser(userID.Hex())
+
+	context.JSON(http.StatusOK, gin.H{"message": "Signed out of every session"})
+}
+
+// GetPresence returns the presence of the users listed in the comma separated ids query parameter
+func (c *UserController) GetPresence(context *gin.Context) {
+	ids := strings.Split(context.Query("ids"), ",")
+	if context.Query("ids") == "" || len(ids) > domain.MaxPresenceQuery {
+		badRequest(context, "Between 1 and 100 user IDs are required")
+		return
+	}
+
+	userIDs := make([]primitive.ObjectID, 0, len(ids))
+	for _, id := range ids {
+		userID, err := primitive.ObjectIDFromHex(strings.TrimSpace(id))
+		if err != nil {
+			badRequest(context, "Invalid user ID")
+			return
+		}
+		userIDs = append(userIDs, userID)
+	}
+
+	presence, err := c.hub.Presence(context.Request.Context(), userIDs)
+	if err != nil {
+		httperr.Respond(context, err)
+		return
+	}
+
+	context.JSON(http.StatusOK, presence)
+}
@@ -0,0 +1,89 @@
+package domain
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	// ErrInvalidCredentials is returned when the email or password does not match
+	ErrInvalidCredentials = NewError(ErrUnauthorized, "invalid email or password")
+	// ErrInvalidToken is returned when a token is malformed, expired or of the wrong type
+	ErrInvalidToken = NewError(ErrUnauthorized, "invalid or expired token")
+)
+
+// TokenType distinguishes short-lived access tokens from refresh tokens.
+type TokenType string
+
+const (
+	AccessToken  TokenType = "access"
+	RefreshToken TokenType = "refresh"
+)
+
+// TokenPair is returned to the client after a successful login or refresh.
+type TokenPair struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"` // lifetime of the access token in seconds
+
+	RefreshExpiresAt time.Time `json:"-"` // when the refresh token expires
+}
+
+// TokenClaims is the identity carried by a validated token.
+type TokenClaims struct {
+	UserID    primitive.ObjectID
+	SessionID primitive.ObjectID // the Session the token was issued for
+	Type      TokenType
+	ExpiresAt time.Time
+}
+
+type TokenService interface {
+	GenerateTokens(userID, sessionID primitive.ObjectID) (*TokenPair, error)
+	ValidateToken(token string, tokenType TokenType) (*TokenClaims, error)
+}
+
+// PasswordHasher hashes passwords and checks them against stored hashes
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	// Compare reports whether password matches hash
+	Compare(hash, password string) bool
+	// NeedsRehash reports whether hash was made with weaker settings than the current ones
+	NeedsRehash(hash string) bool
+}
+
+// AuthUsecase signs users in and manages their sessions. Each login starts a Session for the
+// device, which a refresh keeps going and a revocation ends.
+type AuthUsecase interface {
+	SessionChecker
+	// Login upgrades the stored hash of the password when the hasher's settings became stronger.
+	// For users with two-factor authentication it returns a challenge instead of tokens.
+	Login(ctx context.Context, email string, password string, device DeviceInfo) (*LoginResult, error)
+	// LoginTwoFactor answers the challenge of Login with a TOTP or recovery code, and starts the session
+	LoginTwoFactor(ctx context.Context, challenge, code string, device DeviceInfo) (*TokenPair, error)
+	// RefreshToken only accepts the latest refresh token of a session, and records the device's activity
+	RefreshToken(ctx context.Context, refreshToken string, device DeviceInfo) (*TokenPair, error)
+	// ListSessions returns the user's sessions, most recently active first, marking currentSessionID as current
+	ListSessions(ctx context.Context, userID, currentSessionID primitive.ObjectID) ([]Session, error)
+	// RevokeSession signs one of the user's devices out
+	RevokeSession(ctx context.Context, userID, sessionID primitive.ObjectID) error
+	// RevokeAllSessions signs the user out everywhere, including the caller's own session
+	RevokeAllSessions(ctx context.Context, userID primitive.ObjectID) error
+	// RequestPasswordReset mails a password reset token to the user with the email, at most once
+	// per PasswordResetCooldown. Unknown emails and requests within the cooldown are ignored
+	// without an error, so callers cannot find out who has an account.
+	RequestPasswordReset(ctx context.Context, email string) error
+	// ResetPassword sets a new password for the user a reset token was issued to, using up the
+	// token, and signs the user out everywhere. It returns the user.
+	ResetPassword(ctx context.Context, token, newPassword string) (primitive.ObjectID, error)
+	// SetupTwoFactor generates a TOTP secret for the user, which ConfirmTwoFactor enables
+	SetupTwoFactor(ctx context.Context, userID primitive.ObjectID) (*TwoFactorSetup, error)
+	// ConfirmTwoFactor enables two-factor authentication given a code of the new secret, and
+	// returns the recovery codes, which are never shown again
+	ConfirmTwoFactor(ctx context.Context, userID primitive.ObjectID, code string) ([]string, error)
+	// DisableTwoFactor turns two-factor authentication off given a TOTP or recovery code
+	DisableTwoFactor(ctx context.Context, userID primitive.ObjectID, code string) error
+	// TwoFactorStatus returns the two-factor state of a user to the user themselves or an admin
+	TwoFactorStatus(ctx context.Context, callerID, userID primitive.ObjectID) (*TwoFactorStatus, error)
+}
@@ -2,34 +2,186 @@ package domain
 
 import (
 	"context"
+	"sort"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
-// Chat represents a chat between two users.
+// Chat types. Chats stored before groups existed have no type and are direct chats.
+const (
+	ChatTypeDirect = "direct"
+	ChatTypeGroup  = "group"
+)
+
+// MaxGroupSize is the largest number of participants of a group chat
+const MaxGroupSize = 256
+
+// ErrInvalidMembers is returned when removing or changing the role of a user who is not a member of the group
+var ErrInvalidMembers = NewError(ErrValidation, "invalid members")
+
+// ErrChatNotFound is returned when a chat does not exist
+var ErrChatNotFound = NewError(ErrNotFound, "chat not found")
+
+// ErrChatExists is returned when storing a direct chat between two users who already have one
+var ErrChatExists = NewError(ErrConflict, "chat already exists")
+
+// ErrNotGroup is returned when changing the members of a direct chat, which always has the same two participants
+var ErrNotGroup = NewError(ErrValidation, "not a group chat")
+
+// Chat represents a chat: either a direct chat between two users or a group chat.
 type Chat struct {
 	ChatID     primitive.ObjectID `json:"chat_id" bson:"_id,omitempty"`
-	Participants []primitive.ObjectID `json:"participants" bson:"participants"` // [SenderID, ReceiverID]
-	Messages   []Message          `json:"messages" bson:"messages"`
+	Type       string             `json:"type" bson:"type,omitempty"`
+	Participants []primitive.ObjectID `json:"participants" bson:"participants"` // [SenderID, ReceiverID] for direct chats
+	Title      string             `json:"title,omitempty" bson:"title,omitempty"`   // groups only
+	Avatar     string             `json:"avatar,omitempty" bson:"avatar,omitempty"` // URL of the group picture
+	CreatedBy  primitive.ObjectID `json:"created_by,omitempty" bson:"created_by,omitempty"`
+	DirectKey  string             `json:"-" bson:"direct_key,omitempty"` // DirectChatKey of the participants of a direct chat, unique
+	Roles      map[string]string  `json:"roles,omitempty" bson:"roles,omitempty"` // keyed by user ID, members without one are plain members
+	AnnouncementOnly bool         `json:"announcement_only,omitempty" bson:"announcement_only,omitempty"` // only managers may post
 	CreatedAt  time.Time          `json:"created_at" bson:"created_at"`
 	UpdatedAt  time.Time          `json:"updated_at" bson:"updated_at"`
+	ReadMarkers map[string]ReadMarker `json:"read_markers,omitempty" bson:"read_markers,omitempty"` // keyed by user ID
+	LastMessage *MessagePreview   `json:"last_message,omitempty" bson:"last_message,omitempty"`
+}
+
+// MessagePreviewLength is the number of characters of a message kept in a chat's preview
+const MessagePreviewLength = 100
+
+// MessagePreview is a short copy of the latest message of a chat, kept on the chat document
+// so the chat list does not have to read the history.
+type MessagePreview struct {
+	MessageID primitive.ObjectID `json:"message_id" bson:"message_id"`
+	SenderID  primitive.ObjectID `json:"sender_id" bson:"sender_id"`
+	Content   string             `json:"content" bson:"content"`
+	Time      time.Time          `json:"time" bson:"time"`
+}
+
+// NewMessagePreview shortens a message to a preview
+func NewMessagePreview(message Message) MessagePreview {
+	return MessagePreview{
+		MessageID: message.MessageID,
+		SenderID:  message.SenderID,
+		Content:   PreviewContent(message.Content),
+		Time:      message.Time,
+	}
+}
+
+// PreviewContent cuts content down to MessagePreviewLength characters
+func PreviewContent(content string) string {
+	runes := []rune(content)
+	if len(runes) <= MessagePreviewLength {
+		return content
+	}
+	return string(runes[:MessagePreviewLength])
+}
+
+// ChatSummary is an entry of a user's chat list
+type ChatSummary struct {
+	ChatID       primitive.ObjectID   `json:"chat_id"`
+	Type         string               `json:"type"`
+	Title        string               `json:"title,omitempty"`
+	Avatar       string               `json:"avatar,omitempty"`
+	Participants []primitive.ObjectID `json:"participants"` // everyone but the user
+	LastMessage  *MessagePreview      `json:"last_message,omitempty"`
+	LastActivity time.Time            `json:"last_activity"`
+	UnreadCount  int64                `json:"unread_count"`
+}
+
+// ChatSettings are the properties of a group its managers can change. An update only changes
+// the fields that are set.
+type ChatSettings struct {
+	Title            *string `json:"title,omitempty"`
+	Avatar           *string `json:"avatar,omitempty"`
+	AnnouncementOnly *bool   `json:"announcement_only,omitempty"`
+}
+
+// ReadMarker is how far a participant has read a chat: up to and including MessageID.
+// MessageTime is the time of that message, used to only ever move the marker forward.
+type ReadMarker struct {
+	MessageID   primitive.ObjectID `json:"message_id" bson:"message_id"`
+	MessageTime time.Time          `json:"message_time" bson:"message_time"`
+	ReadAt      time.Time          `json:"read_at" bson:"read_at"`
+}
+
+// DirectChatKey identifies the direct chat between two users whatever their order
+func DirectChatKey(a, b primitive.ObjectID) string {
+	ids := []string{a.Hex(), b.Hex()}
+	sort.Strings(ids)
+	return ids[0] + ":" + ids[1]
+}
+
+// IsGroup reports whether the chat is a group chat
+func (chat *Chat) IsGroup() bool {
+	return chat.Type == ChatTypeGroup
+}
+
+// HasParticipant reports whether userID is one of the chat's participants.
+func (chat *Chat) HasParticipant(userID primitive.ObjectID) bool {
+	for _, participant := range chat.Participants {
+		if participant == userID {
+			return true
+		}
+	}
+	return false
 }
 
 type ChatRepository interface {
+	// CreateChat stores a direct chat, or returns ErrChatExists if the two users already have one
 	CreateChat(ctx context.Context, SenderID primitive.ObjectID, ReceiverID primitive.ObjectID) (primitive.ObjectID, error)
 	GetChat(ctx context.Context, chatID primitive.ObjectID) (*Chat, error)
 	GetChatsByUserID(ctx context.Context, userID primitive.ObjectID) ([]Chat, error)
+	// CreateGroupChat stores a new group chat as given
+	CreateGroupChat(ctx context.Context, chat *Chat) (primitive.ObjectID, error)
+	// GetChatByParticipants returns the direct chat between two users, never a group
 	GetChatByParticipants(ctx context.Context, SenderID primitive.ObjectID, ReceiverID primitive.ObjectID) (*Chat, error)
 	UpdateChat(ctx context.Context, chatID primitive.ObjectID, chat *Chat) error
 	DeleteChat(ctx context.Context, chatID primitive.ObjectID) error
+	AddParticipants(ctx context.Context, chatID primitive.ObjectID, userIDs []primitive.ObjectID) error
+	// RemoveParticipant also drops the user's read marker and role
+	RemoveParticipant(ctx context.Context, chatID, userID primitive.ObjectID) error
+	UpdateChatSettings(ctx context.Context, chatID primitive.ObjectID, settings ChatSettings) error
+	// SetRoles stores the role of each given member, leaving the others unchanged
+	SetRoles(ctx context.Context, chatID primitive.ObjectID, roles map[primitive.ObjectID]string) error
+	// UpdateReadMarker moves the user's read marker to marker if it is further than the current one
+	// and reports whether it moved
+	UpdateReadMarker(ctx context.Context, chatID, userID primitive.ObjectID, marker ReadMarker) (bool, error)
+	// GetRecentChats returns the chats of a user, most recently active first
+	GetRecentChats(ctx context.Context, userID primitive.ObjectID) ([]Chat, error)
 }
 
+// ChatUsecase methods taking a userID act on behalf of that user and return ErrForbidden
+// when the user is not a participant of the chat.
+//
+// Membership and role changes of a group are recorded in its history as system messages, which
+// the methods making them return so they can be broadcast. What a member of a group may do
+// depends on their role (see RoleOwner); members of direct chats cannot change (ErrNotGroup).
 type ChatUsecase interface {
-	CreateChat(ctx context.Context, SenderID primitive.ObjectID, ReceiverID primitive.ObjectID) (primitive.ObjectID, error)
-	GetChat(ctx context.Context, chatID primitive.ObjectID) (*Chat, error)
+	// CreateChat returns the direct chat between the two users, creating it if they have none;
+	// created tells which happened. A user cannot start a chat with themselves.
+	CreateChat(ctx context.Context, SenderID primitive.ObjectID, ReceiverID primitive.ObjectID) (chatID primitive.ObjectID, created bool, err error)
+	CreateGroupChat(ctx context.Context, creatorID primitive.ObjectID, memberIDs []primitive.ObjectID, title, avatar string) (*Chat, *Message, error)
+	// AddMembers returns a nil message when every user was already a member
+	AddMembers(ctx context.Context, userID, chatID primitive.ObjectID, memberIDs []primitive.ObjectID) (*Message, error)
+	RemoveMember(ctx context.Context, userID, chatID, memberID primitive.ObjectID) (*Message, error)
+	// LeaveChat returns a nil message when the last member left, which deletes the group
+	LeaveChat(ctx context.Context, userID, chatID primitive.ObjectID) (*Message, error)
+	// SetMemberRole lets the owner change the role of another member. Giving the owner role
+	// hands the group over, and the previous owner becomes an admin. It returns a nil message
+	// when the member already had the role.
+	SetMemberRole(ctx context.Context, userID, chatID, memberID primitive.ObjectID, role string) (*Message, error)
+	GetChat(ctx context.Context, userID, chatID primitive.ObjectID) (*Chat, error)
 	GetChatsByUserID(ctx context.Context, userID primitive.ObjectID) ([]Chat, error)
 	GetChatByParticipants(ctx context.Context, SenderID primitive.ObjectID, ReceiverID primitive.ObjectID) (*Chat, error)
-	UpdateChat(ctx context.Context, chatID primitive.ObjectID, chat *Chat) error
-	DeleteChat(ctx context.Context, chatID primitive.ObjectID) error
+	// UpdateChat changes the given ChatSettings of a group, which requires a manager, and
+	// returns the updated chat
+	UpdateChat(ctx context.Context, userID, chatID primitive.ObjectID, settings ChatSettings) (*Chat, error)
+	DeleteChat(ctx context.Context, userID, chatID primitive.ObjectID) error
+	AuthorizeParticipant(ctx context.Context, userID, chatID primitive.ObjectID) error
+	// MarkRead records that the user has read the chat up to messageID. Marking an older message
+	// than the current marker leaves it in place; advanced tells whether the marker moved.
+	MarkRead(ctx context.Context, userID, chatID, messageID primitive.ObjectID) (marker ReadMarker, advanced bool, err error)
+	// ListChats returns the user's chat list, most recently active first
+	ListChats(ctx context.Context, userID primitive.ObjectID) ([]ChatSummary, error)
 }
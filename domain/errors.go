@@ -0,0 +1,41 @@
+package domain
+
+import "errors"
+
+// Kinds of errors returned by the repositories and usecases. Specific errors, such as
+// ErrChatNotFound, belong to one of these kinds and match it with errors.Is, so callers can
+// react to the kind without knowing every specific error.
+var (
+	// ErrNotFound is returned when a resource does not exist
+	ErrNotFound = errors.New("not found")
+	// ErrConflict is returned when a resource clashes with one that already exists
+	ErrConflict = errors.New("conflict")
+	// ErrForbidden is returned when the caller is authenticated but not allowed to act on a resource,
+	// e.g. reading a chat they do not participate in or editing someone else's message
+	ErrForbidden = errors.New("forbidden")
+	// ErrValidation is returned when a request is malformed or breaks a rule about its content
+	ErrValidation = errors.New("validation failed")
+	// ErrUnauthorized is returned when the caller could not be authenticated
+	ErrUnauthorized = errors.New("unauthorized")
+	// ErrRateLimited is returned when the caller repeats an action sooner than allowed
+	ErrRateLimited = errors.New("too many requests")
+)
+
+// Error is a specific error of one of the kinds above
+type Error struct {
+	Kind    error
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Kind
+}
+
+// NewError returns a specific error of the given kind
+func NewError(kind error, message string) error {
+	return &Error{Kind: kind, Message: message}
+}
@@ -0,0 +1,15 @@
+package domain
+
+import "context"
+
+// Mail is a plain text email to a single recipient
+type Mail struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer sends mails to users
+type Mailer interface {
+	Send(ctx context.Context, mail Mail) error
+}
@@ -8,26 +8,102 @@ import (
 )
 
 // Message represents a message sent by a user.
+// Messages are stored in their own collection, indexed by chat and time.
 type Message struct {
-	MessageID primitive.ObjectID `json:"message_id" bson:"message_id,omitempty"`
+	MessageID primitive.ObjectID `json:"message_id" bson:"_id,omitempty"`
+	ChatID    primitive.ObjectID `json:"chat_id" bson:"chat_id"`
 	SenderID  primitive.ObjectID `json:"sender_id" bson:"sender_id"`
 	Content   string             `json:"content" bson:"content"`
 	Time      time.Time          `json:"time" bson:"time"`
 	Edited    bool               `json:"edited" bson:"edited"`
+	System    *SystemEvent       `json:"system,omitempty" bson:"system,omitempty"` // set on system messages only
+}
+
+// Actions recorded by system messages
+const (
+	SystemChatCreated   = "chat_created"
+	SystemMembersAdded  = "members_added"
+	SystemMemberRemoved = "member_removed"
+	SystemMemberLeft    = "member_left"
+	SystemRoleChanged   = "role_changed"
+)
+
+// SystemEvent describes a change to a chat recorded in its history. The sender of a system
+// message is the user who made the change and UserIDs are the users it affected.
+// System messages cannot be edited or deleted.
+type SystemEvent struct {
+	Action  string               `json:"action" bson:"action"`
+	UserIDs []primitive.ObjectID `json:"user_ids,omitempty" bson:"user_ids,omitempty"`
+	Role    string               `json:"role,omitempty" bson:"role,omitempty"` // the new role of a role_changed event
+}
+
+// NewSystemMessage returns a system message recording an action of actorID
+func NewSystemMessage(actorID primitive.ObjectID, action string, userIDs []primitive.ObjectID, content string) Message {
+	return Message{
+		SenderID: actorID,
+		Content:  content,
+		System:   &SystemEvent{Action: action, UserIDs: userIDs},
+	}
+}
+
+// Page sizes used when paginating a chat's history
+const (
+	DefaultMessagePageSize = 50
+	MaxMessagePageSize     = 100
+)
+
+// ErrInvalidCursor is returned when a pagination cursor is neither a message of the chat nor a timestamp
+var ErrInvalidCursor = NewError(ErrValidation, "invalid cursor")
+
+// ErrMessageNotFound is returned when a message does not exist in the chat, or no longer does
+var ErrMessageNotFound = NewError(ErrNotFound, "message not found")
+
+// MessageCursor is a position in a chat's history. A cursor built from a timestamp has no MessageID;
+// one built from a message also uses its ID to order messages sent at the same time.
+type MessageCursor struct {
+	Time      time.Time
+	MessageID primitive.ObjectID
+}
+
+// MessagePage is one page of a chat's history, always in chronological order.
+// NextCursor is the message to pass as the cursor of the next page in the same direction.
+type MessagePage struct {
+	Messages   []Message `json:"messages"`
+	NextCursor string    `json:"next_cursor,omitempty"`
+	HasMore    bool      `json:"has_more"`
 }
 
 type MessageRepository interface {
 	SendMessage(ctx context.Context, chatID primitive.ObjectID, message *Message) error
 	GetMessages(ctx context.Context, chatID primitive.ObjectID) ([]Message, error)
+	// GetMessagesBefore returns up to limit messages older than the cursor, or the latest ones when it is nil
+	GetMessagesBefore(ctx context.Context, chatID primitive.ObjectID, cursor *MessageCursor, limit int) ([]Message, error)
+	// GetMessagesAfter returns up to limit messages newer than the cursor
+	GetMessagesAfter(ctx context.Context, chatID primitive.ObjectID, cursor MessageCursor, limit int) ([]Message, error)
 	GetMessage(ctx context.Context, chatID, messageID primitive.ObjectID) (Message, error) 
 	DeleteMessage(ctx context.Context, chatID, messageID primitive.ObjectID) error
 	UpdateMessage(ctx context.Context, chatID, messageID primitive.ObjectID, newContent string) error
+	DeleteMessagesByChat(ctx context.Context, chatID primitive.ObjectID) error
+	// CountUnread counts, per chat, the messages others sent after the cursor, or all of them when
+	// the cursor is nil. Chats without unread messages are left out of the result.
+	CountUnread(ctx context.Context, userID primitive.ObjectID, since map[primitive.ObjectID]*MessageCursor) (map[primitive.ObjectID]int64, error)
 }
 
+// MessageUsecase methods taking a userID act on behalf of that user. SendMessage acts on behalf
+// of message.SenderID. Non-participants get ErrForbidden, as do members whose role does not
+// allow posting, anyone but the sender trying to edit a message and anyone but the sender or
+// a group manager trying to delete one. UpdateMessage returns the message as edited.
+// Content that is blank or longer than MaxMessageLength is rejected with a ValidationError.
+//
+// The paginated variants take a cursor that is either a message ID or an RFC 3339 timestamp.
+// GetMessagesBefore with an empty cursor returns the latest page. A limit outside
+// 1..MaxMessagePageSize falls back to DefaultMessagePageSize or MaxMessagePageSize.
 type MessageUsecase interface {
 	SendMessage(ctx context.Context, chatID primitive.ObjectID, message *Message) error
-	GetMessages(ctx context.Context, chatID primitive.ObjectID) ([]Message, error)
-	GetMessage(ctx context.Context, chatID, messageID primitive.ObjectID) (Message, error) 
-	DeleteMessage(ctx context.Context, chatID, messageID primitive.ObjectID) error
-	UpdateMessage(ctx context.Context, chatID, messageID primitive.ObjectID, newContent string) error
+	GetMessages(ctx context.Context, userID, chatID primitive.ObjectID) ([]Message, error)
+	GetMessagesBefore(ctx context.Context, userID, chatID primitive.ObjectID, cursor string, limit int) (MessagePage, error)
+	GetMessagesAfter(ctx context.Context, userID, chatID primitive.ObjectID, cursor string, limit int) (MessagePage, error)
+	GetMessage(ctx context.Context, userID, chatID, messageID primitive.ObjectID) (Message, error)
+	DeleteMessage(ctx context.Context, userID, chatID, messageID primitive.ObjectID) error
+	UpdateMessage(ctx context.Context, userID, chatID, messageID primitive.ObjectID, newContent string) (Message, error)
 }
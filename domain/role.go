@@ -0,0 +1,82 @@
+package domain
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// Roles of the members of a group chat, from the most to the least privileged:
+//   - the owner manages everything, including roles; there is exactly one per group
+//   - admins rename the group, change its settings, add and remove members below them and
+//     delete other people's messages
+//   - members post messages
+//   - read-only members can only read
+//
+// Participants of direct chats are all members.
+const (
+	RoleOwner    = "owner"
+	RoleAdmin    = "admin"
+	RoleMember   = "member"
+	RoleReadOnly = "read_only"
+)
+
+// ErrInvalidRole is returned for a role that does not exist or cannot be given
+var ErrInvalidRole = NewError(ErrValidation, "invalid role")
+
+var roleRanks = map[string]int{
+	RoleReadOnly: 0,
+	RoleMember:   1,
+	RoleAdmin:    2,
+	RoleOwner:    3,
+}
+
+// ValidRole reports whether role is one of the roles above
+func ValidRole(role string) bool {
+	_, ok := roleRanks[role]
+	return ok
+}
+
+// RoleOf returns the role of a participant. Members without a stored role are plain members,
+// except for the creator of a group created before roles existed, who owns it.
+func (chat *Chat) RoleOf(userID primitive.ObjectID) string {
+	if role, ok := chat.Roles[userID.Hex()]; ok {
+		return role
+	}
+	if chat.IsGroup() && userID == chat.CreatedBy && !chat.hasOwner() {
+		return RoleOwner
+	}
+	return RoleMember
+}
+
+func (chat *Chat) hasOwner() bool {
+	for _, role := range chat.Roles {
+		if role == RoleOwner {
+			return true
+		}
+	}
+	return false
+}
+
+// IsOwner reports whether userID owns the group
+func (chat *Chat) IsOwner(userID primitive.ObjectID) bool {
+	return chat.IsGroup() && chat.RoleOf(userID) == RoleOwner
+}
+
+// CanManage reports whether userID may rename the group, change its settings, add members
+// and delete other people's messages
+func (chat *Chat) CanManage(userID primitive.ObjectID) bool {
+	return chat.IsGroup() && roleRanks[chat.RoleOf(userID)] >= roleRanks[RoleAdmin]
+}
+
+// CanRemove reports whether userID may remove memberID from the group: managers can only
+// remove members ranked below them
+func (chat *Chat) CanRemove(userID, memberID primitive.ObjectID) bool {
+	return chat.CanManage(userID) && roleRanks[chat.RoleOf(userID)] > roleRanks[chat.RoleOf(memberID)]
+}
+
+// CanPost reports whether userID may post messages. Read-only members never can and only
+// managers can post in announcement-only groups.
+func (chat *Chat) CanPost(userID primitive.ObjectID) bool {
+	role := chat.RoleOf(userID)
+	if role == RoleReadOnly {
+		return false
+	}
+	return !chat.AnnouncementOnly || chat.CanManage(userID)
+}
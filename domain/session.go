@@ -0,0 +1,63 @@
+package domain
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Longest device name a client may give, and longest user agent kept, in characters
+const (
+	MaxDeviceNameLength = 64
+	MaxUserAgentLength  = 512
+)
+
+// ErrSessionNotFound is returned when a session does not exist, or belongs to another user
+var ErrSessionNotFound = NewError(ErrNotFound, "session not found")
+
+// DeviceInfo describes the device a request comes from
+type DeviceInfo struct {
+	Name      string // chosen by the client, e.g. "Jane's phone"
+	IP        string
+	UserAgent string
+}
+
+// Session is a signed in device. Every login starts one, and its refresh token keeps it going:
+// each refresh replaces the token, so only the latest one works. Deleting the session signs
+// the device out. Only a hash of the refresh token is stored.
+type Session struct {
+	SessionID        primitive.ObjectID `json:"session_id" bson:"_id,omitempty"`
+	UserID           primitive.ObjectID `json:"-" bson:"user_id"`
+	DeviceName       string             `json:"device_name" bson:"device_name"`
+	IP               string             `json:"ip" bson:"ip"`
+	UserAgent        string             `json:"user_agent" bson:"user_agent"`
+	RefreshTokenHash string             `json:"-" bson:"refresh_token_hash"`
+	CreatedAt        time.Time          `json:"created_at" bson:"created_at"`
+	LastActiveAt     time.Time          `json:"last_active_at" bson:"last_active_at"` // last login or refresh
+	ExpiresAt        time.Time          `json:"expires_at" bson:"expires_at"`         // when the refresh token expires
+	Current          bool               `json:"current" bson:"-"`                     // whether the caller uses this session
+}
+
+type SessionRepository interface {
+	CreateSession(ctx context.Context, session *Session) error
+	GetSession(ctx context.Context, sessionID primitive.ObjectID) (*Session, error)
+	// GetSessionsByUserID returns the sessions of a user, most recently active first
+	GetSessionsByUserID(ctx context.Context, userID primitive.ObjectID) ([]Session, error)
+	// RotateSession replaces the refresh token hash of a session and records the activity, as
+	// long as the session still holds refreshTokenHash. Otherwise it returns ErrSessionNotFound,
+	// so of two refreshes with the same token only one succeeds.
+	RotateSession(ctx context.Context, sessionID primitive.ObjectID, refreshTokenHash string, update *Session) error
+	// DeleteSession deletes a session of the user, or returns ErrSessionNotFound
+	DeleteSession(ctx context.Context, userID, sessionID primitive.ObjectID) error
+	// DeleteSessions deletes every session of the user
+	DeleteSessions(ctx context.Context, userID primitive.ObjectID) error
+	// DeleteOtherSessions deletes every session of the user but sessionID
+	DeleteOtherSessions(ctx context.Context, userID, sessionID primitive.ObjectID) error
+}
+
+// SessionChecker tells whether the session an access token was issued for is still active
+type SessionChecker interface {
+	// CheckSession returns ErrInvalidToken unless the session exists and belongs to the user
+	CheckSession(ctx context.Context, userID, sessionID primitive.ObjectID) error
+}
@@ -0,0 +1,69 @@
+package domain
+
+import "time"
+
+// TOTP settings of RFC 6238: codes of TOTPDigits digits, each valid for TOTPPeriod
+const (
+	TOTPDigits = 6
+	TOTPPeriod = 30 * time.Second
+)
+
+// The issuer authenticator apps show for the account, and how many recovery codes a user gets
+const (
+	TwoFactorIssuer   = "Real-Time Chat"
+	RecoveryCodeCount = 10
+)
+
+var (
+	// ErrTwoFactorAlreadyEnabled is returned when setting up two-factor authentication for a user who has it
+	ErrTwoFactorAlreadyEnabled = NewError(ErrConflict, "two-factor authentication is already enabled")
+	// ErrTwoFactorNotEnabled is returned when confirming a setup that was not started, or disabling
+	// two-factor authentication for a user who does not have it
+	ErrTwoFactorNotEnabled = NewError(ErrValidation, "two-factor authentication is not set up")
+	// ErrInvalidTwoFactorCode is returned when the second login step gets a wrong, reused or expired code
+	ErrInvalidTwoFactorCode = NewError(ErrUnauthorized, "invalid two-factor code")
+)
+
+// TwoFactor is the two-factor authentication of a user. It is stored on the user as soon as the
+// setup starts, and only enabled once the user proved their authenticator app works.
+type TwoFactor struct {
+	// Secret is the base32 TOTP key. Unlike passwords it cannot be hashed, since checking a
+	// code needs the key itself.
+	Secret        string     `bson:"secret"`
+	Enabled       bool       `bson:"enabled"`
+	EnabledAt     *time.Time `bson:"enabled_at,omitempty"`
+	LastUsedStep  int64      `bson:"last_used_step"` // time step of the latest accepted code, so no code works twice
+	RecoveryCodes []string   `bson:"recovery_codes"` // SHA-256 hashes of the unused recovery codes
+}
+
+// TwoFactorSetup is what a user adds to their authenticator app: the secret, or the otpauth URI
+// holding it, usually shown as a QR code
+type TwoFactorSetup struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+// TwoFactorStatus is the two-factor state of a user, visible to the user and to admins
+type TwoFactorStatus struct {
+	Enabled           bool       `json:"enabled"`
+	EnabledAt         *time.Time `json:"enabled_at,omitempty"`
+	RecoveryCodesLeft int        `json:"recovery_codes_left"`
+}
+
+// LoginResult is the outcome of checking a user's password: the tokens, or for users with
+// two-factor authentication a challenge to answer with a code instead
+type LoginResult struct {
+	Tokens    *TokenPair
+	Challenge string
+}
+
+// TOTP generates and checks RFC 6238 time-based one-time passwords
+type TOTP interface {
+	// GenerateSecret returns a new random base32 secret
+	GenerateSecret() (string, error)
+	// URI returns the otpauth URI of secret for the account, to be added to an authenticator app
+	URI(secret, account string) string
+	// Validate reports whether code is valid for secret now, allowing for one time step of clock
+	// drift either way, and returns the time step it is valid for
+	Validate(secret, code string) (step int64, ok bool)
+}
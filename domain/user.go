@@ -7,6 +7,19 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+var (
+	// ErrUserNotFound is returned when a user does not exist
+	ErrUserNotFound = NewError(ErrNotFound, "user not found")
+	// ErrUserExists is returned when the email or username of a user is already taken
+	ErrUserExists = NewError(ErrConflict, "email or username already taken")
+	// ErrNothingToUpdate is returned when an update of a user changes no field
+	ErrNothingToUpdate = NewError(ErrValidation, "no fields provided for update")
+	// ErrEmailNotVerified is returned when a user who has not verified their email does something that requires it
+	ErrEmailNotVerified = NewError(ErrForbidden, "email address is not verified")
+	// ErrEmailAlreadyVerified is returned when asking to verify an email that already is
+	ErrEmailAlreadyVerified = NewError(ErrConflict, "email address is already verified")
+)
+
 // User represents a user of the application.
 type User struct {
 	UserID   primitive.ObjectID   `json:"-" bson:"_id"`
@@ -16,6 +29,33 @@ type User struct {
 	Chats    []primitive.ObjectID `json:"chats" bson:"chats"`
 	CreatedAt  time.Time          `json:"created_at" bson:"created_at"`
 	UpdatedAt  time.Time          `json:"updated_at" bson:"updated_at"`
+	LastSeen   *time.Time         `json:"last_seen,omitempty" bson:"last_seen,omitempty"` // when the user last went offline
+	EmailVerified bool            `json:"email_verified" bson:"email_verified"`
+	TwoFactor  *TwoFactor         `json:"-" bson:"two_factor,omitempty"`
+	IsAdmin    bool               `json:"-" bson:"is_admin,omitempty"` // only ever set in the database
+}
+
+// TwoFactorEnabled reports whether the user has to give a second factor to log in
+func (user *User) TwoFactorEnabled() bool {
+	return user.TwoFactor != nil && user.TwoFactor.Enabled
+}
+
+// Presence statuses. A user is online when any of their connections is active, away when
+// every connection is idle, and offline without connections.
+const (
+	PresenceOnline  = "online"
+	PresenceAway    = "away"
+	PresenceOffline = "offline"
+)
+
+// MaxPresenceQuery is the number of users whose presence can be queried at once
+const MaxPresenceQuery = 100
+
+// Presence is whether a user is connected. LastSeen is only set for users who are not online.
+type Presence struct {
+	UserID   primitive.ObjectID `json:"user_id"`
+	Status   string             `json:"status"`
+	LastSeen *time.Time         `json:"last_seen,omitempty"`
 }
 
 type UserRepository interface {
@@ -23,10 +63,27 @@ type UserRepository interface {
 	GetUserByID(ctx context.Context, userID primitive.ObjectID) (*User, error)
 	GetUserByEmail(ctx context.Context, email string) (*User, error)
 	GetUserByUsername(ctx context.Context, username string) (*User, error)
+	// UpdateUser stores the non-empty username and password of user; the password must already be hashed
 	UpdateUser(ctx context.Context, userID primitive.ObjectID, user *User) error
 	DeleteUser(ctx context.Context, userID primitive.ObjectID) error
+	GetUsersByIDs(ctx context.Context, userIDs []primitive.ObjectID) ([]User, error)
+	UpdateLastSeen(ctx context.Context, userID primitive.ObjectID, lastSeen time.Time) error
+	MarkEmailVerified(ctx context.Context, userID primitive.ObjectID) error
+	// SetTwoFactor stores the two-factor authentication of a user, or removes it when twoFactor is nil
+	SetTwoFactor(ctx context.Context, userID primitive.ObjectID, twoFactor *TwoFactor) error
+	// UseTOTPStep records that the code of step was used, or returns ErrInvalidTwoFactorCode when a
+	// code of that step or a later one already was
+	UseTOTPStep(ctx context.Context, userID primitive.ObjectID, step int64) error
+	// UseRecoveryCode deletes the unused recovery code with the given hash, or returns
+	// ErrInvalidTwoFactorCode when there is none. Of two concurrent calls only one succeeds.
+	UseRecoveryCode(ctx context.Context, userID primitive.ObjectID, hash string) error
 }
 
+// UserUsecase rejects users breaking the rules on emails, usernames and passwords with a
+// ValidationError listing every invalid field. Passwords are hashed before they are stored.
+//
+// Users start with an unverified email and are mailed a token to verify it. Until they do,
+// they cannot start chats (ErrEmailNotVerified).
 type UserUsecase interface {
 	CreateUser(ctx context.Context, user *User) (primitive.ObjectID, error)
 	GetUserByID(ctx context.Context, userID primitive.ObjectID) (*User, error)
@@ -34,4 +91,13 @@ type UserUsecase interface {
 	GetUserByUsername(ctx context.Context, username string) (*User, error)
 	UpdateUser(ctx context.Context, userID primitive.ObjectID, user *User) error
 	DeleteUser(ctx context.Context, userID primitive.ObjectID) error
-}
\ No newline at end of file
+	GetUsersByIDs(ctx context.Context, userIDs []primitive.ObjectID) ([]User, error)
+	UpdateLastSeen(ctx context.Context, userID primitive.ObjectID, lastSeen time.Time) error
+	// ChangePassword replaces the password of a user who proves they know the current one, and
+	// signs out every session of the user but sessionID
+	ChangePassword(ctx context.Context, userID, sessionID primitive.ObjectID, currentPassword, newPassword string) error
+	// VerifyEmail marks the email of the user a verification token was issued to as verified
+	VerifyEmail(ctx context.Context, token string) error
+	// ResendVerification mails the user a new verification token, at most once per VerificationResendCooldown
+	ResendVerification(ctx context.Context, userID primitive.ObjectID) error
+}
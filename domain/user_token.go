@@ -0,0 +1,55 @@
+package domain
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Purposes of a UserToken. A token only works for the purpose it was issued for.
+const (
+	TokenPasswordReset     = "password_reset"
+	TokenEmailVerification = "email_verification"
+	TokenTwoFactorLogin    = "two_factor_login" // a login waiting for its second factor
+)
+
+// How long tokens can be used, and how often a verification or reset mail can be sent again
+const (
+	PasswordResetTTL           = time.Hour
+	EmailVerificationTTL       = 24 * time.Hour
+	TwoFactorChallengeTTL      = 5 * time.Minute
+	VerificationResendCooldown = time.Minute
+	PasswordResetCooldown      = time.Minute
+)
+
+// ErrInvalidUserToken is returned when a one-time token is unknown, already used or expired
+var ErrInvalidUserToken = NewError(ErrValidation, "invalid or expired token")
+
+// ErrResendTooSoon is returned when a verification mail is asked for within VerificationResendCooldown of the last one
+var ErrResendTooSoon = NewError(ErrRateLimited, "a verification mail was sent recently, try again later")
+
+// UserToken is a single-use token proving a user received a mail, e.g. to reset their password,
+// or passed the first step of a login. Only a hash of the token is stored; the token itself is
+// only ever sent to the user.
+type UserToken struct {
+	TokenID   primitive.ObjectID `json:"-" bson:"_id,omitempty"`
+	UserID    primitive.ObjectID `json:"-" bson:"user_id"`
+	Purpose   string             `json:"-" bson:"purpose"`
+	Hash      string             `json:"-" bson:"hash"`
+	CreatedAt time.Time          `json:"-" bson:"created_at"`
+	ExpiresAt time.Time          `json:"-" bson:"expires_at"`
+}
+
+type UserTokenRepository interface {
+	CreateToken(ctx context.Context, token *UserToken) error
+	// ConsumeToken deletes and returns the token of purpose with the given hash, or returns
+	// ErrInvalidUserToken when there is none that is still valid at now. Of two concurrent
+	// calls for the same token only one succeeds.
+	ConsumeToken(ctx context.Context, purpose, hash string, now time.Time) (*UserToken, error)
+	// DeleteTokens deletes every token of purpose issued to the user
+	DeleteTokens(ctx context.Context, userID primitive.ObjectID, purpose string) error
+	// LatestTokenTime returns when the latest token of purpose was issued to the user, or the
+	// zero time when the user has none
+	LatestTokenTime(ctx context.Context, userID primitive.ObjectID, purpose string) (time.Time, error)
+}
@@ -0,0 +1,52 @@
+package domain
+
+import "strings"
+
+// Limits of the fields checked when users, chats and messages are created or changed
+const (
+	MaxEmailLength     = 254
+	MinUsernameLength  = 3
+	MaxUsernameLength  = 32
+	MinPasswordLength  = 8
+	MaxPasswordLength  = 72 // bcrypt ignores anything longer
+	MaxMessageLength   = 4000
+	MaxChatTitleLength = 100
+	MaxAvatarLength    = 2048 // long enough for any reasonable image URL
+)
+
+// FieldError is a rule broken by one field of a request
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError lists every field of a request that breaks a rule, so a client can report
+// them all at once. It is of kind ErrValidation.
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Fields))
+	for i, field := range e.Fields {
+		messages[i] = field.Field + ": " + field.Message
+	}
+	return strings.Join(messages, "; ")
+}
+
+func (e *ValidationError) Unwrap() error {
+	return ErrValidation
+}
+
+// Add records that field breaks a rule
+func (e *ValidationError) Add(field, message string) {
+	e.Fields = append(e.Fields, FieldError{Field: field, Message: message})
+}
+
+// Err returns the ValidationError, or nil when no field broke a rule
+func (e *ValidationError) Err() error {
+	if len(e.Fields) == 0 {
+		return nil
+	}
+	return e
+}
@@ -0,0 +1,75 @@
+// Package httperr turns domain errors into HTTP error responses, so the controllers, the
+// middleware and the websocket upgrade all answer failures with the same body.
+package httperr
+
+import (
+	"Real-Time-Chat-Application/domain"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Codes of Response, one per kind of domain error
+const (
+	CodeInvalidRequest = "invalid_request"
+	CodeValidation     = "validation_failed"
+	CodeUnauthorized   = "unauthorized"
+	CodeForbidden      = "forbidden"
+	CodeNotFound       = "not_found"
+	CodeConflict       = "conflict"
+	CodeRateLimited    = "rate_limited"
+	CodeInternal       = "internal"
+)
+
+// Response is the body of every error response. Code is stable for clients to switch on,
+// Error is a human readable message. Fields lists the invalid fields of a request failing validation.
+type Response struct {
+	Error  string              `json:"error"`
+	Code   string              `json:"code"`
+	Fields []domain.FieldError `json:"fields,omitempty"`
+}
+
+// Status maps an error to the HTTP status code and Response code to respond with, by the
+// kind of domain error it wraps
+func Status(err error) (int, string) {
+	var validationErr *domain.ValidationError
+	switch {
+	case errors.As(err, &validationErr):
+		return http.StatusUnprocessableEntity, CodeValidation
+	case errors.Is(err, domain.ErrValidation):
+		return http.StatusBadRequest, CodeInvalidRequest
+	case errors.Is(err, domain.ErrUnauthorized):
+		return http.StatusUnauthorized, CodeUnauthorized
+	case errors.Is(err, domain.ErrForbidden):
+		return http.StatusForbidden, CodeForbidden
+	case errors.Is(err, domain.ErrNotFound):
+		return http.StatusNotFound, CodeNotFound
+	case errors.Is(err, domain.ErrConflict):
+		return http.StatusConflict, CodeConflict
+	case errors.Is(err, domain.ErrRateLimited):
+		return http.StatusTooManyRequests, CodeRateLimited
+	default:
+		return http.StatusInternalServerError, CodeInternal
+	}
+}
+
+// Respond responds with the status of err and stops the handlers after the caller. Errors of
+// no known kind are failures of the server, such as a database outage, so they are logged and
+// their details are not exposed.
+func Respond(c *gin.Context, err error) {
+	status, code := Status(err)
+	message := err.Error()
+	if status == http.StatusInternalServerError {
+		log.Printf("%s %s: %v", c.Request.Method, c.FullPath(), err)
+		message = "Internal server error"
+	}
+	response := Response{Error: message, Code: code}
+	var validationErr *domain.ValidationError
+	if errors.As(err, &validationErr) {
+		response.Error = "Validation failed"
+		response.Fields = validationErr.Fields
+	}
+	c.AbortWithStatusJSON(status, response)
+}
@@ -0,0 +1,40 @@
+package infrastructure
+
+import (
+	"Real-Time-Chat-Application/domain"
+	"fmt"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// BcryptHasher hashes passwords with bcrypt at a fixed cost
+type BcryptHasher struct {
+	cost int
+}
+
+// NewBcryptHasher returns a hasher using cost, or bcrypt.DefaultCost when cost is out of bcrypt's range
+func NewBcryptHasher(cost int) domain.PasswordHasher {
+	if cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+		cost = bcrypt.DefaultCost
+	}
+	return &BcryptHasher{cost: cost}
+}
+
+func (h *BcryptHasher) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), h.cost)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash the password: %w", err)
+	}
+	return string(hash), nil
+}
+
+func (h *BcryptHasher) Compare(hash, password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+// NeedsRehash reports whether hash was made with a lower cost than the current one. Lowering the
+// cost leaves existing hashes alone.
+func (h *BcryptHasher) NeedsRehash(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err == nil && cost < h.cost
+}
@@ -0,0 +1,101 @@
+package infrastructure
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config holds the runtime settings of the server, read from the environment
+type Config struct {
+	ServerAddress   string
+	MongoURI        string
+	DatabaseName    string
+	ContextTimeout  time.Duration
+	ShutdownTimeout time.Duration
+	JWTSecret       string
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+	WSPingInterval  time.Duration
+	WSPongWait      time.Duration
+	WSWriteWait     time.Duration
+	WSMaxMessage    int64
+	BcryptCost      int
+	SMTPHost        string
+	SMTPPort        int
+	SMTPUsername    string
+	SMTPPassword    string
+	MailFrom        string
+	TrustedProxies  []string
+}
+
+// LoadConfig reads the configuration from environment variables, falling back to
+// defaults suitable for local development
+func LoadConfig() Config {
+	return Config{
+		ServerAddress:   getEnv("SERVER_ADDRESS", ":8080"),
+		MongoURI:        getEnv("MONGO_URI", "mongodb://localhost:27017"),
+		DatabaseName:    getEnv("DB_NAME", "chat_app"),
+		ContextTimeout:  getDuration("CONTEXT_TIMEOUT", 5*time.Second),
+		ShutdownTimeout: getDuration("SHUTDOWN_TIMEOUT", 10*time.Second),
+		JWTSecret:       getEnv("JWT_SECRET", ""),
+		AccessTokenTTL:  getDuration("ACCESS_TOKEN_TTL", 15*time.Minute),
+		RefreshTokenTTL: getDuration("REFRESH_TOKEN_TTL", 7*24*time.Hour),
+		WSPingInterval:  getDuration("WS_PING_INTERVAL", 54*time.Second),
+		WSPongWait:      getDuration("WS_PONG_WAIT", 60*time.Second),
+		WSWriteWait:     getDuration("WS_WRITE_WAIT", 10*time.Second),
+		WSMaxMessage:    getInt("WS_MAX_MESSAGE_SIZE", 64*1024),
+		BcryptCost:      int(getInt("BCRYPT_COST", 10)),
+		SMTPHost:        getEnv("SMTP_HOST", ""),
+		SMTPPort:        int(getInt("SMTP_PORT", 587)),
+		SMTPUsername:    getEnv("SMTP_USERNAME", ""),
+		SMTPPassword:    getEnv("SMTP_PASSWORD", ""),
+		MailFrom:        getEnv("MAIL_FROM", "no-reply@localhost"),
+		TrustedProxies:  getList("TRUSTED_PROXIES"),
+	}
+}
+
+func getEnv(key, fallback string) string {
+	if value, ok := os.LookupEnv(key); ok && value != "" {
+		return value
+	}
+	return fallback
+}
+
+// getList splits a comma separated value, dropping empty entries; unset values give nil
+func getList(key string) []string {
+	var list []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			list = append(list, value)
+		}
+	}
+	return list
+}
+
+// getDuration parses values such as "5s" or "1m"; invalid values use the fallback
+func getDuration(key string, fallback time.Duration) time.Duration {
+	value, ok := os.LookupEnv(key)
+	if !ok || value == "" {
+		return fallback
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return fallback
+	}
+	return duration
+}
+
+// getInt parses a positive integer; invalid values use the fallback
+func getInt(key string, fallback int64) int64 {
+	value, ok := os.LookupEnv(key)
+	if !ok || value == "" {
+		return fallback
+	}
+	number, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || number <= 0 {
+		return fallback
+	}
+	return number
+}
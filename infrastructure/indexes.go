@@ -0,0 +1,87 @@
+package infrastructure
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// EnsureIndexes creates the indexes the repositories rely on. Creating an index that
+// already exists is a no-op, so it is safe to call on every start up
+func EnsureIndexes(ctx context.Context, database *mongo.Database) error {
+	// Messages are always read per chat in time order
+	_, err := database.Collection("messages").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "chat_id", Value: 1}, {Key: "time", Value: 1}, {Key: "_id", Value: 1}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create messages index: %w", err)
+	}
+
+	// Chats are looked up by participant, and listed by most recent activity
+	_, err = database.Collection("chats").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "participants", Value: 1}, {Key: "updated_at", Value: -1}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create chats index: %w", err)
+	}
+
+	// Two users have at most one direct chat. Chats created before direct_key existed are
+	// left out until cmd/migrate fills it in.
+	_, err = database.Collection("chats").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "direct_key", Value: 1}},
+		Options: options.Index().
+			SetUnique(true).
+			SetPartialFilterExpression(bson.M{"direct_key": bson.M{"$exists": true}}),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create direct chat index: %w", err)
+	}
+
+	// Emails and usernames are unique, which is how a taken one is rejected on sign up
+	for _, field := range []string{"email", "username"} {
+		_, err = database.Collection("users").Indexes().CreateOne(ctx, mongo.IndexModel{
+			Keys:    bson.D{{Key: field, Value: 1}},
+			Options: options.Index().SetUnique(true),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to create users %s index: %w", field, err)
+		}
+	}
+
+	// One-time tokens are looked up by hash, and MongoDB deletes them once they expire
+	_, err = database.Collection("user_tokens").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "hash", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create user tokens index: %w", err)
+	}
+	_, err = database.Collection("user_tokens").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create user tokens expiry index: %w", err)
+	}
+
+	// Sessions are listed per user by latest activity, and MongoDB deletes them once their
+	// refresh token expires
+	_, err = database.Collection("sessions").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "last_active_at", Value: -1}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create sessions index: %w", err)
+	}
+	_, err = database.Collection("sessions").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create sessions expiry index: %w", err)
+	}
+
+	return nil
+}
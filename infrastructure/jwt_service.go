@@ -0,0 +1,102 @@
+package infrastructure
+
+import (
+	"Real-Time-Chat-Application/domain"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// JWTService issues and validates HMAC-signed JSON Web Tokens
+type JWTService struct {
+	secret          []byte
+	accessTokenTTL  time.Duration
+	refreshTokenTTL time.Duration
+}
+
+type jwtClaims struct {
+	Type    domain.TokenType `json:"typ"`
+	Session string           `json:"sid"`
+	jwt.RegisteredClaims
+}
+
+func NewJWTService(secret string, accessTokenTTL, refreshTokenTTL time.Duration) domain.TokenService {
+	return &JWTService{
+		secret:          []byte(secret),
+		accessTokenTTL:  accessTokenTTL,
+		refreshTokenTTL: refreshTokenTTL,
+	}
+}
+
+func (s *JWTService) GenerateTokens(userID, sessionID primitive.ObjectID) (*domain.TokenPair, error) {
+	now := time.Now()
+	accessToken, err := s.sign(userID, sessionID, domain.AccessToken, now, s.accessTokenTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, err := s.sign(userID, sessionID, domain.RefreshToken, now, s.refreshTokenTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	return &domain.TokenPair{
+		AccessToken:      accessToken,
+		RefreshToken:     refreshToken,
+		ExpiresIn:        int64(s.accessTokenTTL.Seconds()),
+		RefreshExpiresAt: now.Add(s.refreshTokenTTL),
+	}, nil
+}
+
+func (s *JWTService) ValidateToken(token string, tokenType domain.TokenType) (*domain.TokenClaims, error) {
+	var claims jwtClaims
+	_, err := jwt.ParseWithClaims(token, &claims, func(t *jwt.Token) (interface{}, error) {
+		return s.secret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
+	if err != nil {
+		return nil, domain.ErrInvalidToken
+	}
+
+	if claims.Type != tokenType {
+		return nil, domain.ErrInvalidToken
+	}
+
+	userID, err := primitive.ObjectIDFromHex(claims.Subject)
+	if err != nil {
+		return nil, domain.ErrInvalidToken
+	}
+
+	// Tokens issued before sessions existed have no session, and cannot be revoked
+	sessionID, err := primitive.ObjectIDFromHex(claims.Session)
+	if err != nil {
+		return nil, domain.ErrInvalidToken
+	}
+
+	return &domain.TokenClaims{
+		UserID:    userID,
+		SessionID: sessionID,
+		Type:      claims.Type,
+		ExpiresAt: claims.ExpiresAt.Time,
+	}, nil
+}
+
+func (s *JWTService) sign(userID, sessionID primitive.ObjectID, tokenType domain.TokenType, now time.Time, ttl time.Duration) (string, error) {
+	claims := jwtClaims{
+		Type:    tokenType,
+		Session: sessionID.Hex(),
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   userID.Hex(),
+			ID:        primitive.NewObjectID().Hex(),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		},
+	}
+
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(s.secret)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign %s token: %w", tokenType, err)
+	}
+	return signed, nil
+}
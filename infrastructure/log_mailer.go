@@ -0,0 +1,20 @@
+package infrastructure
+
+import (
+	"Real-Time-Chat-Application/domain"
+	"context"
+	"log"
+)
+
+// LogMailer writes mails to the log instead of sending them, for local development without
+// an SMTP server. Mails carry verification and reset tokens, so it must not be used in production.
+type LogMailer struct{}
+
+func NewLogMailer() domain.Mailer {
+	return LogMailer{}
+}
+
+func (LogMailer) Send(ctx context.Context, mail domain.Mail) error {
+	log.Printf("mail to %s: %s\n%s", mail.To, mail.Subject, mail.Body)
+	return nil
+}
@@ -0,0 +1,43 @@
+package infrastructure
+
+import (
+	"Real-Time-Chat-Application/domain"
+	"context"
+	"sync"
+)
+
+// MemoryMailer keeps mails instead of sending them, for tests
+type MemoryMailer struct {
+	mu   sync.Mutex
+	sent []domain.Mail
+}
+
+func NewMemoryMailer() *MemoryMailer {
+	return &MemoryMailer{}
+}
+
+func (m *MemoryMailer) Send(ctx context.Context, mail domain.Mail) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent = append(m.sent, mail)
+	return nil
+}
+
+// Sent returns the mails sent so far, oldest first
+func (m *MemoryMailer) Sent() []domain.Mail {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]domain.Mail(nil), m.sent...)
+}
+
+// Last returns the latest mail sent to the address, if any
+func (m *MemoryMailer) Last(to string) (domain.Mail, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := len(m.sent) - 1; i >= 0; i-- {
+		if m.sent[i].To == to {
+			return m.sent[i], true
+		}
+	}
+	return domain.Mail{}, false
+}
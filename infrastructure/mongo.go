@@ -0,0 +1,70 @@
+package infrastructure
+
+import (
+	"Real-Time-Chat-Application/repository"
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoCollection adapts a *mongo.Collection to repository.CollectionInterface
+type MongoCollection struct {
+	collection *mongo.Collection
+}
+
+func NewMongoCollection(collection *mongo.Collection) repository.CollectionInterface {
+	return &MongoCollection{collection: collection}
+}
+
+func (mc *MongoCollection) InsertOne(ctx context.Context, document interface{}, opts ...*options.InsertOneOptions) (*mongo.InsertOneResult, error) {
+	return mc.collection.InsertOne(ctx, document, opts...)
+}
+
+func (mc *MongoCollection) FindOne(ctx context.Context, filter interface{}, opts ...*options.FindOneOptions) repository.SingleResultInterface {
+	return mc.collection.FindOne(ctx, filter, opts...)
+}
+
+func (mc *MongoCollection) Find(ctx context.Context, filter interface{}, opts ...*options.FindOptions) (repository.CursorInterface, error) {
+	cursor, err := mc.collection.Find(ctx, filter, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return cursor, nil
+}
+
+func (mc *MongoCollection) UpdateOne(ctx context.Context, filter interface{}, update interface{}, opts ...*options.UpdateOptions) (*mongo.UpdateResult, error) {
+	return mc.collection.UpdateOne(ctx, filter, update, opts...)
+}
+
+func (mc *MongoCollection) DeleteOne(ctx context.Context, filter interface{}, opts ...*options.DeleteOptions) (*mongo.DeleteResult, error) {
+	return mc.collection.DeleteOne(ctx, filter, opts...)
+}
+
+func (mc *MongoCollection) DeleteMany(ctx context.Context, filter interface{}, opts ...*options.DeleteOptions) (*mongo.DeleteResult, error) {
+	return mc.collection.DeleteMany(ctx, filter, opts...)
+}
+
+func (mc *MongoCollection) Aggregate(ctx context.Context, pipeline interface{}, opts ...*options.AggregateOptions) (repository.CursorInterface, error) {
+	cursor, err := mc.collection.Aggregate(ctx, pipeline, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return cursor, nil
+}
+
+// ConnectMongo opens a client to the given URI and verifies the connection with a ping
+func ConnectMongo(ctx context.Context, uri string) (*mongo.Client, error) {
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to mongo: %w", err)
+	}
+
+	if err := client.Ping(ctx, nil); err != nil {
+		client.Disconnect(context.Background())
+		return nil, fmt.Errorf("failed to ping mongo: %w", err)
+	}
+
+	return client, nil
+}
@@ -0,0 +1,118 @@
+package infrastructure
+
+import (
+	"Real-Time-Chat-Application/domain"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// totpSecretSize is the length of generated secrets in bytes, the size RFC 4226 recommends
+const totpSecretSize = 20
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// TOTPGenerator generates and checks RFC 6238 codes with HMAC-SHA1, the variant every
+// authenticator app supports
+type TOTPGenerator struct {
+	issuer string
+	now    func() time.Time
+}
+
+// NewTOTPGenerator returns a generator naming issuer in its URIs and reading the time from now,
+// or from time.Now when now is nil. Tests pass a fixed clock.
+func NewTOTPGenerator(issuer string, now func() time.Time) *TOTPGenerator {
+	if now == nil {
+		now = time.Now
+	}
+	return &TOTPGenerator{issuer: issuer, now: now}
+}
+
+var _ domain.TOTP = (*TOTPGenerator)(nil)
+
+func (g *TOTPGenerator) GenerateSecret() (string, error) {
+	secret := make([]byte, totpSecretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return "", fmt.Errorf("failed to generate TOTP secret: %w", err)
+	}
+	return totpEncoding.EncodeToString(secret), nil
+}
+
+// URI follows the key URI format of Google Authenticator, which other apps support as well
+func (g *TOTPGenerator) URI(secret, account string) string {
+	label := url.PathEscape(g.issuer) + ":" + url.PathEscape(account)
+	query := url.Values{
+		"secret":    {secret},
+		"issuer":    {g.issuer},
+		"algorithm": {"SHA1"},
+		"digits":    {strconv.Itoa(domain.TOTPDigits)},
+		"period":    {strconv.Itoa(int(domain.TOTPPeriod.Seconds()))},
+	}
+	// Some apps show a "+" literally, so spaces are encoded as %20
+	return "otpauth://totp/" + label + "?" + strings.ReplaceAll(query.Encode(), "+", "%20")
+}
+
+func (g *TOTPGenerator) Validate(secret, code string) (int64, bool) {
+	key, err := decodeTOTPSecret(secret)
+	if err != nil || len(code) != domain.TOTPDigits {
+		return 0, false
+	}
+
+	step := totpStep(g.now())
+	for _, candidate := range []int64{step - 1, step, step + 1} {
+		if subtle.ConstantTimeCompare([]byte(hotp(key, candidate)), []byte(code)) == 1 {
+			return candidate, true
+		}
+	}
+	return 0, false
+}
+
+// Code returns the code of secret at a given time, as an authenticator app would show it
+func (g *TOTPGenerator) Code(secret string, at time.Time) (string, error) {
+	key, err := decodeTOTPSecret(secret)
+	if err != nil {
+		return "", err
+	}
+	return hotp(key, totpStep(at)), nil
+}
+
+func decodeTOTPSecret(secret string) ([]byte, error) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(strings.TrimRight(secret, "=")))
+	if err != nil {
+		return nil, fmt.Errorf("invalid TOTP secret: %w", err)
+	}
+	return key, nil
+}
+
+// totpStep is the number of TOTPPeriods since the Unix epoch
+func totpStep(t time.Time) int64 {
+	return t.Unix() / int64(domain.TOTPPeriod.Seconds())
+}
+
+// hotp computes the RFC 4226 code of key for a counter
+func hotp(key []byte, counter int64) string {
+	var message [8]byte
+	binary.BigEndian.PutUint64(message[:], uint64(counter))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(message[:])
+	sum := mac.Sum(nil)
+
+	// Dynamic truncation
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	modulo := uint32(1)
+	for i := 0; i < domain.TOTPDigits; i++ {
+		modulo *= 10
+	}
+	return fmt.Sprintf("%0*d", domain.TOTPDigits, value%modulo)
+}
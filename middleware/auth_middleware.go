@@ -0,0 +1,95 @@
+package middleware
+
+import (
+	"Real-Time-Chat-Application/domain"
+	"Real-Time-Chat-Application/httperr"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Gin context keys holding the authenticated user's ID and the ID of their session
+const (
+	UserIDKey    = "user_id"
+	SessionIDKey = "session_id"
+)
+
+// AuthMiddleware rejects requests without a valid "Authorization: Bearer <token>" access token,
+// or whose session was revoked, and stores the caller's user and session IDs in the gin context
+func AuthMiddleware(tokenService domain.TokenService, sessions domain.SessionChecker) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		authenticate(c, tokenService, sessions, bearerToken(c))
+	}
+}
+
+// WebSocketAuthMiddleware behaves like AuthMiddleware but also accepts the access token
+// in the "token" query parameter, since browsers cannot set headers on a websocket upgrade.
+// The router logs requests with RequestLogger, which leaves the query string out.
+func WebSocketAuthMiddleware(tokenService domain.TokenService, sessions domain.SessionChecker) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := bearerToken(c)
+		if token == "" {
+			token = c.Query("token")
+		}
+		authenticate(c, tokenService, sessions, token)
+	}
+}
+
+// GetUserID returns the authenticated user's ID set by the auth middleware
+func GetUserID(c *gin.Context) (primitive.ObjectID, bool) {
+	value, ok := c.Get(UserIDKey)
+	if !ok {
+		return primitive.NilObjectID, false
+	}
+	userID, ok := value.(primitive.ObjectID)
+	return userID, ok
+}
+
+// GetSessionID returns the ID of the authenticated user's session set by the auth middleware
+func GetSessionID(c *gin.Context) (primitive.ObjectID, bool) {
+	value, ok := c.Get(SessionIDKey)
+	if !ok {
+		return primitive.NilObjectID, false
+	}
+	sessionID, ok := value.(primitive.ObjectID)
+	return sessionID, ok
+}
+
+func authenticate(c *gin.Context, tokenService domain.TokenService, sessions domain.SessionChecker, token string) {
+	if token == "" {
+		httperr.Respond(c, domain.NewError(domain.ErrUnauthorized, "Missing access token"))
+		return
+	}
+
+	claims, err := tokenService.ValidateToken(token, domain.AccessToken)
+	if err != nil {
+		httperr.Respond(c, err)
+		return
+	}
+
+	// Access tokens outlive a revocation, so the session is checked on every request
+	if err := sessions.CheckSession(c.Request.Context(), claims.UserID, claims.SessionID); err != nil {
+		if errors.Is(err, domain.ErrInvalidToken) {
+			err = domain.NewError(domain.ErrUnauthorized, "Session revoked")
+		} else {
+			err = fmt.Errorf("failed to check session: %w", err)
+		}
+		httperr.Respond(c, err)
+		return
+	}
+
+	c.Set(UserIDKey, claims.UserID)
+	c.Set(SessionIDKey, claims.SessionID)
+	c.Next()
+}
+
+func bearerToken(c *gin.Context) string {
+	header := c.GetHeader("Authorization")
+	if len(header) > len("Bearer ") && strings.EqualFold(header[:len("Bearer ")], "Bearer ") {
+		return strings.TrimSpace(header[len("Bearer "):])
+	}
+	return ""
+}
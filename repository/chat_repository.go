@@ -9,6 +9,7 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 // ChatRepository is a struct for the chat repository
@@ -25,18 +26,41 @@ func(chatrepo *ChatRepository) CreateChat(ctx context.Context, SenderID primitiv
 	collection := chatrepo.collection
 
 	chat := domain.Chat{
+		Type: domain.ChatTypeDirect,
 		Participants: []primitive.ObjectID{SenderID, ReceiverID},
+		DirectKey: domain.DirectChatKey(SenderID, ReceiverID),
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
-		Messages: []domain.Message{},
 	}
 
+	// the unique index on direct_key rejects a second chat between the same users
 	result, err := collection.InsertOne(ctx, chat)
+	if mongo.IsDuplicateKeyError(err) {
+		return primitive.NilObjectID, fmt.Errorf("failed to create chat: %w", domain.ErrChatExists)
+	}
 	if err != nil {
 		return primitive.NilObjectID, fmt.Errorf("failed to create chat: %w", err)
 	}
 	return result.InsertedID.(primitive.ObjectID), nil
 
+}
+
+// CreateGroupChat stores the group as given by the usecase, which sets its members and creator
+func(chatrepo *ChatRepository) CreateGroupChat(ctx context.Context, chat *domain.Chat) (primitive.ObjectID, error) {
+
+	collection := chatrepo.collection
+
+	chat.Type = domain.ChatTypeGroup
+	chat.CreatedAt = time.Now()
+	chat.UpdatedAt = chat.CreatedAt
+
+	result, err := collection.InsertOne(ctx, chat)
+	if err != nil {
+		return primitive.NilObjectID, fmt.Errorf("failed to create chat: %w", err)
+	}
+	chat.ChatID = result.InsertedID.(primitive.ObjectID)
+	return chat.ChatID, nil
+
 }
 func(chatrepo *ChatRepository) GetChat(ctx context.Context, chatID primitive.ObjectID) (*domain.Chat, error) {
 
@@ -45,7 +69,7 @@ func(chatrepo *ChatRepository) GetChat(ctx context.Context, chatID primitive.Obj
 	err := collection.FindOne(ctx, bson.M{"_id": chatID}).Decode(&chat)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
-			return nil, fmt.Errorf("chat not found")
+			return nil, domain.ErrChatNotFound
 		}
 		return nil, fmt.Errorf("failed to fetch chat: %w", err)
 	}
@@ -94,24 +118,168 @@ func(chatrepo *ChatRepository) DeleteChat(ctx context.Context, chatID primitive.
 	return nil
 
 }
+// GetChatByParticipants finds the direct chat by its key. Databases that were not migrated yet
+// have direct chats without a key, so it falls back to matching the participants and returns
+// the oldest such chat, the one the migration keeps.
 func(chatrepo *ChatRepository) GetChatByParticipants(ctx context.Context, SenderID primitive.ObjectID, ReceiverID primitive.ObjectID) (*domain.Chat, error) {
 	collection := chatrepo.collection
 	var chat domain.Chat
 
+	err := collection.FindOne(ctx, bson.M{"direct_key": domain.DirectChatKey(SenderID, ReceiverID)}).Decode(&chat)
+	if err == nil {
+		return &chat, nil
+	}
+	if err != mongo.ErrNoDocuments {
+		return nil, fmt.Errorf("failed to fetch chat: %w", err)
+	}
+
+	// a group that shrank to two members is still a group
 	filter := bson.M{
 		"participants": bson.M{
 			"$all": []primitive.ObjectID{SenderID, ReceiverID},
 			"$size": 2,
 		},
+		"type": bson.M{"$ne": domain.ChatTypeGroup},
 	}
+	opts := options.FindOne().SetSort(bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}})
 
-	err := collection.FindOne(ctx, filter).Decode(&chat)
+	err = collection.FindOne(ctx, filter, opts).Decode(&chat)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
-			return nil, fmt.Errorf("chat not found")
+			return nil, domain.ErrChatNotFound
 		}
 		return nil, fmt.Errorf("failed to fetch chat: %w", err)
 	}
 
 	return &chat, nil
 }
+
+// UpdateReadMarker only matches the chat when the stored marker is behind the new one, so
+// concurrent updates can never move a marker backwards
+func(chatrepo *ChatRepository) UpdateReadMarker(ctx context.Context, chatID, userID primitive.ObjectID, marker domain.ReadMarker) (bool, error) {
+
+	collection := chatrepo.collection
+	field := "read_markers." + userID.Hex()
+
+	filter := bson.M{
+		"_id": chatID,
+		"$or": bson.A{
+			bson.M{field: bson.M{"$exists": false}},
+			bson.M{field + ".message_time": bson.M{"$lt": marker.MessageTime}},
+			bson.M{field + ".message_time": marker.MessageTime, field + ".message_id": bson.M{"$lt": marker.MessageID}},
+		},
+	}
+
+	result, err := collection.UpdateOne(ctx, filter, bson.M{"$set": bson.M{field: marker}})
+	if err != nil {
+		return false, fmt.Errorf("failed to update read marker: %w", err)
+	}
+	return result.MatchedCount > 0, nil
+
+}
+
+// GetRecentChats sorts on updated_at, which every new message bumps. The chats are served by
+// the (participants, updated_at) index; the legacy embedded messages are never read.
+func(chatrepo *ChatRepository) GetRecentChats(ctx context.Context, userID primitive.ObjectID) ([]domain.Chat, error) {
+
+	collection := chatrepo.collection
+	opts := options.Find().
+		SetSort(bson.D{{Key: "updated_at", Value: -1}, {Key: "_id", Value: -1}}).
+		SetProjection(bson.M{"messages": 0})
+
+	cursor, err := collection.Find(ctx, bson.M{"participants": userID}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch chats: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	chats := []domain.Chat{}
+	for cursor.Next(ctx) {
+		var chat domain.Chat
+		if err := cursor.Decode(&chat); err != nil {
+			return nil, fmt.Errorf("failed to decode chat: %w", err)
+		}
+		chats = append(chats, chat)
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, fmt.Errorf("cursor error: %w", err)
+	}
+	return chats, nil
+
+}
+
+// AddParticipants adds the users who are not members yet
+func(chatrepo *ChatRepository) AddParticipants(ctx context.Context, chatID primitive.ObjectID, userIDs []primitive.ObjectID) error {
+
+	collection := chatrepo.collection
+	update := bson.M{
+		"$addToSet": bson.M{"participants": bson.M{"$each": userIDs}},
+		"$set":      bson.M{"updated_at": time.Now()},
+	}
+
+	_, err := collection.UpdateOne(ctx, bson.M{"_id": chatID}, update)
+	if err != nil {
+		return fmt.Errorf("failed to add participants: %w", err)
+	}
+	return nil
+
+}
+
+// RemoveParticipant takes the user out of the chat along with their read marker and role
+func(chatrepo *ChatRepository) RemoveParticipant(ctx context.Context, chatID, userID primitive.ObjectID) error {
+
+	collection := chatrepo.collection
+	update := bson.M{
+		"$pull":  bson.M{"participants": userID},
+		"$unset": bson.M{"read_markers." + userID.Hex(): "", "roles." + userID.Hex(): ""},
+		"$set":   bson.M{"updated_at": time.Now()},
+	}
+
+	_, err := collection.UpdateOne(ctx, bson.M{"_id": chatID}, update)
+	if err != nil {
+		return fmt.Errorf("failed to remove participant: %w", err)
+	}
+	return nil
+
+}
+
+// UpdateChatSettings only touches the settings that are set, leaving the others, the members
+// and their roles alone
+func(chatrepo *ChatRepository) UpdateChatSettings(ctx context.Context, chatID primitive.ObjectID, settings domain.ChatSettings) error {
+
+	collection := chatrepo.collection
+	set := bson.M{"updated_at": time.Now()}
+	if settings.Title != nil {
+		set["title"] = *settings.Title
+	}
+	if settings.Avatar != nil {
+		set["avatar"] = *settings.Avatar
+	}
+	if settings.AnnouncementOnly != nil {
+		set["announcement_only"] = *settings.AnnouncementOnly
+	}
+
+	_, err := collection.UpdateOne(ctx, bson.M{"_id": chatID}, bson.M{"$set": set})
+	if err != nil {
+		return fmt.Errorf("failed to update chat settings: %w", err)
+	}
+	return nil
+
+}
+
+// SetRoles writes every role in one update, so handing over a group never leaves it with two owners
+func(chatrepo *ChatRepository) SetRoles(ctx context.Context, chatID primitive.ObjectID, roles map[primitive.ObjectID]string) error {
+
+	collection := chatrepo.collection
+	set := bson.M{}
+	for userID, role := range roles {
+		set["roles."+userID.Hex()] = role
+	}
+
+	_, err := collection.UpdateOne(ctx, bson.M{"_id": chatID}, bson.M{"$set": set})
+	if err != nil {
+		return fmt.Errorf("failed to set roles: %w", err)
+	}
+	return nil
+
+}
@@ -4,116 +4,172 @@ import (
 	"Real-Time-Chat-Application/domain"
 	"context"
 	"fmt"
-	"sort"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+// MessageRepository stores every message as its own document in the messages collection,
+// keyed by chat ID and time, so a chat's history is no longer bounded by the size of the chat document
 type MessageRepository struct {
-	collection CollectionInterface
+	collection     CollectionInterface // messages collection
+	chatCollection CollectionInterface // chats collection, used to track the last activity of a chat
 }
 
-func NewMessageRepository(collection CollectionInterface) domain.MessageRepository {
-	return &MessageRepository{collection: collection}
+func NewMessageRepository(collection CollectionInterface, chatCollection CollectionInterface) domain.MessageRepository {
+	return &MessageRepository{collection: collection, chatCollection: chatCollection}
 }
-// ChatRepository is a struct that defines the ChatRepository type
-// send message sends a message between two people who have already been chatting. It accepts the chatId and the message to send
-func(messageRepo *MessageRepository) SendMessage(ctx context.Context, chatID primitive.ObjectID, message *domain.Message) error {
+
+// send message stores a message in a chat between people who have already been chatting. It accepts the chatId and the message to send
+func (messageRepo *MessageRepository) SendMessage(ctx context.Context, chatID primitive.ObjectID, message *domain.Message) error {
 
 	collection := messageRepo.collection
 
-	// add a time stamp to the message
+	// add an ID, the chat it belongs to and a time stamp to the message
 	message.MessageID = primitive.NewObjectID()
+	message.ChatID = chatID
 	message.Time = time.Now()
 
-	// Push the message into the "messages" array in the chat document
-	update := bson.M{
-		"$push": bson.M{"messages": message},
-		"$set":  bson.M{"updated_at": time.Now()},
+	_, err := collection.InsertOne(ctx, message)
+	if err != nil {
+		return fmt.Errorf("failed to send message: %w", err)
 	}
 
-	// add the message to the chat list inside the chat ID
-	_, err := collection.UpdateOne(ctx, bson.M{"_id": chatID}, update)
+	// record the activity on the chat itself, along with the preview shown in the chat list
+	update := bson.M{"$set": bson.M{"updated_at": message.Time, "last_message": domain.NewMessagePreview(*message)}}
+	_, err = messageRepo.chatCollection.UpdateOne(ctx, bson.M{"_id": chatID}, update)
 	if err != nil {
-		return fmt.Errorf("failed to send message: %w", err)
+		return fmt.Errorf("failed to update chat: %w", err)
 	}
 
 	return nil
 
 }
 
-// Get messages will retrieve all the available messages based on their time stamp from the specific chat required
-func(messageRepo *MessageRepository) GetMessages(ctx context.Context, chatID primitive.ObjectID) ([]domain.Message, error) {
+// Get messages will retrieve all the available messages of the specific chat ordered by their time stamp
+func (messageRepo *MessageRepository) GetMessages(ctx context.Context, chatID primitive.ObjectID) ([]domain.Message, error) {
 
-	collection := messageRepo.collection
+	// the (chat_id, time, _id) index serves both the filter and the sort
+	opts := options.Find().SetSort(bson.D{{Key: "time", Value: 1}, {Key: "_id", Value: 1}})
+
+	return messageRepo.findMessages(ctx, bson.M{"chat_id": chatID}, opts)
+
+}
 
-	//get the messages using the chatID
-	var chat domain.Chat
+// GetMessagesBefore walks a chat's history backwards from the cursor, newest first, and returns the page in chronological order
+func (messageRepo *MessageRepository) GetMessagesBefore(ctx context.Context, chatID primitive.ObjectID, cursor *domain.MessageCursor, limit int) ([]domain.Message, error) {
 
-	//if the required chat doesn't exist in the database return there is no message to retireve with
-	err := collection.FindOne(ctx,bson.M{"_id":chatID}).Decode(&chat)
+	filter := bson.M{"chat_id": chatID}
+	if cursor != nil {
+		filter = cursorFilter(chatID, *cursor, "$lt")
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "time", Value: -1}, {Key: "_id", Value: -1}}).
+		SetLimit(int64(limit))
+
+	messages, err := messageRepo.findMessages(ctx, filter, opts)
 	if err != nil {
-		return []domain.Message{}, fmt.Errorf("failed to fetch chat: %w", err)
+		return []domain.Message{}, err
 	}
 
-	sort.Slice(chat.Messages, func(i,j int) bool {
-		return chat.Messages[i].Time.Before(chat.Messages[j].Time)
-	})
+	// restore chronological order
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
 
-	//otherwise return list of messages in sorted order
-	return chat.Messages, nil
+	return messages, nil
 
 }
 
+// GetMessagesAfter walks a chat's history forwards from the cursor
+func (messageRepo *MessageRepository) GetMessagesAfter(ctx context.Context, chatID primitive.ObjectID, cursor domain.MessageCursor, limit int) ([]domain.Message, error) {
+
+	filter := cursorFilter(chatID, cursor, "$gt")
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "time", Value: 1}, {Key: "_id", Value: 1}}).
+		SetLimit(int64(limit))
+
+	return messageRepo.findMessages(ctx, filter, opts)
+
+}
+
+// cursorFilter matches the messages of a chat strictly before ($lt) or after ($gt) the cursor. Messages
+// sent at the cursor's time are ordered by ID when the cursor points at a message.
+func cursorFilter(chatID primitive.ObjectID, cursor domain.MessageCursor, operator string) bson.M {
+	if cursor.MessageID.IsZero() {
+		return bson.M{"chat_id": chatID, "time": bson.M{operator: cursor.Time}}
+	}
+	return bson.M{
+		"chat_id": chatID,
+		"$or": bson.A{
+			bson.M{"time": bson.M{operator: cursor.Time}},
+			bson.M{"time": cursor.Time, "_id": bson.M{operator: cursor.MessageID}},
+		},
+	}
+}
+
+func (messageRepo *MessageRepository) findMessages(ctx context.Context, filter bson.M, opts *options.FindOptions) ([]domain.Message, error) {
+	cursor, err := messageRepo.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return []domain.Message{}, fmt.Errorf("failed to fetch messages: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	messages := []domain.Message{}
+	for cursor.Next(ctx) {
+		var message domain.Message
+		if err := cursor.Decode(&message); err != nil {
+			return []domain.Message{}, fmt.Errorf("failed to decode message: %w", err)
+		}
+		messages = append(messages, message)
+	}
+	if err := cursor.Err(); err != nil {
+		return []domain.Message{}, fmt.Errorf("cursor error: %w", err)
+	}
+
+	return messages, nil
+}
+
 // Getmessage returns a specific message given the message id from a specific chat
-func(messageRepo *MessageRepository) GetMessage(ctx context.Context, chatID, messageID primitive.ObjectID) (domain.Message, error) {
+func (messageRepo *MessageRepository) GetMessage(ctx context.Context, chatID, messageID primitive.ObjectID) (domain.Message, error) {
 
 	collection := messageRepo.collection
 
-	// declare the parameters to retrieve the specified message from the chat list
-	filter := bson.M{"_id":chatID, "messages.messageID":messageID}
-	projection := bson.M{"messages.$": 1}
-	
-	// declare a list that will be type of message
-	var result []domain.Message
+	var message domain.Message
 
-	// retrieve the specified message from the database
-	err := collection.FindOne(ctx, filter, options.FindOne().SetProjection(projection)).Decode(&result)
+	err := collection.FindOne(ctx, bson.M{"_id": messageID, "chat_id": chatID}).Decode(&message)
 	if err != nil {
-		return domain.Message{}, fmt.Errorf("failed to fetch chat: %w", err)
+		if err == mongo.ErrNoDocuments {
+			return domain.Message{}, domain.ErrMessageNotFound
+		}
+		return domain.Message{}, fmt.Errorf("failed to fetch message: %w", err)
 	}
 
-	//if the message is found return the message
-	return result[0], nil
+	return message, nil
 
 }
 
-func(messageRepo *MessageRepository) DeleteMessage(ctx context.Context, chatID, messageID primitive.ObjectID) error{
+func (messageRepo *MessageRepository) DeleteMessage(ctx context.Context, chatID, messageID primitive.ObjectID) error {
 
 	collection := messageRepo.collection
 
-	// Pull the message from the "messages" array in the chat document
-	update := bson.M{
-		"$pull": bson.M{"messages": bson.M{"message_id": messageID}},
-		"$set":  bson.M{"updated_at": time.Now()},
-	}
-
-	// delete the message from the chat list inside the chat ID
-	result, err := collection.UpdateOne(ctx,bson.M{"_id": chatID}, update)
+	result, err := collection.DeleteOne(ctx, bson.M{"_id": messageID, "chat_id": chatID})
 	if err != nil {
 		return fmt.Errorf("failed to delete message: %w", err)
 	}
 
-	//if no entry was modified return an error message
-	if result.ModifiedCount == 0 {
-		return fmt.Errorf("message not found or already deleted")
+	//if no entry was deleted the message never existed or is already deleted
+	if result.DeletedCount == 0 {
+		return domain.ErrMessageNotFound
 	}
 
-	return nil
-	
+	return messageRepo.refreshPreview(ctx, chatID, messageID)
+
 }
 
 func (messageRepo *MessageRepository) UpdateMessage(ctx context.Context, chatID, messageID primitive.ObjectID, newContent string) error {
@@ -122,26 +178,109 @@ func (messageRepo *MessageRepository) UpdateMessage(ctx context.Context, chatID,
 	// Define the update query
 	update := bson.M{
 		"$set": bson.M{
-			"messages.$[elem].content": newContent, // Update the message content
-			"messages.$[elem].edited":  true,       // Mark the message as 
-			"updated_at": time.Now(),
+			"content": newContent, // Update the message content
+			"edited":  true,       // Mark the message as edited
 		},
 	}
 
-	// Define the filter to match the chat and the specific message inside the messages array
-	filter := bson.M{"_id": chatID}
-	arrayFilter := options.ArrayFilters{Filters: bson.A{bson.M{"elem.message_id": messageID}}}
-
 	// Execute the update
-	result, err := collection.UpdateOne(ctx, filter, update, &options.UpdateOptions{ArrayFilters: &arrayFilter})
+	result, err := collection.UpdateOne(ctx, bson.M{"_id": messageID, "chat_id": chatID}, update)
 	if err != nil {
 		return fmt.Errorf("failed to update message: %w", err)
 	}
 
-	// Check if any document was actually modified
-	if result.ModifiedCount == 0 {
-		return fmt.Errorf("message not found or already updated")
+	// Check if the message exists in the chat
+	if result.MatchedCount == 0 {
+		return domain.ErrMessageNotFound
+	}
+
+	// Keep the chat's preview in step when the latest message is edited
+	_, err = messageRepo.chatCollection.UpdateOne(ctx,
+		bson.M{"_id": chatID, "last_message.message_id": messageID},
+		bson.M{"$set": bson.M{"last_message.content": domain.PreviewContent(newContent)}},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update chat: %w", err)
 	}
 
 	return nil
-}
\ No newline at end of file
+}
+
+// refreshPreview replaces the preview of a chat whose latest message was deleted with the message
+// that is now the latest, or removes it when the chat is empty. Chats previewing another message are
+// not matched, so they are left alone.
+func (messageRepo *MessageRepository) refreshPreview(ctx context.Context, chatID, deletedID primitive.ObjectID) error {
+	var latest domain.Message
+	opts := options.FindOne().SetSort(bson.D{{Key: "time", Value: -1}, {Key: "_id", Value: -1}})
+	err := messageRepo.collection.FindOne(ctx, bson.M{"chat_id": chatID}, opts).Decode(&latest)
+
+	var update bson.M
+	switch {
+	case err == mongo.ErrNoDocuments:
+		update = bson.M{"$unset": bson.M{"last_message": ""}}
+	case err != nil:
+		return fmt.Errorf("failed to fetch message: %w", err)
+	default:
+		update = bson.M{"$set": bson.M{"last_message": domain.NewMessagePreview(latest)}}
+	}
+
+	_, err = messageRepo.chatCollection.UpdateOne(ctx, bson.M{"_id": chatID, "last_message.message_id": deletedID}, update)
+	if err != nil {
+		return fmt.Errorf("failed to update chat: %w", err)
+	}
+	return nil
+}
+
+// DeleteMessagesByChat removes the whole history of a chat
+func (messageRepo *MessageRepository) DeleteMessagesByChat(ctx context.Context, chatID primitive.ObjectID) error {
+	_, err := messageRepo.collection.DeleteMany(ctx, bson.M{"chat_id": chatID})
+	if err != nil {
+		return fmt.Errorf("failed to delete messages: %w", err)
+	}
+	return nil
+}
+
+// CountUnread counts the unread messages of every chat in a single aggregation. Each chat only
+// scans the part of its history after the cursor, using the (chat_id, time, _id) index.
+func (messageRepo *MessageRepository) CountUnread(ctx context.Context, userID primitive.ObjectID, since map[primitive.ObjectID]*domain.MessageCursor) (map[primitive.ObjectID]int64, error) {
+	counts := map[primitive.ObjectID]int64{}
+	if len(since) == 0 {
+		return counts, nil
+	}
+
+	chats := bson.A{}
+	for chatID, cursor := range since {
+		if cursor == nil {
+			chats = append(chats, bson.M{"chat_id": chatID})
+		} else {
+			chats = append(chats, cursorFilter(chatID, *cursor, "$gt"))
+		}
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"$or": chats, "sender_id": bson.M{"$ne": userID}}}},
+		{{Key: "$group", Value: bson.M{"_id": "$chat_id", "unread": bson.M{"$sum": 1}}}},
+	}
+
+	cursor, err := messageRepo.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count unread messages: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var result struct {
+			ChatID primitive.ObjectID `bson:"_id"`
+			Unread int64              `bson:"unread"`
+		}
+		if err := cursor.Decode(&result); err != nil {
+			return nil, fmt.Errorf("failed to decode unread count: %w", err)
+		}
+		counts[result.ChatID] = result.Unread
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, fmt.Errorf("cursor error: %w", err)
+	}
+
+	return counts, nil
+}
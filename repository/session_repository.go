@@ -0,0 +1,112 @@
+package repository
+
+import (
+	"Real-Time-Chat-Application/domain"
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type SessionRepository struct {
+	collection CollectionInterface
+}
+
+func NewSessionRepository(collection CollectionInterface) domain.SessionRepository {
+	return &SessionRepository{collection: collection}
+}
+
+func (sessionRepo *SessionRepository) CreateSession(ctx context.Context, session *domain.Session) error {
+	if session.SessionID.IsZero() {
+		session.SessionID = primitive.NewObjectID()
+	}
+	_, err := sessionRepo.collection.InsertOne(ctx, session)
+	if err != nil {
+		return fmt.Errorf("failed to create session: %w", err)
+	}
+	return nil
+}
+
+func (sessionRepo *SessionRepository) GetSession(ctx context.Context, sessionID primitive.ObjectID) (*domain.Session, error) {
+	var session domain.Session
+	err := sessionRepo.collection.FindOne(ctx, bson.M{"_id": sessionID}).Decode(&session)
+	if err == mongo.ErrNoDocuments {
+		return nil, domain.ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch session: %w", err)
+	}
+	return &session, nil
+}
+
+func (sessionRepo *SessionRepository) GetSessionsByUserID(ctx context.Context, userID primitive.ObjectID) ([]domain.Session, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "last_active_at", Value: -1}, {Key: "_id", Value: -1}})
+	cursor, err := sessionRepo.collection.Find(ctx, bson.M{"user_id": userID}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch sessions: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	sessions := []domain.Session{}
+	for cursor.Next(ctx) {
+		var session domain.Session
+		if err := cursor.Decode(&session); err != nil {
+			return nil, fmt.Errorf("failed to decode session: %w", err)
+		}
+		sessions = append(sessions, session)
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, fmt.Errorf("cursor error: %w", err)
+	}
+	return sessions, nil
+}
+
+// RotateSession matches on the current hash as well as the ID, which makes the swap atomic
+func (sessionRepo *SessionRepository) RotateSession(ctx context.Context, sessionID primitive.ObjectID, refreshTokenHash string, update *domain.Session) error {
+	result, err := sessionRepo.collection.UpdateOne(ctx,
+		bson.M{"_id": sessionID, "refresh_token_hash": refreshTokenHash},
+		bson.M{"$set": bson.M{
+			"refresh_token_hash": update.RefreshTokenHash,
+			"ip":                 update.IP,
+			"user_agent":         update.UserAgent,
+			"last_active_at":     update.LastActiveAt,
+			"expires_at":         update.ExpiresAt,
+		}})
+	if err != nil {
+		return fmt.Errorf("failed to update session: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return domain.ErrSessionNotFound
+	}
+	return nil
+}
+
+func (sessionRepo *SessionRepository) DeleteSession(ctx context.Context, userID, sessionID primitive.ObjectID) error {
+	result, err := sessionRepo.collection.DeleteOne(ctx, bson.M{"_id": sessionID, "user_id": userID})
+	if err != nil {
+		return fmt.Errorf("failed to delete session: %w", err)
+	}
+	if result.DeletedCount == 0 {
+		return domain.ErrSessionNotFound
+	}
+	return nil
+}
+
+func (sessionRepo *SessionRepository) DeleteSessions(ctx context.Context, userID primitive.ObjectID) error {
+	_, err := sessionRepo.collection.DeleteMany(ctx, bson.M{"user_id": userID})
+	if err != nil {
+		return fmt.Errorf("failed to delete sessions: %w", err)
+	}
+	return nil
+}
+
+func (sessionRepo *SessionRepository) DeleteOtherSessions(ctx context.Context, userID, sessionID primitive.ObjectID) error {
+	_, err := sessionRepo.collection.DeleteMany(ctx, bson.M{"user_id": userID, "_id": bson.M{"$ne": sessionID}})
+	if err != nil {
+		return fmt.Errorf("failed to delete sessions: %w", err)
+	}
+	return nil
+}
@@ -2,12 +2,13 @@ package repository
 
 import (
 	"Real-Time-Chat-Application/domain"
-	"Real-Time-Chat-Application/utils"
 	"context"
 	"fmt"
+	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 type UserRepository struct {
@@ -22,7 +23,16 @@ func(userrepo *UserRepository) CreateUser(ctx context.Context, user *domain.User
 
 	collection := userrepo.collection
 
+	// The _id of a user is never omitted, so it must be set before inserting
+	if user.UserID.IsZero() {
+		user.UserID = primitive.NewObjectID()
+	}
+
+	// the unique indexes on email and username reject a taken one
 	result, err := collection.InsertOne(ctx, user)
+	if mongo.IsDuplicateKeyError(err) {
+		return primitive.NilObjectID, domain.ErrUserExists
+	}
 	if err != nil {
 		return primitive.NilObjectID, err
 	}
@@ -37,6 +47,9 @@ func(userrepo *UserRepository) GetUserByID(ctx context.Context, userID primitive
 	var user domain.User
 
 	err := collection.FindOne(ctx, bson.M{"_id": userID}).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return nil, domain.ErrUserNotFound
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -51,6 +64,9 @@ func(userrepo *UserRepository) GetUserByEmail(ctx context.Context, email string)
 	var user domain.User
 
 	err := collection.FindOne(ctx, bson.M{"email": email}).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return nil, domain.ErrUserNotFound
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -65,6 +81,9 @@ func(userrepo *UserRepository) GetUserByUsername(ctx context.Context, username s
 	var user domain.User
 
 	err := collection.FindOne(ctx, bson.M{"username": username}).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return nil, domain.ErrUserNotFound
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -83,24 +102,25 @@ func(userrepo *UserRepository) UpdateUser(ctx context.Context, userID primitive.
 	}
 
 	if user.Password != "" {
-		hashedPassword, err := utils.HashPassword(user.Password)
-		if err != nil {
-			return fmt.Errorf("Failed to hash the password %w", err)
-		}
-		updatedFields["password"] = hashedPassword
+		updatedFields["password"] = user.Password
 	}
 
 	if len(updatedFields) == 0{
-		return fmt.Errorf("No fields provided for update")
+		return domain.ErrNothingToUpdate
 	}
 
 	update := bson.M{"$set": updatedFields}
 
-	_, err := collection.UpdateOne(ctx,bson.M{"_id":userID},update)
-
+	result, err := collection.UpdateOne(ctx,bson.M{"_id":userID},update)
+	if mongo.IsDuplicateKeyError(err) {
+		return domain.ErrUserExists
+	}
 	if err != nil {
 		return fmt.Errorf("Failed to update the user %w", err)
 	}
+	if result.MatchedCount == 0 {
+		return domain.ErrUserNotFound
+	}
 
 	return nil
 }
@@ -108,11 +128,104 @@ func(userrepo *UserRepository) DeleteUser(ctx context.Context, userID primitive.
 
 	collection := userrepo.collection
 
-	_, err := collection.DeleteOne(ctx, bson.M{"_id": userID})
+	result, err := collection.DeleteOne(ctx, bson.M{"_id": userID})
 
 	if err != nil {
 		return fmt.Errorf("Failed to delete the user %w", err)
 	}
+	if result.DeletedCount == 0 {
+		return domain.ErrUserNotFound
+	}
+
+	return nil
+}
+
+func(userrepo *UserRepository) GetUsersByIDs(ctx context.Context, userIDs []primitive.ObjectID) ([]domain.User, error){
+
+	collection := userrepo.collection
+
+	cursor, err := collection.Find(ctx, bson.M{"_id": bson.M{"$in": userIDs}})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to fetch the users %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	users := []domain.User{}
+	for cursor.Next(ctx) {
+		var user domain.User
+		if err := cursor.Decode(&user); err != nil {
+			return nil, fmt.Errorf("Failed to decode the user %w", err)
+		}
+		users = append(users, user)
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, fmt.Errorf("cursor error: %w", err)
+	}
+
+	return users, nil
+}
+func(userrepo *UserRepository) UpdateLastSeen(ctx context.Context, userID primitive.ObjectID, lastSeen time.Time) error{
+
+	collection := userrepo.collection
+
+	_, err := collection.UpdateOne(ctx, bson.M{"_id": userID}, bson.M{"$set": bson.M{"last_seen": lastSeen}})
+	if err != nil {
+		return fmt.Errorf("Failed to update the last seen time %w", err)
+	}
+
+	return nil
+}
 
+func(userrepo *UserRepository) MarkEmailVerified(ctx context.Context, userID primitive.ObjectID) error{
+	result, err := userrepo.collection.UpdateOne(ctx, bson.M{"_id": userID}, bson.M{"$set": bson.M{"email_verified": true}})
+	if err != nil {
+		return fmt.Errorf("Failed to verify the email %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return domain.ErrUserNotFound
+	}
 	return nil
-}
\ No newline at end of file
+}
+
+func(userrepo *UserRepository) SetTwoFactor(ctx context.Context, userID primitive.ObjectID, twoFactor *domain.TwoFactor) error{
+	update := bson.M{"$set": bson.M{"two_factor": twoFactor}}
+	if twoFactor == nil {
+		update = bson.M{"$unset": bson.M{"two_factor": ""}}
+	}
+
+	result, err := userrepo.collection.UpdateOne(ctx, bson.M{"_id": userID}, update)
+	if err != nil {
+		return fmt.Errorf("Failed to update two-factor authentication %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return domain.ErrUserNotFound
+	}
+	return nil
+}
+
+// UseTOTPStep only moves last_used_step forward, so of two logins with the same code only one matches
+func(userrepo *UserRepository) UseTOTPStep(ctx context.Context, userID primitive.ObjectID, step int64) error{
+	result, err := userrepo.collection.UpdateOne(ctx,
+		bson.M{"_id": userID, "two_factor.enabled": true, "two_factor.last_used_step": bson.M{"$lt": step}},
+		bson.M{"$set": bson.M{"two_factor.last_used_step": step}})
+	if err != nil {
+		return fmt.Errorf("Failed to record the two-factor code %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return domain.ErrInvalidTwoFactorCode
+	}
+	return nil
+}
+
+func(userrepo *UserRepository) UseRecoveryCode(ctx context.Context, userID primitive.ObjectID, hash string) error{
+	result, err := userrepo.collection.UpdateOne(ctx,
+		bson.M{"_id": userID, "two_factor.enabled": true, "two_factor.recovery_codes": hash},
+		bson.M{"$pull": bson.M{"two_factor.recovery_codes": hash}})
+	if err != nil {
+		return fmt.Errorf("Failed to use the recovery code %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return domain.ErrInvalidTwoFactorCode
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package repository
+
+import (
+	"Real-Time-Chat-Application/domain"
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type UserTokenRepository struct {
+	collection CollectionInterface
+}
+
+func NewUserTokenRepository(collection CollectionInterface) domain.UserTokenRepository {
+	return &UserTokenRepository{collection: collection}
+}
+
+func (tokenRepo *UserTokenRepository) CreateToken(ctx context.Context, token *domain.UserToken) error {
+	result, err := tokenRepo.collection.InsertOne(ctx, token)
+	if err != nil {
+		return fmt.Errorf("failed to create token: %w", err)
+	}
+	token.TokenID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+// ConsumeToken finds the token, then deletes it by ID. The delete is what makes it single use:
+// only one of two concurrent calls finding the token deletes it.
+func (tokenRepo *UserTokenRepository) ConsumeToken(ctx context.Context, purpose, hash string, now time.Time) (*domain.UserToken, error) {
+	var token domain.UserToken
+	err := tokenRepo.collection.FindOne(ctx, bson.M{
+		"purpose":    purpose,
+		"hash":       hash,
+		"expires_at": bson.M{"$gt": now},
+	}).Decode(&token)
+	if err == mongo.ErrNoDocuments {
+		return nil, domain.ErrInvalidUserToken
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch token: %w", err)
+	}
+
+	result, err := tokenRepo.collection.DeleteOne(ctx, bson.M{"_id": token.TokenID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete token: %w", err)
+	}
+	if result.DeletedCount == 0 {
+		return nil, domain.ErrInvalidUserToken
+	}
+
+	return &token, nil
+}
+
+func (tokenRepo *UserTokenRepository) DeleteTokens(ctx context.Context, userID primitive.ObjectID, purpose string) error {
+	_, err := tokenRepo.collection.DeleteMany(ctx, bson.M{"user_id": userID, "purpose": purpose})
+	if err != nil {
+		return fmt.Errorf("failed to delete tokens: %w", err)
+	}
+	return nil
+}
+
+func (tokenRepo *UserTokenRepository) LatestTokenTime(ctx context.Context, userID primitive.ObjectID, purpose string) (time.Time, error) {
+	var token domain.UserToken
+	opts := options.FindOne().SetSort(bson.D{{Key: "created_at", Value: -1}})
+	err := tokenRepo.collection.FindOne(ctx, bson.M{"user_id": userID, "purpose": purpose}, opts).Decode(&token)
+	if err == mongo.ErrNoDocuments {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to fetch token: %w", err)
+	}
+	return token.CreatedAt, nil
+}
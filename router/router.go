@@ -0,0 +1,124 @@
+package router
+
+import (
+	"Real-Time-Chat-Application/controller"
+	"Real-Time-Chat-Application/domain"
+	"Real-Time-Chat-Application/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// NewRouter registers every HTTP and websocket route of the application.
+// Routes marked with * are public; every other route requires an access token in the
+// "Authorization: Bearer <token>" header (or the "token" query parameter for /ws) whose
+// session sessions still holds active.
+//
+// Route table:
+//
+//	POST   /users                                       create a user *
+//	POST   /users/login                                 exchange email and password for tokens or a two-factor challenge *
+//	POST   /users/login/two-factor                      exchange a two-factor challenge and code for tokens *
+//	POST   /users/refresh                               exchange a refresh token for new tokens *
+//	POST   /users/password/forgot                       mail a password reset token *
+//	POST   /users/password/reset                        set a new password with a reset token *
+//	POST   /users/verify-email                          verify the email of a user with a mailed token *
+//	POST   /users/verify-email/resend                   mail the caller a new verification token
+//	GET    /users/presence?ids=                         get the presence of up to 100 users
+//	GET    /users/:id                                   get a user by ID
+//	GET    /users/email/:email                          get a user by email
+//	GET    /users/username/:username                    get a user by username
+//	PUT    /users/:id                                   update the caller
+//	PUT    /users/:id/password                          change the caller's password, given the current one
+//	GET    /users/:id/two-factor                        get a user's two-factor status, for the user or an admin
+//	POST   /users/two-factor/setup                      start the caller's two-factor setup
+//	POST   /users/two-factor/confirm                    turn the caller's two-factor authentication on with a code
+//	POST   /users/two-factor/disable                    turn the caller's two-factor authentication off with a code
+//	GET    /users/sessions                              list the devices the caller is signed in on
+//	DELETE /users/sessions/:session_id                  sign one of the caller's devices out
+//	DELETE /users/sessions                              sign the caller out everywhere
+//	DELETE /users/:id                                   delete the caller and sign them out everywhere
+//
+//	POST   /chats                                       create a chat between two users, or a group with member_ids; requires a verified email
+//	GET    /chats                                       list the caller's chats with previews and unread counts
+//	GET    /chats/:chat_id                              get a chat
+//	PUT    /chats/:chat_id                              rename a group or change its settings
+//	DELETE /chats/:chat_id                              delete a chat
+//	GET    /chats/user/:user_id                         list the chats of a user
+//	GET    /chats/participants/:sender_id/:receiver_id  get the chat between two users
+//	POST   /chats/:chat_id/read                         move the caller's read marker to a message
+//	POST   /chats/:chat_id/members                      add members to a group
+//	DELETE /chats/:chat_id/members/:user_id             remove a member from a group
+//	PUT    /chats/:chat_id/members/:user_id/role        change the role of a member of a group
+//	POST   /chats/:chat_id/leave                        leave a group
+//
+//	POST   /chats/:chat_id/messages                     send a message
+//	GET    /chats/:chat_id/messages                     list the messages of a chat, paginated with ?before, ?after and ?limit
+//	GET    /chats/:chat_id/messages/:message_id         get a message
+//	PUT    /chats/:chat_id/messages/:message_id         edit a message
+//	DELETE /chats/:chat_id/messages/:message_id         delete a message
+//
+//	GET    /ws                                          upgrade to a websocket connection
+func NewRouter(tokenService domain.TokenService, sessions domain.SessionChecker, userController *controller.UserController, chatController *controller.ChatController, messageController *controller.MessageController) *gin.Engine {
+	// gin.Default's logger would print the access token websocket clients pass in the query
+	r := gin.New()
+	r.Use(middleware.RequestLogger(), gin.Recovery())
+	// Trust no proxy until told otherwise, so clients cannot choose the IP recorded for their
+	// session with an X-Forwarded-For header. SetTrustedProxies(nil) cannot fail.
+	_ = r.SetTrustedProxies(nil)
+
+	public := r.Group("")
+	{
+		public.POST("/users", userController.CreateUser)
+		public.POST("/users/login", userController.Login)
+		public.POST("/users/login/two-factor", userController.LoginTwoFactor)
+		public.POST("/users/refresh", userController.RefreshToken)
+		public.POST("/users/password/forgot", userController.ForgotPassword)
+		public.POST("/users/password/reset", userController.ResetPassword)
+		public.POST("/users/verify-email", userController.VerifyEmail)
+	}
+
+	users := r.Group("/users", middleware.AuthMiddleware(tokenService, sessions))
+	{
+		users.GET("/presence", userController.GetPresence)
+		users.POST("/two-factor/setup", userController.SetupTwoFactor)
+		users.POST("/two-factor/confirm", userController.ConfirmTwoFactor)
+		users.POST("/two-factor/disable", userController.DisableTwoFactor)
+		users.GET("/sessions", userController.ListSessions)
+		users.DELETE("/sessions", userController.RevokeAllSessions)
+		users.DELETE("/sessions/:session_id", userController.RevokeSession)
+		users.POST("/verify-email/resend", userController.ResendVerification)
+		users.GET("/:id", userController.GetUserByID)
+		users.GET("/email/:email", userController.GetUserByEmail)
+		users.GET("/username/:username", userController.GetUserByUsername)
+		users.PUT("/:id", userController.UpdateUser)
+		users.PUT("/:id/password", userController.ChangePassword)
+		users.GET("/:id/two-factor", userController.GetTwoFactorStatus)
+		users.DELETE("/:id", userController.DeleteUser)
+	}
+
+	chats := r.Group("/chats", middleware.AuthMiddleware(tokenService, sessions))
+	{
+		chats.POST("", chatController.CreateChat)
+		chats.GET("", chatController.ListChats)
+		chats.GET("/:chat_id", chatController.GetChat)
+		chats.PUT("/:chat_id", chatController.UpdateChat)
+		chats.DELETE("/:chat_id", chatController.DeleteChat)
+		chats.GET("/user/:user_id", chatController.GetUserChats)
+		chats.GET("/participants/:sender_id/:receiver_id", chatController.GetChatByParticipants)
+		chats.POST("/:chat_id/read", chatController.MarkRead)
+		chats.POST("/:chat_id/members", chatController.AddMembers)
+		chats.DELETE("/:chat_id/members/:user_id", chatController.RemoveMember)
+		chats.PUT("/:chat_id/members/:user_id/role", chatController.SetMemberRole)
+		chats.POST("/:chat_id/leave", chatController.LeaveChat)
+
+		chats.POST("/:chat_id/messages", messageController.SendMessage)
+		chats.GET("/:chat_id/messages", messageController.GetMessages)
+		chats.GET("/:chat_id/messages/:message_id", messageController.GetMessage)
+		chats.PUT("/:chat_id/messages/:message_id", messageController.UpdateMessage)
+		chats.DELETE("/:chat_id/messages/:message_id", messageController.DeleteMessage)
+	}
+
+	r.GET("/ws", middleware.WebSocketAuthMiddleware(tokenService, sessions), messageController.HandleWebSocket)
+
+	return r
+}
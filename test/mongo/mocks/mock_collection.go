@@ -40,3 +40,12 @@ func (m *MockCollection) DeleteOne(ctx context.Context, filter interface{}, opts
 	return args.Get(0).(*mongo.DeleteResult), args.Error(1)
 }
 
+func (m *MockCollection) DeleteMany(ctx context.Context, filter interface{}, opts ...*options.DeleteOptions) (*mongo.DeleteResult, error) {
+	args := m.Called(ctx, filter)
+	return args.Get(0).(*mongo.DeleteResult), args.Error(1)
+}
+
+func (m *MockCollection) Aggregate(ctx context.Context, pipeline interface{}, opts ...*options.AggregateOptions) (repository.CursorInterface, error) {
+	args := m.Called(ctx, pipeline)
+	return args.Get(0).(repository.CursorInterface), args.Error(1)
+}
@@ -3,6 +3,8 @@ package test
 import (
 	"Real-Time-Chat-Application/controller"
 	"Real-Time-Chat-Application/domain"
+	"Real-Time-Chat-Application/httperr"
+	"Real-Time-Chat-Application/middleware"
 	"Real-Time-Chat-Application/test/test_usecase/mocks"
 	websocket "Real-Time-Chat-Application/websocket"
 	"bytes"
@@ -26,10 +28,11 @@ func TestCreateChat(t *testing.T) {
 	senderID := primitive.NewObjectID()
 	receiverID := primitive.NewObjectID()
 
-	mockChatUsecase.On("CreateChat", mock.Anything, senderID, receiverID).Return(chatID, nil)
+	mockChatUsecase.On("CreateChat", mock.Anything, senderID, receiverID).Return(chatID, true, nil)
 
 	w := httptest.NewRecorder()
 	c, _ := gin.CreateTestContext(w)
+	c.Set(middleware.UserIDKey, senderID)
 
 	// Create request body
 	reqBody := map[string]string{
@@ -49,26 +52,81 @@ func TestCreateChat(t *testing.T) {
 	mockChatUsecase.AssertExpectations(t)
 }
 
+func TestCreateExistingChat(t *testing.T) {
+	mockChatUsecase := new(mocks.MockChatUsecase)
+	chatID := primitive.NewObjectID()
+	senderID := primitive.NewObjectID()
+	receiverID := primitive.NewObjectID()
+
+	// Opening a direct chat again returns the existing one
+	mockChatUsecase.On("CreateChat", mock.Anything, senderID, receiverID).Return(chatID, false, nil)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Set(middleware.UserIDKey, senderID)
+	c.Request = httptest.NewRequest("POST", "/chats", bytes.NewBufferString(`{"receiver_id":"`+receiverID.Hex()+`"}`))
+
+	controller.NewChatController(mockChatUsecase, &websocket.Hub{}).CreateChat(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"chat_id":"`+chatID.Hex()+`"}`, w.Body.String())
+}
+
+func TestCreateChatSubscribesParticipants(t *testing.T) {
+	chatID := primitive.NewObjectID()
+	senderID := primitive.NewObjectID()
+	receiverID := primitive.NewObjectID()
+
+	mockChatUsecase := new(mocks.MockChatUsecase)
+	mockMessageUsecase := new(mocks.MockMessageUsecase)
+	hub, _ := runningHubWithObserver(t, primitive.NewObjectID())
+	sender := connectedUser(t, hub, senderID)
+	receiver := connectedUser(t, hub, receiverID)
+	mockChatUsecase.On("CreateChat", mock.Anything, senderID, receiverID).Return(chatID, true, nil)
+	mockMessageUsecase.On("SendMessage", mock.Anything, chatID, mock.AnythingOfType("*domain.Message")).Return(nil)
+
+	r := gin.New()
+	r.Use(authenticatedAs(senderID))
+	r.POST("/chats", controller.NewChatController(mockChatUsecase, hub).CreateChat)
+	r.POST("/chats/:chat_id/messages", controller.NewMessageController(mockMessageUsecase, hub).SendMessage)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("POST", "/chats", bytes.NewBufferString(`{"receiver_id":"`+receiverID.Hex()+`"}`)))
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	// Both users' connections opened before the chat existed receive its messages
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("POST", "/chats/"+chatID.Hex()+"/messages", bytes.NewBufferString(`{"content":"Hello"}`)))
+	assert.Equal(t, http.StatusOK, w.Code)
+	for _, client := range []*websocket.Client{sender, receiver} {
+		event := nextEvent(t, client)
+		assert.Equal(t, websocket.EventMessageCreated, event.Type)
+		assert.Equal(t, chatID.Hex(), event.ChatID)
+		assert.Contains(t, string(event.Payload), "Hello")
+	}
+}
+
 func TestGetChat(t *testing.T) {
     mockChatUsecase := new(mocks.MockChatUsecase)
     mockHub := &websocket.Hub{} // Create mock hub
     chatID := primitive.NewObjectID()
+    userID := primitive.NewObjectID()
 
     // Creating the expected chat
     expectedChat := &domain.Chat{
         ChatID:       chatID,
-        Participants: []primitive.ObjectID{primitive.NewObjectID(), primitive.NewObjectID()},
-        Messages:     []domain.Message{},
+        Participants: []primitive.ObjectID{userID, primitive.NewObjectID()},
         CreatedAt:    time.Now(),
         UpdatedAt:    time.Now(),
     }
 
     // Mock the GetChat method to return the expected chat
-    mockChatUsecase.On("GetChat", mock.Anything, chatID).Return(expectedChat, nil)
+    mockChatUsecase.On("GetChat", mock.Anything, userID, chatID).Return(expectedChat, nil)
 
     // Creating a response recorder and test context
     w := httptest.NewRecorder()
     c, _ := gin.CreateTestContext(w)
+    c.Set(middleware.UserIDKey, userID)
 
     // Create a test request
     req := httptest.NewRequest("GET", "/chats/"+chatID.Hex(), nil)
@@ -99,7 +157,6 @@ func TestGetChatsByUserID(t *testing.T) {
 		{
 			ChatID:       primitive.NewObjectID(),
 			Participants: []primitive.ObjectID{userID, primitive.NewObjectID()},
-			Messages:     []domain.Message{},
 			CreatedAt:    time.Now(),
 			UpdatedAt:    time.Now(),
 		},
@@ -109,6 +166,7 @@ func TestGetChatsByUserID(t *testing.T) {
 
 	w := httptest.NewRecorder()
 	c, _ := gin.CreateTestContext(w)
+	c.Set(middleware.UserIDKey, userID)
 	
 	// Create request with user_id param
 	req := httptest.NewRequest("GET", "/chats/user/"+userID.Hex(), nil)
@@ -125,47 +183,75 @@ func TestGetChatsByUserID(t *testing.T) {
 	mockChatUsecase.AssertExpectations(t)
 }
 
+func TestListChats(t *testing.T) {
+	mockChatUsecase := new(mocks.MockChatUsecase)
+	userID := primitive.NewObjectID()
+	expectedChats := []domain.ChatSummary{
+		{
+			ChatID:       primitive.NewObjectID(),
+			Participants: []primitive.ObjectID{primitive.NewObjectID()},
+			LastMessage:  &domain.MessagePreview{MessageID: primitive.NewObjectID(), Content: "Hello", Time: time.Now().UTC()},
+			LastActivity: time.Now().UTC(),
+			UnreadCount:  3,
+		},
+	}
+
+	mockChatUsecase.On("ListChats", mock.Anything, userID).Return(expectedChats, nil)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Set(middleware.UserIDKey, userID)
+	c.Request = httptest.NewRequest("GET", "/chats", nil)
+
+	chatController := controller.NewChatController(mockChatUsecase, &websocket.Hub{})
+	chatController.ListChats(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var chats []domain.ChatSummary
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &chats))
+	assert.Equal(t, expectedChats, chats)
+	mockChatUsecase.AssertExpectations(t)
+}
+
 func TestUpdateChat(t *testing.T) {
 	mockChatUsecase := new(mocks.MockChatUsecase)
 	mockHub := &websocket.Hub{} // Create mock hub
 	chatID := primitive.NewObjectID()
-	updatedChat := &domain.Chat{
-		ChatID:       chatID,
-		Participants: []primitive.ObjectID{primitive.NewObjectID(), primitive.NewObjectID()},
-		Messages:     []domain.Message{},
-		CreatedAt:    time.Now(),
-		UpdatedAt:    time.Now(),
-	}
-
-	// Create a copy of updatedChat for the mock expectation
-	expectedChat := &domain.Chat{
-		ChatID:       updatedChat.ChatID,
-		Participants: updatedChat.Participants,
-		Messages:     updatedChat.Messages,
-		CreatedAt:    updatedChat.CreatedAt,
-		UpdatedAt:    updatedChat.UpdatedAt,
+	userID := primitive.NewObjectID()
+	storedChat := &domain.Chat{
+		ChatID:           chatID,
+		Type:             domain.ChatTypeGroup,
+		Participants:     []primitive.ObjectID{userID, primitive.NewObjectID()},
+		Title:            "Renamed",
+		Avatar:           "https://example.com/a.png",
+		AnnouncementOnly: true,
+		CreatedAt:        time.Now().UTC().Truncate(time.Millisecond),
+		UpdatedAt:        time.Now().UTC().Truncate(time.Millisecond),
 	}
 
-	mockChatUsecase.On("UpdateChat", mock.Anything, chatID, mock.MatchedBy(func(chat *domain.Chat) bool {
-		return chat.ChatID == expectedChat.ChatID &&
-			len(chat.Participants) == len(expectedChat.Participants) &&
-			len(chat.Messages) == len(expectedChat.Messages)
-	})).Return(nil)
+	// Only the title is sent, so only the title is passed on
+	mockChatUsecase.On("UpdateChat", mock.Anything, userID, chatID, mock.MatchedBy(func(settings domain.ChatSettings) bool {
+		return settings.Title != nil && *settings.Title == "Renamed" && settings.Avatar == nil && settings.AnnouncementOnly == nil
+	})).Return(storedChat, nil)
 
 	w := httptest.NewRecorder()
 	c, _ := gin.CreateTestContext(w)
+	c.Set(middleware.UserIDKey, userID)
 	c.Params = []gin.Param{{Key: "chat_id", Value: chatID.Hex()}}
 
-	jsonBody, _ := json.Marshal(updatedChat)
-	c.Request = httptest.NewRequest("PUT", "/chats/"+chatID.Hex(), bytes.NewBuffer(jsonBody))
+	c.Request = httptest.NewRequest("PUT", "/chats/"+chatID.Hex(), bytes.NewBufferString(`{"title": "Renamed"}`))
 	c.Request.Header.Set("Content-Type", "application/json")
 
 	// Test the handler
 	chatController := controller.NewChatController(mockChatUsecase, mockHub)
 	chatController.UpdateChat(c)
-	
+
 	assert.Equal(t, http.StatusOK, w.Code)
 
+	// The stored chat is returned, including the settings the request left out
+	var chat domain.Chat
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &chat))
+	assert.Equal(t, *storedChat, chat)
 	mockChatUsecase.AssertExpectations(t)
 }
 
@@ -173,11 +259,13 @@ func TestDeleteChat(t *testing.T) {
 	mockChatUsecase := new(mocks.MockChatUsecase)
 	mockHub := &websocket.Hub{} // Create mock hub
 	chatID := primitive.NewObjectID()
+	userID := primitive.NewObjectID()
 
-	mockChatUsecase.On("DeleteChat", mock.Anything, chatID).Return(nil)
+	mockChatUsecase.On("DeleteChat", mock.Anything, userID, chatID).Return(nil)
 
 	w := httptest.NewRecorder()
 	c, _ := gin.CreateTestContext(w)
+	c.Set(middleware.UserIDKey, userID)
 	c.Params = []gin.Param{{Key: "chat_id", Value: chatID.Hex()}}
 
 	// Create request
@@ -201,7 +289,6 @@ func TestGetChatByParticipants(t *testing.T) {
 	expectedChat := &domain.Chat{
 		ChatID:       primitive.NewObjectID(),
 		Participants: []primitive.ObjectID{senderID, receiverID},
-		Messages:     []domain.Message{},
 		CreatedAt:    time.Now(),
 		UpdatedAt:    time.Now(),
 	}
@@ -210,6 +297,7 @@ func TestGetChatByParticipants(t *testing.T) {
 
 	w := httptest.NewRecorder()
 	c, _ := gin.CreateTestContext(w)
+	c.Set(middleware.UserIDKey, senderID)
 	c.Params = []gin.Param{
 		{Key: "sender_id", Value: senderID.Hex()},
 		{Key: "receiver_id", Value: receiverID.Hex()},
@@ -227,3 +315,331 @@ func TestGetChatByParticipants(t *testing.T) {
 
 	mockChatUsecase.AssertExpectations(t)
 }
+
+func TestGetChatForbidden(t *testing.T) {
+	mockChatUsecase := new(mocks.MockChatUsecase)
+	mockHub := &websocket.Hub{}
+	chatID := primitive.NewObjectID()
+	userID := primitive.NewObjectID()
+
+	mockChatUsecase.On("GetChat", mock.Anything, userID, chatID).Return(nil, domain.ErrForbidden)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Set(middleware.UserIDKey, userID)
+	c.Request = httptest.NewRequest("GET", "/chats/"+chatID.Hex(), nil)
+	c.Params = []gin.Param{{Key: "chat_id", Value: chatID.Hex()}}
+
+	chatController := controller.NewChatController(mockChatUsecase, mockHub)
+	chatController.GetChat(c)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	mockChatUsecase.AssertExpectations(t)
+}
+
+func TestGetChatNotFound(t *testing.T) {
+	mockChatUsecase := new(mocks.MockChatUsecase)
+	chatID := primitive.NewObjectID()
+	userID := primitive.NewObjectID()
+
+	mockChatUsecase.On("GetChat", mock.Anything, userID, chatID).Return(nil, fmt.Errorf("failed to get chat: %w", domain.ErrChatNotFound))
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Set(middleware.UserIDKey, userID)
+	c.Request = httptest.NewRequest("GET", "/chats/"+chatID.Hex(), nil)
+	c.Params = []gin.Param{{Key: "chat_id", Value: chatID.Hex()}}
+
+	chatController := controller.NewChatController(mockChatUsecase, &websocket.Hub{})
+	chatController.GetChat(c)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	var body httperr.Response
+	json.Unmarshal(w.Body.Bytes(), &body)
+	assert.Equal(t, httperr.CodeNotFound, body.Code)
+	mockChatUsecase.AssertExpectations(t)
+}
+
+func TestGetChatsOfAnotherUser(t *testing.T) {
+	mockChatUsecase := new(mocks.MockChatUsecase)
+	mockHub := &websocket.Hub{}
+	otherUserID := primitive.NewObjectID()
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Set(middleware.UserIDKey, primitive.NewObjectID())
+	c.Request = httptest.NewRequest("GET", "/chats/user/"+otherUserID.Hex(), nil)
+	c.Params = []gin.Param{{Key: "user_id", Value: otherUserID.Hex()}}
+
+	chatController := controller.NewChatController(mockChatUsecase, mockHub)
+	chatController.GetUserChats(c)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	mockChatUsecase.AssertNotCalled(t, "GetChatsByUserID", mock.Anything, otherUserID)
+}
+
+func TestMarkRead(t *testing.T) {
+	chatID := primitive.NewObjectID()
+	userID := primitive.NewObjectID()
+	messageID := primitive.NewObjectID()
+	marker := domain.ReadMarker{MessageID: messageID, MessageTime: time.Now(), ReadAt: time.Now()}
+
+	markRead := func(chatController *controller.ChatController, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Set(middleware.UserIDKey, userID)
+		c.Request = httptest.NewRequest("POST", "/chats/"+chatID.Hex()+"/read", bytes.NewBufferString(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		c.Params = []gin.Param{{Key: "chat_id", Value: chatID.Hex()}}
+		chatController.MarkRead(c)
+		return w
+	}
+
+	t.Run("Success", func(t *testing.T) {
+		mockChatUsecase := new(mocks.MockChatUsecase)
+		hub, observer := runningHubWithObserver(t, chatID)
+		mockChatUsecase.On("MarkRead", mock.Anything, userID, chatID, messageID).Return(marker, true, nil)
+
+		w := markRead(controller.NewChatController(mockChatUsecase, hub), `{"message_id":"`+messageID.Hex()+`"}`)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		mockChatUsecase.AssertExpectations(t)
+
+		// The other participants get a receipt
+		event := nextEvent(t, observer)
+		assert.Equal(t, websocket.EventReceipt, event.Type)
+		var receipt websocket.ReceiptPayload
+		assert.NoError(t, json.Unmarshal(event.Payload, &receipt))
+		assert.Equal(t, userID.Hex(), receipt.UserID)
+		assert.Equal(t, messageID.Hex(), receipt.MessageID)
+	})
+
+	t.Run("Marker not advanced", func(t *testing.T) {
+		mockChatUsecase := new(mocks.MockChatUsecase)
+		hub, observer := runningHubWithObserver(t, chatID)
+		mockChatUsecase.On("MarkRead", mock.Anything, userID, chatID, messageID).Return(marker, false, nil)
+
+		w := markRead(controller.NewChatController(mockChatUsecase, hub), `{"message_id":"`+messageID.Hex()+`"}`)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Empty(t, observer.SendChan)
+	})
+
+	t.Run("Missing message ID", func(t *testing.T) {
+		mockChatUsecase := new(mocks.MockChatUsecase)
+
+		w := markRead(controller.NewChatController(mockChatUsecase, &websocket.Hub{}), `{}`)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		mockChatUsecase.AssertNotCalled(t, "MarkRead", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("Not a participant", func(t *testing.T) {
+		mockChatUsecase := new(mocks.MockChatUsecase)
+		mockChatUsecase.On("MarkRead", mock.Anything, userID, chatID, messageID).Return(domain.ReadMarker{}, false, domain.ErrForbidden)
+
+		w := markRead(controller.NewChatController(mockChatUsecase, &websocket.Hub{}), `{"message_id":"`+messageID.Hex()+`"}`)
+
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+}
+
+// connectedUser registers a connection of a user following the given chats
+func connectedUser(t *testing.T, hub *websocket.Hub, userID primitive.ObjectID, chatIDs ...string) *websocket.Client {
+	client := websocket.NewClient(nil, userID.Hex(), chatIDs...)
+	hub.Register <- client
+	// Run handles one request at a time, so once this is accepted the client is registered
+	hub.Broadcast <- websocket.ChatMessage{ChatID: primitive.NilObjectID.Hex()}
+	return client
+}
+
+func TestCreateGroupChat(t *testing.T) {
+	creatorID := primitive.NewObjectID()
+	memberID := primitive.NewObjectID()
+	chat := &domain.Chat{
+		ChatID:       primitive.NewObjectID(),
+		Type:         domain.ChatTypeGroup,
+		Participants: []primitive.ObjectID{creatorID, memberID},
+		Title:        "Team",
+		CreatedBy:    creatorID,
+	}
+	message := domain.NewSystemMessage(creatorID, domain.SystemChatCreated, []primitive.ObjectID{memberID}, "created the group")
+
+	mockChatUsecase := new(mocks.MockChatUsecase)
+	hub, _ := runningHubWithObserver(t, primitive.NewObjectID())
+	member := connectedUser(t, hub, memberID)
+	mockChatUsecase.On("CreateGroupChat", mock.Anything, creatorID, []primitive.ObjectID{memberID}, "Team", "").Return(chat, &message, nil)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Set(middleware.UserIDKey, creatorID)
+	c.Request = httptest.NewRequest("POST", "/chats", bytes.NewBufferString(`{"member_ids":["`+memberID.Hex()+`"],"title":"Team"}`))
+	controller.NewChatController(mockChatUsecase, hub).CreateChat(c)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var created domain.Chat
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	assert.Equal(t, chat.ChatID, created.ChatID)
+	mockChatUsecase.AssertNotCalled(t, "CreateChat", mock.Anything, mock.Anything, mock.Anything)
+
+	// The member's open connection follows the new group
+	event := nextEvent(t, member)
+	assert.Equal(t, websocket.EventMessageCreated, event.Type)
+	assert.Equal(t, chat.ChatID.Hex(), event.ChatID)
+	assert.True(t, hub.IsSubscribed(member, chat.ChatID.Hex()))
+}
+
+func TestAddMembers(t *testing.T) {
+	chatID := primitive.NewObjectID()
+	userID := primitive.NewObjectID()
+	newID := primitive.NewObjectID()
+
+	addMembers := func(chatController *controller.ChatController, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Set(middleware.UserIDKey, userID)
+		c.Request = httptest.NewRequest("POST", "/chats/"+chatID.Hex()+"/members", bytes.NewBufferString(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		c.Params = []gin.Param{{Key: "chat_id", Value: chatID.Hex()}}
+		chatController.AddMembers(c)
+		return w
+	}
+
+	t.Run("Success", func(t *testing.T) {
+		mockChatUsecase := new(mocks.MockChatUsecase)
+		hub, observer := runningHubWithObserver(t, chatID)
+		newMember := connectedUser(t, hub, newID)
+		message := domain.NewSystemMessage(userID, domain.SystemMembersAdded, []primitive.ObjectID{newID}, "added members")
+		mockChatUsecase.On("AddMembers", mock.Anything, userID, chatID, []primitive.ObjectID{newID}).Return(&message, nil)
+
+		w := addMembers(controller.NewChatController(mockChatUsecase, hub), `{"user_ids":["`+newID.Hex()+`"]}`)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		// Both the existing members and the new one see the system message
+		assert.Equal(t, websocket.EventMessageCreated, nextEvent(t, observer).Type)
+		assert.Equal(t, websocket.EventMessageCreated, nextEvent(t, newMember).Type)
+	})
+
+	t.Run("Direct chat", func(t *testing.T) {
+		mockChatUsecase := new(mocks.MockChatUsecase)
+		mockChatUsecase.On("AddMembers", mock.Anything, userID, chatID, []primitive.ObjectID{newID}).Return(nil, domain.ErrNotGroup)
+
+		w := addMembers(controller.NewChatController(mockChatUsecase, &websocket.Hub{}), `{"user_ids":["`+newID.Hex()+`"]}`)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+func TestRemoveMember(t *testing.T) {
+	chatID := primitive.NewObjectID()
+	creatorID := primitive.NewObjectID()
+	memberID := primitive.NewObjectID()
+
+	removeMember := func(chatController *controller.ChatController) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Set(middleware.UserIDKey, creatorID)
+		c.Request = httptest.NewRequest("DELETE", "/chats/"+chatID.Hex()+"/members/"+memberID.Hex(), nil)
+		c.Params = []gin.Param{{Key: "chat_id", Value: chatID.Hex()}, {Key: "user_id", Value: memberID.Hex()}}
+		chatController.RemoveMember(c)
+		return w
+	}
+
+	t.Run("Success", func(t *testing.T) {
+		mockChatUsecase := new(mocks.MockChatUsecase)
+		hub, _ := runningHubWithObserver(t, chatID)
+		member := connectedUser(t, hub, memberID, chatID.Hex())
+		message := domain.NewSystemMessage(creatorID, domain.SystemMemberRemoved, []primitive.ObjectID{memberID}, "removed a member")
+		mockChatUsecase.On("RemoveMember", mock.Anything, creatorID, chatID, memberID).Return(&message, nil)
+
+		w := removeMember(controller.NewChatController(mockChatUsecase, hub))
+
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		// The removed member learns about it and then stops following the group
+		assert.Equal(t, websocket.EventMessageCreated, nextEvent(t, member).Type)
+		assert.False(t, hub.IsSubscribed(member, chatID.Hex()))
+	})
+
+	t.Run("Not allowed", func(t *testing.T) {
+		mockChatUsecase := new(mocks.MockChatUsecase)
+		mockChatUsecase.On("RemoveMember", mock.Anything, creatorID, chatID, memberID).Return(nil, domain.ErrForbidden)
+
+		w := removeMember(controller.NewChatController(mockChatUsecase, &websocket.Hub{}))
+
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+}
+
+func TestLeaveChat(t *testing.T) {
+	chatID := primitive.NewObjectID()
+	userID := primitive.NewObjectID()
+
+	// The last member leaving deletes the group, so there is nothing to broadcast
+	mockChatUsecase := new(mocks.MockChatUsecase)
+	hub, _ := runningHubWithObserver(t, chatID)
+	leaver := connectedUser(t, hub, userID, chatID.Hex())
+	mockChatUsecase.On("LeaveChat", mock.Anything, userID, chatID).Return(nil, nil)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Set(middleware.UserIDKey, userID)
+	c.Request = httptest.NewRequest("POST", "/chats/"+chatID.Hex()+"/leave", nil)
+	c.Params = []gin.Param{{Key: "chat_id", Value: chatID.Hex()}}
+	controller.NewChatController(mockChatUsecase, hub).LeaveChat(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.False(t, hub.IsSubscribed(leaver, chatID.Hex()))
+	assert.Empty(t, leaver.SendChan)
+	mockChatUsecase.AssertExpectations(t)
+}
+
+func TestSetMemberRole(t *testing.T) {
+	chatID := primitive.NewObjectID()
+	ownerID := primitive.NewObjectID()
+	memberID := primitive.NewObjectID()
+
+	setRole := func(chatController *controller.ChatController, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Set(middleware.UserIDKey, ownerID)
+		c.Request = httptest.NewRequest("PUT", "/chats/"+chatID.Hex()+"/members/"+memberID.Hex()+"/role", bytes.NewBufferString(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		c.Params = []gin.Param{{Key: "chat_id", Value: chatID.Hex()}, {Key: "user_id", Value: memberID.Hex()}}
+		chatController.SetMemberRole(c)
+		return w
+	}
+
+	t.Run("Success", func(t *testing.T) {
+		mockChatUsecase := new(mocks.MockChatUsecase)
+		hub, observer := runningHubWithObserver(t, chatID)
+		message := domain.NewSystemMessage(ownerID, domain.SystemRoleChanged, []primitive.ObjectID{memberID}, "changed a role")
+		message.System.Role = domain.RoleAdmin
+		mockChatUsecase.On("SetMemberRole", mock.Anything, ownerID, chatID, memberID, domain.RoleAdmin).Return(&message, nil)
+
+		w := setRole(controller.NewChatController(mockChatUsecase, hub), `{"role":"admin"}`)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"user_id":"`+memberID.Hex()+`","role":"admin"}`, w.Body.String())
+		assert.Equal(t, websocket.EventMessageCreated, nextEvent(t, observer).Type)
+	})
+
+	t.Run("Invalid role", func(t *testing.T) {
+		mockChatUsecase := new(mocks.MockChatUsecase)
+		mockChatUsecase.On("SetMemberRole", mock.Anything, ownerID, chatID, memberID, "superuser").Return(nil, domain.ErrInvalidRole)
+
+		w := setRole(controller.NewChatController(mockChatUsecase, &websocket.Hub{}), `{"role":"superuser"}`)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Missing role", func(t *testing.T) {
+		mockChatUsecase := new(mocks.MockChatUsecase)
+
+		w := setRole(controller.NewChatController(mockChatUsecase, &websocket.Hub{}), `{}`)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		mockChatUsecase.AssertNotCalled(t, "SetMemberRole", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+}
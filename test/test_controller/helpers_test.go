@@ -0,0 +1,51 @@
+package test
+
+import (
+	"Real-Time-Chat-Application/middleware"
+	"Real-Time-Chat-Application/websocket"
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// authenticatedAs stands in for the auth middleware and marks every request as coming from userID
+func authenticatedAs(userID primitive.ObjectID) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(middleware.UserIDKey, userID)
+		c.Next()
+	}
+}
+
+// runningHubWithObserver starts a hub with a client following chatID, so tests can inspect
+// what controllers broadcast. The hub is stopped when the test ends.
+func runningHubWithObserver(t *testing.T, chatID primitive.ObjectID) (*websocket.Hub, *websocket.Client) {
+	hub := websocket.NewHub(nil, nil, nil)
+	go hub.Run()
+	t.Cleanup(func() { hub.Stop(context.Background()) })
+
+	observer := websocket.NewClient(nil, "observer", chatID.Hex())
+	hub.Register <- observer
+	// Run handles one request at a time, so once this is accepted the observer is registered
+	hub.Broadcast <- websocket.ChatMessage{ChatID: primitive.NilObjectID.Hex()}
+
+	return hub, observer
+}
+
+// nextEvent returns the next event queued for a client
+func nextEvent(t *testing.T, client *websocket.Client) websocket.Envelope {
+	select {
+	case data := <-client.SendChan:
+		var envelope websocket.Envelope
+		if err := json.Unmarshal(data, &envelope); err != nil {
+			t.Fatalf("invalid event: %v", err)
+		}
+		return envelope
+	case <-time.After(time.Second):
+		t.Fatal("no event was broadcast")
+		return websocket.Envelope{}
+	}
+}
@@ -19,20 +19,24 @@ import (
 
 func TestSendMessage(t *testing.T) {
 	t.Run("Success", func(t *testing.T) {
+		chatID := primitive.NewObjectID()
 		mockMessageUsecase := new(mocks.MockMessageUsecase)
-		hub := websocket.NewHub()
+		hub, observer := runningHubWithObserver(t, chatID)
 		messageController := controller.NewMessageController(mockMessageUsecase, hub)
 
 		r := gin.Default()
+		userID := primitive.NewObjectID()
+		r.Use(authenticatedAs(userID))
 		r.POST("/chats/:chat_id/messages", messageController.SendMessage)
 
-		chatID := primitive.NewObjectID()
 		message := domain.Message{
 			Content:  "Test message",
 			SenderID: primitive.NewObjectID(),
 		}
 
-		mockMessageUsecase.On("SendMessage", mock.Anything, chatID, mock.AnythingOfType("*domain.Message")).Return(nil)
+		mockMessageUsecase.On("SendMessage", mock.Anything, chatID, mock.MatchedBy(func(m *domain.Message) bool {
+			return m.SenderID == userID
+		})).Return(nil)
 
 		jsonValue, _ := json.Marshal(message)
 		req, _ := http.NewRequest("POST", "/chats/"+chatID.Hex()+"/messages", bytes.NewBuffer(jsonValue))
@@ -42,14 +46,22 @@ func TestSendMessage(t *testing.T) {
 
 		assert.Equal(t, http.StatusOK, w.Code)
 		mockMessageUsecase.AssertExpectations(t)
+
+		// The chat is told about the new message in a typed envelope
+		event := nextEvent(t, observer)
+		assert.Equal(t, websocket.EventMessageCreated, event.Type)
+		assert.Equal(t, chatID.Hex(), event.ChatID)
+		assert.Contains(t, string(event.Payload), "Test message")
 	})
 
 	t.Run("Invalid Chat ID", func(t *testing.T) {
 		mockMessageUsecase := new(mocks.MockMessageUsecase)
-		hub := websocket.NewHub()
+		hub := websocket.NewHub(nil, nil, nil)
 		messageController := controller.NewMessageController(mockMessageUsecase, hub)
 
 		r := gin.Default()
+		userID := primitive.NewObjectID()
+		r.Use(authenticatedAs(userID))
 		r.POST("/chats/:chat_id/messages", messageController.SendMessage)
 
 		message := domain.Message{
@@ -68,10 +80,12 @@ func TestSendMessage(t *testing.T) {
 
 	t.Run("Internal Server Error", func(t *testing.T) {
 		mockMessageUsecase := new(mocks.MockMessageUsecase)
-		hub := websocket.NewHub()
+		hub := websocket.NewHub(nil, nil, nil)
 		messageController := controller.NewMessageController(mockMessageUsecase, hub)
 
 		r := gin.Default()
+		userID := primitive.NewObjectID()
+		r.Use(authenticatedAs(userID))
 		r.POST("/chats/:chat_id/messages", messageController.SendMessage)
 
 		chatID := primitive.NewObjectID()
@@ -96,10 +110,12 @@ func TestSendMessage(t *testing.T) {
 func TestGetMessages(t *testing.T) {
 	t.Run("Success", func(t *testing.T) {
 		mockMessageUsecase := new(mocks.MockMessageUsecase)
-		hub := websocket.NewHub()
+		hub := websocket.NewHub(nil, nil, nil)
 		messageController := controller.NewMessageController(mockMessageUsecase, hub)
 
 		r := gin.Default()
+		userID := primitive.NewObjectID()
+		r.Use(authenticatedAs(userID))
 		r.GET("/chats/:chat_id/messages", messageController.GetMessages)
 
 		chatID := primitive.NewObjectID()
@@ -116,7 +132,7 @@ func TestGetMessages(t *testing.T) {
 			},
 		}
 
-		mockMessageUsecase.On("GetMessages", mock.Anything, chatID).Return(expectedMessages, nil)
+		mockMessageUsecase.On("GetMessages", mock.Anything, userID, chatID).Return(expectedMessages, nil)
 
 		req, _ := http.NewRequest("GET", "/chats/"+chatID.Hex()+"/messages", nil)
 		w := httptest.NewRecorder()
@@ -131,12 +147,35 @@ func TestGetMessages(t *testing.T) {
 		mockMessageUsecase.AssertExpectations(t)
 	})
 
+	t.Run("Not a participant", func(t *testing.T) {
+		mockMessageUsecase := new(mocks.MockMessageUsecase)
+		hub := websocket.NewHub(nil, nil, nil)
+		messageController := controller.NewMessageController(mockMessageUsecase, hub)
+
+		r := gin.Default()
+		userID := primitive.NewObjectID()
+		r.Use(authenticatedAs(userID))
+		r.GET("/chats/:chat_id/messages", messageController.GetMessages)
+
+		chatID := primitive.NewObjectID()
+		mockMessageUsecase.On("GetMessages", mock.Anything, userID, chatID).Return(nil, domain.ErrForbidden)
+
+		req, _ := http.NewRequest("GET", "/chats/"+chatID.Hex()+"/messages", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		mockMessageUsecase.AssertExpectations(t)
+	})
+
 	t.Run("Invalid Chat ID", func(t *testing.T) {
 		mockMessageUsecase := new(mocks.MockMessageUsecase)
-		hub := websocket.NewHub()
+		hub := websocket.NewHub(nil, nil, nil)
 		messageController := controller.NewMessageController(mockMessageUsecase, hub)
 
 		r := gin.Default()
+		userID := primitive.NewObjectID()
+		r.Use(authenticatedAs(userID))
 		r.GET("/chats/:chat_id/messages", messageController.GetMessages)
 
 		req, _ := http.NewRequest("GET", "/chats/invalid_id/messages", nil)
@@ -147,19 +186,115 @@ func TestGetMessages(t *testing.T) {
 	})
 }
 
+func TestGetMessagesPaginated(t *testing.T) {
+	setup := func() (*mocks.MockMessageUsecase, *gin.Engine, primitive.ObjectID) {
+		mockMessageUsecase := new(mocks.MockMessageUsecase)
+		messageController := controller.NewMessageController(mockMessageUsecase, websocket.NewHub(nil, nil, nil))
+
+		r := gin.Default()
+		userID := primitive.NewObjectID()
+		r.Use(authenticatedAs(userID))
+		r.GET("/chats/:chat_id/messages", messageController.GetMessages)
+		return mockMessageUsecase, r, userID
+	}
+
+	t.Run("Before cursor", func(t *testing.T) {
+		mockMessageUsecase, r, userID := setup()
+
+		chatID := primitive.NewObjectID()
+		cursor := primitive.NewObjectID().Hex()
+		expectedPage := domain.MessagePage{
+			Messages:   []domain.Message{{MessageID: primitive.NewObjectID(), Content: "Test message"}},
+			NextCursor: primitive.NewObjectID().Hex(),
+			HasMore:    true,
+		}
+		mockMessageUsecase.On("GetMessagesBefore", mock.Anything, userID, chatID, cursor, 20).Return(expectedPage, nil)
+
+		req, _ := http.NewRequest("GET", "/chats/"+chatID.Hex()+"/messages?before="+cursor+"&limit=20", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var response domain.MessagePage
+		err := json.Unmarshal(w.Body.Bytes(), &response)
+		assert.NoError(t, err)
+		assert.Equal(t, expectedPage.NextCursor, response.NextCursor)
+		assert.True(t, response.HasMore)
+		assert.Len(t, response.Messages, 1)
+		mockMessageUsecase.AssertExpectations(t)
+	})
+
+	t.Run("Limit only returns the latest page", func(t *testing.T) {
+		mockMessageUsecase, r, userID := setup()
+
+		chatID := primitive.NewObjectID()
+		mockMessageUsecase.On("GetMessagesBefore", mock.Anything, userID, chatID, "", 10).Return(domain.MessagePage{Messages: []domain.Message{}}, nil)
+
+		req, _ := http.NewRequest("GET", "/chats/"+chatID.Hex()+"/messages?limit=10", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		mockMessageUsecase.AssertExpectations(t)
+	})
+
+	t.Run("After cursor", func(t *testing.T) {
+		mockMessageUsecase, r, userID := setup()
+
+		chatID := primitive.NewObjectID()
+		mockMessageUsecase.On("GetMessagesAfter", mock.Anything, userID, chatID, "2025-01-02T15:04:05Z", 0).Return(domain.MessagePage{Messages: []domain.Message{}}, nil)
+
+		req, _ := http.NewRequest("GET", "/chats/"+chatID.Hex()+"/messages?after=2025-01-02T15:04:05Z", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		mockMessageUsecase.AssertExpectations(t)
+	})
+
+	t.Run("Invalid cursor", func(t *testing.T) {
+		mockMessageUsecase, r, userID := setup()
+
+		chatID := primitive.NewObjectID()
+		mockMessageUsecase.On("GetMessagesBefore", mock.Anything, userID, chatID, "yesterday", 0).Return(domain.MessagePage{}, domain.ErrInvalidCursor)
+
+		req, _ := http.NewRequest("GET", "/chats/"+chatID.Hex()+"/messages?before=yesterday", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Invalid query", func(t *testing.T) {
+		_, r, _ := setup()
+		chatID := primitive.NewObjectID()
+
+		for _, query := range []string{"before=a&after=b", "limit=abc", "limit=0", "after="} {
+			req, _ := http.NewRequest("GET", "/chats/"+chatID.Hex()+"/messages?"+query, nil)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code, query)
+		}
+	})
+}
+
 func TestDeleteMessage(t *testing.T) {
 	t.Run("Success", func(t *testing.T) {
+		chatID := primitive.NewObjectID()
 		mockMessageUsecase := new(mocks.MockMessageUsecase)
-		hub := websocket.NewHub()
+		hub, observer := runningHubWithObserver(t, chatID)
 		messageController := controller.NewMessageController(mockMessageUsecase, hub)
 
 		r := gin.Default()
+		userID := primitive.NewObjectID()
+		r.Use(authenticatedAs(userID))
 		r.DELETE("/chats/:chat_id/messages/:message_id", messageController.DeleteMessage)
 
-		chatID := primitive.NewObjectID()
 		messageID := primitive.NewObjectID()
 
-		mockMessageUsecase.On("DeleteMessage", mock.Anything, chatID, messageID).Return(nil)
+		mockMessageUsecase.On("DeleteMessage", mock.Anything, userID, chatID, messageID).Return(nil)
 
 		req, _ := http.NewRequest("DELETE", "/chats/"+chatID.Hex()+"/messages/"+messageID.Hex(), nil)
 		w := httptest.NewRecorder()
@@ -167,19 +302,50 @@ func TestDeleteMessage(t *testing.T) {
 
 		assert.Equal(t, http.StatusOK, w.Code)
 		mockMessageUsecase.AssertExpectations(t)
+
+		// Subscribers learn which message to drop
+		event := nextEvent(t, observer)
+		assert.Equal(t, websocket.EventMessageDeleted, event.Type)
+		var payload websocket.MessageDeletedPayload
+		assert.NoError(t, json.Unmarshal(event.Payload, &payload))
+		assert.Equal(t, messageID.Hex(), payload.MessageID)
+	})
+
+	t.Run("Failure is not broadcast", func(t *testing.T) {
+		chatID := primitive.NewObjectID()
+		mockMessageUsecase := new(mocks.MockMessageUsecase)
+		hub, observer := runningHubWithObserver(t, chatID)
+		messageController := controller.NewMessageController(mockMessageUsecase, hub)
+
+		r := gin.Default()
+		userID := primitive.NewObjectID()
+		r.Use(authenticatedAs(userID))
+		r.DELETE("/chats/:chat_id/messages/:message_id", messageController.DeleteMessage)
+
+		messageID := primitive.NewObjectID()
+		mockMessageUsecase.On("DeleteMessage", mock.Anything, userID, chatID, messageID).Return(domain.ErrForbidden)
+
+		req, _ := http.NewRequest("DELETE", "/chats/"+chatID.Hex()+"/messages/"+messageID.Hex(), nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Empty(t, observer.SendChan)
 	})
 }
 
 func TestUpdateMessage(t *testing.T) {
 	t.Run("Success", func(t *testing.T) {
+		chatID := primitive.NewObjectID()
 		mockMessageUsecase := new(mocks.MockMessageUsecase)
-		hub := websocket.NewHub()
+		hub, observer := runningHubWithObserver(t, chatID)
 		messageController := controller.NewMessageController(mockMessageUsecase, hub)
 
 		r := gin.Default()
+		userID := primitive.NewObjectID()
+		r.Use(authenticatedAs(userID))
 		r.PUT("/chats/:chat_id/messages/:message_id", messageController.UpdateMessage)
 
-		chatID := primitive.NewObjectID()
 		messageID := primitive.NewObjectID()
 		updateReq := struct {
 			Content string `json:"content"`
@@ -187,7 +353,8 @@ func TestUpdateMessage(t *testing.T) {
 			Content: "Updated message",
 		}
 
-		mockMessageUsecase.On("UpdateMessage", mock.Anything, chatID, messageID, updateReq.Content).Return(nil)
+		edited := domain.Message{MessageID: messageID, ChatID: chatID, SenderID: userID, Content: updateReq.Content, Edited: true}
+		mockMessageUsecase.On("UpdateMessage", mock.Anything, userID, chatID, messageID, updateReq.Content).Return(edited, nil)
 
 		jsonValue, _ := json.Marshal(updateReq)
 		req, _ := http.NewRequest("PUT", "/chats/"+chatID.Hex()+"/messages/"+messageID.Hex(), bytes.NewBuffer(jsonValue))
@@ -197,5 +364,37 @@ func TestUpdateMessage(t *testing.T) {
 
 		assert.Equal(t, http.StatusOK, w.Code)
 		mockMessageUsecase.AssertExpectations(t)
+
+		// Subscribers receive the edited message
+		event := nextEvent(t, observer)
+		assert.Equal(t, websocket.EventMessageUpdated, event.Type)
+		var message domain.Message
+		assert.NoError(t, json.Unmarshal(event.Payload, &message))
+		assert.Equal(t, "Updated message", message.Content)
+		assert.True(t, message.Edited)
+	})
+
+	t.Run("Not the sender", func(t *testing.T) {
+		mockMessageUsecase := new(mocks.MockMessageUsecase)
+		hub := websocket.NewHub(nil, nil, nil)
+		messageController := controller.NewMessageController(mockMessageUsecase, hub)
+
+		r := gin.Default()
+		userID := primitive.NewObjectID()
+		r.Use(authenticatedAs(userID))
+		r.PUT("/chats/:chat_id/messages/:message_id", messageController.UpdateMessage)
+
+		chatID := primitive.NewObjectID()
+		messageID := primitive.NewObjectID()
+		mockMessageUsecase.On("UpdateMessage", mock.Anything, userID, chatID, messageID, "Updated message").Return(domain.Message{}, domain.ErrForbidden)
+
+		jsonValue, _ := json.Marshal(map[string]string{"content": "Updated message"})
+		req, _ := http.NewRequest("PUT", "/chats/"+chatID.Hex()+"/messages/"+messageID.Hex(), bytes.NewBuffer(jsonValue))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		mockMessageUsecase.AssertExpectations(t)
 	})
 }
@@ -3,7 +3,10 @@ package test
 import (
 	"Real-Time-Chat-Application/controller"
 	"Real-Time-Chat-Application/domain"
+	"Real-Time-Chat-Application/httperr"
+	"Real-Time-Chat-Application/middleware"
 	"Real-Time-Chat-Application/test/test_usecase/mocks"
+	"Real-Time-Chat-Application/websocket"
 	"bytes"
 	"encoding/json"
 	"errors"
@@ -20,7 +23,7 @@ import (
 
 func TestCreateUser(t *testing.T) {
 	mockUserUsecase := new(mocks.MockUserUsecase)
-	userController := controller.NewUserController(mockUserUsecase)
+	userController := controller.NewUserController(mockUserUsecase, new(mocks.MockAuthUsecase), nil)
 
 	gin.SetMode(gin.TestMode)
 	r := gin.Default()
@@ -68,13 +71,54 @@ func TestCreateUser(t *testing.T) {
 		r.ServeHTTP(w, req)
 
 		assert.Equal(t, http.StatusInternalServerError, w.Code)
+		var body httperr.Response
+		json.Unmarshal(w.Body.Bytes(), &body)
+		assert.Equal(t, httperr.Response{Error: "Internal server error", Code: httperr.CodeInternal}, body)
+		mockUserUsecase.AssertExpectations(t)
+	})
+
+	t.Run("invalid fields", func(t *testing.T) {
+		validationErr := &domain.ValidationError{}
+		validationErr.Add("email", "must be a valid email address")
+		mockUserUsecase.On("CreateUser", mock.Anything, mock.AnythingOfType("*domain.User")).Return(primitive.NilObjectID, validationErr).Once()
+
+		req, _ := http.NewRequest(http.MethodPost, "/users", bytes.NewBufferString(`{"email": "test", "username": "testuser", "password": "password123"}`))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+		var body httperr.Response
+		json.Unmarshal(w.Body.Bytes(), &body)
+		assert.Equal(t, httperr.CodeValidation, body.Code)
+		assert.Equal(t, []domain.FieldError{{Field: "email", Message: "must be a valid email address"}}, body.Fields)
+		mockUserUsecase.AssertExpectations(t)
+	})
+
+	t.Run("email taken", func(t *testing.T) {
+		user := &domain.User{
+			Email:    "test@example.com",
+			Username: "testuser",
+			Password: "password123",
+		}
+
+		mockUserUsecase.On("CreateUser", mock.Anything, mock.AnythingOfType("*domain.User")).Return(primitive.NilObjectID, domain.ErrUserExists).Once()
+
+		jsonUser, _ := json.Marshal(user)
+		req, _ := http.NewRequest(http.MethodPost, "/users", bytes.NewBuffer(jsonUser))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusConflict, w.Code)
+		var body httperr.Response
+		json.Unmarshal(w.Body.Bytes(), &body)
+		assert.Equal(t, httperr.Response{Error: domain.ErrUserExists.Error(), Code: httperr.CodeConflict}, body)
 		mockUserUsecase.AssertExpectations(t)
 	})
 }
 
 func TestGetUserByID(t *testing.T) {
 	mockUserUsecase := new(mocks.MockUserUsecase)
-	userController := controller.NewUserController(mockUserUsecase)
+	userController := controller.NewUserController(mockUserUsecase, new(mocks.MockAuthUsecase), nil)
 
 	gin.SetMode(gin.TestMode)
 	r := gin.Default()
@@ -110,7 +154,7 @@ func TestGetUserByID(t *testing.T) {
 
 	t.Run("user not found", func(t *testing.T) {
 		userID := primitive.NewObjectID()
-		mockUserUsecase.On("GetUserByID", mock.Anything, userID).Return(nil, errors.New("user not found")).Once()
+		mockUserUsecase.On("GetUserByID", mock.Anything, userID).Return(nil, domain.ErrUserNotFound).Once()
 
 		req, _ := http.NewRequest(http.MethodGet, "/users/"+userID.Hex(), nil)
 		w := httptest.NewRecorder()
@@ -123,7 +167,7 @@ func TestGetUserByID(t *testing.T) {
 
 func TestGetUserByEmail(t *testing.T) {
 	mockUserUsecase := new(mocks.MockUserUsecase)
-	userController := controller.NewUserController(mockUserUsecase)
+	userController := controller.NewUserController(mockUserUsecase, new(mocks.MockAuthUsecase), nil)
 
 	gin.SetMode(gin.TestMode)
 	r := gin.Default()
@@ -150,7 +194,7 @@ func TestGetUserByEmail(t *testing.T) {
 
 	t.Run("user not found", func(t *testing.T) {
 		email := "test@example.com"
-		mockUserUsecase.On("GetUserByEmail", mock.Anything, email).Return(nil, errors.New("user not found")).Once()
+		mockUserUsecase.On("GetUserByEmail", mock.Anything, email).Return(nil, domain.ErrUserNotFound).Once()
 
 		req, _ := http.NewRequest(http.MethodGet, "/users/email/"+email, nil)
 		w := httptest.NewRecorder()
@@ -163,7 +207,7 @@ func TestGetUserByEmail(t *testing.T) {
 
 func TestGetUserByUsername(t *testing.T) {
 	mockUserUsecase := new(mocks.MockUserUsecase)
-	userController := controller.NewUserController(mockUserUsecase)
+	userController := controller.NewUserController(mockUserUsecase, new(mocks.MockAuthUsecase), nil)
 
 	gin.SetMode(gin.TestMode)
 	r := gin.Default()
@@ -190,7 +234,7 @@ func TestGetUserByUsername(t *testing.T) {
 
 	t.Run("user not found", func(t *testing.T) {
 		username := "testuser"
-		mockUserUsecase.On("GetUserByUsername", mock.Anything, username).Return(nil, errors.New("user not found")).Once()
+		mockUserUsecase.On("GetUserByUsername", mock.Anything, username).Return(nil, domain.ErrUserNotFound).Once()
 
 		req, _ := http.NewRequest(http.MethodGet, "/users/username/"+username, nil)
 		w := httptest.NewRecorder()
@@ -203,28 +247,29 @@ func TestGetUserByUsername(t *testing.T) {
 
 func TestUpdateUser(t *testing.T) {
 	mockUserUsecase := new(mocks.MockUserUsecase)
-	userController := controller.NewUserController(mockUserUsecase)
+	userController := controller.NewUserController(mockUserUsecase, new(mocks.MockAuthUsecase), nil)
+	userID := primitive.NewObjectID()
 
 	gin.SetMode(gin.TestMode)
 	r := gin.Default()
-	r.PUT("/users/:id", userController.UpdateUser)	
+	r.PUT("/users/:id", authenticatedAs(userID), userController.UpdateUser)
+
+	user := &domain.User{
+		UserID:    userID,
+		Email:     "test@example.com",
+		Username:  "testuser",
+		Password:  "password123",
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+	matchesUser := mock.MatchedBy(func(u *domain.User) bool {
+		return u.Email == user.Email &&
+			u.Username == user.Username &&
+			u.UserID == userID
+	})
 
 	t.Run("success", func(t *testing.T) {
-		userID := primitive.NewObjectID()
-		user := &domain.User{
-			UserID:    userID,
-			Email:     "test@example.com",
-			Username:  "testuser",
-			Password:  "password123",
-			CreatedAt: time.Now(),
-			UpdatedAt: time.Now(),
-		}
-
-		mockUserUsecase.On("UpdateUser", mock.Anything, userID, mock.MatchedBy(func(u *domain.User) bool {
-			return u.Email == user.Email && 
-				   u.Username == user.Username &&
-				   u.UserID == userID
-		})).Return(nil).Once()
+		mockUserUsecase.On("UpdateUser", mock.Anything, userID, matchesUser).Return(nil).Once()
 
 		jsonUser, _ := json.Marshal(user)
 		req, _ := http.NewRequest(http.MethodPut, "/users/"+userID.Hex(), bytes.NewBuffer(jsonUser))
@@ -244,22 +289,20 @@ func TestUpdateUser(t *testing.T) {
 		assert.Equal(t, http.StatusBadRequest, w.Code)
 	})
 
-	t.Run("usecase error", func(t *testing.T) {
-		userID := primitive.NewObjectID()
-		user := &domain.User{
-			UserID:    userID,
-			Email:     "test@example.com", 
-			Username:  "testuser",
-			Password:  "password123",
-			CreatedAt: time.Now(),
-			UpdatedAt: time.Now(),
-		}
+	t.Run("another user", func(t *testing.T) {
+		otherID := primitive.NewObjectID()
+		jsonUser, _ := json.Marshal(user)
+		req, _ := http.NewRequest(http.MethodPut, "/users/"+otherID.Hex(), bytes.NewBuffer(jsonUser))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		mockUserUsecase.AssertNotCalled(t, "UpdateUser", mock.Anything, otherID, mock.Anything)
+	})
 
-		mockUserUsecase.On("UpdateUser", mock.Anything, userID, mock.MatchedBy(func(u *domain.User) bool {
-			return u.Email == user.Email && 
-				   u.Username == user.Username &&
-				   u.UserID == userID
-		})).Return(errors.New("usecase error")).Once()
+	t.Run("usecase error", func(t *testing.T) {
+		mockUserUsecase.On("UpdateUser", mock.Anything, userID, matchesUser).Return(errors.New("usecase error")).Once()
 
 		jsonUser, _ := json.Marshal(user)
 		req, _ := http.NewRequest(http.MethodPut, "/users/"+userID.Hex(), bytes.NewBuffer(jsonUser))
@@ -273,52 +316,668 @@ func TestUpdateUser(t *testing.T) {
 }
 
 func TestDeleteUser(t *testing.T) {
+	userID := primitive.NewObjectID()
+
+	// deleteUser runs the handler for a caller with one open connection, and returns the
+	// response and the connection
+	deleteUser := func(t *testing.T, mockUserUsecase *mocks.MockUserUsecase, mockAuthUsecase *mocks.MockAuthUsecase, id string) (*httptest.ResponseRecorder, *websocket.Client) {
+		hub, _ := runningHubWithObserver(t, primitive.NewObjectID())
+		client := websocket.NewClient(nil, userID.Hex())
+		hub.Register <- client
+		hub.Broadcast <- websocket.ChatMessage{ChatID: primitive.NilObjectID.Hex()}
+
+		userController := controller.NewUserController(mockUserUsecase, mockAuthUsecase, hub)
+		gin.SetMode(gin.TestMode)
+		r := gin.New()
+		r.DELETE("/users/:id", authenticatedAs(userID), userController.DeleteUser)
+
+		req, _ := http.NewRequest(http.MethodDelete, "/users/"+id, nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w, client
+	}
+
+	t.Run("success", func(t *testing.T) {
+		mockUserUsecase := new(mocks.MockUserUsecase)
+		mockAuthUsecase := new(mocks.MockAuthUsecase)
+		mockUserUsecase.On("DeleteUser", mock.Anything, userID).Return(nil)
+		mockAuthUsecase.On("RevokeAllSessions", mock.Anything, userID).Return(nil)
+
+		w, client := deleteUser(t, mockUserUsecase, mockAuthUsecase, userID.Hex())
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		_, open := <-client.SendChan
+		assert.False(t, open, "connections of the deleted user should be closed")
+		mockUserUsecase.AssertExpectations(t)
+		mockAuthUsecase.AssertExpectations(t)
+	})
+
+	t.Run("invalid user ID", func(t *testing.T) {
+		w, _ := deleteUser(t, new(mocks.MockUserUsecase), new(mocks.MockAuthUsecase), "invalid-id")
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("another user", func(t *testing.T) {
+		mockUserUsecase := new(mocks.MockUserUsecase)
+		mockAuthUsecase := new(mocks.MockAuthUsecase)
+
+		w, client := deleteUser(t, mockUserUsecase, mockAuthUsecase, primitive.NewObjectID().Hex())
+
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Empty(t, client.SendChan)
+		mockUserUsecase.AssertNotCalled(t, "DeleteUser", mock.Anything, mock.Anything)
+		mockAuthUsecase.AssertNotCalled(t, "RevokeAllSessions", mock.Anything, mock.Anything)
+	})
+
+	t.Run("usecase error", func(t *testing.T) {
+		mockUserUsecase := new(mocks.MockUserUsecase)
+		mockAuthUsecase := new(mocks.MockAuthUsecase)
+		mockUserUsecase.On("DeleteUser", mock.Anything, userID).Return(errors.New("usecase error"))
+
+		w, client := deleteUser(t, mockUserUsecase, mockAuthUsecase, userID.Hex())
+
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+		assert.Empty(t, client.SendChan)
+		mockAuthUsecase.AssertNotCalled(t, "RevokeAllSessions", mock.Anything, mock.Anything)
+	})
+}
+
+func TestChangePassword(t *testing.T) {
+	userID := primitive.NewObjectID()
+	sessionID := primitive.NewObjectID()
+
+	// changePassword runs the handler for a caller with a connection of their current session
+	// and one of another session, and returns the response and both connections
+	changePassword := func(t *testing.T, mockUserUsecase *mocks.MockUserUsecase, id, body string) (*httptest.ResponseRecorder, *websocket.Client, *websocket.Client) {
+		hub, _ := runningHubWithObserver(t, primitive.NewObjectID())
+		current := websocket.NewClient(nil, userID.Hex())
+		current.SessionID = sessionID.Hex()
+		other := websocket.NewClient(nil, userID.Hex())
+		other.SessionID = primitive.NewObjectID().Hex()
+		hub.Register <- current
+		hub.Register <- other
+		hub.Broadcast <- websocket.ChatMessage{ChatID: primitive.NilObjectID.Hex()}
+
+		userController := controller.NewUserController(mockUserUsecase, new(mocks.MockAuthUsecase), hub)
+		gin.SetMode(gin.TestMode)
+		r := gin.New()
+		r.PUT("/users/:id/password", func(c *gin.Context) {
+			c.Set(middleware.UserIDKey, userID)
+			c.Set(middleware.SessionIDKey, sessionID)
+		}, userController.ChangePassword)
+
+		req, _ := http.NewRequest(http.MethodPut, "/users/"+id+"/password", bytes.NewBufferString(body))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w, current, other
+	}
+
+	t.Run("success", func(t *testing.T) {
+		mockUserUsecase := new(mocks.MockUserUsecase)
+		mockUserUsecase.On("ChangePassword", mock.Anything, userID, sessionID, "password123", "newpassword1").Return(nil)
+
+		w, current, other := changePassword(t, mockUserUsecase, userID.Hex(), `{"current_password": "password123", "new_password": "newpassword1"}`)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		_, open := <-other.SendChan
+		assert.False(t, open, "connections of the other sessions should be closed")
+		assert.Empty(t, current.SendChan)
+		mockUserUsecase.AssertExpectations(t)
+	})
+
+	t.Run("wrong current password", func(t *testing.T) {
+		validationErr := &domain.ValidationError{}
+		validationErr.Add("current_password", "is incorrect")
+		mockUserUsecase := new(mocks.MockUserUsecase)
+		mockUserUsecase.On("ChangePassword", mock.Anything, userID, sessionID, "password124", "newpassword1").Return(validationErr)
+
+		w, _, other := changePassword(t, mockUserUsecase, userID.Hex(), `{"current_password": "password124", "new_password": "newpassword1"}`)
+
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+		assert.Empty(t, other.SendChan)
+		mockUserUsecase.AssertExpectations(t)
+	})
+
+	t.Run("another user", func(t *testing.T) {
+		w, _, _ := changePassword(t, new(mocks.MockUserUsecase), primitive.NewObjectID().Hex(), `{"current_password": "password123", "new_password": "newpassword1"}`)
+
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+}
+
+func TestGetPresence(t *testing.T) {
 	mockUserUsecase := new(mocks.MockUserUsecase)
-	userController := controller.NewUserController(mockUserUsecase)
+	hub := websocket.NewHub(nil, nil, mockUserUsecase)
+	userController := controller.NewUserController(mockUserUsecase, new(mocks.MockAuthUsecase), hub)
 
 	gin.SetMode(gin.TestMode)
 	r := gin.Default()
-	r.DELETE("/users/:id", userController.DeleteUser)
+	r.GET("/users/presence", userController.GetPresence)
 
 	t.Run("success", func(t *testing.T) {
 		userID := primitive.NewObjectID()
-		mockUserUsecase.On("DeleteUser", mock.Anything, userID).Return(nil).Once()
+		lastSeen := time.Now().UTC().Truncate(time.Second)
+		mockUserUsecase.On("GetUsersByIDs", mock.Anything, []primitive.ObjectID{userID}).
+			Return([]domain.User{{UserID: userID, LastSeen: &lastSeen}}, nil).Once()
 
-		req, _ := http.NewRequest(http.MethodDelete, "/users/"+userID.Hex(), nil)
+		req, _ := http.NewRequest(http.MethodGet, "/users/presence?ids="+userID.Hex(), nil)
 		w := httptest.NewRecorder()
 		r.ServeHTTP(w, req)
 
 		assert.Equal(t, http.StatusOK, w.Code)
+		var presence []domain.Presence
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &presence))
+		assert.Equal(t, []domain.Presence{{UserID: userID, Status: domain.PresenceOffline, LastSeen: &lastSeen}}, presence)
 		mockUserUsecase.AssertExpectations(t)
 	})
 
 	t.Run("invalid user ID", func(t *testing.T) {
-		req, _ := http.NewRequest(http.MethodDelete, "/users/invalid-id", nil)
+		req, _ := http.NewRequest(http.MethodGet, "/users/presence?ids="+primitive.NewObjectID().Hex()+",invalid", nil)
 		w := httptest.NewRecorder()
 		r.ServeHTTP(w, req)
 
 		assert.Equal(t, http.StatusBadRequest, w.Code)
 	})
 
-	t.Run("usecase error", func(t *testing.T) {
-		userID := primitive.NewObjectID()
-		mockUserUsecase.On("DeleteUser", mock.Anything, userID).Return(errors.New("usecase error")).Once()
+	t.Run("missing IDs", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, "/users/presence", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
 
-		req, _ := http.NewRequest(http.MethodDelete, "/users/"+userID.Hex(), nil)
+func TestLogin(t *testing.T) {
+	mockAuthUsecase := new(mocks.MockAuthUsecase)
+	userController := controller.NewUserController(new(mocks.MockUserUsecase), mockAuthUsecase, nil)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.Default()
+	r.POST("/users/login", userController.Login)
+
+	t.Run("success", func(t *testing.T) {
+		tokens := &domain.TokenPair{AccessToken: "access", RefreshToken: "refresh", ExpiresIn: 900}
+		device := domain.DeviceInfo{Name: "Laptop", IP: "192.0.2.1", UserAgent: "test-agent"}
+		mockAuthUsecase.On("Login", mock.Anything, "test@example.com", "password123", device).Return(&domain.LoginResult{Tokens: tokens}, nil).Once()
+
+		body, _ := json.Marshal(map[string]string{"email": "test@example.com", "password": "password123", "device_name": "Laptop"})
+		req, _ := http.NewRequest(http.MethodPost, "/users/login", bytes.NewBuffer(body))
+		req.Header.Set("User-Agent", "test-agent")
+		req.RemoteAddr = "192.0.2.1:1234"
 		w := httptest.NewRecorder()
 		r.ServeHTTP(w, req)
 
-		assert.Equal(t, http.StatusInternalServerError, w.Code)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var response domain.TokenPair
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, *tokens, response)
+		mockAuthUsecase.AssertExpectations(t)
+	})
+
+	t.Run("two-factor challenge", func(t *testing.T) {
+		mockAuthUsecase.On("Login", mock.Anything, "2fa@example.com", "password123", mock.Anything).Return(&domain.LoginResult{Challenge: "challenge"}, nil).Once()
+
+		body, _ := json.Marshal(map[string]string{"email": "2fa@example.com", "password": "password123"})
+		req, _ := http.NewRequest(http.MethodPost, "/users/login", bytes.NewBuffer(body))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"two_factor_required": true, "challenge_token": "challenge"}`, w.Body.String())
+		mockAuthUsecase.AssertExpectations(t)
+	})
+
+	t.Run("missing password", func(t *testing.T) {
+		body, _ := json.Marshal(map[string]string{"email": "test@example.com"})
+		req, _ := http.NewRequest(http.MethodPost, "/users/login", bytes.NewBuffer(body))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("invalid credentials", func(t *testing.T) {
+		mockAuthUsecase.On("Login", mock.Anything, "test@example.com", "wrong", mock.Anything).Return(nil, domain.ErrInvalidCredentials).Once()
+
+		body, _ := json.Marshal(map[string]string{"email": "test@example.com", "password": "wrong"})
+		req, _ := http.NewRequest(http.MethodPost, "/users/login", bytes.NewBuffer(body))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		mockAuthUsecase.AssertExpectations(t)
+	})
+}
+
+func TestRefreshToken(t *testing.T) {
+	mockAuthUsecase := new(mocks.MockAuthUsecase)
+	userController := controller.NewUserController(new(mocks.MockUserUsecase), mockAuthUsecase, nil)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.Default()
+	r.POST("/users/refresh", userController.RefreshToken)
+
+	t.Run("success", func(t *testing.T) {
+		tokens := &domain.TokenPair{AccessToken: "access", RefreshToken: "refresh", ExpiresIn: 900}
+		mockAuthUsecase.On("RefreshToken", mock.Anything, "old-refresh", mock.Anything).Return(tokens, nil).Once()
+
+		body, _ := json.Marshal(map[string]string{"refresh_token": "old-refresh"})
+		req, _ := http.NewRequest(http.MethodPost, "/users/refresh", bytes.NewBuffer(body))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		mockAuthUsecase.AssertExpectations(t)
+	})
+
+	t.Run("invalid token", func(t *testing.T) {
+		mockAuthUsecase.On("RefreshToken", mock.Anything, "bad", mock.Anything).Return(nil, domain.ErrInvalidToken).Once()
+
+		body, _ := json.Marshal(map[string]string{"refresh_token": "bad"})
+		req, _ := http.NewRequest(http.MethodPost, "/users/refresh", bytes.NewBuffer(body))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		mockAuthUsecase.AssertExpectations(t)
+	})
+}
+
+func TestForgotPassword(t *testing.T) {
+	mockAuthUsecase := new(mocks.MockAuthUsecase)
+	userController := controller.NewUserController(new(mocks.MockUserUsecase), mockAuthUsecase, nil)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.Default()
+	r.POST("/users/password/forgot", userController.ForgotPassword)
+
+	t.Run("accepted", func(t *testing.T) {
+		mockAuthUsecase.On("RequestPasswordReset", mock.Anything, "test@example.com").Return(nil).Once()
+
+		body, _ := json.Marshal(map[string]string{"email": "test@example.com"})
+		req, _ := http.NewRequest(http.MethodPost, "/users/password/forgot", bytes.NewBuffer(body))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusAccepted, w.Code)
+		mockAuthUsecase.AssertExpectations(t)
+	})
+
+	t.Run("missing email", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodPost, "/users/password/forgot", bytes.NewBufferString(`{}`))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+func TestResetPassword(t *testing.T) {
+	userID := primitive.NewObjectID()
+
+	// resetPassword runs the handler while the user has an open connection, and returns the
+	// response and the connection
+	resetPassword := func(t *testing.T, mockAuthUsecase *mocks.MockAuthUsecase, token string) (*httptest.ResponseRecorder, *websocket.Client) {
+		hub, _ := runningHubWithObserver(t, primitive.NewObjectID())
+		client := websocket.NewClient(nil, userID.Hex())
+		hub.Register <- client
+		hub.Broadcast <- websocket.ChatMessage{ChatID: primitive.NilObjectID.Hex()}
+
+		userController := controller.NewUserController(new(mocks.MockUserUsecase), mockAuthUsecase, hub)
+		gin.SetMode(gin.TestMode)
+		r := gin.New()
+		r.POST("/users/password/reset", userController.ResetPassword)
+
+		body, _ := json.Marshal(map[string]string{"token": token, "new_password": "newpassword1"})
+		req, _ := http.NewRequest(http.MethodPost, "/users/password/reset", bytes.NewBuffer(body))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w, client
+	}
+
+	t.Run("success", func(t *testing.T) {
+		mockAuthUsecase := new(mocks.MockAuthUsecase)
+		mockAuthUsecase.On("ResetPassword", mock.Anything, "token", "newpassword1").Return(userID, nil)
+
+		w, client := resetPassword(t, mockAuthUsecase, "token")
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		_, open := <-client.SendChan
+		assert.False(t, open, "every connection of the user should be closed")
+		mockAuthUsecase.AssertExpectations(t)
+	})
+
+	t.Run("used token", func(t *testing.T) {
+		mockAuthUsecase := new(mocks.MockAuthUsecase)
+		mockAuthUsecase.On("ResetPassword", mock.Anything, "used", "newpassword1").Return(primitive.NilObjectID, domain.ErrInvalidUserToken)
+
+		w, client := resetPassword(t, mockAuthUsecase, "used")
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Empty(t, client.SendChan)
+		mockAuthUsecase.AssertExpectations(t)
+	})
+}
+
+func TestVerifyEmail(t *testing.T) {
+	mockUserUsecase := new(mocks.MockUserUsecase)
+	userController := controller.NewUserController(mockUserUsecase, new(mocks.MockAuthUsecase), nil)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.Default()
+	r.POST("/users/verify-email", userController.VerifyEmail)
+
+	t.Run("success", func(t *testing.T) {
+		mockUserUsecase.On("VerifyEmail", mock.Anything, "token").Return(nil).Once()
+
+		body, _ := json.Marshal(map[string]string{"token": "token"})
+		req, _ := http.NewRequest(http.MethodPost, "/users/verify-email", bytes.NewBuffer(body))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		mockUserUsecase.AssertExpectations(t)
+	})
+
+	t.Run("invalid token", func(t *testing.T) {
+		mockUserUsecase.On("VerifyEmail", mock.Anything, "expired").Return(domain.ErrInvalidUserToken).Once()
+
+		body, _ := json.Marshal(map[string]string{"token": "expired"})
+		req, _ := http.NewRequest(http.MethodPost, "/users/verify-email", bytes.NewBuffer(body))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		mockUserUsecase.AssertExpectations(t)
+	})
+}
+
+func TestResendVerification(t *testing.T) {
+	mockUserUsecase := new(mocks.MockUserUsecase)
+	userController := controller.NewUserController(mockUserUsecase, new(mocks.MockAuthUsecase), nil)
+	userID := primitive.NewObjectID()
+
+	gin.SetMode(gin.TestMode)
+	r := gin.Default()
+	r.POST("/users/verify-email/resend", func(c *gin.Context) { c.Set(middleware.UserIDKey, userID) }, userController.ResendVerification)
+
+	t.Run("accepted", func(t *testing.T) {
+		mockUserUsecase.On("ResendVerification", mock.Anything, userID).Return(nil).Once()
+
+		req, _ := http.NewRequest(http.MethodPost, "/users/verify-email/resend", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusAccepted, w.Code)
+		mockUserUsecase.AssertExpectations(t)
+	})
+
+	t.Run("too soon", func(t *testing.T) {
+		mockUserUsecase.On("ResendVerification", mock.Anything, userID).Return(domain.ErrResendTooSoon).Once()
+
+		req, _ := http.NewRequest(http.MethodPost, "/users/verify-email/resend", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+		var body httperr.Response
+		json.Unmarshal(w.Body.Bytes(), &body)
+		assert.Equal(t, httperr.CodeRateLimited, body.Code)
 		mockUserUsecase.AssertExpectations(t)
 	})
 }
 
+func TestListSessions(t *testing.T) {
+	mockAuthUsecase := new(mocks.MockAuthUsecase)
+	userController := controller.NewUserController(new(mocks.MockUserUsecase), mockAuthUsecase, nil)
+	userID := primitive.NewObjectID()
+	sessionID := primitive.NewObjectID()
+
+	gin.SetMode(gin.TestMode)
+	r := gin.Default()
+	r.GET("/users/sessions", func(c *gin.Context) {
+		c.Set(middleware.UserIDKey, userID)
+		c.Set(middleware.SessionIDKey, sessionID)
+	}, userController.ListSessions)
+
+	sessions := []domain.Session{{SessionID: sessionID, UserID: userID, DeviceName: "Laptop", RefreshTokenHash: "hash", Current: true}}
+	mockAuthUsecase.On("ListSessions", mock.Anything, userID, sessionID).Return(sessions, nil).Once()
+
+	req, _ := http.NewRequest(http.MethodGet, "/users/sessions", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"device_name":"Laptop"`)
+	assert.Contains(t, w.Body.String(), `"current":true`)
+	assert.NotContains(t, w.Body.String(), "hash")
+	mockAuthUsecase.AssertExpectations(t)
+}
+
+func TestRevokeSession(t *testing.T) {
+	userID := primitive.NewObjectID()
+	sessionID := primitive.NewObjectID()
+
+	// revokeSession runs the handler with a hub holding one connection of the revoked session
+	// and one of another session, and returns the response and both connections
+	revokeSession := func(t *testing.T, mockAuthUsecase *mocks.MockAuthUsecase, id string) (*httptest.ResponseRecorder, *websocket.Client, *websocket.Client) {
+		hub, _ := runningHubWithObserver(t, primitive.NewObjectID())
+		revoked := websocket.NewClient(nil, userID.Hex())
+		revoked.SessionID = sessionID.Hex()
+		kept := websocket.NewClient(nil, userID.Hex())
+		kept.SessionID = primitive.NewObjectID().Hex()
+		hub.Register <- revoked
+		hub.Register <- kept
+		hub.Broadcast <- websocket.ChatMessage{ChatID: primitive.NilObjectID.Hex()}
+
+		userController := controller.NewUserController(new(mocks.MockUserUsecase), mockAuthUsecase, hub)
+		r := gin.New()
+		r.DELETE("/users/sessions/:session_id", authenticatedAs(userID), userController.RevokeSession)
+
+		req, _ := http.NewRequest(http.MethodDelete, "/users/sessions/"+id, nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w, revoked, kept
+	}
+
+	t.Run("success", func(t *testing.T) {
+		mockAuthUsecase := new(mocks.MockAuthUsecase)
+		mockAuthUsecase.On("RevokeSession", mock.Anything, userID, sessionID).Return(nil)
+
+		w, revoked, kept := revokeSession(t, mockAuthUsecase, sessionID.Hex())
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		_, open := <-revoked.SendChan
+		assert.False(t, open, "connections of the revoked session should be closed")
+		assert.Empty(t, kept.SendChan)
+		mockAuthUsecase.AssertExpectations(t)
+	})
+
+	t.Run("another user's session", func(t *testing.T) {
+		mockAuthUsecase := new(mocks.MockAuthUsecase)
+		mockAuthUsecase.On("RevokeSession", mock.Anything, userID, sessionID).Return(domain.ErrSessionNotFound)
+
+		w, revoked, _ := revokeSession(t, mockAuthUsecase, sessionID.Hex())
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Empty(t, revoked.SendChan)
+	})
+
+	t.Run("invalid ID", func(t *testing.T) {
+		w, _, _ := revokeSession(t, new(mocks.MockAuthUsecase), "invalid")
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+func TestRevokeAllSessions(t *testing.T) {
+	userID := primitive.NewObjectID()
+	hub, observer := runningHubWithObserver(t, primitive.NewObjectID())
+	phone := websocket.NewClient(nil, userID.Hex())
+	laptop := websocket.NewClient(nil, userID.Hex())
+	hub.Register <- phone
+	hub.Register <- laptop
+	hub.Broadcast <- websocket.ChatMessage{ChatID: primitive.NilObjectID.Hex()}
+
+	mockAuthUsecase := new(mocks.MockAuthUsecase)
+	mockAuthUsecase.On("RevokeAllSessions", mock.Anything, userID).Return(nil)
+	userController := controller.NewUserController(new(mocks.MockUserUsecase), mockAuthUsecase, hub)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.DELETE("/users/sessions", authenticatedAs(userID), userController.RevokeAllSessions)
+
+	req, _ := http.NewRequest(http.MethodDelete, "/users/sessions", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	for _, client := range []*websocket.Client{phone, laptop} {
+		_, open := <-client.SendChan
+		assert.False(t, open, "every connection of the user should be closed")
+	}
+	assert.True(t, hub.Clients[observer])
+	mockAuthUsecase.AssertExpectations(t)
+}
+
+func TestLoginTwoFactor(t *testing.T) {
+	mockAuthUsecase := new(mocks.MockAuthUsecase)
+	userController := controller.NewUserController(new(mocks.MockUserUsecase), mockAuthUsecase, nil)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/users/login/two-factor", userController.LoginTwoFactor)
+
+	t.Run("success", func(t *testing.T) {
+		tokens := &domain.TokenPair{AccessToken: "access", RefreshToken: "refresh", ExpiresIn: 900}
+		device := domain.DeviceInfo{Name: "Phone", IP: "192.0.2.1", UserAgent: "test-agent"}
+		mockAuthUsecase.On("LoginTwoFactor", mock.Anything, "challenge", "123456", device).Return(tokens, nil).Once()
+
+		body, _ := json.Marshal(map[string]string{"challenge_token": "challenge", "code": "123456", "device_name": "Phone"})
+		req, _ := http.NewRequest(http.MethodPost, "/users/login/two-factor", bytes.NewBuffer(body))
+		req.Header.Set("User-Agent", "test-agent")
+		req.RemoteAddr = "192.0.2.1:1234"
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		var response domain.TokenPair
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, *tokens, response)
+		mockAuthUsecase.AssertExpectations(t)
+	})
+
+	t.Run("wrong code", func(t *testing.T) {
+		mockAuthUsecase.On("LoginTwoFactor", mock.Anything, "challenge", "000000", mock.Anything).Return(nil, domain.ErrInvalidTwoFactorCode).Once()
+
+		body, _ := json.Marshal(map[string]string{"challenge_token": "challenge", "code": "000000"})
+		req, _ := http.NewRequest(http.MethodPost, "/users/login/two-factor", bytes.NewBuffer(body))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+}
+
+func TestSetupTwoFactor(t *testing.T) {
+	userID := primitive.NewObjectID()
+	mockAuthUsecase := new(mocks.MockAuthUsecase)
+	userController := controller.NewUserController(new(mocks.MockUserUsecase), mockAuthUsecase, nil)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/users/two-factor/setup", authenticatedAs(userID), userController.SetupTwoFactor)
+	r.POST("/users/two-factor/confirm", authenticatedAs(userID), userController.ConfirmTwoFactor)
+	r.POST("/users/two-factor/disable", authenticatedAs(userID), userController.DisableTwoFactor)
+
+	t.Run("setup", func(t *testing.T) {
+		setup := &domain.TwoFactorSetup{Secret: "SECRET", URI: "otpauth://totp/x"}
+		mockAuthUsecase.On("SetupTwoFactor", mock.Anything, userID).Return(setup, nil).Once()
+
+		req, _ := http.NewRequest(http.MethodPost, "/users/two-factor/setup", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"secret": "SECRET", "uri": "otpauth://totp/x"}`, w.Body.String())
+	})
+
+	t.Run("already enabled", func(t *testing.T) {
+		mockAuthUsecase.On("SetupTwoFactor", mock.Anything, userID).Return(nil, domain.ErrTwoFactorAlreadyEnabled).Once()
+
+		req, _ := http.NewRequest(http.MethodPost, "/users/two-factor/setup", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusConflict, w.Code)
+	})
+
+	t.Run("confirm", func(t *testing.T) {
+		mockAuthUsecase.On("ConfirmTwoFactor", mock.Anything, userID, "123456").Return([]string{"abcde-fghij"}, nil).Once()
+
+		body, _ := json.Marshal(map[string]string{"code": "123456"})
+		req, _ := http.NewRequest(http.MethodPost, "/users/two-factor/confirm", bytes.NewBuffer(body))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"recovery_codes": ["abcde-fghij"]}`, w.Body.String())
+	})
+
+	t.Run("disable", func(t *testing.T) {
+		mockAuthUsecase.On("DisableTwoFactor", mock.Anything, userID, "abcde-fghij").Return(nil).Once()
+
+		body, _ := json.Marshal(map[string]string{"code": "abcde-fghij"})
+		req, _ := http.NewRequest(http.MethodPost, "/users/two-factor/disable", bytes.NewBuffer(body))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	mockAuthUsecase.AssertExpectations(t)
+}
+
+func TestGetTwoFactorStatus(t *testing.T) {
+	callerID := primitive.NewObjectID()
+	userID := primitive.NewObjectID()
+	mockAuthUsecase := new(mocks.MockAuthUsecase)
+	userController := controller.NewUserController(new(mocks.MockUserUsecase), mockAuthUsecase, nil)
 
-	
-	
-	
-	
-	
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/users/:id/two-factor", authenticatedAs(callerID), userController.GetTwoFactorStatus)
+
+	t.Run("success", func(t *testing.T) {
+		mockAuthUsecase.On("TwoFactorStatus", mock.Anything, callerID, callerID).Return(&domain.TwoFactorStatus{Enabled: true, RecoveryCodesLeft: 9}, nil).Once()
+
+		req, _ := http.NewRequest(http.MethodGet, "/users/"+callerID.Hex()+"/two-factor", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"enabled": true, "recovery_codes_left": 9}`, w.Body.String())
+	})
+
+	t.Run("not an admin", func(t *testing.T) {
+		mockAuthUsecase.On("TwoFactorStatus", mock.Anything, callerID, userID).Return(nil, domain.ErrForbidden).Once()
 
+		req, _ := http.NewRequest(http.MethodGet, "/users/"+userID.Hex()+"/two-factor", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+
+	t.Run("invalid ID", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, "/users/invalid/two-factor", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
 
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
 
+	mockAuthUsecase.AssertExpectations(t)
+}
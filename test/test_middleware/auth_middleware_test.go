@@ -0,0 +1,122 @@
+package test
+
+import (
+	"Real-Time-Chat-Application/domain"
+	"Real-Time-Chat-Application/httperr"
+	"Real-Time-Chat-Application/infrastructure"
+	"Real-Time-Chat-Application/middleware"
+	"Real-Time-Chat-Application/test/test_usecase/mocks"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestAuthMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tokenService := infrastructure.NewJWTService("secret", time.Minute, time.Hour)
+	userID := primitive.NewObjectID()
+	sessionID := primitive.NewObjectID()
+	tokens, _ := tokenService.GenerateTokens(userID, sessionID)
+	sessions := new(mocks.MockAuthUsecase)
+	sessions.On("CheckSession", mock.Anything, userID, sessionID).Return(nil)
+
+	r := gin.New()
+	r.GET("/me", middleware.AuthMiddleware(tokenService, sessions), func(c *gin.Context) {
+		id, _ := middleware.GetUserID(c)
+		session, _ := middleware.GetSessionID(c)
+		c.String(http.StatusOK, id.Hex()+" "+session.Hex())
+	})
+	r.GET("/ws", middleware.WebSocketAuthMiddleware(tokenService, sessions), func(c *gin.Context) {
+		id, _ := middleware.GetUserID(c)
+		c.String(http.StatusOK, id.Hex())
+	})
+
+	t.Run("valid bearer token", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, "/me", nil)
+		req.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, userID.Hex()+" "+sessionID.Hex(), w.Body.String())
+	})
+
+	t.Run("revoked session", func(t *testing.T) {
+		revokedID := primitive.NewObjectID()
+		revoked, _ := tokenService.GenerateTokens(userID, revokedID)
+		sessions.On("CheckSession", mock.Anything, userID, revokedID).Return(domain.ErrInvalidToken)
+
+		req, _ := http.NewRequest(http.MethodGet, "/me", nil)
+		req.Header.Set("Authorization", "Bearer "+revoked.AccessToken)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		var body httperr.Response
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+		assert.Equal(t, httperr.Response{Error: "Session revoked", Code: httperr.CodeUnauthorized}, body)
+	})
+
+	t.Run("session store failing", func(t *testing.T) {
+		brokenID := primitive.NewObjectID()
+		broken, _ := tokenService.GenerateTokens(userID, brokenID)
+		sessions.On("CheckSession", mock.Anything, userID, brokenID).Return(errors.New("connection refused"))
+
+		req, _ := http.NewRequest(http.MethodGet, "/me", nil)
+		req.Header.Set("Authorization", "Bearer "+broken.AccessToken)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+		var body httperr.Response
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+		assert.Equal(t, httperr.Response{Error: "Internal server error", Code: httperr.CodeInternal}, body)
+	})
+
+	t.Run("missing token", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, "/me", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("refresh token rejected", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, "/me", nil)
+		req.Header.Set("Authorization", "Bearer "+tokens.RefreshToken)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("token signed with another secret", func(t *testing.T) {
+		other, _ := infrastructure.NewJWTService("other", time.Minute, time.Hour).GenerateTokens(userID, sessionID)
+		req, _ := http.NewRequest(http.MethodGet, "/me", nil)
+		req.Header.Set("Authorization", "Bearer "+other.AccessToken)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("query token only accepted on websocket route", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, "/ws?token="+tokens.AccessToken, nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		req, _ = http.NewRequest(http.MethodGet, "/me?token="+tokens.AccessToken, nil)
+		w = httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+}
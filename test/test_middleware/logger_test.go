@@ -0,0 +1,31 @@
+package test
+
+import (
+	"Real-Time-Chat-Application/middleware"
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestLoggerDropsQueryString(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var out bytes.Buffer
+	defaultWriter := gin.DefaultWriter
+	gin.DefaultWriter = &out
+	defer func() { gin.DefaultWriter = defaultWriter }()
+
+	r := gin.New()
+	r.Use(middleware.RequestLogger())
+	r.GET("/ws", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/ws?token=secret-access-token", nil)
+	r.ServeHTTP(w, req)
+
+	assert.Contains(t, out.String(), `"/ws"`)
+	assert.NotContains(t, out.String(), "secret-access-token")
+}
@@ -3,7 +3,9 @@ package test
 
 import (
 	"context"
+	"errors"
 	"testing"
+	"time"
 
 	"Real-Time-Chat-Application/domain"
 	"Real-Time-Chat-Application/repository"
@@ -33,7 +35,9 @@ func TestCreateChat(t *testing.T) {
 	// Mock InsertOne to return a successful result
 	mockCollection.On("InsertOne", mock.Anything, mock.MatchedBy(func(chat domain.Chat) bool {
 		// Verify the chat object has the expected participants
-		return len(chat.Participants) == 2 &&
+		return chat.Type == domain.ChatTypeDirect &&
+			chat.DirectKey == domain.DirectChatKey(ReceiverID, SenderID) &&
+			len(chat.Participants) == 2 &&
 			chat.Participants[0] == SenderID &&
 			chat.Participants[1] == ReceiverID
 	})).Return(&mongo.InsertOneResult{InsertedID: chatID}, nil)
@@ -47,6 +51,22 @@ func TestCreateChat(t *testing.T) {
 	mockCollection.AssertExpectations(t)
 }
 
+func TestCreateChatDuplicate(t *testing.T) {
+	// Setup
+	mockCollection := new(mocks.MockCollection)
+	repo := repository.NewChatRepository(mockCollection)
+
+	// The unique index on direct_key rejects a second chat between the same users
+	duplicate := mongo.WriteException{WriteErrors: []mongo.WriteError{{Code: 11000, Message: "duplicate key"}}}
+	mockCollection.On("InsertOne", mock.Anything, mock.Anything).Return((*mongo.InsertOneResult)(nil), duplicate)
+
+	// Execute
+	_, err := repo.CreateChat(context.TODO(), primitive.NewObjectID(), primitive.NewObjectID())
+
+	// Verify
+	assert.ErrorIs(t, err, domain.ErrChatExists)
+}
+
 // Add other tests...
 
 func TestGetChat(t *testing.T) {
@@ -59,7 +79,6 @@ func TestGetChat(t *testing.T) {
 	expectedChat := &domain.Chat{
 		ChatID:       chatID,
 		Participants: []primitive.ObjectID{primitive.NewObjectID()},
-		Messages:     []domain.Message{},
 	}
 
 	// Mock Decode
@@ -93,7 +112,6 @@ func TestGetChatsByUserID(t *testing.T) {
 	expectedChat := domain.Chat{
 		ChatID:       primitive.NewObjectID(),
 		Participants: []primitive.ObjectID{userID},
-		Messages:     []domain.Message{},
 	}
 
 	// Set up expectations for Find to return the mock cursor
@@ -125,6 +143,46 @@ func TestGetChatsByUserID(t *testing.T) {
 	mockCursor.AssertExpectations(t)
 }
 
+func TestGetRecentChats(t *testing.T) {
+	mockCollection := new(mocks.MockCollection)
+	mockCursor := new(mocks.MockCursor)
+	chatrepo := repository.NewChatRepository(mockCollection)
+
+	userID := primitive.NewObjectID()
+	expectedChat := domain.Chat{
+		ChatID:       primitive.NewObjectID(),
+		Participants: []primitive.ObjectID{userID, primitive.NewObjectID()},
+		LastMessage:  &domain.MessagePreview{MessageID: primitive.NewObjectID(), Content: "Hello"},
+	}
+
+	mockCollection.On("Find", mock.Anything, bson.M{"participants": userID}).Return(mockCursor, nil)
+	mockCursor.On("Next", mock.Anything).Return(true).Once()
+	mockCursor.On("Decode", mock.Anything).Run(func(args mock.Arguments) {
+		*args.Get(0).(*domain.Chat) = expectedChat
+	}).Return(nil)
+	mockCursor.On("Next", mock.Anything).Return(false).Once()
+	mockCursor.On("Close", mock.Anything).Return(nil)
+	mockCursor.On("Err").Return(nil)
+
+	chats, err := chatrepo.GetRecentChats(context.TODO(), userID)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []domain.Chat{expectedChat}, chats)
+	mockCollection.AssertExpectations(t)
+	mockCursor.AssertExpectations(t)
+}
+
+func TestGetRecentChatsError(t *testing.T) {
+	mockCollection := new(mocks.MockCollection)
+	chatrepo := repository.NewChatRepository(mockCollection)
+
+	mockCollection.On("Find", mock.Anything, mock.Anything).Return((*mocks.MockCursor)(nil), errors.New("database error"))
+
+	_, err := chatrepo.GetRecentChats(context.TODO(), primitive.NewObjectID())
+
+	assert.EqualError(t, err, "failed to fetch chats: database error")
+}
+
 func TestUpdateChat(t *testing.T) {
 	// Setup
 	mockCollection := new(mocks.MockCollection)
@@ -134,7 +192,6 @@ func TestUpdateChat(t *testing.T) {
 	chat := &domain.Chat{
 		ChatID:       chatID,
 		Participants: []primitive.ObjectID{primitive.NewObjectID()},
-		Messages:     []domain.Message{},
 	}
 
 	// Create a mock response for UpdateOne (MongoDB returns *mongo.UpdateResult)
@@ -173,43 +230,261 @@ func TestDeleteChat(t *testing.T) {
 }
 
 func TestGetChatByParticipants(t *testing.T) {
-	// Setup
-	mockCollection := new(mocks.MockCollection)
-	mockSingleResult := new(mocks.MockSingleResult)
-	repo := repository.NewChatRepository(mockCollection)
-
 	SenderID := primitive.NewObjectID()
 	ReceiverID := primitive.NewObjectID()
-	chatID := primitive.NewObjectID()
-
-	// Create a mock chat
-	expectedChat := &domain.Chat{
-		ChatID:       chatID,
-		Participants: []primitive.ObjectID{SenderID, ReceiverID},
-		Messages:     []domain.Message{},
-	}
-
-	// Mock FindOne
-	mockCollection.On("FindOne", mock.Anything, bson.M{
+	keyFilter := bson.M{"direct_key": domain.DirectChatKey(SenderID, ReceiverID)}
+	// The fallback for chats stored before direct_key existed must skip groups of the same two users
+	legacyFilter := bson.M{
 		"participants": bson.M{
 			"$all":  []primitive.ObjectID{SenderID, ReceiverID},
 			"$size": 2,
 		},
-	}).Return(mockSingleResult)
+		"type": bson.M{"$ne": domain.ChatTypeGroup},
+	}
 
-	// Mock Decode to return the expected chat
-	mockSingleResult.On("Decode", mock.AnythingOfType("*domain.Chat")).Run(func(args mock.Arguments) {
-		chat := args.Get(0).(*domain.Chat)
-		*chat = *expectedChat
-	}).Return(nil)
+	// decodes returns a single result that decodes into chat, or fails with err when chat is nil
+	decodes := func(chat *domain.Chat, err error) *mocks.MockSingleResult {
+		result := new(mocks.MockSingleResult)
+		result.On("Decode", mock.AnythingOfType("*domain.Chat")).Run(func(args mock.Arguments) {
+			if chat != nil {
+				*args.Get(0).(*domain.Chat) = *chat
+			}
+		}).Return(err)
+		return result
+	}
 
-	// Execute
-	chat, err := repo.GetChatByParticipants(context.TODO(), SenderID, ReceiverID)
+	t.Run("Success - By Key", func(t *testing.T) {
+		mockCollection := new(mocks.MockCollection)
+		repo := repository.NewChatRepository(mockCollection)
+		expectedChat := &domain.Chat{
+			ChatID:       primitive.NewObjectID(),
+			Participants: []primitive.ObjectID{SenderID, ReceiverID},
+			DirectKey:    domain.DirectChatKey(SenderID, ReceiverID),
+		}
+		mockCollection.On("FindOne", mock.Anything, keyFilter).Return(decodes(expectedChat, nil))
+
+		chat, err := repo.GetChatByParticipants(context.TODO(), SenderID, ReceiverID)
+
+		assert.NoError(t, err)
+		assert.Equal(t, expectedChat, chat)
+		mockCollection.AssertExpectations(t)
+		mockCollection.AssertNotCalled(t, "FindOne", mock.Anything, legacyFilter)
+	})
+
+	t.Run("Success - Not Migrated", func(t *testing.T) {
+		mockCollection := new(mocks.MockCollection)
+		repo := repository.NewChatRepository(mockCollection)
+		expectedChat := &domain.Chat{
+			ChatID:       primitive.NewObjectID(),
+			Participants: []primitive.ObjectID{SenderID, ReceiverID},
+		}
+		mockCollection.On("FindOne", mock.Anything, keyFilter).Return(decodes(nil, mongo.ErrNoDocuments))
+		mockCollection.On("FindOne", mock.Anything, legacyFilter).Return(decodes(expectedChat, nil))
+
+		chat, err := repo.GetChatByParticipants(context.TODO(), SenderID, ReceiverID)
+
+		assert.NoError(t, err)
+		assert.Equal(t, expectedChat, chat)
+		mockCollection.AssertExpectations(t)
+	})
+
+	t.Run("Failure - Not Found", func(t *testing.T) {
+		mockCollection := new(mocks.MockCollection)
+		repo := repository.NewChatRepository(mockCollection)
+		mockCollection.On("FindOne", mock.Anything, keyFilter).Return(decodes(nil, mongo.ErrNoDocuments))
+		mockCollection.On("FindOne", mock.Anything, legacyFilter).Return(decodes(nil, mongo.ErrNoDocuments))
+
+		chat, err := repo.GetChatByParticipants(context.TODO(), SenderID, ReceiverID)
+
+		assert.ErrorIs(t, err, domain.ErrChatNotFound)
+		assert.Nil(t, chat)
+	})
+
+	t.Run("Failure - Database Error", func(t *testing.T) {
+		mockCollection := new(mocks.MockCollection)
+		repo := repository.NewChatRepository(mockCollection)
+		mockCollection.On("FindOne", mock.Anything, keyFilter).Return(decodes(nil, errors.New("connection lost")))
+
+		_, err := repo.GetChatByParticipants(context.TODO(), SenderID, ReceiverID)
+
+		assert.Error(t, err)
+		assert.NotErrorIs(t, err, domain.ErrChatNotFound)
+		mockCollection.AssertNotCalled(t, "FindOne", mock.Anything, legacyFilter)
+	})
+}
+
+
+func TestUpdateReadMarker(t *testing.T) {
+	chatID := primitive.NewObjectID()
+	userID := primitive.NewObjectID()
+	marker := domain.ReadMarker{MessageID: primitive.NewObjectID(), MessageTime: time.Now(), ReadAt: time.Now()}
+	field := "read_markers." + userID.Hex()
+
+	// The filter only matches when the stored marker is missing or behind
+	expectedFilter := bson.M{
+		"_id": chatID,
+		"$or": bson.A{
+			bson.M{field: bson.M{"$exists": false}},
+			bson.M{field + ".message_time": bson.M{"$lt": marker.MessageTime}},
+			bson.M{field + ".message_time": marker.MessageTime, field + ".message_id": bson.M{"$lt": marker.MessageID}},
+		},
+	}
+
+	tests := []struct {
+		name         string
+		matchedCount int64
+		expected     bool
+	}{
+		{name: "Marker advanced", matchedCount: 1, expected: true},
+		{name: "Marker already further", matchedCount: 0, expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockCollection := new(mocks.MockCollection)
+			repo := repository.NewChatRepository(mockCollection)
+
+			mockCollection.On("UpdateOne", mock.Anything, expectedFilter, bson.M{"$set": bson.M{field: marker}}).
+				Return(&mongo.UpdateResult{MatchedCount: tt.matchedCount, ModifiedCount: tt.matchedCount}, nil)
+
+			advanced, err := repo.UpdateReadMarker(context.TODO(), chatID, userID, marker)
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, advanced)
+			mockCollection.AssertExpectations(t)
+		})
+	}
+}
+
+func TestCreateGroupChat(t *testing.T) {
+	mockCollection := new(mocks.MockCollection)
+	repo := repository.NewChatRepository(mockCollection)
+
+	creatorID := primitive.NewObjectID()
+	chatID := primitive.NewObjectID()
+	chat := &domain.Chat{
+		Participants: []primitive.ObjectID{creatorID, primitive.NewObjectID(), primitive.NewObjectID()},
+		Title:        "Team",
+		CreatedBy:    creatorID,
+	}
+
+	mockCollection.On("InsertOne", mock.Anything, mock.MatchedBy(func(stored *domain.Chat) bool {
+		return stored.Type == domain.ChatTypeGroup && len(stored.Participants) == 3 && !stored.CreatedAt.IsZero()
+	})).Return(&mongo.InsertOneResult{InsertedID: chatID}, nil)
+
+	insertedID, err := repo.CreateGroupChat(context.TODO(), chat)
 
-	// Verify
 	assert.NoError(t, err)
-	assert.Equal(t, expectedChat, chat)
+	assert.Equal(t, chatID, insertedID)
+	assert.Equal(t, chatID, chat.ChatID)
 	mockCollection.AssertExpectations(t)
-	mockSingleResult.AssertExpectations(t)
 }
 
+func TestAddParticipants(t *testing.T) {
+	mockCollection := new(mocks.MockCollection)
+	repo := repository.NewChatRepository(mockCollection)
+
+	chatID := primitive.NewObjectID()
+	userIDs := []primitive.ObjectID{primitive.NewObjectID(), primitive.NewObjectID()}
+
+	mockCollection.On("UpdateOne", mock.Anything, bson.M{"_id": chatID}, mock.MatchedBy(func(update bson.M) bool {
+		addToSet, ok := update["$addToSet"].(bson.M)
+		return ok && assert.ObjectsAreEqual(bson.M{"participants": bson.M{"$each": userIDs}}, addToSet)
+	})).Return(&mongo.UpdateResult{MatchedCount: 1}, nil)
+
+	err := repo.AddParticipants(context.TODO(), chatID, userIDs)
+
+	assert.NoError(t, err)
+	mockCollection.AssertExpectations(t)
+}
+
+func TestRemoveParticipant(t *testing.T) {
+	mockCollection := new(mocks.MockCollection)
+	repo := repository.NewChatRepository(mockCollection)
+
+	chatID := primitive.NewObjectID()
+	userID := primitive.NewObjectID()
+
+	// The read marker and role of the user go with them
+	mockCollection.On("UpdateOne", mock.Anything, bson.M{"_id": chatID}, mock.MatchedBy(func(update bson.M) bool {
+		return assert.ObjectsAreEqual(bson.M{"participants": userID}, update["$pull"]) &&
+			assert.ObjectsAreEqual(bson.M{"read_markers." + userID.Hex(): "", "roles." + userID.Hex(): ""}, update["$unset"])
+	})).Return(&mongo.UpdateResult{MatchedCount: 1}, nil)
+
+	err := repo.RemoveParticipant(context.TODO(), chatID, userID)
+
+	assert.NoError(t, err)
+	mockCollection.AssertExpectations(t)
+}
+
+func TestRemoveParticipantError(t *testing.T) {
+	mockCollection := new(mocks.MockCollection)
+	repo := repository.NewChatRepository(mockCollection)
+
+	chatID := primitive.NewObjectID()
+	mockCollection.On("UpdateOne", mock.Anything, bson.M{"_id": chatID}, mock.Anything).Return((*mongo.UpdateResult)(nil), errors.New("database error"))
+
+	err := repo.RemoveParticipant(context.TODO(), chatID, primitive.NewObjectID())
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to remove participant")
+}
+
+func TestUpdateChatSettings(t *testing.T) {
+	chatID := primitive.NewObjectID()
+	title, avatar, announcementOnly := "Renamed", "https://example.com/a.png", true
+
+	t.Run("all settings", func(t *testing.T) {
+		mockCollection := new(mocks.MockCollection)
+		repo := repository.NewChatRepository(mockCollection)
+
+		// Only the settings are written, never the members or roles
+		mockCollection.On("UpdateOne", mock.Anything, bson.M{"_id": chatID}, mock.MatchedBy(func(update bson.M) bool {
+			set := update["$set"].(bson.M)
+			return len(set) == 4 && set["title"] == title && set["avatar"] == avatar && set["announcement_only"] == true
+		})).Return(&mongo.UpdateResult{MatchedCount: 1}, nil)
+
+		err := repo.UpdateChatSettings(context.TODO(), chatID, domain.ChatSettings{Title: &title, Avatar: &avatar, AnnouncementOnly: &announcementOnly})
+
+		assert.NoError(t, err)
+		mockCollection.AssertExpectations(t)
+	})
+
+	t.Run("some settings", func(t *testing.T) {
+		mockCollection := new(mocks.MockCollection)
+		repo := repository.NewChatRepository(mockCollection)
+
+		// Settings left out keep their stored value
+		mockCollection.On("UpdateOne", mock.Anything, bson.M{"_id": chatID}, mock.MatchedBy(func(update bson.M) bool {
+			set := update["$set"].(bson.M)
+			_, hasAvatar := set["avatar"]
+			_, hasAnnouncementOnly := set["announcement_only"]
+			return len(set) == 2 && set["title"] == title && !hasAvatar && !hasAnnouncementOnly
+		})).Return(&mongo.UpdateResult{MatchedCount: 1}, nil)
+
+		err := repo.UpdateChatSettings(context.TODO(), chatID, domain.ChatSettings{Title: &title})
+
+		assert.NoError(t, err)
+		mockCollection.AssertExpectations(t)
+	})
+}
+
+func TestSetRoles(t *testing.T) {
+	mockCollection := new(mocks.MockCollection)
+	repo := repository.NewChatRepository(mockCollection)
+
+	chatID := primitive.NewObjectID()
+	ownerID := primitive.NewObjectID()
+	adminID := primitive.NewObjectID()
+
+	// A hand over writes both roles at once
+	mockCollection.On("UpdateOne", mock.Anything, bson.M{"_id": chatID}, bson.M{"$set": bson.M{
+		"roles." + ownerID.Hex(): domain.RoleOwner,
+		"roles." + adminID.Hex(): domain.RoleAdmin,
+	}}).Return(&mongo.UpdateResult{MatchedCount: 1}, nil)
+
+	err := repo.SetRoles(context.TODO(), chatID, map[primitive.ObjectID]string{ownerID: domain.RoleOwner, adminID: domain.RoleAdmin})
+
+	assert.NoError(t, err)
+	mockCollection.AssertExpectations(t)
+}
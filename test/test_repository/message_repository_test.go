@@ -20,38 +20,65 @@ import (
 func TestSendMessage(t *testing.T) {
 	// Setup
 	mockCollection := new(mocks.MockCollection)
-	repo := repository.NewMessageRepository(mockCollection) 
+	mockChatCollection := new(mocks.MockCollection)
+	repo := repository.NewMessageRepository(mockCollection, mockChatCollection)
 
 	chatID := primitive.NewObjectID()
+	senderID := primitive.NewObjectID()
 	message := &domain.Message{
-		MessageID: primitive.NewObjectID(),
-		Time:      time.Now(),
+		SenderID: senderID,
+		Content:  "Hello",
 	}
 
-	// Mock UpdateOne result
-	updateResult := &mongo.UpdateResult{MatchedCount: 1, ModifiedCount: 1}
-
-	// Use mock.MatchedBy to compare bson.M dynamically
-	mockCollection.On("UpdateOne", mock.Anything, bson.M{"_id": chatID}, mock.MatchedBy(func(update bson.M) bool {
-		// Ensure that "messages" is being pushed and "updated_at" is set
-		_, msgExists := update["$push"].(bson.M)["messages"]
-		_, timeExists := update["$set"].(bson.M)["updated_at"]
-		return msgExists && timeExists
-	})).Return(updateResult, nil)
+	// The message is inserted as its own document tagged with the chat
+	mockCollection.On("InsertOne", mock.Anything, mock.MatchedBy(func(m *domain.Message) bool {
+		return m.ChatID == chatID && !m.MessageID.IsZero() && !m.Time.IsZero() && m.SenderID == senderID
+	})).Return(&mongo.InsertOneResult{}, nil)
+
+	// The chat only records the activity
+	mockChatCollection.On("UpdateOne", mock.Anything, bson.M{"_id": chatID}, mock.MatchedBy(func(update bson.M) bool {
+		set, ok := update["$set"].(bson.M)
+		if !ok {
+			return false
+		}
+		_, timeExists := set["updated_at"]
+		preview, previewExists := set["last_message"].(domain.MessagePreview)
+		_, pushExists := update["$push"]
+		return timeExists && previewExists && preview.Content == "Hello" && !pushExists
+	})).Return(&mongo.UpdateResult{MatchedCount: 1, ModifiedCount: 1}, nil)
 
 	// Execute
 	err := repo.SendMessage(context.TODO(), chatID, message)
 
 	// Verify
 	assert.NoError(t, err)
+	assert.Equal(t, chatID, message.ChatID)
 	mockCollection.AssertExpectations(t)
+	mockChatCollection.AssertExpectations(t)
+}
+
+func TestSendMessageInsertError(t *testing.T) {
+	// Setup
+	mockCollection := new(mocks.MockCollection)
+	mockChatCollection := new(mocks.MockCollection)
+	repo := repository.NewMessageRepository(mockCollection, mockChatCollection)
+
+	mockCollection.On("InsertOne", mock.Anything, mock.Anything).Return((*mongo.InsertOneResult)(nil), errors.New("database error"))
+
+	// Execute
+	err := repo.SendMessage(context.TODO(), primitive.NewObjectID(), &domain.Message{Content: "Hello"})
+
+	// Verify the chat is left untouched
+	assert.EqualError(t, err, "failed to send message: database error")
+	mockChatCollection.AssertNotCalled(t, "UpdateOne", mock.Anything, mock.Anything, mock.Anything)
 }
 
 func TestGetMessage(t *testing.T) {
 	// Create a mock collection and single result
-	mockCollection := new(mocks.MockCollection)
-	mockSingleResult := new(mocks.MockSingleResult)
-	chatRepo := repository.NewMessageRepository(mockCollection)
+	var (
+		mockCollection   *mocks.MockCollection
+		mockSingleResult *mocks.MockSingleResult
+	)
 
 	// Generate common ObjectIDs for consistency
 	commonChatID := primitive.NewObjectID()
@@ -59,40 +86,40 @@ func TestGetMessage(t *testing.T) {
 
 	// Define test cases
 	tests := []struct {
-		name         string
-		chatID       primitive.ObjectID
-		messageID    primitive.ObjectID
-		mockReturn   *domain.Message
-		mockError    error
-		expectedMsg  domain.Message
-		expectedErr  error
+		name        string
+		chatID      primitive.ObjectID
+		messageID   primitive.ObjectID
+		mockReturn  *domain.Message
+		mockError   error
+		expectedMsg domain.Message
+		expectedErr error
 	}{
 		{
-			name:       "Successful retrieval",
-			chatID:     commonChatID, // Use common ID
-			messageID:  commonMessageID,
-			mockReturn: &domain.Message{MessageID: commonMessageID, Content: "Hello"},
-			mockError:  nil,
-			expectedMsg: domain.Message{MessageID: commonMessageID, Content: "Hello"}, // Match with mockReturn
+			name:        "Successful retrieval",
+			chatID:      commonChatID,
+			messageID:   commonMessageID,
+			mockReturn:  &domain.Message{MessageID: commonMessageID, ChatID: commonChatID, Content: "Hello"},
+			mockError:   nil,
+			expectedMsg: domain.Message{MessageID: commonMessageID, ChatID: commonChatID, Content: "Hello"},
 			expectedErr: nil,
 		},
 		{
-			name:       "Message not found",
-			chatID:     primitive.NewObjectID(),
-			messageID:  primitive.NewObjectID(),
-			mockReturn: nil,
-			mockError:  mongo.ErrNoDocuments,
+			name:        "Message not found",
+			chatID:      primitive.NewObjectID(),
+			messageID:   primitive.NewObjectID(),
+			mockReturn:  nil,
+			mockError:   mongo.ErrNoDocuments,
 			expectedMsg: domain.Message{},
-			expectedErr: fmt.Errorf("failed to fetch chat: %w", mongo.ErrNoDocuments),
+			expectedErr: fmt.Errorf("message not found"),
 		},
 		{
-			name:       "Database error",
-			chatID:     primitive.NewObjectID(),
-			messageID:  primitive.NewObjectID(),
-			mockReturn: nil,
-			mockError:  errors.New("some database error"),
+			name:        "Database error",
+			chatID:      primitive.NewObjectID(),
+			messageID:   primitive.NewObjectID(),
+			mockReturn:  nil,
+			mockError:   errors.New("some database error"),
 			expectedMsg: domain.Message{},
-			expectedErr: fmt.Errorf("failed to fetch chat: some database error"),
+			expectedErr: fmt.Errorf("failed to fetch message: some database error"),
 		},
 	}
 
@@ -101,24 +128,24 @@ func TestGetMessage(t *testing.T) {
 			// Reset mocks before each test
 			mockCollection = new(mocks.MockCollection)
 			mockSingleResult = new(mocks.MockSingleResult)
-			chatRepo = repository.NewMessageRepository(mockCollection)
+			repo := repository.NewMessageRepository(mockCollection, new(mocks.MockCollection))
 
-			// Mock the expected FindOne call
-			mockCollection.On("FindOne", mock.Anything, bson.M{"_id": tt.chatID, "messages.messageID": tt.messageID}, mock.Anything).
+			// The message must belong to the requested chat
+			mockCollection.On("FindOne", mock.Anything, bson.M{"_id": tt.messageID, "chat_id": tt.chatID}).
 				Return(mockSingleResult)
 
 			// If message exists, mock the Decode method to return it
 			if tt.mockReturn != nil {
 				mockSingleResult.On("Decode", mock.Anything).Return(nil).Run(func(args mock.Arguments) {
-					arg := args.Get(0).(*[]domain.Message)
-					*arg = []domain.Message{*tt.mockReturn} // Store the mock message in the slice
+					arg := args.Get(0).(*domain.Message)
+					*arg = *tt.mockReturn
 				})
 			} else {
 				mockSingleResult.On("Decode", mock.Anything).Return(tt.mockError)
 			}
 
 			// Execute function
-			msg, err := chatRepo.GetMessage(context.Background(), tt.chatID, tt.messageID)
+			msg, err := repo.GetMessage(context.Background(), tt.chatID, tt.messageID)
 
 			// Assertions
 			assert.Equal(t, tt.expectedMsg, msg)
@@ -134,179 +161,155 @@ func TestGetMessage(t *testing.T) {
 		})
 	}
 }
+
 func TestGetMessages(t *testing.T) {
-	var (
-		mockCollection   *mocks.MockCollection
-		mockSingleResult *mocks.MockSingleResult
-		
-	)
+	t.Run("Success - Messages found", func(t *testing.T) {
+		// Setup
+		mockCollection := new(mocks.MockCollection)
+		mockCursor := new(mocks.MockCursor)
+		repo := repository.NewMessageRepository(mockCollection, new(mocks.MockCollection))
+
+		chatID := primitive.NewObjectID()
+		stored := []domain.Message{
+			{MessageID: primitive.NewObjectID(), ChatID: chatID, Content: "Message 1", Time: time.Now().Add(-time.Hour)},
+			{MessageID: primitive.NewObjectID(), ChatID: chatID, Content: "Message 2", Time: time.Now()},
+		}
+
+		mockCollection.On("Find", mock.Anything, bson.M{"chat_id": chatID}).Return(mockCursor, nil)
+		mockCursor.On("Next", mock.Anything).Return(true).Twice()
+		mockCursor.On("Next", mock.Anything).Return(false).Once()
+		call := 0
+		mockCursor.On("Decode", mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+			arg := args.Get(0).(*domain.Message)
+			*arg = stored[call]
+			call++
+		})
+		mockCursor.On("Err").Return(nil)
+		mockCursor.On("Close", mock.Anything).Return(nil)
+
+		// Execute
+		messages, err := repo.GetMessages(context.Background(), chatID)
+
+		// Verify
+		assert.NoError(t, err)
+		assert.Equal(t, stored, messages)
+		mockCollection.AssertExpectations(t)
+		mockCursor.AssertExpectations(t)
+	})
+
+	t.Run("Database error", func(t *testing.T) {
+		// Setup
+		mockCollection := new(mocks.MockCollection)
+		repo := repository.NewMessageRepository(mockCollection, new(mocks.MockCollection))
+
+		chatID := primitive.NewObjectID()
+		mockCollection.On("Find", mock.Anything, bson.M{"chat_id": chatID}).Return((*mocks.MockCursor)(nil), errors.New("database error"))
+
+		// Execute
+		messages, err := repo.GetMessages(context.Background(), chatID)
+
+		// Verify
+		assert.EqualError(t, err, "failed to fetch messages: database error")
+		assert.Empty(t, messages)
+	})
+}
 
+func TestDeleteMessage(t *testing.T) {
 	tests := []struct {
 		name        string
 		chatID      primitive.ObjectID
-		mockReturn  *domain.Chat
+		messageID   primitive.ObjectID
+		mockResult  *mongo.DeleteResult
 		mockError   error
-		expectedMsg []domain.Message
 		expectedErr error
 	}{
 		{
-			name:   "Success - Messages found",
-			chatID: primitive.NewObjectID(),
-			mockReturn: &domain.Chat{
-				Messages: []domain.Message{
-					{
-						MessageID: primitive.NewObjectID(),
-						Content:   "Message 1",
-						Time:     time.Now().Add(-time.Hour),
-					},
-					{
-						MessageID: primitive.NewObjectID(),
-						Content:   "Message 2", 
-						Time:     time.Now(),
-					},
-				},
-			},
-			mockError: nil,
-			expectedMsg: []domain.Message{
-				{
-					MessageID: primitive.NewObjectID(),
-					Content:   "Message 1",
-					Time:     time.Now().Add(-time.Hour),
-				},
-				{
-					MessageID: primitive.NewObjectID(),
-					Content:   "Message 2",
-					Time:     time.Now(), 
-				},
-			},
+			name:        "Success - Message deleted",
+			chatID:      primitive.NewObjectID(),
+			messageID:   primitive.NewObjectID(),
+			mockResult:  &mongo.DeleteResult{DeletedCount: 1},
+			mockError:   nil,
 			expectedErr: nil,
 		},
+		{
+			name:        "Failure - Message not found",
+			chatID:      primitive.NewObjectID(),
+			messageID:   primitive.NewObjectID(),
+			mockResult:  &mongo.DeleteResult{DeletedCount: 0},
+			mockError:   nil,
+			expectedErr: domain.ErrMessageNotFound,
+		},
 		{
 			name:        "Database error",
 			chatID:      primitive.NewObjectID(),
-			mockReturn:  nil,
+			messageID:   primitive.NewObjectID(),
+			mockResult:  nil,
 			mockError:   errors.New("database error"),
-			expectedMsg: []domain.Message{},
-			expectedErr: fmt.Errorf("failed to fetch chat: database error"),
+			expectedErr: fmt.Errorf("failed to delete message: database error"),
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			// Reset mocks before each test
-			mockCollection = new(mocks.MockCollection)
-			mockSingleResult = new(mocks.MockSingleResult)
-			chatRepo := repository.NewMessageRepository(mockCollection)
-
-			// Mock FindOne
-			mockCollection.On("FindOne", mock.Anything, bson.M{"_id": tt.chatID}).Return(mockSingleResult)
-
-			if tt.mockReturn != nil {
-				mockSingleResult.On("Decode", mock.Anything).Return(nil).Run(func(args mock.Arguments) {
-					arg := args.Get(0).(*domain.Chat)
-					*arg = *tt.mockReturn
-				})
-			} else {
-				mockSingleResult.On("Decode", mock.Anything).Return(tt.mockError)
+			// Reset mocks
+			mockCollection := new(mocks.MockCollection)
+			mockChatCollection := new(mocks.MockCollection)
+			repo := repository.NewMessageRepository(mockCollection, mockChatCollection)
+
+			mockCollection.On("DeleteOne", mock.Anything, bson.M{"_id": tt.messageID, "chat_id": tt.chatID}).
+				Return(tt.mockResult, tt.mockError)
+
+			// A chat previewing the deleted message falls back to the one before it
+			if tt.expectedErr == nil {
+				mockSingleResult := new(mocks.MockSingleResult)
+				mockSingleResult.On("Decode", mock.AnythingOfType("*domain.Message")).Return(nil)
+				mockCollection.On("FindOne", mock.Anything, bson.M{"chat_id": tt.chatID}).Return(mockSingleResult)
+				mockChatCollection.On("UpdateOne", mock.Anything, bson.M{"_id": tt.chatID, "last_message.message_id": tt.messageID}, mock.MatchedBy(func(update bson.M) bool {
+					_, ok := update["$set"].(bson.M)["last_message"]
+					return ok
+				})).Return(&mongo.UpdateResult{}, nil)
 			}
 
 			// Execute
-			messages, err := chatRepo.GetMessages(context.Background(), tt.chatID)
+			err := repo.DeleteMessage(context.Background(), tt.chatID, tt.messageID)
 
 			// Verify
 			if tt.expectedErr != nil {
 				assert.EqualError(t, err, tt.expectedErr.Error())
 			} else {
 				assert.NoError(t, err)
-				assert.Equal(t, len(tt.expectedMsg), len(messages))
 			}
 
 			mockCollection.AssertExpectations(t)
-			mockSingleResult.AssertExpectations(t)
+			mockChatCollection.AssertExpectations(t)
 		})
 	}
 }
 
-func TestDeleteMessage(t *testing.T) {
-	var (
-		mockCollection *mocks.MockCollection
-	)
+func TestDeleteLastMessageOfChat(t *testing.T) {
+	mockCollection := new(mocks.MockCollection)
+	mockChatCollection := new(mocks.MockCollection)
+	repo := repository.NewMessageRepository(mockCollection, mockChatCollection)
 
-	tests := []struct {
-		name        string
-		chatID      primitive.ObjectID
-		messageID   primitive.ObjectID
-		mockResult  *mongo.UpdateResult
-		mockError   error
-		expectedErr error
-	}{
-		{
-			name:      "Success - Message deleted",
-			chatID:    primitive.NewObjectID(),
-			messageID: primitive.NewObjectID(),
-			mockResult: &mongo.UpdateResult{
-				ModifiedCount: 1,
-			},
-			mockError:   nil,
-			expectedErr: nil,
-		},
-		{
-			name:      "Failure - Message not found",
-			chatID:    primitive.NewObjectID(),
-			messageID: primitive.NewObjectID(),
-			mockResult: &mongo.UpdateResult{
-				ModifiedCount: 0,
-			},
-			mockError:   nil,
-			expectedErr: fmt.Errorf("message not found or already deleted"),
-		},
-		{
-			name:       "Database error",
-			chatID:     primitive.NewObjectID(),
-			messageID:  primitive.NewObjectID(),
-			mockResult: nil,
-			mockError:  errors.New("database error"),
-			expectedErr: fmt.Errorf("failed to delete message: database error"),
-		},
-	}
+	chatID := primitive.NewObjectID()
+	messageID := primitive.NewObjectID()
 
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			// Reset mocks
-			mockCollection = new(mocks.MockCollection)
-			chatRepo := repository.NewMessageRepository(mockCollection)
-
-			// Mock UpdateOne with MatchedBy to handle time.Now()
-			mockCollection.On("UpdateOne", 
-				mock.Anything,
-				bson.M{"_id": tt.chatID},
-				mock.MatchedBy(func(update bson.M) bool {
-					pull := update["$pull"].(bson.M)
-					messages := pull["messages"].(bson.M)
-					return messages["message_id"] == tt.messageID && update["$set"] != nil
-				}),
-			).Return(tt.mockResult, tt.mockError)
+	mockSingleResult := new(mocks.MockSingleResult)
+	mockSingleResult.On("Decode", mock.Anything).Return(mongo.ErrNoDocuments)
+	mockCollection.On("DeleteOne", mock.Anything, bson.M{"_id": messageID, "chat_id": chatID}).Return(&mongo.DeleteResult{DeletedCount: 1}, nil)
+	mockCollection.On("FindOne", mock.Anything, bson.M{"chat_id": chatID}).Return(mockSingleResult)
 
-			// Execute
-			err := chatRepo.DeleteMessage(context.Background(), tt.chatID, tt.messageID)
+	// An empty chat has no preview left
+	mockChatCollection.On("UpdateOne", mock.Anything, bson.M{"_id": chatID, "last_message.message_id": messageID}, bson.M{"$unset": bson.M{"last_message": ""}}).
+		Return(&mongo.UpdateResult{}, nil)
 
-			// Verify
-			if tt.expectedErr != nil {
-				assert.EqualError(t, err, tt.expectedErr.Error())
-			} else {
-				assert.NoError(t, err)
-			}
+	err := repo.DeleteMessage(context.Background(), chatID, messageID)
 
-			mockCollection.AssertExpectations(t)
-		})
-	}
+	assert.NoError(t, err)
+	mockChatCollection.AssertExpectations(t)
 }
 
 func TestUpdateMessage(t *testing.T) {
-	var (
-		mockCollection *mocks.MockCollection
-	)
-
 	tests := []struct {
 		name        string
 		chatID      primitive.ObjectID
@@ -317,32 +320,28 @@ func TestUpdateMessage(t *testing.T) {
 		expectedErr error
 	}{
 		{
-			name:      "Success - Message updated",
-			chatID:    primitive.NewObjectID(),
-			messageID: primitive.NewObjectID(),
-			content:   "Updated content",
-			mockResult: &mongo.UpdateResult{
-				ModifiedCount: 1,
-			},
+			name:        "Success - Message updated",
+			chatID:      primitive.NewObjectID(),
+			messageID:   primitive.NewObjectID(),
+			content:     "Updated content",
+			mockResult:  &mongo.UpdateResult{MatchedCount: 1, ModifiedCount: 1},
 			mockError:   nil,
 			expectedErr: nil,
 		},
 		{
-			name:      "Failure - Message not found",
-			chatID:    primitive.NewObjectID(),
-			messageID: primitive.NewObjectID(),
-			content:   "Updated content",
-			mockResult: &mongo.UpdateResult{
-				ModifiedCount: 0,
-			},
+			name:        "Failure - Message not found",
+			chatID:      primitive.NewObjectID(),
+			messageID:   primitive.NewObjectID(),
+			content:     "Updated content",
+			mockResult:  &mongo.UpdateResult{MatchedCount: 0},
 			mockError:   nil,
-			expectedErr: fmt.Errorf("message not found or already updated"),
+			expectedErr: fmt.Errorf("message not found"),
 		},
 		{
-			name:      "Database error",
-			chatID:    primitive.NewObjectID(),
-			messageID: primitive.NewObjectID(),
-			content:   "Updated content",
+			name:        "Database error",
+			chatID:      primitive.NewObjectID(),
+			messageID:   primitive.NewObjectID(),
+			content:     "Updated content",
 			mockResult:  nil,
 			mockError:   errors.New("database error"),
 			expectedErr: fmt.Errorf("failed to update message: database error"),
@@ -352,26 +351,26 @@ func TestUpdateMessage(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			// Reset mocks
-			mockCollection = new(mocks.MockCollection)
-			chatRepo := repository.NewMessageRepository(mockCollection)
+			mockCollection := new(mocks.MockCollection)
+			mockChatCollection := new(mocks.MockCollection)
+			repo := repository.NewMessageRepository(mockCollection, mockChatCollection)
 
-			// Mock UpdateOne correctly with 4 parameters
 			mockCollection.On("UpdateOne",
 				mock.Anything, // Context
-				bson.M{"_id": tt.chatID}, // Filter
-				mock.MatchedBy(func(update bson.M) bool {
-					set, ok := update["$set"].(bson.M)
-					if !ok {
-						return false
-					}
-					delete(set, "updated_at") // Ignore the timestamp comparison
-					return true
-				}),
-				mock.Anything, // Options (like arrayFilters)
+				bson.M{"_id": tt.messageID, "chat_id": tt.chatID}, // Filter
+				bson.M{"$set": bson.M{"content": tt.content, "edited": true}},
 			).Return(tt.mockResult, tt.mockError)
 
+			// The preview follows the edit when it shows this message
+			if tt.expectedErr == nil {
+				mockChatCollection.On("UpdateOne", mock.Anything,
+					bson.M{"_id": tt.chatID, "last_message.message_id": tt.messageID},
+					bson.M{"$set": bson.M{"last_message.content": tt.content}},
+				).Return(&mongo.UpdateResult{}, nil)
+			}
+
 			// Execute the function being tested
-			err := chatRepo.UpdateMessage(context.Background(), tt.chatID, tt.messageID, tt.content)
+			err := repo.UpdateMessage(context.Background(), tt.chatID, tt.messageID, tt.content)
 
 			// Verify the expected result
 			if tt.expectedErr != nil {
@@ -382,6 +381,173 @@ func TestUpdateMessage(t *testing.T) {
 
 			// Ensure the mock expectations are met
 			mockCollection.AssertExpectations(t)
+			mockChatCollection.AssertExpectations(t)
 		})
 	}
-}
\ No newline at end of file
+}
+
+func TestDeleteMessagesByChat(t *testing.T) {
+	// Setup
+	mockCollection := new(mocks.MockCollection)
+	repo := repository.NewMessageRepository(mockCollection, new(mocks.MockCollection))
+
+	chatID := primitive.NewObjectID()
+	mockCollection.On("DeleteMany", mock.Anything, bson.M{"chat_id": chatID}).Return(&mongo.DeleteResult{DeletedCount: 3}, nil)
+
+	// Execute
+	err := repo.DeleteMessagesByChat(context.Background(), chatID)
+
+	// Verify
+	assert.NoError(t, err)
+	mockCollection.AssertExpectations(t)
+}
+
+// cursorOver returns a mock cursor yielding the given messages in order
+func cursorOver(messages []domain.Message) *mocks.MockCursor {
+	mockCursor := new(mocks.MockCursor)
+	mockCursor.On("Next", mock.Anything).Return(true).Times(len(messages))
+	mockCursor.On("Next", mock.Anything).Return(false).Once()
+	call := 0
+	mockCursor.On("Decode", mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+		arg := args.Get(0).(*domain.Message)
+		*arg = messages[call]
+		call++
+	})
+	mockCursor.On("Err").Return(nil)
+	mockCursor.On("Close", mock.Anything).Return(nil)
+	return mockCursor
+}
+
+func TestGetMessagesBefore(t *testing.T) {
+	chatID := primitive.NewObjectID()
+	now := time.Now()
+	older := domain.Message{MessageID: primitive.NewObjectID(), ChatID: chatID, Content: "older", Time: now.Add(-2 * time.Minute)}
+	newer := domain.Message{MessageID: primitive.NewObjectID(), ChatID: chatID, Content: "newer", Time: now.Add(-time.Minute)}
+
+	t.Run("Latest page", func(t *testing.T) {
+		mockCollection := new(mocks.MockCollection)
+		repo := repository.NewMessageRepository(mockCollection, new(mocks.MockCollection))
+
+		// The collection yields newest first
+		mockCollection.On("Find", mock.Anything, bson.M{"chat_id": chatID}).Return(cursorOver([]domain.Message{newer, older}), nil)
+
+		messages, err := repo.GetMessagesBefore(context.Background(), chatID, nil, 2)
+
+		// The page comes back in chronological order
+		assert.NoError(t, err)
+		assert.Equal(t, []domain.Message{older, newer}, messages)
+		mockCollection.AssertExpectations(t)
+	})
+
+	t.Run("Before a message", func(t *testing.T) {
+		mockCollection := new(mocks.MockCollection)
+		repo := repository.NewMessageRepository(mockCollection, new(mocks.MockCollection))
+
+		cursor := domain.MessageCursor{Time: now, MessageID: primitive.NewObjectID()}
+		expectedFilter := bson.M{
+			"chat_id": chatID,
+			"$or": bson.A{
+				bson.M{"time": bson.M{"$lt": cursor.Time}},
+				bson.M{"time": cursor.Time, "_id": bson.M{"$lt": cursor.MessageID}},
+			},
+		}
+		mockCollection.On("Find", mock.Anything, expectedFilter).Return(cursorOver([]domain.Message{newer}), nil)
+
+		messages, err := repo.GetMessagesBefore(context.Background(), chatID, &cursor, 1)
+
+		assert.NoError(t, err)
+		assert.Equal(t, []domain.Message{newer}, messages)
+		mockCollection.AssertExpectations(t)
+	})
+}
+
+func TestGetMessagesAfter(t *testing.T) {
+	t.Run("After a timestamp", func(t *testing.T) {
+		mockCollection := new(mocks.MockCollection)
+		repo := repository.NewMessageRepository(mockCollection, new(mocks.MockCollection))
+
+		chatID := primitive.NewObjectID()
+		cursor := domain.MessageCursor{Time: time.Now().Add(-time.Hour)}
+		stored := []domain.Message{
+			{MessageID: primitive.NewObjectID(), ChatID: chatID, Content: "first", Time: time.Now().Add(-time.Minute)},
+			{MessageID: primitive.NewObjectID(), ChatID: chatID, Content: "second", Time: time.Now()},
+		}
+
+		mockCollection.On("Find", mock.Anything, bson.M{"chat_id": chatID, "time": bson.M{"$gt": cursor.Time}}).
+			Return(cursorOver(stored), nil)
+
+		messages, err := repo.GetMessagesAfter(context.Background(), chatID, cursor, 2)
+
+		assert.NoError(t, err)
+		assert.Equal(t, stored, messages)
+		mockCollection.AssertExpectations(t)
+	})
+
+	t.Run("Database error", func(t *testing.T) {
+		mockCollection := new(mocks.MockCollection)
+		repo := repository.NewMessageRepository(mockCollection, new(mocks.MockCollection))
+
+		mockCollection.On("Find", mock.Anything, mock.Anything).Return((*mocks.MockCursor)(nil), errors.New("database error"))
+
+		messages, err := repo.GetMessagesAfter(context.Background(), primitive.NewObjectID(), domain.MessageCursor{Time: time.Now()}, 10)
+
+		assert.EqualError(t, err, "failed to fetch messages: database error")
+		assert.Empty(t, messages)
+	})
+}
+
+func TestCountUnread(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		mockCollection := new(mocks.MockCollection)
+		mockCursor := new(mocks.MockCursor)
+		repo := repository.NewMessageRepository(mockCollection, new(mocks.MockCollection))
+
+		userID := primitive.NewObjectID()
+		chatID := primitive.NewObjectID()
+		since := map[primitive.ObjectID]*domain.MessageCursor{chatID: {Time: time.Now(), MessageID: primitive.NewObjectID()}}
+
+		// A single aggregation counts every chat, skipping the user's own messages
+		mockCollection.On("Aggregate", mock.Anything, mock.MatchedBy(func(pipeline mongo.Pipeline) bool {
+			match := pipeline[0][0].Value.(bson.M)
+			chats := match["$or"].(bson.A)
+			return len(pipeline) == 2 && len(chats) == 1 && match["sender_id"].(bson.M)["$ne"] == userID
+		})).Return(mockCursor, nil)
+		mockCursor.On("Next", mock.Anything).Return(true).Once()
+		mockCursor.On("Next", mock.Anything).Return(false)
+		mockCursor.On("Decode", mock.Anything).Run(func(args mock.Arguments) {
+			result := args.Get(0)
+			bytes, _ := bson.Marshal(bson.M{"_id": chatID, "unread": int64(3)})
+			_ = bson.Unmarshal(bytes, result)
+		}).Return(nil)
+		mockCursor.On("Err").Return(nil)
+		mockCursor.On("Close", mock.Anything).Return(nil)
+
+		counts, err := repo.CountUnread(context.Background(), userID, since)
+
+		assert.NoError(t, err)
+		assert.Equal(t, map[primitive.ObjectID]int64{chatID: 3}, counts)
+		mockCollection.AssertExpectations(t)
+	})
+
+	t.Run("No chats", func(t *testing.T) {
+		mockCollection := new(mocks.MockCollection)
+		repo := repository.NewMessageRepository(mockCollection, new(mocks.MockCollection))
+
+		counts, err := repo.CountUnread(context.Background(), primitive.NewObjectID(), nil)
+
+		assert.NoError(t, err)
+		assert.Empty(t, counts)
+		mockCollection.AssertNotCalled(t, "Aggregate", mock.Anything, mock.Anything)
+	})
+
+	t.Run("Database error", func(t *testing.T) {
+		mockCollection := new(mocks.MockCollection)
+		repo := repository.NewMessageRepository(mockCollection, new(mocks.MockCollection))
+
+		mockCollection.On("Aggregate", mock.Anything, mock.Anything).Return((*mocks.MockCursor)(nil), errors.New("database error"))
+
+		_, err := repo.CountUnread(context.Background(), primitive.NewObjectID(), map[primitive.ObjectID]*domain.MessageCursor{primitive.NewObjectID(): nil})
+
+		assert.EqualError(t, err, "failed to count unread messages: database error")
+	})
+}
@@ -49,3 +49,41 @@ func (m *MockChatRepository) GetChatByParticipants(ctx context.Context, SenderID
 	}
 	return args.Get(0).(*domain.Chat), args.Error(1)
 }
+
+func (m *MockChatRepository) UpdateReadMarker(ctx context.Context, chatID, userID primitive.ObjectID, marker domain.ReadMarker) (bool, error) {
+	args := m.Called(ctx, chatID, userID, marker)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockChatRepository) GetRecentChats(ctx context.Context, userID primitive.ObjectID) ([]domain.Chat, error) {
+	args := m.Called(ctx, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]domain.Chat), args.Error(1)
+}
+
+func (m *MockChatRepository) CreateGroupChat(ctx context.Context, chat *domain.Chat) (primitive.ObjectID, error) {
+	args := m.Called(ctx, chat)
+	return args.Get(0).(primitive.ObjectID), args.Error(1)
+}
+
+func (m *MockChatRepository) AddParticipants(ctx context.Context, chatID primitive.ObjectID, userIDs []primitive.ObjectID) error {
+	args := m.Called(ctx, chatID, userIDs)
+	return args.Error(0)
+}
+
+func (m *MockChatRepository) RemoveParticipant(ctx context.Context, chatID, userID primitive.ObjectID) error {
+	args := m.Called(ctx, chatID, userID)
+	return args.Error(0)
+}
+
+func (m *MockChatRepository) UpdateChatSettings(ctx context.Context, chatID primitive.ObjectID, settings domain.ChatSettings) error {
+	args := m.Called(ctx, chatID, settings)
+	return args.Error(0)
+}
+
+func (m *MockChatRepository) SetRoles(ctx context.Context, chatID primitive.ObjectID, roles map[primitive.ObjectID]string) error {
+	args := m.Called(ctx, chatID, roles)
+	return args.Error(0)
+}
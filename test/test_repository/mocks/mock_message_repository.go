@@ -35,3 +35,26 @@ func (m *MockMessageRepository) UpdateMessage(ctx context.Context, chatID, messa
 	args := m.Called(ctx, chatID, messageID, newContent)
 	return args.Error(0)
 }
+
+func (m *MockMessageRepository) DeleteMessagesByChat(ctx context.Context, chatID primitive.ObjectID) error {
+	args := m.Called(ctx, chatID)
+	return args.Error(0)
+}
+
+func (m *MockMessageRepository) GetMessagesBefore(ctx context.Context, chatID primitive.ObjectID, cursor *domain.MessageCursor, limit int) ([]domain.Message, error) {
+	args := m.Called(ctx, chatID, cursor, limit)
+	return args.Get(0).([]domain.Message), args.Error(1)
+}
+
+func (m *MockMessageRepository) GetMessagesAfter(ctx context.Context, chatID primitive.ObjectID, cursor domain.MessageCursor, limit int) ([]domain.Message, error) {
+	args := m.Called(ctx, chatID, cursor, limit)
+	return args.Get(0).([]domain.Message), args.Error(1)
+}
+
+func (m *MockMessageRepository) CountUnread(ctx context.Context, userID primitive.ObjectID, since map[primitive.ObjectID]*domain.MessageCursor) (map[primitive.ObjectID]int64, error) {
+	args := m.Called(ctx, userID, since)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(map[primitive.ObjectID]int64), args.Error(1)
+}
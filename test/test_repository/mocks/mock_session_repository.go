@@ -0,0 +1,54 @@
+package mocks
+
+import (
+	"Real-Time-Chat-Application/domain"
+	"context"
+
+	"github.com/stretchr/testify/mock"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type MockSessionRepository struct {
+	mock.Mock
+}
+
+func (m *MockSessionRepository) CreateSession(ctx context.Context, session *domain.Session) error {
+	args := m.Called(ctx, session)
+	return args.Error(0)
+}
+
+func (m *MockSessionRepository) GetSession(ctx context.Context, sessionID primitive.ObjectID) (*domain.Session, error) {
+	args := m.Called(ctx, sessionID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.Session), args.Error(1)
+}
+
+func (m *MockSessionRepository) GetSessionsByUserID(ctx context.Context, userID primitive.ObjectID) ([]domain.Session, error) {
+	args := m.Called(ctx, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]domain.Session), args.Error(1)
+}
+
+func (m *MockSessionRepository) RotateSession(ctx context.Context, sessionID primitive.ObjectID, refreshTokenHash string, update *domain.Session) error {
+	args := m.Called(ctx, sessionID, refreshTokenHash, update)
+	return args.Error(0)
+}
+
+func (m *MockSessionRepository) DeleteSession(ctx context.Context, userID, sessionID primitive.ObjectID) error {
+	args := m.Called(ctx, userID, sessionID)
+	return args.Error(0)
+}
+
+func (m *MockSessionRepository) DeleteSessions(ctx context.Context, userID primitive.ObjectID) error {
+	args := m.Called(ctx, userID)
+	return args.Error(0)
+}
+
+func (m *MockSessionRepository) DeleteOtherSessions(ctx context.Context, userID, sessionID primitive.ObjectID) error {
+	args := m.Called(ctx, userID, sessionID)
+	return args.Error(0)
+}
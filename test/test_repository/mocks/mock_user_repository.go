@@ -3,6 +3,7 @@ package mocks
 import (
 	"Real-Time-Chat-Application/domain"
 	"context"
+	"time"
 
 	"github.com/stretchr/testify/mock"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -51,3 +52,36 @@ func (m *MockUserRepository) DeleteUser(ctx context.Context, userID primitive.Ob
 	return args.Error(0)
 }
 
+
+func (m *MockUserRepository) GetUsersByIDs(ctx context.Context, userIDs []primitive.ObjectID) ([]domain.User, error) {
+	args := m.Called(ctx, userIDs)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]domain.User), args.Error(1)
+}
+
+func (m *MockUserRepository) UpdateLastSeen(ctx context.Context, userID primitive.ObjectID, lastSeen time.Time) error {
+	args := m.Called(ctx, userID, lastSeen)
+	return args.Error(0)
+}
+
+func (m *MockUserRepository) MarkEmailVerified(ctx context.Context, userID primitive.ObjectID) error {
+	args := m.Called(ctx, userID)
+	return args.Error(0)
+}
+
+func (m *MockUserRepository) SetTwoFactor(ctx context.Context, userID primitive.ObjectID, twoFactor *domain.TwoFactor) error {
+	args := m.Called(ctx, userID, twoFactor)
+	return args.Error(0)
+}
+
+func (m *MockUserRepository) UseTOTPStep(ctx context.Context, userID primitive.ObjectID, step int64) error {
+	args := m.Called(ctx, userID, step)
+	return args.Error(0)
+}
+
+func (m *MockUserRepository) UseRecoveryCode(ctx context.Context, userID primitive.ObjectID, hash string) error {
+	args := m.Called(ctx, userID, hash)
+	return args.Error(0)
+}
@@ -0,0 +1,37 @@
+package mocks
+
+import (
+	"Real-Time-Chat-Application/domain"
+	"context"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type MockUserTokenRepository struct {
+	mock.Mock
+}
+
+func (m *MockUserTokenRepository) CreateToken(ctx context.Context, token *domain.UserToken) error {
+	args := m.Called(ctx, token)
+	return args.Error(0)
+}
+
+func (m *MockUserTokenRepository) ConsumeToken(ctx context.Context, purpose, hash string, now time.Time) (*domain.UserToken, error) {
+	args := m.Called(ctx, purpose, hash, now)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.UserToken), args.Error(1)
+}
+
+func (m *MockUserTokenRepository) DeleteTokens(ctx context.Context, userID primitive.ObjectID, purpose string) error {
+	args := m.Called(ctx, userID, purpose)
+	return args.Error(0)
+}
+
+func (m *MockUserTokenRepository) LatestTokenTime(ctx context.Context, userID primitive.ObjectID, purpose string) (time.Time, error) {
+	args := m.Called(ctx, userID, purpose)
+	return args.Get(0).(time.Time), args.Error(1)
+}
@@ -0,0 +1,167 @@
+package test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"Real-Time-Chat-Application/domain"
+	"Real-Time-Chat-Application/repository"
+	"Real-Time-Chat-Application/test/mongo/mocks"
+)
+
+func TestCreateSession(t *testing.T) {
+	mockCollection := new(mocks.MockCollection)
+	repo := repository.NewSessionRepository(mockCollection)
+
+	session := &domain.Session{UserID: primitive.NewObjectID(), RefreshTokenHash: "hash"}
+	mockCollection.On("InsertOne", mock.Anything, session).Return(&mongo.InsertOneResult{}, nil)
+
+	err := repo.CreateSession(context.TODO(), session)
+
+	assert.NoError(t, err)
+	assert.False(t, session.SessionID.IsZero())
+	mockCollection.AssertExpectations(t)
+}
+
+func TestGetSession(t *testing.T) {
+	sessionID := primitive.NewObjectID()
+
+	t.Run("Success", func(t *testing.T) {
+		mockCollection := new(mocks.MockCollection)
+		mockSingleResult := new(mocks.MockSingleResult)
+		repo := repository.NewSessionRepository(mockCollection)
+
+		mockSingleResult.On("Decode", mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+			*args.Get(0).(*domain.Session) = domain.Session{SessionID: sessionID, DeviceName: "Laptop"}
+		})
+		mockCollection.On("FindOne", mock.Anything, bson.M{"_id": sessionID}).Return(mockSingleResult)
+
+		session, err := repo.GetSession(context.TODO(), sessionID)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "Laptop", session.DeviceName)
+	})
+
+	t.Run("Failure - Not Found", func(t *testing.T) {
+		mockCollection := new(mocks.MockCollection)
+		mockSingleResult := new(mocks.MockSingleResult)
+		repo := repository.NewSessionRepository(mockCollection)
+
+		mockSingleResult.On("Decode", mock.Anything).Return(mongo.ErrNoDocuments)
+		mockCollection.On("FindOne", mock.Anything, bson.M{"_id": sessionID}).Return(mockSingleResult)
+
+		session, err := repo.GetSession(context.TODO(), sessionID)
+
+		assert.ErrorIs(t, err, domain.ErrSessionNotFound)
+		assert.Nil(t, session)
+	})
+}
+
+func TestGetSessionsByUserID(t *testing.T) {
+	mockCollection := new(mocks.MockCollection)
+	mockCursor := new(mocks.MockCursor)
+	repo := repository.NewSessionRepository(mockCollection)
+
+	userID := primitive.NewObjectID()
+	mockCollection.On("Find", mock.Anything, bson.M{"user_id": userID}).Return(mockCursor, nil)
+	mockCursor.On("Next", mock.Anything).Return(true).Once()
+	mockCursor.On("Next", mock.Anything).Return(false).Once()
+	mockCursor.On("Decode", mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+		*args.Get(0).(*domain.Session) = domain.Session{UserID: userID, DeviceName: "Phone"}
+	})
+	mockCursor.On("Err").Return(nil)
+	mockCursor.On("Close", mock.Anything).Return(nil)
+
+	sessions, err := repo.GetSessionsByUserID(context.TODO(), userID)
+
+	assert.NoError(t, err)
+	assert.Len(t, sessions, 1)
+	assert.Equal(t, "Phone", sessions[0].DeviceName)
+}
+
+func TestRotateSession(t *testing.T) {
+	sessionID := primitive.NewObjectID()
+	now := time.Now()
+	update := &domain.Session{RefreshTokenHash: "new", IP: "192.0.2.1", UserAgent: "agent", LastActiveAt: now, ExpiresAt: now.Add(time.Hour)}
+	filter := bson.M{"_id": sessionID, "refresh_token_hash": "old"}
+	set := bson.M{"$set": bson.M{
+		"refresh_token_hash": "new",
+		"ip":                 "192.0.2.1",
+		"user_agent":         "agent",
+		"last_active_at":     now,
+		"expires_at":         now.Add(time.Hour),
+	}}
+
+	t.Run("Success", func(t *testing.T) {
+		mockCollection := new(mocks.MockCollection)
+		repo := repository.NewSessionRepository(mockCollection)
+		mockCollection.On("UpdateOne", mock.Anything, filter, set).Return(&mongo.UpdateResult{MatchedCount: 1, ModifiedCount: 1}, nil)
+
+		err := repo.RotateSession(context.TODO(), sessionID, "old", update)
+
+		assert.NoError(t, err)
+		mockCollection.AssertExpectations(t)
+	})
+
+	t.Run("Failure - Revoked Or Token Already Used", func(t *testing.T) {
+		mockCollection := new(mocks.MockCollection)
+		repo := repository.NewSessionRepository(mockCollection)
+		mockCollection.On("UpdateOne", mock.Anything, filter, set).Return(&mongo.UpdateResult{MatchedCount: 0}, nil)
+
+		err := repo.RotateSession(context.TODO(), sessionID, "old", update)
+
+		assert.ErrorIs(t, err, domain.ErrSessionNotFound)
+	})
+}
+
+func TestDeleteSession(t *testing.T) {
+	userID := primitive.NewObjectID()
+	sessionID := primitive.NewObjectID()
+	filter := bson.M{"_id": sessionID, "user_id": userID}
+
+	t.Run("Success", func(t *testing.T) {
+		mockCollection := new(mocks.MockCollection)
+		repo := repository.NewSessionRepository(mockCollection)
+		mockCollection.On("DeleteOne", mock.Anything, filter).Return(&mongo.DeleteResult{DeletedCount: 1}, nil)
+
+		assert.NoError(t, repo.DeleteSession(context.TODO(), userID, sessionID))
+	})
+
+	t.Run("Failure - Not Found", func(t *testing.T) {
+		mockCollection := new(mocks.MockCollection)
+		repo := repository.NewSessionRepository(mockCollection)
+		mockCollection.On("DeleteOne", mock.Anything, filter).Return(&mongo.DeleteResult{DeletedCount: 0}, nil)
+
+		assert.ErrorIs(t, repo.DeleteSession(context.TODO(), userID, sessionID), domain.ErrSessionNotFound)
+	})
+}
+
+func TestDeleteSessions(t *testing.T) {
+	mockCollection := new(mocks.MockCollection)
+	repo := repository.NewSessionRepository(mockCollection)
+
+	userID := primitive.NewObjectID()
+	mockCollection.On("DeleteMany", mock.Anything, bson.M{"user_id": userID}).Return(&mongo.DeleteResult{DeletedCount: 3}, nil)
+
+	assert.NoError(t, repo.DeleteSessions(context.TODO(), userID))
+	mockCollection.AssertExpectations(t)
+}
+
+func TestDeleteOtherSessions(t *testing.T) {
+	mockCollection := new(mocks.MockCollection)
+	repo := repository.NewSessionRepository(mockCollection)
+
+	userID := primitive.NewObjectID()
+	sessionID := primitive.NewObjectID()
+	mockCollection.On("DeleteMany", mock.Anything, bson.M{"user_id": userID, "_id": bson.M{"$ne": sessionID}}).Return(&mongo.DeleteResult{DeletedCount: 2}, nil)
+
+	assert.NoError(t, repo.DeleteOtherSessions(context.TODO(), userID, sessionID))
+	mockCollection.AssertExpectations(t)
+}
@@ -76,7 +76,7 @@ func TestCreateUser(t *testing.T) {
 
 		// Verify
 		assert.Error(t, err)
-		assert.Contains(t, err.Error(), "write exception: write errors: [duplicate username]")
+		assert.ErrorIs(t, err, domain.ErrUserExists)
 		mockCollection.AssertExpectations(t)
 	})
 }
@@ -134,7 +134,7 @@ func TestGetUserByUsername(t *testing.T) {
 		// Verify
 		assert.Error(t, err)
 		assert.Nil(t, user)
-		assert.Equal(t, mongo.ErrNoDocuments.Error(), err.Error())
+		assert.ErrorIs(t, err, domain.ErrUserNotFound)
 		mockCollection.AssertExpectations(t)
 		mockSingleResult.AssertExpectations(t)
 	})
@@ -194,7 +194,7 @@ func TestGetUserByID(t *testing.T) {
 		// Verify
 		assert.Error(t, err)
 		assert.Nil(t, user)
-		assert.Equal(t, mongo.ErrNoDocuments.Error(), err.Error())
+		assert.ErrorIs(t, err, domain.ErrUserNotFound)
 		mockCollection.AssertExpectations(t)
 		mockSingleResult.AssertExpectations(t)
 	})
@@ -217,7 +217,7 @@ func TestUpdateUser(t *testing.T) {
 			// Verify the update has the correct structure
 			setMap := update["$set"].(bson.M)
 			return setMap["username"] == "newusername" && setMap["password"] != ""
-		})).Return(&mongo.UpdateResult{ModifiedCount: 1}, nil)
+		})).Return(&mongo.UpdateResult{MatchedCount: 1, ModifiedCount: 1}, nil)
 
 		// Execute
 		err := repo.UpdateUser(context.TODO(), userID, updateUser)
@@ -240,7 +240,7 @@ func TestUpdateUser(t *testing.T) {
 
 		// Verify
 		assert.Error(t, err)
-		assert.Contains(t, err.Error(), "No fields provided for update")
+		assert.ErrorIs(t, err, domain.ErrNothingToUpdate)
 		mockCollection.AssertExpectations(t)
 	})
 
@@ -288,6 +288,25 @@ func TestDeleteUser(t *testing.T) {
 		mockCollection.AssertExpectations(t)
 	})
 
+	t.Run("Failure - User Not Found", func(t *testing.T) {
+		// Setup
+		mockCollection := new(mocks.MockCollection)
+		repo := repository.NewUserRepository(mockCollection)
+
+		userID := primitive.NewObjectID()
+
+		// Mock DeleteOne matching nothing
+		mockCollection.On("DeleteOne", mock.Anything, bson.M{"_id": userID}).
+			Return(&mongo.DeleteResult{DeletedCount: 0}, nil)
+
+		// Execute
+		err := repo.DeleteUser(context.TODO(), userID)
+
+		// Verify
+		assert.ErrorIs(t, err, domain.ErrUserNotFound)
+		mockCollection.AssertExpectations(t)
+	})
+
 	t.Run("Failure - Delete Error", func(t *testing.T) {
 		// Setup
 		mockCollection := new(mocks.MockCollection)
@@ -308,3 +327,169 @@ func TestDeleteUser(t *testing.T) {
 		mockCollection.AssertExpectations(t)
 	})
 }
+
+func TestGetUsersByIDs(t *testing.T) {
+	mockCollection := new(mocks.MockCollection)
+	mockCursor := new(mocks.MockCursor)
+	repo := repository.NewUserRepository(mockCollection)
+
+	userIDs := []primitive.ObjectID{primitive.NewObjectID()}
+	expectedUser := domain.User{UserID: userIDs[0], Username: "testuser"}
+
+	mockCollection.On("Find", mock.Anything, bson.M{"_id": bson.M{"$in": userIDs}}).Return(mockCursor, nil)
+	mockCursor.On("Next", mock.Anything).Return(true).Once()
+	mockCursor.On("Decode", mock.Anything).Run(func(args mock.Arguments) {
+		*args.Get(0).(*domain.User) = expectedUser
+	}).Return(nil)
+	mockCursor.On("Next", mock.Anything).Return(false).Once()
+	mockCursor.On("Close", mock.Anything).Return(nil)
+	mockCursor.On("Err").Return(nil)
+
+	users, err := repo.GetUsersByIDs(context.TODO(), userIDs)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []domain.User{expectedUser}, users)
+	mockCollection.AssertExpectations(t)
+}
+
+func TestUpdateLastSeen(t *testing.T) {
+	mockCollection := new(mocks.MockCollection)
+	repo := repository.NewUserRepository(mockCollection)
+
+	userID := primitive.NewObjectID()
+	lastSeen := time.Now()
+
+	mockCollection.On("UpdateOne", mock.Anything, bson.M{"_id": userID}, bson.M{"$set": bson.M{"last_seen": lastSeen}}).
+		Return(&mongo.UpdateResult{MatchedCount: 1, ModifiedCount: 1}, nil)
+
+	err := repo.UpdateLastSeen(context.TODO(), userID, lastSeen)
+
+	assert.NoError(t, err)
+	mockCollection.AssertExpectations(t)
+}
+
+func TestMarkEmailVerified(t *testing.T) {
+	userID := primitive.NewObjectID()
+	update := bson.M{"$set": bson.M{"email_verified": true}}
+
+	t.Run("Success", func(t *testing.T) {
+		mockCollection := new(mocks.MockCollection)
+		repo := repository.NewUserRepository(mockCollection)
+		mockCollection.On("UpdateOne", mock.Anything, bson.M{"_id": userID}, update).
+			Return(&mongo.UpdateResult{MatchedCount: 1, ModifiedCount: 1}, nil)
+
+		err := repo.MarkEmailVerified(context.TODO(), userID)
+
+		assert.NoError(t, err)
+		mockCollection.AssertExpectations(t)
+	})
+
+	t.Run("Failure - Not Found", func(t *testing.T) {
+		mockCollection := new(mocks.MockCollection)
+		repo := repository.NewUserRepository(mockCollection)
+		mockCollection.On("UpdateOne", mock.Anything, bson.M{"_id": userID}, update).
+			Return(&mongo.UpdateResult{MatchedCount: 0}, nil)
+
+		err := repo.MarkEmailVerified(context.TODO(), userID)
+
+		assert.ErrorIs(t, err, domain.ErrUserNotFound)
+	})
+}
+
+func TestSetTwoFactor(t *testing.T) {
+	userID := primitive.NewObjectID()
+	twoFactor := &domain.TwoFactor{Secret: "SECRET"}
+
+	t.Run("Success", func(t *testing.T) {
+		mockCollection := new(mocks.MockCollection)
+		repo := repository.NewUserRepository(mockCollection)
+		mockCollection.On("UpdateOne", mock.Anything, bson.M{"_id": userID}, bson.M{"$set": bson.M{"two_factor": twoFactor}}).
+			Return(&mongo.UpdateResult{MatchedCount: 1, ModifiedCount: 1}, nil)
+
+		err := repo.SetTwoFactor(context.TODO(), userID, twoFactor)
+
+		assert.NoError(t, err)
+		mockCollection.AssertExpectations(t)
+	})
+
+	t.Run("Success - Disable", func(t *testing.T) {
+		mockCollection := new(mocks.MockCollection)
+		repo := repository.NewUserRepository(mockCollection)
+		mockCollection.On("UpdateOne", mock.Anything, bson.M{"_id": userID}, bson.M{"$unset": bson.M{"two_factor": ""}}).
+			Return(&mongo.UpdateResult{MatchedCount: 1, ModifiedCount: 1}, nil)
+
+		err := repo.SetTwoFactor(context.TODO(), userID, nil)
+
+		assert.NoError(t, err)
+		mockCollection.AssertExpectations(t)
+	})
+
+	t.Run("Failure - Not Found", func(t *testing.T) {
+		mockCollection := new(mocks.MockCollection)
+		repo := repository.NewUserRepository(mockCollection)
+		mockCollection.On("UpdateOne", mock.Anything, bson.M{"_id": userID}, mock.Anything).
+			Return(&mongo.UpdateResult{MatchedCount: 0}, nil)
+
+		err := repo.SetTwoFactor(context.TODO(), userID, twoFactor)
+
+		assert.ErrorIs(t, err, domain.ErrUserNotFound)
+	})
+}
+
+func TestUseTOTPStep(t *testing.T) {
+	userID := primitive.NewObjectID()
+	filter := bson.M{"_id": userID, "two_factor.enabled": true, "two_factor.last_used_step": bson.M{"$lt": int64(42)}}
+	update := bson.M{"$set": bson.M{"two_factor.last_used_step": int64(42)}}
+
+	t.Run("Success", func(t *testing.T) {
+		mockCollection := new(mocks.MockCollection)
+		repo := repository.NewUserRepository(mockCollection)
+		mockCollection.On("UpdateOne", mock.Anything, filter, update).
+			Return(&mongo.UpdateResult{MatchedCount: 1, ModifiedCount: 1}, nil)
+
+		err := repo.UseTOTPStep(context.TODO(), userID, 42)
+
+		assert.NoError(t, err)
+		mockCollection.AssertExpectations(t)
+	})
+
+	t.Run("Failure - Step Already Used", func(t *testing.T) {
+		mockCollection := new(mocks.MockCollection)
+		repo := repository.NewUserRepository(mockCollection)
+		mockCollection.On("UpdateOne", mock.Anything, filter, update).
+			Return(&mongo.UpdateResult{MatchedCount: 0}, nil)
+
+		err := repo.UseTOTPStep(context.TODO(), userID, 42)
+
+		assert.ErrorIs(t, err, domain.ErrInvalidTwoFactorCode)
+	})
+}
+
+func TestUseRecoveryCode(t *testing.T) {
+	userID := primitive.NewObjectID()
+	filter := bson.M{"_id": userID, "two_factor.enabled": true, "two_factor.recovery_codes": "hash"}
+	update := bson.M{"$pull": bson.M{"two_factor.recovery_codes": "hash"}}
+
+	t.Run("Success", func(t *testing.T) {
+		mockCollection := new(mocks.MockCollection)
+		repo := repository.NewUserRepository(mockCollection)
+		mockCollection.On("UpdateOne", mock.Anything, filter, update).
+			Return(&mongo.UpdateResult{MatchedCount: 1, ModifiedCount: 1}, nil)
+
+		err := repo.UseRecoveryCode(context.TODO(), userID, "hash")
+
+		assert.NoError(t, err)
+		mockCollection.AssertExpectations(t)
+	})
+
+	t.Run("Failure - Unknown Or Used Code", func(t *testing.T) {
+		mockCollection := new(mocks.MockCollection)
+		repo := repository.NewUserRepository(mockCollection)
+		mockCollection.On("UpdateOne", mock.Anything, filter, update).
+			Return(&mongo.UpdateResult{MatchedCount: 0}, nil)
+
+		err := repo.UseRecoveryCode(context.TODO(), userID, "hash")
+
+		assert.ErrorIs(t, err, domain.ErrInvalidTwoFactorCode)
+	})
+}
@@ -0,0 +1,138 @@
+package test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"Real-Time-Chat-Application/domain"
+	"Real-Time-Chat-Application/repository"
+	"Real-Time-Chat-Application/test/mongo/mocks"
+)
+
+func TestCreateToken(t *testing.T) {
+	mockCollection := new(mocks.MockCollection)
+	repo := repository.NewUserTokenRepository(mockCollection)
+
+	tokenID := primitive.NewObjectID()
+	token := &domain.UserToken{UserID: primitive.NewObjectID(), Purpose: domain.TokenPasswordReset, Hash: "hash"}
+	mockCollection.On("InsertOne", mock.Anything, token).Return(&mongo.InsertOneResult{InsertedID: tokenID}, nil)
+
+	err := repo.CreateToken(context.TODO(), token)
+
+	assert.NoError(t, err)
+	assert.Equal(t, tokenID, token.TokenID)
+	mockCollection.AssertExpectations(t)
+}
+
+func TestConsumeToken(t *testing.T) {
+	now := time.Now()
+	filter := bson.M{"purpose": domain.TokenPasswordReset, "hash": "hash", "expires_at": bson.M{"$gt": now}}
+	stored := domain.UserToken{TokenID: primitive.NewObjectID(), UserID: primitive.NewObjectID(), Purpose: domain.TokenPasswordReset, Hash: "hash"}
+
+	t.Run("Success", func(t *testing.T) {
+		mockCollection := new(mocks.MockCollection)
+		mockSingleResult := new(mocks.MockSingleResult)
+		repo := repository.NewUserTokenRepository(mockCollection)
+
+		mockSingleResult.On("Decode", mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+			*args.Get(0).(*domain.UserToken) = stored
+		})
+		mockCollection.On("FindOne", mock.Anything, filter).Return(mockSingleResult)
+		mockCollection.On("DeleteOne", mock.Anything, bson.M{"_id": stored.TokenID}).Return(&mongo.DeleteResult{DeletedCount: 1}, nil)
+
+		token, err := repo.ConsumeToken(context.TODO(), domain.TokenPasswordReset, "hash", now)
+
+		assert.NoError(t, err)
+		assert.Equal(t, stored.UserID, token.UserID)
+		mockCollection.AssertExpectations(t)
+	})
+
+	t.Run("Failure - Unknown Or Expired", func(t *testing.T) {
+		mockCollection := new(mocks.MockCollection)
+		mockSingleResult := new(mocks.MockSingleResult)
+		repo := repository.NewUserTokenRepository(mockCollection)
+
+		mockSingleResult.On("Decode", mock.Anything).Return(mongo.ErrNoDocuments)
+		mockCollection.On("FindOne", mock.Anything, filter).Return(mockSingleResult)
+
+		token, err := repo.ConsumeToken(context.TODO(), domain.TokenPasswordReset, "hash", now)
+
+		assert.ErrorIs(t, err, domain.ErrInvalidUserToken)
+		assert.Nil(t, token)
+		mockCollection.AssertNotCalled(t, "DeleteOne", mock.Anything, mock.Anything)
+	})
+
+	t.Run("Failure - Used Concurrently", func(t *testing.T) {
+		mockCollection := new(mocks.MockCollection)
+		mockSingleResult := new(mocks.MockSingleResult)
+		repo := repository.NewUserTokenRepository(mockCollection)
+
+		mockSingleResult.On("Decode", mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+			*args.Get(0).(*domain.UserToken) = stored
+		})
+		mockCollection.On("FindOne", mock.Anything, filter).Return(mockSingleResult)
+		mockCollection.On("DeleteOne", mock.Anything, bson.M{"_id": stored.TokenID}).Return(&mongo.DeleteResult{DeletedCount: 0}, nil)
+
+		token, err := repo.ConsumeToken(context.TODO(), domain.TokenPasswordReset, "hash", now)
+
+		assert.ErrorIs(t, err, domain.ErrInvalidUserToken)
+		assert.Nil(t, token)
+	})
+}
+
+func TestDeleteTokens(t *testing.T) {
+	mockCollection := new(mocks.MockCollection)
+	repo := repository.NewUserTokenRepository(mockCollection)
+
+	userID := primitive.NewObjectID()
+	mockCollection.On("DeleteMany", mock.Anything, bson.M{"user_id": userID, "purpose": domain.TokenPasswordReset}).
+		Return(&mongo.DeleteResult{DeletedCount: 2}, nil)
+
+	err := repo.DeleteTokens(context.TODO(), userID, domain.TokenPasswordReset)
+
+	assert.NoError(t, err)
+	mockCollection.AssertExpectations(t)
+}
+
+func TestLatestTokenTime(t *testing.T) {
+	userID := primitive.NewObjectID()
+	filter := bson.M{"user_id": userID, "purpose": domain.TokenEmailVerification}
+
+	t.Run("Success", func(t *testing.T) {
+		mockCollection := new(mocks.MockCollection)
+		mockSingleResult := new(mocks.MockSingleResult)
+		repo := repository.NewUserTokenRepository(mockCollection)
+
+		createdAt := time.Now().Add(-time.Minute)
+		mockSingleResult.On("Decode", mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+			*args.Get(0).(*domain.UserToken) = domain.UserToken{UserID: userID, CreatedAt: createdAt}
+		})
+		mockCollection.On("FindOne", mock.Anything, filter).Return(mockSingleResult)
+
+		latest, err := repo.LatestTokenTime(context.TODO(), userID, domain.TokenEmailVerification)
+
+		assert.NoError(t, err)
+		assert.Equal(t, createdAt, latest)
+	})
+
+	t.Run("None", func(t *testing.T) {
+		mockCollection := new(mocks.MockCollection)
+		mockSingleResult := new(mocks.MockSingleResult)
+		repo := repository.NewUserTokenRepository(mockCollection)
+
+		mockSingleResult.On("Decode", mock.Anything).Return(mongo.ErrNoDocuments)
+		mockCollection.On("FindOne", mock.Anything, filter).Return(mockSingleResult)
+
+		latest, err := repo.LatestTokenTime(context.TODO(), userID, domain.TokenEmailVerification)
+
+		assert.NoError(t, err)
+		assert.True(t, latest.IsZero())
+	})
+}
@@ -0,0 +1,144 @@
+package test
+
+import (
+	"Real-Time-Chat-Application/controller"
+	"Real-Time-Chat-Application/domain"
+	"Real-Time-Chat-Application/infrastructure"
+	"Real-Time-Chat-Application/router"
+	"Real-Time-Chat-Application/test/test_usecase/mocks"
+	"Real-Time-Chat-Application/websocket"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestNewRouter(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	hub := websocket.NewHub(nil, nil, nil)
+
+	r := router.NewRouter(
+		infrastructure.NewJWTService("secret", time.Minute, time.Hour),
+		new(mocks.MockAuthUsecase),
+		controller.NewUserController(new(mocks.MockUserUsecase), new(mocks.MockAuthUsecase), hub),
+		controller.NewChatController(new(mocks.MockChatUsecase), hub),
+		controller.NewMessageController(new(mocks.MockMessageUsecase), hub),
+	)
+
+	registered := map[string]bool{}
+	for _, route := range r.Routes() {
+		registered[route.Method+" "+route.Path] = true
+	}
+
+	expected := []string{
+		http.MethodPost + " /users",
+		http.MethodPost + " /users/login",
+		http.MethodPost + " /users/login/two-factor",
+		http.MethodPost + " /users/refresh",
+		http.MethodGet + " /users/presence",
+		http.MethodGet + " /users/:id",
+		http.MethodGet + " /users/email/:email",
+		http.MethodGet + " /users/username/:username",
+		http.MethodPut + " /users/:id",
+		http.MethodDelete + " /users/:id",
+		http.MethodGet + " /users/:id/two-factor",
+		http.MethodPost + " /users/two-factor/setup",
+		http.MethodPost + " /users/two-factor/confirm",
+		http.MethodPost + " /users/two-factor/disable",
+		http.MethodGet + " /users/sessions",
+		http.MethodDelete + " /users/sessions",
+		http.MethodDelete + " /users/sessions/:session_id",
+		http.MethodPost + " /chats",
+		http.MethodGet + " /chats",
+		http.MethodGet + " /chats/:chat_id",
+		http.MethodPut + " /chats/:chat_id",
+		http.MethodDelete + " /chats/:chat_id",
+		http.MethodGet + " /chats/user/:user_id",
+		http.MethodGet + " /chats/participants/:sender_id/:receiver_id",
+		http.MethodPost + " /chats/:chat_id/read",
+		http.MethodPost + " /chats/:chat_id/members",
+		http.MethodDelete + " /chats/:chat_id/members/:user_id",
+		http.MethodPut + " /chats/:chat_id/members/:user_id/role",
+		http.MethodPost + " /chats/:chat_id/leave",
+		http.MethodPost + " /chats/:chat_id/messages",
+		http.MethodGet + " /chats/:chat_id/messages",
+		http.MethodGet + " /chats/:chat_id/messages/:message_id",
+		http.MethodPut + " /chats/:chat_id/messages/:message_id",
+		http.MethodDelete + " /chats/:chat_id/messages/:message_id",
+		http.MethodGet + " /ws",
+	}
+
+	for _, route := range expected {
+		assert.True(t, registered[route], "route %s is not registered", route)
+	}
+}
+
+func TestNewRouterRequiresAuthentication(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	hub := websocket.NewHub(nil, nil, nil)
+
+	r := router.NewRouter(
+		infrastructure.NewJWTService("secret", time.Minute, time.Hour),
+		new(mocks.MockAuthUsecase),
+		controller.NewUserController(new(mocks.MockUserUsecase), new(mocks.MockAuthUsecase), hub),
+		controller.NewChatController(new(mocks.MockChatUsecase), hub),
+		controller.NewMessageController(new(mocks.MockMessageUsecase), hub),
+	)
+
+	for _, path := range []string{"/users/" + primitive.NewObjectID().Hex(), "/chats/" + primitive.NewObjectID().Hex(), "/ws"} {
+		req, _ := http.NewRequest(http.MethodGet, path, nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code, path)
+	}
+}
+
+func TestNewRouterTrustedProxies(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// login sends a login through the router from 192.0.2.1, claiming to forward for
+	// 203.0.113.9, and returns the IP the session would record
+	login := func(t *testing.T, trustedProxies []string) string {
+		mockAuthUsecase := new(mocks.MockAuthUsecase)
+		var device domain.DeviceInfo
+		mockAuthUsecase.On("Login", mock.Anything, "test@example.com", "password123", mock.AnythingOfType("domain.DeviceInfo")).
+			Return(&domain.LoginResult{Tokens: &domain.TokenPair{}}, nil).
+			Run(func(args mock.Arguments) { device = args.Get(3).(domain.DeviceInfo) })
+
+		hub := websocket.NewHub(nil, nil, nil)
+		r := router.NewRouter(
+			infrastructure.NewJWTService("secret", time.Minute, time.Hour),
+			mockAuthUsecase,
+			controller.NewUserController(new(mocks.MockUserUsecase), mockAuthUsecase, hub),
+			controller.NewChatController(new(mocks.MockChatUsecase), hub),
+			controller.NewMessageController(new(mocks.MockMessageUsecase), hub),
+		)
+		if trustedProxies != nil {
+			assert.NoError(t, r.SetTrustedProxies(trustedProxies))
+		}
+
+		req, _ := http.NewRequest(http.MethodPost, "/users/login", strings.NewReader(`{"email": "test@example.com", "password": "password123"}`))
+		req.RemoteAddr = "192.0.2.1:1234"
+		req.Header.Set("X-Forwarded-For", "203.0.113.9")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		return device.IP
+	}
+
+	t.Run("no trusted proxies", func(t *testing.T) {
+		assert.Equal(t, "192.0.2.1", login(t, nil))
+	})
+
+	t.Run("trusted proxy", func(t *testing.T) {
+		assert.Equal(t, "203.0.113.9", login(t, []string{"192.0.2.0/24"}))
+	})
+}
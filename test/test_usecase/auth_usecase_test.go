@@ -0,0 +1,380 @@
+package test_usecase
+
+import (
+	"Real-Time-Chat-Application/domain"
+	"Real-Time-Chat-Application/infrastructure"
+	"Real-Time-Chat-Application/test/test_repository/mocks"
+	"Real-Time-Chat-Application/usecase"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestLogin(t *testing.T) {
+	tokenService := infrastructure.NewJWTService("secret", time.Minute, time.Hour)
+	passwordHasher := infrastructure.NewBcryptHasher(bcrypt.MinCost)
+	hashedPassword, _ := passwordHasher.Hash("password123")
+	user := &domain.User{
+		UserID:   primitive.NewObjectID(),
+		Email:    "test@example.com",
+		Password: hashedPassword,
+	}
+	device := domain.DeviceInfo{Name: "Laptop", IP: "192.0.2.1", UserAgent: "test-agent"}
+
+	t.Run("success", func(t *testing.T) {
+		mockUserRepository := new(mocks.MockUserRepository)
+		mockSessionRepository := new(mocks.MockSessionRepository)
+		authUsecase := usecase.NewAuthUsecase(mockUserRepository, new(mocks.MockUserTokenRepository), mockSessionRepository, tokenService, passwordHasher, infrastructure.NewTOTPGenerator("Test", nil), infrastructure.NewMemoryMailer(), 1*time.Second)
+		mockUserRepository.On("GetUserByEmail", mock.Anything, user.Email).Return(user, nil)
+		var session *domain.Session
+		mockSessionRepository.On("CreateSession", mock.Anything, mock.AnythingOfType("*domain.Session")).Return(nil).Run(func(args mock.Arguments) {
+			session = args.Get(1).(*domain.Session)
+		})
+
+		result, err := authUsecase.Login(context.Background(), user.Email, "password123", device)
+		assert.NoError(t, err)
+		assert.Empty(t, result.Challenge)
+		tokens := result.Tokens
+
+		claims, err := tokenService.ValidateToken(tokens.AccessToken, domain.AccessToken)
+		assert.NoError(t, err)
+		assert.Equal(t, user.UserID, claims.UserID)
+
+		// The session records the device and only a hash of the refresh token
+		assert.Equal(t, claims.SessionID, session.SessionID)
+		assert.Equal(t, user.UserID, session.UserID)
+		assert.Equal(t, "Laptop", session.DeviceName)
+		assert.Equal(t, "192.0.2.1", session.IP)
+		assert.Equal(t, "test-agent", session.UserAgent)
+		sum := sha256.Sum256([]byte(tokens.RefreshToken))
+		assert.Equal(t, hex.EncodeToString(sum[:]), session.RefreshTokenHash)
+		assert.WithinDuration(t, time.Now().Add(time.Hour), session.ExpiresAt, time.Minute)
+		mockUserRepository.AssertExpectations(t)
+	})
+
+	t.Run("rehash after the cost increased", func(t *testing.T) {
+		mockUserRepository := new(mocks.MockUserRepository)
+		mockSessionRepository := new(mocks.MockSessionRepository)
+		strongerHasher := infrastructure.NewBcryptHasher(bcrypt.MinCost + 1)
+		authUsecase := usecase.NewAuthUsecase(mockUserRepository, new(mocks.MockUserTokenRepository), mockSessionRepository, tokenService, strongerHasher, infrastructure.NewTOTPGenerator("Test", nil), infrastructure.NewMemoryMailer(), 1*time.Second)
+		mockUserRepository.On("GetUserByEmail", mock.Anything, user.Email).Return(user, nil)
+		mockUserRepository.On("UpdateUser", mock.Anything, user.UserID, mock.MatchedBy(func(update *domain.User) bool {
+			cost, err := bcrypt.Cost([]byte(update.Password))
+			return err == nil && cost == bcrypt.MinCost+1 && strongerHasher.Compare(update.Password, "password123")
+		})).Return(nil)
+		mockSessionRepository.On("CreateSession", mock.Anything, mock.AnythingOfType("*domain.Session")).Return(nil)
+
+		_, err := authUsecase.Login(context.Background(), user.Email, "password123", device)
+		assert.NoError(t, err)
+		mockUserRepository.AssertExpectations(t)
+	})
+
+	t.Run("wrong password", func(t *testing.T) {
+		mockUserRepository := new(mocks.MockUserRepository)
+		mockSessionRepository := new(mocks.MockSessionRepository)
+		authUsecase := usecase.NewAuthUsecase(mockUserRepository, new(mocks.MockUserTokenRepository), mockSessionRepository, tokenService, passwordHasher, infrastructure.NewTOTPGenerator("Test", nil), infrastructure.NewMemoryMailer(), 1*time.Second)
+		mockUserRepository.On("GetUserByEmail", mock.Anything, user.Email).Return(user, nil)
+
+		tokens, err := authUsecase.Login(context.Background(), user.Email, "wrong", device)
+		assert.ErrorIs(t, err, domain.ErrInvalidCredentials)
+		assert.Nil(t, tokens)
+		mockSessionRepository.AssertNotCalled(t, "CreateSession", mock.Anything, mock.Anything)
+	})
+
+	t.Run("unknown email", func(t *testing.T) {
+		mockUserRepository := new(mocks.MockUserRepository)
+		authUsecase := usecase.NewAuthUsecase(mockUserRepository, new(mocks.MockUserTokenRepository), new(mocks.MockSessionRepository), tokenService, passwordHasher, infrastructure.NewTOTPGenerator("Test", nil), infrastructure.NewMemoryMailer(), 1*time.Second)
+		mockUserRepository.On("GetUserByEmail", mock.Anything, "nobody@example.com").Return(nil, domain.ErrUserNotFound)
+
+		tokens, err := authUsecase.Login(context.Background(), "nobody@example.com", "password123", device)
+		assert.ErrorIs(t, err, domain.ErrInvalidCredentials)
+		assert.Nil(t, tokens)
+	})
+
+	t.Run("two-factor challenge", func(t *testing.T) {
+		mockUserRepository := new(mocks.MockUserRepository)
+		mockUserTokenRepository := new(mocks.MockUserTokenRepository)
+		mockSessionRepository := new(mocks.MockSessionRepository)
+		authUsecase := usecase.NewAuthUsecase(mockUserRepository, mockUserTokenRepository, mockSessionRepository, tokenService, passwordHasher, infrastructure.NewTOTPGenerator("Test", nil), infrastructure.NewMemoryMailer(), 1*time.Second)
+		twoFactorUser := *user
+		twoFactorUser.TwoFactor = &domain.TwoFactor{Secret: testTOTPSecret, Enabled: true}
+		mockUserRepository.On("GetUserByEmail", mock.Anything, user.Email).Return(&twoFactorUser, nil)
+		mockUserTokenRepository.On("DeleteTokens", mock.Anything, user.UserID, domain.TokenTwoFactorLogin).Return(nil)
+		var record *domain.UserToken
+		mockUserTokenRepository.On("CreateToken", mock.Anything, mock.AnythingOfType("*domain.UserToken")).Return(nil).Run(func(args mock.Arguments) {
+			record = args.Get(1).(*domain.UserToken)
+		})
+
+		result, err := authUsecase.Login(context.Background(), user.Email, "password123", device)
+		assert.NoError(t, err)
+		assert.Nil(t, result.Tokens)
+		assert.NotEmpty(t, result.Challenge)
+
+		// The challenge is a single-use token valid for a few minutes, and no session starts yet
+		sum := sha256.Sum256([]byte(result.Challenge))
+		assert.Equal(t, hex.EncodeToString(sum[:]), record.Hash)
+		assert.Equal(t, domain.TokenTwoFactorLogin, record.Purpose)
+		assert.WithinDuration(t, time.Now().Add(domain.TwoFactorChallengeTTL), record.ExpiresAt, time.Minute)
+		mockSessionRepository.AssertNotCalled(t, "CreateSession", mock.Anything, mock.Anything)
+	})
+
+	t.Run("device name too long", func(t *testing.T) {
+		authUsecase := usecase.NewAuthUsecase(new(mocks.MockUserRepository), new(mocks.MockUserTokenRepository), new(mocks.MockSessionRepository), tokenService, passwordHasher, infrastructure.NewTOTPGenerator("Test", nil), infrastructure.NewMemoryMailer(), 1*time.Second)
+
+		_, err := authUsecase.Login(context.Background(), user.Email, "password123", domain.DeviceInfo{Name: strings.Repeat("a", domain.MaxDeviceNameLength+1)})
+		var validationErr *domain.ValidationError
+		assert.ErrorAs(t, err, &validationErr)
+		assert.Equal(t, "device_name", validationErr.Fields[0].Field)
+	})
+}
+
+func TestRefreshToken(t *testing.T) {
+	tokenService := infrastructure.NewJWTService("secret", time.Minute, time.Hour)
+	userID := primitive.NewObjectID()
+	sessionID := primitive.NewObjectID()
+	tokens, _ := tokenService.GenerateTokens(userID, sessionID)
+	sum := sha256.Sum256([]byte(tokens.RefreshToken))
+	refreshHash := hex.EncodeToString(sum[:])
+	passwordHasher := infrastructure.NewBcryptHasher(bcrypt.MinCost)
+	device := domain.DeviceInfo{IP: "198.51.100.7", UserAgent: "test-agent"}
+
+	t.Run("success", func(t *testing.T) {
+		mockUserRepository := new(mocks.MockUserRepository)
+		mockSessionRepository := new(mocks.MockSessionRepository)
+		authUsecase := usecase.NewAuthUsecase(mockUserRepository, new(mocks.MockUserTokenRepository), mockSessionRepository, tokenService, passwordHasher, infrastructure.NewTOTPGenerator("Test", nil), infrastructure.NewMemoryMailer(), 1*time.Second)
+		mockUserRepository.On("GetUserByID", mock.Anything, userID).Return(&domain.User{UserID: userID}, nil)
+		var update *domain.Session
+		mockSessionRepository.On("RotateSession", mock.Anything, sessionID, refreshHash, mock.AnythingOfType("*domain.Session")).Return(nil).Run(func(args mock.Arguments) {
+			update = args.Get(3).(*domain.Session)
+		})
+
+		refreshed, err := authUsecase.RefreshToken(context.Background(), tokens.RefreshToken, device)
+		assert.NoError(t, err)
+		assert.NotEmpty(t, refreshed.AccessToken)
+
+		// The session moves on to the new refresh token and records the activity
+		claims, err := tokenService.ValidateToken(refreshed.AccessToken, domain.AccessToken)
+		assert.NoError(t, err)
+		assert.Equal(t, sessionID, claims.SessionID)
+		newSum := sha256.Sum256([]byte(refreshed.RefreshToken))
+		assert.Equal(t, hex.EncodeToString(newSum[:]), update.RefreshTokenHash)
+		assert.Equal(t, "198.51.100.7", update.IP)
+		assert.WithinDuration(t, time.Now(), update.LastActiveAt, time.Second)
+		mockUserRepository.AssertExpectations(t)
+		mockSessionRepository.AssertExpectations(t)
+	})
+
+	t.Run("revoked or already used", func(t *testing.T) {
+		mockUserRepository := new(mocks.MockUserRepository)
+		mockSessionRepository := new(mocks.MockSessionRepository)
+		authUsecase := usecase.NewAuthUsecase(mockUserRepository, new(mocks.MockUserTokenRepository), mockSessionRepository, tokenService, passwordHasher, infrastructure.NewTOTPGenerator("Test", nil), infrastructure.NewMemoryMailer(), 1*time.Second)
+		mockUserRepository.On("GetUserByID", mock.Anything, userID).Return(&domain.User{UserID: userID}, nil)
+		mockSessionRepository.On("RotateSession", mock.Anything, sessionID, refreshHash, mock.Anything).Return(domain.ErrSessionNotFound)
+
+		refreshed, err := authUsecase.RefreshToken(context.Background(), tokens.RefreshToken, device)
+		assert.ErrorIs(t, err, domain.ErrInvalidToken)
+		assert.Nil(t, refreshed)
+	})
+
+	t.Run("access token rejected", func(t *testing.T) {
+		mockUserRepository := new(mocks.MockUserRepository)
+		authUsecase := usecase.NewAuthUsecase(mockUserRepository, new(mocks.MockUserTokenRepository), new(mocks.MockSessionRepository), tokenService, passwordHasher, infrastructure.NewTOTPGenerator("Test", nil), infrastructure.NewMemoryMailer(), 1*time.Second)
+
+		_, err := authUsecase.RefreshToken(context.Background(), tokens.AccessToken, device)
+		assert.ErrorIs(t, err, domain.ErrInvalidToken)
+	})
+
+	t.Run("deleted user", func(t *testing.T) {
+		mockUserRepository := new(mocks.MockUserRepository)
+		authUsecase := usecase.NewAuthUsecase(mockUserRepository, new(mocks.MockUserTokenRepository), new(mocks.MockSessionRepository), tokenService, passwordHasher, infrastructure.NewTOTPGenerator("Test", nil), infrastructure.NewMemoryMailer(), 1*time.Second)
+		mockUserRepository.On("GetUserByID", mock.Anything, userID).Return(nil, domain.ErrUserNotFound)
+
+		_, err := authUsecase.RefreshToken(context.Background(), tokens.RefreshToken, device)
+		assert.ErrorIs(t, err, domain.ErrInvalidToken)
+	})
+}
+
+func TestCheckSession(t *testing.T) {
+	tokenService := infrastructure.NewJWTService("secret", time.Minute, time.Hour)
+	passwordHasher := infrastructure.NewBcryptHasher(bcrypt.MinCost)
+	userID := primitive.NewObjectID()
+	sessionID := primitive.NewObjectID()
+
+	t.Run("active", func(t *testing.T) {
+		mockSessionRepository := new(mocks.MockSessionRepository)
+		authUsecase := usecase.NewAuthUsecase(new(mocks.MockUserRepository), new(mocks.MockUserTokenRepository), mockSessionRepository, tokenService, passwordHasher, infrastructure.NewTOTPGenerator("Test", nil), infrastructure.NewMemoryMailer(), 1*time.Second)
+		mockSessionRepository.On("GetSession", mock.Anything, sessionID).Return(&domain.Session{SessionID: sessionID, UserID: userID}, nil)
+
+		assert.NoError(t, authUsecase.CheckSession(context.Background(), userID, sessionID))
+	})
+
+	t.Run("revoked", func(t *testing.T) {
+		mockSessionRepository := new(mocks.MockSessionRepository)
+		authUsecase := usecase.NewAuthUsecase(new(mocks.MockUserRepository), new(mocks.MockUserTokenRepository), mockSessionRepository, tokenService, passwordHasher, infrastructure.NewTOTPGenerator("Test", nil), infrastructure.NewMemoryMailer(), 1*time.Second)
+		mockSessionRepository.On("GetSession", mock.Anything, sessionID).Return(nil, domain.ErrSessionNotFound)
+
+		assert.ErrorIs(t, authUsecase.CheckSession(context.Background(), userID, sessionID), domain.ErrInvalidToken)
+	})
+
+	t.Run("another user's session", func(t *testing.T) {
+		mockSessionRepository := new(mocks.MockSessionRepository)
+		authUsecase := usecase.NewAuthUsecase(new(mocks.MockUserRepository), new(mocks.MockUserTokenRepository), mockSessionRepository, tokenService, passwordHasher, infrastructure.NewTOTPGenerator("Test", nil), infrastructure.NewMemoryMailer(), 1*time.Second)
+		mockSessionRepository.On("GetSession", mock.Anything, sessionID).Return(&domain.Session{SessionID: sessionID, UserID: primitive.NewObjectID()}, nil)
+
+		assert.ErrorIs(t, authUsecase.CheckSession(context.Background(), userID, sessionID), domain.ErrInvalidToken)
+	})
+}
+
+func TestListSessions(t *testing.T) {
+	mockSessionRepository := new(mocks.MockSessionRepository)
+	authUsecase := usecase.NewAuthUsecase(new(mocks.MockUserRepository), new(mocks.MockUserTokenRepository), mockSessionRepository, infrastructure.NewJWTService("secret", time.Minute, time.Hour), infrastructure.NewBcryptHasher(bcrypt.MinCost), infrastructure.NewTOTPGenerator("Test", nil), infrastructure.NewMemoryMailer(), 1*time.Second)
+	userID := primitive.NewObjectID()
+	phone := domain.Session{SessionID: primitive.NewObjectID(), UserID: userID, DeviceName: "Phone"}
+	laptop := domain.Session{SessionID: primitive.NewObjectID(), UserID: userID, DeviceName: "Laptop"}
+	mockSessionRepository.On("GetSessionsByUserID", mock.Anything, userID).Return([]domain.Session{phone, laptop}, nil)
+
+	sessions, err := authUsecase.ListSessions(context.Background(), userID, laptop.SessionID)
+	assert.NoError(t, err)
+	assert.Len(t, sessions, 2)
+	assert.False(t, sessions[0].Current)
+	assert.True(t, sessions[1].Current)
+}
+
+func TestRevokeSessions(t *testing.T) {
+	mockSessionRepository := new(mocks.MockSessionRepository)
+	authUsecase := usecase.NewAuthUsecase(new(mocks.MockUserRepository), new(mocks.MockUserTokenRepository), mockSessionRepository, infrastructure.NewJWTService("secret", time.Minute, time.Hour), infrastructure.NewBcryptHasher(bcrypt.MinCost), infrastructure.NewTOTPGenerator("Test", nil), infrastructure.NewMemoryMailer(), 1*time.Second)
+	userID := primitive.NewObjectID()
+	sessionID := primitive.NewObjectID()
+	mockSessionRepository.On("DeleteSession", mock.Anything, userID, sessionID).Return(nil)
+	mockSessionRepository.On("DeleteSessions", mock.Anything, userID).Return(nil)
+
+	assert.NoError(t, authUsecase.RevokeSession(context.Background(), userID, sessionID))
+	assert.NoError(t, authUsecase.RevokeAllSessions(context.Background(), userID))
+	mockSessionRepository.AssertExpectations(t)
+}
+
+func TestRequestPasswordReset(t *testing.T) {
+	tokenService := infrastructure.NewJWTService("secret", time.Minute, time.Hour)
+	passwordHasher := infrastructure.NewBcryptHasher(bcrypt.MinCost)
+	user := &domain.User{UserID: primitive.NewObjectID(), Email: "test@example.com", Username: "testuser"}
+
+	t.Run("success", func(t *testing.T) {
+		mockUserRepository := new(mocks.MockUserRepository)
+		mockUserTokenRepository := new(mocks.MockUserTokenRepository)
+		mailer := infrastructure.NewMemoryMailer()
+		authUsecase := usecase.NewAuthUsecase(mockUserRepository, mockUserTokenRepository, new(mocks.MockSessionRepository), tokenService, passwordHasher, infrastructure.NewTOTPGenerator("Test", nil), mailer, 1*time.Second)
+
+		var stored *domain.UserToken
+		mockUserRepository.On("GetUserByEmail", mock.Anything, user.Email).Return(user, nil)
+		mockUserTokenRepository.On("LatestTokenTime", mock.Anything, user.UserID, domain.TokenPasswordReset).
+			Return(time.Now().Add(-domain.PasswordResetCooldown-time.Second), nil)
+		mockUserTokenRepository.On("DeleteTokens", mock.Anything, user.UserID, domain.TokenPasswordReset).Return(nil)
+		mockUserTokenRepository.On("CreateToken", mock.Anything, mock.AnythingOfType("*domain.UserToken")).
+			Run(func(args mock.Arguments) { stored = args.Get(1).(*domain.UserToken) }).Return(nil)
+
+		err := authUsecase.RequestPasswordReset(context.Background(), user.Email)
+		assert.NoError(t, err)
+
+		mail, ok := mailer.Last(user.Email)
+		assert.True(t, ok)
+		token := resetTokenPattern.FindString(mail.Body)
+		sum := sha256.Sum256([]byte(token))
+		assert.Equal(t, hex.EncodeToString(sum[:]), stored.Hash)
+		assert.Equal(t, user.UserID, stored.UserID)
+		assert.Equal(t, domain.TokenPasswordReset, stored.Purpose)
+		assert.WithinDuration(t, time.Now().Add(domain.PasswordResetTTL), stored.ExpiresAt, time.Minute)
+		mockUserTokenRepository.AssertExpectations(t)
+	})
+
+	t.Run("within cooldown", func(t *testing.T) {
+		mockUserRepository := new(mocks.MockUserRepository)
+		mockUserTokenRepository := new(mocks.MockUserTokenRepository)
+		mailer := infrastructure.NewMemoryMailer()
+		authUsecase := usecase.NewAuthUsecase(mockUserRepository, mockUserTokenRepository, new(mocks.MockSessionRepository), tokenService, passwordHasher, infrastructure.NewTOTPGenerator("Test", nil), mailer, 1*time.Second)
+		mockUserRepository.On("GetUserByEmail", mock.Anything, user.Email).Return(user, nil)
+		mockUserTokenRepository.On("LatestTokenTime", mock.Anything, user.UserID, domain.TokenPasswordReset).Return(time.Now().Add(-time.Second), nil)
+
+		err := authUsecase.RequestPasswordReset(context.Background(), user.Email)
+		assert.NoError(t, err)
+		assert.Empty(t, mailer.Sent())
+		mockUserTokenRepository.AssertNotCalled(t, "CreateToken", mock.Anything, mock.Anything)
+	})
+
+	t.Run("unknown email", func(t *testing.T) {
+		mockUserRepository := new(mocks.MockUserRepository)
+		mockUserTokenRepository := new(mocks.MockUserTokenRepository)
+		mailer := infrastructure.NewMemoryMailer()
+		authUsecase := usecase.NewAuthUsecase(mockUserRepository, mockUserTokenRepository, new(mocks.MockSessionRepository), tokenService, passwordHasher, infrastructure.NewTOTPGenerator("Test", nil), mailer, 1*time.Second)
+		mockUserRepository.On("GetUserByEmail", mock.Anything, "nobody@example.com").Return(nil, domain.ErrUserNotFound)
+
+		err := authUsecase.RequestPasswordReset(context.Background(), "nobody@example.com")
+		assert.NoError(t, err)
+		assert.Empty(t, mailer.Sent())
+		mockUserTokenRepository.AssertNotCalled(t, "CreateToken", mock.Anything, mock.Anything)
+	})
+}
+
+// resetTokenPattern finds a token in a mail: 32 random bytes in unpadded base64url
+var resetTokenPattern = regexp.MustCompile(`[A-Za-z0-9_-]{43}`)
+
+func TestResetPassword(t *testing.T) {
+	tokenService := infrastructure.NewJWTService("secret", time.Minute, time.Hour)
+	passwordHasher := infrastructure.NewBcryptHasher(bcrypt.MinCost)
+	userID := primitive.NewObjectID()
+	sum := sha256.Sum256([]byte("reset-token"))
+	hash := hex.EncodeToString(sum[:])
+
+	t.Run("success", func(t *testing.T) {
+		mockUserRepository := new(mocks.MockUserRepository)
+		mockUserTokenRepository := new(mocks.MockUserTokenRepository)
+		mockSessionRepository := new(mocks.MockSessionRepository)
+		authUsecase := usecase.NewAuthUsecase(mockUserRepository, mockUserTokenRepository, mockSessionRepository, tokenService, passwordHasher, infrastructure.NewTOTPGenerator("Test", nil), infrastructure.NewMemoryMailer(), 1*time.Second)
+
+		mockUserTokenRepository.On("ConsumeToken", mock.Anything, domain.TokenPasswordReset, hash, mock.Anything).
+			Return(&domain.UserToken{UserID: userID, Purpose: domain.TokenPasswordReset, Hash: hash}, nil)
+		mockUserRepository.On("UpdateUser", mock.Anything, userID, mock.MatchedBy(func(update *domain.User) bool {
+			return passwordHasher.Compare(update.Password, "newpassword1")
+		})).Return(nil)
+		// Every session is signed out, whoever holds it
+		mockSessionRepository.On("DeleteSessions", mock.Anything, userID).Return(nil)
+		mockUserTokenRepository.On("DeleteTokens", mock.Anything, userID, domain.TokenPasswordReset).Return(nil)
+
+		resetUserID, err := authUsecase.ResetPassword(context.Background(), "reset-token", "newpassword1")
+		assert.NoError(t, err)
+		assert.Equal(t, userID, resetUserID)
+		mockUserRepository.AssertExpectations(t)
+		mockUserTokenRepository.AssertExpectations(t)
+		mockSessionRepository.AssertExpectations(t)
+	})
+
+	t.Run("used or expired token", func(t *testing.T) {
+		mockUserRepository := new(mocks.MockUserRepository)
+		mockUserTokenRepository := new(mocks.MockUserTokenRepository)
+		authUsecase := usecase.NewAuthUsecase(mockUserRepository, mockUserTokenRepository, new(mocks.MockSessionRepository), tokenService, passwordHasher, infrastructure.NewTOTPGenerator("Test", nil), infrastructure.NewMemoryMailer(), 1*time.Second)
+		mockUserTokenRepository.On("ConsumeToken", mock.Anything, domain.TokenPasswordReset, hash, mock.Anything).Return(nil, domain.ErrInvalidUserToken)
+
+		_, err := authUsecase.ResetPassword(context.Background(), "reset-token", "newpassword1")
+		assert.ErrorIs(t, err, domain.ErrInvalidUserToken)
+		mockUserRepository.AssertNotCalled(t, "UpdateUser", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("weak password keeps the token", func(t *testing.T) {
+		mockUserRepository := new(mocks.MockUserRepository)
+		mockUserTokenRepository := new(mocks.MockUserTokenRepository)
+		authUsecase := usecase.NewAuthUsecase(mockUserRepository, mockUserTokenRepository, new(mocks.MockSessionRepository), tokenService, passwordHasher, infrastructure.NewTOTPGenerator("Test", nil), infrastructure.NewMemoryMailer(), 1*time.Second)
+
+		_, err := authUsecase.ResetPassword(context.Background(), "reset-token", "short")
+		var validationErr *domain.ValidationError
+		assert.ErrorAs(t, err, &validationErr)
+		mockUserTokenRepository.AssertNotCalled(t, "ConsumeToken", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+}
@@ -5,6 +5,7 @@ import (
 	"Real-Time-Chat-Application/test/test_repository/mocks"
 	"Real-Time-Chat-Application/usecase"
 	"context"
+	"strings"
 	"testing"
 	"time"
 
@@ -13,43 +14,124 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// verifiedUsers returns a user repository in which every user has verified their email
+func verifiedUsers() *mocks.MockUserRepository {
+	mockUserRepository := new(mocks.MockUserRepository)
+	mockUserRepository.On("GetUserByID", mock.Anything, mock.Anything).Return(&domain.User{EmailVerified: true}, nil).Maybe()
+	return mockUserRepository
+}
+
 func TestCreateChat(t *testing.T) {
 	mockChatRepository := new(mocks.MockChatRepository)
-	chatUsecase := usecase.NewChatUsecase(mockChatRepository, 1*time.Second)
+	chatUsecase := usecase.NewChatUsecase(mockChatRepository, new(mocks.MockMessageRepository), verifiedUsers(), 1*time.Second)
 
 	chat := domain.Chat{
 		ChatID:       primitive.NewObjectID(),
 		Participants: []primitive.ObjectID{primitive.NewObjectID(), primitive.NewObjectID()},
-		Messages:     []domain.Message{},
 		CreatedAt:    time.Now(),
 		UpdatedAt:    time.Now(),
 	}
 	SenderID := primitive.NewObjectID()
 	ReceiverID := primitive.NewObjectID()
+	mockChatRepository.On("GetChatByParticipants", mock.Anything, SenderID, ReceiverID).Return(nil, domain.ErrChatNotFound)
 	mockChatRepository.On("CreateChat", mock.Anything, SenderID, ReceiverID).Return(chat.ChatID, nil)
 
-	chatID, err := chatUsecase.CreateChat(context.Background(), SenderID, ReceiverID)
+	chatID, created, err := chatUsecase.CreateChat(context.Background(), SenderID, ReceiverID)
 	assert.NoError(t, err)
+	assert.True(t, created)
 	assert.Equal(t, chat.ChatID, chatID)
 	mockChatRepository.AssertExpectations(t)
 }
 
+func TestCreateChatExisting(t *testing.T) {
+	SenderID := primitive.NewObjectID()
+	ReceiverID := primitive.NewObjectID()
+	existing := &domain.Chat{ChatID: primitive.NewObjectID(), Participants: []primitive.ObjectID{ReceiverID, SenderID}}
+
+	t.Run("Found", func(t *testing.T) {
+		mockChatRepository := new(mocks.MockChatRepository)
+		chatUsecase := usecase.NewChatUsecase(mockChatRepository, new(mocks.MockMessageRepository), verifiedUsers(), 1*time.Second)
+
+		mockChatRepository.On("GetChatByParticipants", mock.Anything, SenderID, ReceiverID).Return(existing, nil)
+
+		chatID, created, err := chatUsecase.CreateChat(context.Background(), SenderID, ReceiverID)
+		assert.NoError(t, err)
+		assert.False(t, created)
+		assert.Equal(t, existing.ChatID, chatID)
+		mockChatRepository.AssertNotCalled(t, "CreateChat", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("Created concurrently", func(t *testing.T) {
+		mockChatRepository := new(mocks.MockChatRepository)
+		chatUsecase := usecase.NewChatUsecase(mockChatRepository, new(mocks.MockMessageRepository), verifiedUsers(), 1*time.Second)
+
+		// Another request creates the chat between the lookup and the insert
+		mockChatRepository.On("GetChatByParticipants", mock.Anything, SenderID, ReceiverID).Return(nil, domain.ErrChatNotFound).Once()
+		mockChatRepository.On("CreateChat", mock.Anything, SenderID, ReceiverID).Return(primitive.NilObjectID, domain.ErrChatExists)
+		mockChatRepository.On("GetChatByParticipants", mock.Anything, SenderID, ReceiverID).Return(existing, nil).Once()
+
+		chatID, created, err := chatUsecase.CreateChat(context.Background(), SenderID, ReceiverID)
+		assert.NoError(t, err)
+		assert.False(t, created)
+		assert.Equal(t, existing.ChatID, chatID)
+		mockChatRepository.AssertExpectations(t)
+	})
+}
+
+func TestCreateChatUnverified(t *testing.T) {
+	mockChatRepository := new(mocks.MockChatRepository)
+	mockUserRepository := new(mocks.MockUserRepository)
+	chatUsecase := usecase.NewChatUsecase(mockChatRepository, new(mocks.MockMessageRepository), mockUserRepository, 1*time.Second)
+
+	SenderID := primitive.NewObjectID()
+	ReceiverID := primitive.NewObjectID()
+	mockChatRepository.On("GetChatByParticipants", mock.Anything, SenderID, ReceiverID).Return(nil, domain.ErrChatNotFound)
+	mockUserRepository.On("GetUserByID", mock.Anything, SenderID).Return(&domain.User{UserID: SenderID}, nil)
+
+	_, _, err := chatUsecase.CreateChat(context.Background(), SenderID, ReceiverID)
+	assert.ErrorIs(t, err, domain.ErrEmailNotVerified)
+	mockChatRepository.AssertNotCalled(t, "CreateChat", mock.Anything, mock.Anything, mock.Anything)
+
+	// A chat that already exists is still returned
+	existing := &domain.Chat{ChatID: primitive.NewObjectID()}
+	otherID := primitive.NewObjectID()
+	mockChatRepository.On("GetChatByParticipants", mock.Anything, SenderID, otherID).Return(existing, nil)
+
+	chatID, created, err := chatUsecase.CreateChat(context.Background(), SenderID, otherID)
+	assert.NoError(t, err)
+	assert.False(t, created)
+	assert.Equal(t, existing.ChatID, chatID)
+}
+
+func TestCreateChatWithSelf(t *testing.T) {
+	mockChatRepository := new(mocks.MockChatRepository)
+	chatUsecase := usecase.NewChatUsecase(mockChatRepository, new(mocks.MockMessageRepository), verifiedUsers(), 1*time.Second)
+
+	userID := primitive.NewObjectID()
+
+	_, _, err := chatUsecase.CreateChat(context.Background(), userID, userID)
+	var validationErr *domain.ValidationError
+	assert.ErrorAs(t, err, &validationErr)
+	assert.Equal(t, "receiver_id", validationErr.Fields[0].Field)
+	mockChatRepository.AssertNotCalled(t, "CreateChat", mock.Anything, mock.Anything, mock.Anything)
+}
+
 func TestGetChat(t *testing.T) {
 	mockChatRepository := new(mocks.MockChatRepository)
-	chatUsecase := usecase.NewChatUsecase(mockChatRepository, 1*time.Second)
+	chatUsecase := usecase.NewChatUsecase(mockChatRepository, new(mocks.MockMessageRepository), verifiedUsers(), 1*time.Second)
 
 	chatID := primitive.NewObjectID()
+	userID := primitive.NewObjectID()
 	expectedchat := domain.Chat{
 		ChatID:       chatID,
-		Participants: []primitive.ObjectID{primitive.NewObjectID(), primitive.NewObjectID()},
-		Messages:     []domain.Message{},
+		Participants: []primitive.ObjectID{userID, primitive.NewObjectID()},
 		CreatedAt:    time.Now(),
 		UpdatedAt:    time.Now(),
 	}
 
 	mockChatRepository.On("GetChat", mock.Anything, chatID).Return(&expectedchat, nil)
 
-	chat, err := chatUsecase.GetChat(context.Background(), chatID)
+	chat, err := chatUsecase.GetChat(context.Background(), userID, chatID)
 	assert.NoError(t, err)
 	assert.Equal(t, chat.ChatID, chatID)
 	mockChatRepository.AssertExpectations(t)
@@ -57,15 +139,14 @@ func TestGetChat(t *testing.T) {
 
 func TestGetChatsByUserID(t *testing.T) {
 	mockChatRepository := new(mocks.MockChatRepository)
-	chatUsecase := usecase.NewChatUsecase(mockChatRepository, 1*time.Second)
+	chatUsecase := usecase.NewChatUsecase(mockChatRepository, new(mocks.MockMessageRepository), verifiedUsers(), 1*time.Second)
 
 	userID := primitive.NewObjectID()	
 	expectedchats := []domain.Chat{
 		{
 			ChatID:       primitive.NewObjectID(),
 			Participants: []primitive.ObjectID{userID, primitive.NewObjectID()},
-			Messages:     []domain.Message{},
-			CreatedAt:    time.Now(),
+				CreatedAt:    time.Now(),
 			UpdatedAt:    time.Now(),
 		},
 	}
@@ -79,41 +160,86 @@ func TestGetChatsByUserID(t *testing.T) {
 }
 
 func TestUpdateChat(t *testing.T) {
-	mockChatRepository := new(mocks.MockChatRepository)
-	chatUsecase := usecase.NewChatUsecase(mockChatRepository, 1*time.Second)
-
 	chatID := primitive.NewObjectID()
-	updatedChat := domain.Chat{
-		ChatID:       chatID,
-		Participants: []primitive.ObjectID{primitive.NewObjectID(), primitive.NewObjectID()},
-		Messages:     []domain.Message{},
-		CreatedAt:    time.Now(),
-		UpdatedAt:    time.Now(),
-	}
+	userID := primitive.NewObjectID()
+	memberID := primitive.NewObjectID()
 
-	mockChatRepository.On("UpdateChat", mock.Anything, chatID, &updatedChat).Return(nil)
+	title := "Renamed"
 
-	err := chatUsecase.UpdateChat(context.Background(), chatID, &updatedChat)
-	assert.NoError(t, err)
-	mockChatRepository.AssertExpectations(t)
+	t.Run("Success", func(t *testing.T) {
+		mockChatRepository := new(mocks.MockChatRepository)
+		chatUsecase := usecase.NewChatUsecase(mockChatRepository, new(mocks.MockMessageRepository), verifiedUsers(), 1*time.Second)
+
+		settings := domain.ChatSettings{Title: &title}
+		updated := groupWith(chatID, userID, memberID)
+		updated.Title = title
+		mockChatRepository.On("GetChat", mock.Anything, chatID).Return(groupWith(chatID, userID, memberID), nil).Once()
+		mockChatRepository.On("UpdateChatSettings", mock.Anything, chatID, settings).Return(nil)
+		mockChatRepository.On("GetChat", mock.Anything, chatID).Return(updated, nil).Once()
+
+		// The stored chat is returned, not the settings sent
+		chat, err := chatUsecase.UpdateChat(context.Background(), userID, chatID, settings)
+		assert.NoError(t, err)
+		assert.Equal(t, updated, chat)
+		mockChatRepository.AssertExpectations(t)
+	})
+
+	t.Run("Title too long", func(t *testing.T) {
+		mockChatRepository := new(mocks.MockChatRepository)
+		chatUsecase := usecase.NewChatUsecase(mockChatRepository, new(mocks.MockMessageRepository), verifiedUsers(), 1*time.Second)
+
+		longTitle := strings.Repeat("a", domain.MaxChatTitleLength+1)
+		_, err := chatUsecase.UpdateChat(context.Background(), userID, chatID, domain.ChatSettings{Title: &longTitle})
+
+		var validationErr *domain.ValidationError
+		assert.ErrorAs(t, err, &validationErr)
+		assert.Equal(t, "title", validationErr.Fields[0].Field)
+		mockChatRepository.AssertNotCalled(t, "UpdateChatSettings", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("Plain member", func(t *testing.T) {
+		mockChatRepository := new(mocks.MockChatRepository)
+		chatUsecase := usecase.NewChatUsecase(mockChatRepository, new(mocks.MockMessageRepository), verifiedUsers(), 1*time.Second)
+
+		mockChatRepository.On("GetChat", mock.Anything, chatID).Return(groupWith(chatID, userID, memberID), nil)
+
+		_, err := chatUsecase.UpdateChat(context.Background(), memberID, chatID, domain.ChatSettings{Title: &title})
+		assert.ErrorIs(t, err, domain.ErrForbidden)
+		mockChatRepository.AssertNotCalled(t, "UpdateChatSettings", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("Direct chat", func(t *testing.T) {
+		mockChatRepository := new(mocks.MockChatRepository)
+		chatUsecase := usecase.NewChatUsecase(mockChatRepository, new(mocks.MockMessageRepository), verifiedUsers(), 1*time.Second)
+
+		mockChatRepository.On("GetChat", mock.Anything, chatID).Return(&domain.Chat{ChatID: chatID, Participants: []primitive.ObjectID{userID, memberID}}, nil)
+
+		_, err := chatUsecase.UpdateChat(context.Background(), userID, chatID, domain.ChatSettings{Title: &title})
+		assert.ErrorIs(t, err, domain.ErrNotGroup)
+	})
 }
 
 func TestDeleteChat(t *testing.T) {
 	mockChatRepository := new(mocks.MockChatRepository)
-	chatUsecase := usecase.NewChatUsecase(mockChatRepository, 1*time.Second)
+	mockMessageRepository := new(mocks.MockMessageRepository)
+	chatUsecase := usecase.NewChatUsecase(mockChatRepository, mockMessageRepository, verifiedUsers(), 1*time.Second)
 
 	chatID := primitive.NewObjectID()
+	userID := primitive.NewObjectID()
+	mockChatRepository.On("GetChat", mock.Anything, chatID).Return(&domain.Chat{ChatID: chatID, Participants: []primitive.ObjectID{userID}}, nil)
 	mockChatRepository.On("DeleteChat", mock.Anything, chatID).Return(nil)
+	mockMessageRepository.On("DeleteMessagesByChat", mock.Anything, chatID).Return(nil)
 
-	err := chatUsecase.DeleteChat(context.Background(), chatID)
+	err := chatUsecase.DeleteChat(context.Background(), userID, chatID)
 	assert.NoError(t, err)
 	mockChatRepository.AssertExpectations(t)
+	mockMessageRepository.AssertExpectations(t)
 }
 
 
 func TestGetChatByParticipants(t *testing.T) {
 	mockChatRepository := new(mocks.MockChatRepository)
-	chatUsecase := usecase.NewChatUsecase(mockChatRepository, 1*time.Second)
+	chatUsecase := usecase.NewChatUsecase(mockChatRepository, new(mocks.MockMessageRepository), verifiedUsers(), 1*time.Second)
 
 	SenderID := primitive.NewObjectID()
 	ReceiverID := primitive.NewObjectID()
@@ -121,7 +247,6 @@ func TestGetChatByParticipants(t *testing.T) {
 	expectedChat := domain.Chat{
 		ChatID:       chatID,
 		Participants: []primitive.ObjectID{SenderID, ReceiverID},
-		Messages:     []domain.Message{},
 	}
 
 	mockChatRepository.On("GetChatByParticipants", mock.Anything, SenderID, ReceiverID).Return(&expectedChat, nil)
@@ -132,3 +257,495 @@ func TestGetChatByParticipants(t *testing.T) {
 	mockChatRepository.AssertExpectations(t)
 }
 
+func TestGetChatNotParticipant(t *testing.T) {
+	mockChatRepository := new(mocks.MockChatRepository)
+	chatUsecase := usecase.NewChatUsecase(mockChatRepository, new(mocks.MockMessageRepository), verifiedUsers(), 1*time.Second)
+
+	chatID := primitive.NewObjectID()
+	mockChatRepository.On("GetChat", mock.Anything, chatID).Return(&domain.Chat{
+		ChatID:       chatID,
+		Participants: []primitive.ObjectID{primitive.NewObjectID(), primitive.NewObjectID()},
+	}, nil)
+
+	chat, err := chatUsecase.GetChat(context.Background(), primitive.NewObjectID(), chatID)
+	assert.ErrorIs(t, err, domain.ErrForbidden)
+	assert.Nil(t, chat)
+}
+
+func TestDeleteChatNotParticipant(t *testing.T) {
+	mockChatRepository := new(mocks.MockChatRepository)
+	chatUsecase := usecase.NewChatUsecase(mockChatRepository, new(mocks.MockMessageRepository), verifiedUsers(), 1*time.Second)
+
+	chatID := primitive.NewObjectID()
+	mockChatRepository.On("GetChat", mock.Anything, chatID).Return(&domain.Chat{
+		ChatID:       chatID,
+		Participants: []primitive.ObjectID{primitive.NewObjectID()},
+	}, nil)
+
+	err := chatUsecase.DeleteChat(context.Background(), primitive.NewObjectID(), chatID)
+	assert.ErrorIs(t, err, domain.ErrForbidden)
+	mockChatRepository.AssertNotCalled(t, "DeleteChat", mock.Anything, chatID)
+}
+
+func TestAuthorizeParticipant(t *testing.T) {
+	mockChatRepository := new(mocks.MockChatRepository)
+	chatUsecase := usecase.NewChatUsecase(mockChatRepository, new(mocks.MockMessageRepository), verifiedUsers(), 1*time.Second)
+
+	chatID := primitive.NewObjectID()
+	userID := primitive.NewObjectID()
+	mockChatRepository.On("GetChat", mock.Anything, chatID).Return(&domain.Chat{
+		ChatID:       chatID,
+		Participants: []primitive.ObjectID{userID, primitive.NewObjectID()},
+	}, nil)
+
+	assert.NoError(t, chatUsecase.AuthorizeParticipant(context.Background(), userID, chatID))
+	assert.ErrorIs(t, chatUsecase.AuthorizeParticipant(context.Background(), primitive.NewObjectID(), chatID), domain.ErrForbidden)
+}
+
+func TestMarkRead(t *testing.T) {
+	chatID := primitive.NewObjectID()
+	userID := primitive.NewObjectID()
+	message := domain.Message{MessageID: primitive.NewObjectID(), ChatID: chatID, Time: time.Now().Add(-time.Minute)}
+
+	t.Run("Success", func(t *testing.T) {
+		mockChatRepository := new(mocks.MockChatRepository)
+		mockMessageRepository := new(mocks.MockMessageRepository)
+		chatUsecase := usecase.NewChatUsecase(mockChatRepository, mockMessageRepository, verifiedUsers(), 1*time.Second)
+
+		mockChatRepository.On("GetChat", mock.Anything, chatID).Return(&domain.Chat{ChatID: chatID, Participants: []primitive.ObjectID{userID}}, nil)
+		mockMessageRepository.On("GetMessage", mock.Anything, chatID, message.MessageID).Return(message, nil)
+		mockChatRepository.On("UpdateReadMarker", mock.Anything, chatID, userID, mock.MatchedBy(func(marker domain.ReadMarker) bool {
+			return marker.MessageID == message.MessageID && marker.MessageTime.Equal(message.Time) && !marker.ReadAt.IsZero()
+		})).Return(true, nil)
+
+		marker, advanced, err := chatUsecase.MarkRead(context.Background(), userID, chatID, message.MessageID)
+		assert.NoError(t, err)
+		assert.True(t, advanced)
+		assert.Equal(t, message.MessageID, marker.MessageID)
+		mockChatRepository.AssertExpectations(t)
+	})
+
+	t.Run("Not a participant", func(t *testing.T) {
+		mockChatRepository := new(mocks.MockChatRepository)
+		mockMessageRepository := new(mocks.MockMessageRepository)
+		chatUsecase := usecase.NewChatUsecase(mockChatRepository, mockMessageRepository, verifiedUsers(), 1*time.Second)
+
+		mockChatRepository.On("GetChat", mock.Anything, chatID).Return(&domain.Chat{ChatID: chatID, Participants: []primitive.ObjectID{primitive.NewObjectID()}}, nil)
+
+		_, _, err := chatUsecase.MarkRead(context.Background(), userID, chatID, message.MessageID)
+		assert.ErrorIs(t, err, domain.ErrForbidden)
+		mockChatRepository.AssertNotCalled(t, "UpdateReadMarker", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+}
+
+func TestListChats(t *testing.T) {
+	userID := primitive.NewObjectID()
+	otherID := primitive.NewObjectID()
+	readChat := domain.Chat{
+		ChatID:       primitive.NewObjectID(),
+		Participants: []primitive.ObjectID{userID, otherID},
+		UpdatedAt:    time.Now(),
+		LastMessage:  &domain.MessagePreview{MessageID: primitive.NewObjectID(), Content: "Hello"},
+		ReadMarkers: map[string]domain.ReadMarker{
+			userID.Hex(): {MessageID: primitive.NewObjectID(), MessageTime: time.Now().Add(-time.Minute)},
+		},
+	}
+	newChat := domain.Chat{
+		ChatID:       primitive.NewObjectID(),
+		Participants: []primitive.ObjectID{otherID, userID},
+		UpdatedAt:    time.Now().Add(-time.Hour),
+	}
+
+	t.Run("Success", func(t *testing.T) {
+		mockChatRepository := new(mocks.MockChatRepository)
+		mockMessageRepository := new(mocks.MockMessageRepository)
+		chatUsecase := usecase.NewChatUsecase(mockChatRepository, mockMessageRepository, verifiedUsers(), 1*time.Second)
+
+		marker := readChat.ReadMarkers[userID.Hex()]
+		since := map[primitive.ObjectID]*domain.MessageCursor{
+			readChat.ChatID: {Time: marker.MessageTime, MessageID: marker.MessageID},
+			newChat.ChatID:  nil,
+		}
+		mockChatRepository.On("GetRecentChats", mock.Anything, userID).Return([]domain.Chat{readChat, newChat}, nil)
+		mockMessageRepository.On("CountUnread", mock.Anything, userID, since).Return(map[primitive.ObjectID]int64{readChat.ChatID: 2}, nil)
+
+		summaries, err := chatUsecase.ListChats(context.Background(), userID)
+
+		// The order of the repository is kept and the caller is left out of the participants
+		assert.NoError(t, err)
+		assert.Equal(t, []domain.ChatSummary{
+			{ChatID: readChat.ChatID, Type: domain.ChatTypeDirect, Participants: []primitive.ObjectID{otherID}, LastMessage: readChat.LastMessage, LastActivity: readChat.UpdatedAt, UnreadCount: 2},
+			{ChatID: newChat.ChatID, Type: domain.ChatTypeDirect, Participants: []primitive.ObjectID{otherID}, LastActivity: newChat.UpdatedAt},
+		}, summaries)
+		mockMessageRepository.AssertExpectations(t)
+	})
+
+	t.Run("Repository error", func(t *testing.T) {
+		mockChatRepository := new(mocks.MockChatRepository)
+		mockMessageRepository := new(mocks.MockMessageRepository)
+		chatUsecase := usecase.NewChatUsecase(mockChatRepository, mockMessageRepository, verifiedUsers(), 1*time.Second)
+
+		mockChatRepository.On("GetRecentChats", mock.Anything, userID).Return(nil, assert.AnError)
+
+		_, err := chatUsecase.ListChats(context.Background(), userID)
+		assert.ErrorIs(t, err, assert.AnError)
+		mockMessageRepository.AssertNotCalled(t, "CountUnread", mock.Anything, mock.Anything, mock.Anything)
+	})
+}
+
+func groupWith(chatID, creatorID primitive.ObjectID, members ...primitive.ObjectID) *domain.Chat {
+	return &domain.Chat{
+		ChatID:       chatID,
+		Type:         domain.ChatTypeGroup,
+		Participants: append([]primitive.ObjectID{creatorID}, members...),
+		CreatedBy:    creatorID,
+	}
+}
+
+func TestCreateGroupChat(t *testing.T) {
+	creatorID := primitive.NewObjectID()
+	memberID := primitive.NewObjectID()
+	otherID := primitive.NewObjectID()
+
+	t.Run("Success", func(t *testing.T) {
+		mockChatRepository := new(mocks.MockChatRepository)
+		mockMessageRepository := new(mocks.MockMessageRepository)
+		chatUsecase := usecase.NewChatUsecase(mockChatRepository, mockMessageRepository, verifiedUsers(), 1*time.Second)
+
+		chatID := primitive.NewObjectID()
+		mockChatRepository.On("CreateGroupChat", mock.Anything, mock.AnythingOfType("*domain.Chat")).Run(func(args mock.Arguments) {
+			args.Get(1).(*domain.Chat).ChatID = chatID
+		}).Return(chatID, nil)
+		mockMessageRepository.On("SendMessage", mock.Anything, chatID, mock.AnythingOfType("*domain.Message")).Return(nil)
+
+		// Duplicates and the creator are dropped from the member list
+		chat, message, err := chatUsecase.CreateGroupChat(context.Background(), creatorID, []primitive.ObjectID{memberID, creatorID, otherID, memberID}, "Team", "")
+
+		assert.NoError(t, err)
+		assert.Equal(t, []primitive.ObjectID{creatorID, memberID, otherID}, chat.Participants)
+		assert.Equal(t, creatorID, chat.CreatedBy)
+		assert.Equal(t, domain.RoleOwner, chat.RoleOf(creatorID))
+		assert.Equal(t, domain.RoleMember, chat.RoleOf(memberID))
+		assert.Equal(t, "Team", chat.Title)
+		assert.Equal(t, creatorID, message.SenderID)
+		assert.Equal(t, &domain.SystemEvent{Action: domain.SystemChatCreated, UserIDs: []primitive.ObjectID{memberID, otherID}}, message.System)
+		mockChatRepository.AssertExpectations(t)
+		mockMessageRepository.AssertExpectations(t)
+	})
+
+	t.Run("No other member", func(t *testing.T) {
+		mockChatRepository := new(mocks.MockChatRepository)
+		chatUsecase := usecase.NewChatUsecase(mockChatRepository, new(mocks.MockMessageRepository), verifiedUsers(), 1*time.Second)
+
+		_, _, err := chatUsecase.CreateGroupChat(context.Background(), creatorID, []primitive.ObjectID{creatorID}, "Alone", "")
+
+		var validationErr *domain.ValidationError
+		assert.ErrorAs(t, err, &validationErr)
+		assert.Equal(t, "member_ids", validationErr.Fields[0].Field)
+		mockChatRepository.AssertNotCalled(t, "CreateGroupChat", mock.Anything, mock.Anything)
+	})
+
+	t.Run("Too many members", func(t *testing.T) {
+		mockChatRepository := new(mocks.MockChatRepository)
+		chatUsecase := usecase.NewChatUsecase(mockChatRepository, new(mocks.MockMessageRepository), verifiedUsers(), 1*time.Second)
+
+		memberIDs := make([]primitive.ObjectID, domain.MaxGroupSize)
+		for i := range memberIDs {
+			memberIDs[i] = primitive.NewObjectID()
+		}
+		_, _, err := chatUsecase.CreateGroupChat(context.Background(), creatorID, memberIDs, "Crowd", "")
+
+		var validationErr *domain.ValidationError
+		assert.ErrorAs(t, err, &validationErr)
+		assert.Equal(t, "member_ids", validationErr.Fields[0].Field)
+		mockChatRepository.AssertNotCalled(t, "CreateGroupChat", mock.Anything, mock.Anything)
+	})
+
+	t.Run("Title and avatar too long", func(t *testing.T) {
+		mockChatRepository := new(mocks.MockChatRepository)
+		chatUsecase := usecase.NewChatUsecase(mockChatRepository, new(mocks.MockMessageRepository), verifiedUsers(), 1*time.Second)
+
+		title := strings.Repeat("a", domain.MaxChatTitleLength+1)
+		avatar := "https://example.com/" + strings.Repeat("a", domain.MaxAvatarLength)
+		_, _, err := chatUsecase.CreateGroupChat(context.Background(), creatorID, []primitive.ObjectID{memberID}, title, avatar)
+
+		var validationErr *domain.ValidationError
+		assert.ErrorAs(t, err, &validationErr)
+		assert.Len(t, validationErr.Fields, 2)
+		assert.Equal(t, "title", validationErr.Fields[0].Field)
+		assert.Equal(t, "avatar", validationErr.Fields[1].Field)
+		mockChatRepository.AssertNotCalled(t, "CreateGroupChat", mock.Anything, mock.Anything)
+	})
+}
+
+func TestAddMembers(t *testing.T) {
+	chatID := primitive.NewObjectID()
+	creatorID := primitive.NewObjectID()
+	memberID := primitive.NewObjectID()
+	newID := primitive.NewObjectID()
+
+	t.Run("Success", func(t *testing.T) {
+		mockChatRepository := new(mocks.MockChatRepository)
+		mockMessageRepository := new(mocks.MockMessageRepository)
+		chatUsecase := usecase.NewChatUsecase(mockChatRepository, mockMessageRepository, verifiedUsers(), 1*time.Second)
+
+		// Admins can add people; existing members are skipped
+		group := groupWith(chatID, creatorID, memberID)
+		group.Roles = map[string]string{memberID.Hex(): domain.RoleAdmin}
+		mockChatRepository.On("GetChat", mock.Anything, chatID).Return(group, nil)
+		mockChatRepository.On("AddParticipants", mock.Anything, chatID, []primitive.ObjectID{newID}).Return(nil)
+		mockMessageRepository.On("SendMessage", mock.Anything, chatID, mock.AnythingOfType("*domain.Message")).Return(nil)
+
+		message, err := chatUsecase.AddMembers(context.Background(), memberID, chatID, []primitive.ObjectID{newID, creatorID})
+
+		assert.NoError(t, err)
+		assert.Equal(t, memberID, message.SenderID)
+		assert.Equal(t, &domain.SystemEvent{Action: domain.SystemMembersAdded, UserIDs: []primitive.ObjectID{newID}}, message.System)
+		mockChatRepository.AssertExpectations(t)
+	})
+
+	t.Run("Already members", func(t *testing.T) {
+		mockChatRepository := new(mocks.MockChatRepository)
+		mockMessageRepository := new(mocks.MockMessageRepository)
+		chatUsecase := usecase.NewChatUsecase(mockChatRepository, mockMessageRepository, verifiedUsers(), 1*time.Second)
+
+		mockChatRepository.On("GetChat", mock.Anything, chatID).Return(groupWith(chatID, creatorID, memberID), nil)
+
+		message, err := chatUsecase.AddMembers(context.Background(), creatorID, chatID, []primitive.ObjectID{memberID})
+
+		assert.NoError(t, err)
+		assert.Nil(t, message)
+		mockChatRepository.AssertNotCalled(t, "AddParticipants", mock.Anything, mock.Anything, mock.Anything)
+		mockMessageRepository.AssertNotCalled(t, "SendMessage", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("Group full", func(t *testing.T) {
+		mockChatRepository := new(mocks.MockChatRepository)
+		chatUsecase := usecase.NewChatUsecase(mockChatRepository, new(mocks.MockMessageRepository), verifiedUsers(), 1*time.Second)
+
+		members := make([]primitive.ObjectID, domain.MaxGroupSize-1)
+		for i := range members {
+			members[i] = primitive.NewObjectID()
+		}
+		mockChatRepository.On("GetChat", mock.Anything, chatID).Return(groupWith(chatID, creatorID, members...), nil)
+
+		_, err := chatUsecase.AddMembers(context.Background(), creatorID, chatID, []primitive.ObjectID{newID})
+
+		var validationErr *domain.ValidationError
+		assert.ErrorAs(t, err, &validationErr)
+		assert.Equal(t, "user_ids", validationErr.Fields[0].Field)
+		mockChatRepository.AssertNotCalled(t, "AddParticipants", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("Plain member", func(t *testing.T) {
+		mockChatRepository := new(mocks.MockChatRepository)
+		chatUsecase := usecase.NewChatUsecase(mockChatRepository, new(mocks.MockMessageRepository), verifiedUsers(), 1*time.Second)
+
+		mockChatRepository.On("GetChat", mock.Anything, chatID).Return(groupWith(chatID, creatorID, memberID), nil)
+
+		_, err := chatUsecase.AddMembers(context.Background(), memberID, chatID, []primitive.ObjectID{newID})
+
+		assert.ErrorIs(t, err, domain.ErrForbidden)
+		mockChatRepository.AssertNotCalled(t, "AddParticipants", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("Direct chat", func(t *testing.T) {
+		mockChatRepository := new(mocks.MockChatRepository)
+		chatUsecase := usecase.NewChatUsecase(mockChatRepository, new(mocks.MockMessageRepository), verifiedUsers(), 1*time.Second)
+
+		mockChatRepository.On("GetChat", mock.Anything, chatID).Return(&domain.Chat{ChatID: chatID, Participants: []primitive.ObjectID{creatorID, memberID}}, nil)
+
+		_, err := chatUsecase.AddMembers(context.Background(), creatorID, chatID, []primitive.ObjectID{newID})
+
+		assert.ErrorIs(t, err, domain.ErrNotGroup)
+		mockChatRepository.AssertNotCalled(t, "AddParticipants", mock.Anything, mock.Anything, mock.Anything)
+	})
+}
+
+func TestRemoveMember(t *testing.T) {
+	chatID := primitive.NewObjectID()
+	creatorID := primitive.NewObjectID()
+	memberID := primitive.NewObjectID()
+	otherID := primitive.NewObjectID()
+
+	t.Run("Success", func(t *testing.T) {
+		mockChatRepository := new(mocks.MockChatRepository)
+		mockMessageRepository := new(mocks.MockMessageRepository)
+		chatUsecase := usecase.NewChatUsecase(mockChatRepository, mockMessageRepository, verifiedUsers(), 1*time.Second)
+
+		mockChatRepository.On("GetChat", mock.Anything, chatID).Return(groupWith(chatID, creatorID, memberID, otherID), nil)
+		mockChatRepository.On("RemoveParticipant", mock.Anything, chatID, memberID).Return(nil)
+		mockMessageRepository.On("SendMessage", mock.Anything, chatID, mock.AnythingOfType("*domain.Message")).Return(nil)
+
+		message, err := chatUsecase.RemoveMember(context.Background(), creatorID, chatID, memberID)
+
+		assert.NoError(t, err)
+		assert.Equal(t, &domain.SystemEvent{Action: domain.SystemMemberRemoved, UserIDs: []primitive.ObjectID{memberID}}, message.System)
+		mockChatRepository.AssertExpectations(t)
+	})
+
+	t.Run("Plain member", func(t *testing.T) {
+		mockChatRepository := new(mocks.MockChatRepository)
+		chatUsecase := usecase.NewChatUsecase(mockChatRepository, new(mocks.MockMessageRepository), verifiedUsers(), 1*time.Second)
+
+		mockChatRepository.On("GetChat", mock.Anything, chatID).Return(groupWith(chatID, creatorID, memberID, otherID), nil)
+
+		_, err := chatUsecase.RemoveMember(context.Background(), memberID, chatID, otherID)
+
+		assert.ErrorIs(t, err, domain.ErrForbidden)
+		mockChatRepository.AssertNotCalled(t, "RemoveParticipant", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("Admin removing an admin", func(t *testing.T) {
+		mockChatRepository := new(mocks.MockChatRepository)
+		chatUsecase := usecase.NewChatUsecase(mockChatRepository, new(mocks.MockMessageRepository), verifiedUsers(), 1*time.Second)
+
+		// Admins only remove members ranked below them
+		group := groupWith(chatID, creatorID, memberID, otherID)
+		group.Roles = map[string]string{memberID.Hex(): domain.RoleAdmin, otherID.Hex(): domain.RoleAdmin}
+		mockChatRepository.On("GetChat", mock.Anything, chatID).Return(group, nil)
+
+		_, err := chatUsecase.RemoveMember(context.Background(), memberID, chatID, otherID)
+
+		assert.ErrorIs(t, err, domain.ErrForbidden)
+		mockChatRepository.AssertNotCalled(t, "RemoveParticipant", mock.Anything, mock.Anything, mock.Anything)
+	})
+}
+
+func TestLeaveChat(t *testing.T) {
+	chatID := primitive.NewObjectID()
+	creatorID := primitive.NewObjectID()
+	memberID := primitive.NewObjectID()
+
+	t.Run("Success", func(t *testing.T) {
+		mockChatRepository := new(mocks.MockChatRepository)
+		mockMessageRepository := new(mocks.MockMessageRepository)
+		chatUsecase := usecase.NewChatUsecase(mockChatRepository, mockMessageRepository, verifiedUsers(), 1*time.Second)
+
+		mockChatRepository.On("GetChat", mock.Anything, chatID).Return(groupWith(chatID, creatorID, memberID), nil)
+		mockChatRepository.On("RemoveParticipant", mock.Anything, chatID, memberID).Return(nil)
+		mockMessageRepository.On("SendMessage", mock.Anything, chatID, mock.AnythingOfType("*domain.Message")).Return(nil)
+
+		message, err := chatUsecase.LeaveChat(context.Background(), memberID, chatID)
+
+		assert.NoError(t, err)
+		assert.Equal(t, memberID, message.SenderID)
+		assert.Equal(t, domain.SystemMemberLeft, message.System.Action)
+		mockChatRepository.AssertExpectations(t)
+	})
+
+	t.Run("Owner", func(t *testing.T) {
+		mockChatRepository := new(mocks.MockChatRepository)
+		mockMessageRepository := new(mocks.MockMessageRepository)
+		chatUsecase := usecase.NewChatUsecase(mockChatRepository, mockMessageRepository, verifiedUsers(), 1*time.Second)
+
+		// An admin takes over ahead of the longer standing plain member
+		adminID := primitive.NewObjectID()
+		group := groupWith(chatID, creatorID, memberID, adminID)
+		group.Roles = map[string]string{creatorID.Hex(): domain.RoleOwner, adminID.Hex(): domain.RoleAdmin}
+		mockChatRepository.On("GetChat", mock.Anything, chatID).Return(group, nil)
+		mockChatRepository.On("SetRoles", mock.Anything, chatID, map[primitive.ObjectID]string{adminID: domain.RoleOwner}).Return(nil)
+		mockChatRepository.On("RemoveParticipant", mock.Anything, chatID, creatorID).Return(nil)
+		mockMessageRepository.On("SendMessage", mock.Anything, chatID, mock.AnythingOfType("*domain.Message")).Return(nil)
+
+		_, err := chatUsecase.LeaveChat(context.Background(), creatorID, chatID)
+
+		assert.NoError(t, err)
+		mockChatRepository.AssertExpectations(t)
+	})
+
+	t.Run("Last member", func(t *testing.T) {
+		mockChatRepository := new(mocks.MockChatRepository)
+		mockMessageRepository := new(mocks.MockMessageRepository)
+		chatUsecase := usecase.NewChatUsecase(mockChatRepository, mockMessageRepository, verifiedUsers(), 1*time.Second)
+
+		// The group is deleted along with its history
+		mockChatRepository.On("GetChat", mock.Anything, chatID).Return(groupWith(chatID, creatorID), nil)
+		mockChatRepository.On("DeleteChat", mock.Anything, chatID).Return(nil)
+		mockMessageRepository.On("DeleteMessagesByChat", mock.Anything, chatID).Return(nil)
+
+		message, err := chatUsecase.LeaveChat(context.Background(), creatorID, chatID)
+
+		assert.NoError(t, err)
+		assert.Nil(t, message)
+		mockChatRepository.AssertExpectations(t)
+		mockMessageRepository.AssertExpectations(t)
+	})
+}
+
+func TestDeleteGroupChatNotCreator(t *testing.T) {
+	mockChatRepository := new(mocks.MockChatRepository)
+	chatUsecase := usecase.NewChatUsecase(mockChatRepository, new(mocks.MockMessageRepository), verifiedUsers(), 1*time.Second)
+
+	chatID := primitive.NewObjectID()
+	creatorID := primitive.NewObjectID()
+	memberID := primitive.NewObjectID()
+	mockChatRepository.On("GetChat", mock.Anything, chatID).Return(groupWith(chatID, creatorID, memberID), nil)
+
+	err := chatUsecase.DeleteChat(context.Background(), memberID, chatID)
+
+	assert.ErrorIs(t, err, domain.ErrForbidden)
+	mockChatRepository.AssertNotCalled(t, "DeleteChat", mock.Anything, chatID)
+}
+
+func TestSetMemberRole(t *testing.T) {
+	chatID := primitive.NewObjectID()
+	ownerID := primitive.NewObjectID()
+	memberID := primitive.NewObjectID()
+
+	t.Run("Success", func(t *testing.T) {
+		mockChatRepository := new(mocks.MockChatRepository)
+		mockMessageRepository := new(mocks.MockMessageRepository)
+		chatUsecase := usecase.NewChatUsecase(mockChatRepository, mockMessageRepository, verifiedUsers(), 1*time.Second)
+
+		mockChatRepository.On("GetChat", mock.Anything, chatID).Return(groupWith(chatID, ownerID, memberID), nil)
+		mockChatRepository.On("SetRoles", mock.Anything, chatID, map[primitive.ObjectID]string{memberID: domain.RoleReadOnly}).Return(nil)
+		mockMessageRepository.On("SendMessage", mock.Anything, chatID, mock.AnythingOfType("*domain.Message")).Return(nil)
+
+		message, err := chatUsecase.SetMemberRole(context.Background(), ownerID, chatID, memberID, domain.RoleReadOnly)
+
+		assert.NoError(t, err)
+		assert.Equal(t, &domain.SystemEvent{Action: domain.SystemRoleChanged, UserIDs: []primitive.ObjectID{memberID}, Role: domain.RoleReadOnly}, message.System)
+		mockChatRepository.AssertExpectations(t)
+	})
+
+	t.Run("Hand over", func(t *testing.T) {
+		mockChatRepository := new(mocks.MockChatRepository)
+		mockMessageRepository := new(mocks.MockMessageRepository)
+		chatUsecase := usecase.NewChatUsecase(mockChatRepository, mockMessageRepository, verifiedUsers(), 1*time.Second)
+
+		// The previous owner stays on as an admin
+		mockChatRepository.On("GetChat", mock.Anything, chatID).Return(groupWith(chatID, ownerID, memberID), nil)
+		mockChatRepository.On("SetRoles", mock.Anything, chatID, map[primitive.ObjectID]string{memberID: domain.RoleOwner, ownerID: domain.RoleAdmin}).Return(nil)
+		mockMessageRepository.On("SendMessage", mock.Anything, chatID, mock.AnythingOfType("*domain.Message")).Return(nil)
+
+		_, err := chatUsecase.SetMemberRole(context.Background(), ownerID, chatID, memberID, domain.RoleOwner)
+
+		assert.NoError(t, err)
+		mockChatRepository.AssertExpectations(t)
+	})
+
+	t.Run("Not the owner", func(t *testing.T) {
+		mockChatRepository := new(mocks.MockChatRepository)
+		chatUsecase := usecase.NewChatUsecase(mockChatRepository, new(mocks.MockMessageRepository), verifiedUsers(), 1*time.Second)
+
+		group := groupWith(chatID, ownerID, memberID)
+		group.Roles = map[string]string{memberID.Hex(): domain.RoleAdmin}
+		mockChatRepository.On("GetChat", mock.Anything, chatID).Return(group, nil)
+
+		_, err := chatUsecase.SetMemberRole(context.Background(), memberID, chatID, ownerID, domain.RoleMember)
+
+		assert.ErrorIs(t, err, domain.ErrForbidden)
+		mockChatRepository.AssertNotCalled(t, "SetRoles", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("Unknown role", func(t *testing.T) {
+		mockChatRepository := new(mocks.MockChatRepository)
+		chatUsecase := usecase.NewChatUsecase(mockChatRepository, new(mocks.MockMessageRepository), verifiedUsers(), 1*time.Second)
+
+		_, err := chatUsecase.SetMemberRole(context.Background(), ownerID, chatID, memberID, "superuser")
+
+		assert.ErrorIs(t, err, domain.ErrInvalidRole)
+		mockChatRepository.AssertNotCalled(t, "GetChat", mock.Anything, mock.Anything)
+	})
+}
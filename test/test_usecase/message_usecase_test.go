@@ -5,6 +5,8 @@ import (
 	"Real-Time-Chat-Application/test/test_repository/mocks"
 	"Real-Time-Chat-Application/usecase"
 	"context"
+	"errors"
+	"strings"
 	"testing"
 	"time"
 
@@ -13,19 +15,32 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// chatWith returns a chat whose participants are the given users
+func chatWith(chatID primitive.ObjectID, participants ...primitive.ObjectID) *domain.Chat {
+	return &domain.Chat{
+		ChatID:       chatID,
+		Participants: participants,
+	}
+}
+
 func TestSendMessage(t *testing.T) {
 	// Setup
 	mockMessageRepo := new(mocks.MockMessageRepository)
-	messageUsecase := usecase.NewMessageUsecase(mockMessageRepo, 1*time.Second)
+	mockChatRepo := new(mocks.MockChatRepository)
+	messageUsecase := usecase.NewMessageUsecase(mockMessageRepo, mockChatRepo, 1*time.Second)
 
 	chatID := primitive.NewObjectID()
+	senderID := primitive.NewObjectID()
 	message := &domain.Message{
 		MessageID: primitive.NewObjectID(),
+		SenderID:  senderID,
 		Content:   "Hello, world!",
 		Time:      time.Now(),
+		System:    &domain.SystemEvent{Action: domain.SystemChatCreated}, // clients cannot post system messages
 	}
 
 	// Mock the repository layer
+	mockChatRepo.On("GetChat", mock.Anything, chatID).Return(chatWith(chatID, senderID, primitive.NewObjectID()), nil)
 	mockMessageRepo.On("SendMessage", mock.Anything, chatID, message).Return(nil)
 
 	// Call the usecase layer
@@ -33,15 +48,80 @@ func TestSendMessage(t *testing.T) {
 
 	// Assert
 	assert.NoError(t, err)
+	assert.Nil(t, message.System)
 	mockMessageRepo.AssertExpectations(t)
+	mockChatRepo.AssertExpectations(t)
+}
+
+func TestSendMessageNotParticipant(t *testing.T) {
+	// Setup
+	mockMessageRepo := new(mocks.MockMessageRepository)
+	mockChatRepo := new(mocks.MockChatRepository)
+	messageUsecase := usecase.NewMessageUsecase(mockMessageRepo, mockChatRepo, 1*time.Second)
+
+	chatID := primitive.NewObjectID()
+	message := &domain.Message{
+		SenderID: primitive.NewObjectID(),
+		Content:  "Hello, world!",
+	}
+
+	mockChatRepo.On("GetChat", mock.Anything, chatID).Return(chatWith(chatID, primitive.NewObjectID(), primitive.NewObjectID()), nil)
+
+	// Call the usecase layer
+	err := messageUsecase.SendMessage(context.Background(), chatID, message)
+
+	// Assert the message never reaches the repository
+	assert.ErrorIs(t, err, domain.ErrForbidden)
+	mockMessageRepo.AssertNotCalled(t, "SendMessage", mock.Anything, chatID, message)
+}
+
+func TestSendMessageInvalidContent(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{name: "empty", content: ""},
+		{name: "blank", content: " \n\t "},
+		{name: "too long", content: strings.Repeat("é", domain.MaxMessageLength+1)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockMessageRepo := new(mocks.MockMessageRepository)
+			mockChatRepo := new(mocks.MockChatRepository)
+			messageUsecase := usecase.NewMessageUsecase(mockMessageRepo, mockChatRepo, 1*time.Second)
+
+			message := &domain.Message{SenderID: primitive.NewObjectID(), Content: tt.content}
+			err := messageUsecase.SendMessage(context.Background(), primitive.NewObjectID(), message)
+
+			assert.ErrorIs(t, err, domain.ErrValidation)
+			mockMessageRepo.AssertNotCalled(t, "SendMessage", mock.Anything, mock.Anything, mock.Anything)
+		})
+	}
+
+	t.Run("longest allowed", func(t *testing.T) {
+		mockMessageRepo := new(mocks.MockMessageRepository)
+		mockChatRepo := new(mocks.MockChatRepository)
+		messageUsecase := usecase.NewMessageUsecase(mockMessageRepo, mockChatRepo, 1*time.Second)
+
+		chatID := primitive.NewObjectID()
+		senderID := primitive.NewObjectID()
+		message := &domain.Message{SenderID: senderID, Content: strings.Repeat("é", domain.MaxMessageLength)}
+		mockChatRepo.On("GetChat", mock.Anything, chatID).Return(chatWith(chatID, senderID, primitive.NewObjectID()), nil)
+		mockMessageRepo.On("SendMessage", mock.Anything, chatID, message).Return(nil)
+
+		assert.NoError(t, messageUsecase.SendMessage(context.Background(), chatID, message))
+	})
 }
 
 func TestGetMessages(t *testing.T) {
 	// Setup
 	mockMessageRepo := new(mocks.MockMessageRepository)
-	messageUsecase := usecase.NewMessageUsecase(mockMessageRepo, 1*time.Second)
+	mockChatRepo := new(mocks.MockChatRepository)
+	messageUsecase := usecase.NewMessageUsecase(mockMessageRepo, mockChatRepo, 1*time.Second)
 
 	chatID := primitive.NewObjectID()
+	userID := primitive.NewObjectID()
 	messages := []domain.Message{
 		{
 			MessageID: primitive.NewObjectID(),
@@ -56,10 +136,11 @@ func TestGetMessages(t *testing.T) {
 	}
 
 	// Mock the repository layer
+	mockChatRepo.On("GetChat", mock.Anything, chatID).Return(chatWith(chatID, userID), nil)
 	mockMessageRepo.On("GetMessages", mock.Anything, chatID).Return(messages, nil)
 
 	// Call the usecase layer
-	receivedMessages, err := messageUsecase.GetMessages(context.Background(), chatID)
+	receivedMessages, err := messageUsecase.GetMessages(context.Background(), userID, chatID)
 
 	// Assert
 	assert.NoError(t, err)
@@ -67,12 +148,161 @@ func TestGetMessages(t *testing.T) {
 	mockMessageRepo.AssertExpectations(t)
 }
 
+func TestGetMessagesNotParticipant(t *testing.T) {
+	// Setup
+	mockMessageRepo := new(mocks.MockMessageRepository)
+	mockChatRepo := new(mocks.MockChatRepository)
+	messageUsecase := usecase.NewMessageUsecase(mockMessageRepo, mockChatRepo, 1*time.Second)
+
+	chatID := primitive.NewObjectID()
+	mockChatRepo.On("GetChat", mock.Anything, chatID).Return(chatWith(chatID, primitive.NewObjectID()), nil)
+
+	// Call the usecase layer
+	_, err := messageUsecase.GetMessages(context.Background(), primitive.NewObjectID(), chatID)
+
+	// Assert
+	assert.ErrorIs(t, err, domain.ErrForbidden)
+	mockMessageRepo.AssertNotCalled(t, "GetMessages", mock.Anything, chatID)
+}
+
+func TestGetMessagesBefore(t *testing.T) {
+	chatID := primitive.NewObjectID()
+	userID := primitive.NewObjectID()
+	now := time.Now()
+	oldest := domain.Message{MessageID: primitive.NewObjectID(), Content: "oldest", Time: now.Add(-3 * time.Minute)}
+	older := domain.Message{MessageID: primitive.NewObjectID(), Content: "older", Time: now.Add(-2 * time.Minute)}
+	newer := domain.Message{MessageID: primitive.NewObjectID(), Content: "newer", Time: now.Add(-time.Minute)}
+
+	t.Run("Latest page with more history", func(t *testing.T) {
+		mockMessageRepo := new(mocks.MockMessageRepository)
+		mockChatRepo := new(mocks.MockChatRepository)
+		messageUsecase := usecase.NewMessageUsecase(mockMessageRepo, mockChatRepo, 1*time.Second)
+
+		// One extra message is requested to detect the next page
+		mockChatRepo.On("GetChat", mock.Anything, chatID).Return(chatWith(chatID, userID), nil)
+		mockMessageRepo.On("GetMessagesBefore", mock.Anything, chatID, (*domain.MessageCursor)(nil), 3).
+			Return([]domain.Message{oldest, older, newer}, nil)
+
+		page, err := messageUsecase.GetMessagesBefore(context.Background(), userID, chatID, "", 2)
+
+		assert.NoError(t, err)
+		assert.Equal(t, []domain.Message{older, newer}, page.Messages)
+		assert.True(t, page.HasMore)
+		assert.Equal(t, older.MessageID.Hex(), page.NextCursor)
+		mockMessageRepo.AssertExpectations(t)
+	})
+
+	t.Run("Message cursor", func(t *testing.T) {
+		mockMessageRepo := new(mocks.MockMessageRepository)
+		mockChatRepo := new(mocks.MockChatRepository)
+		messageUsecase := usecase.NewMessageUsecase(mockMessageRepo, mockChatRepo, 1*time.Second)
+
+		mockChatRepo.On("GetChat", mock.Anything, chatID).Return(chatWith(chatID, userID), nil)
+		mockMessageRepo.On("GetMessage", mock.Anything, chatID, newer.MessageID).Return(newer, nil)
+		cursor := &domain.MessageCursor{Time: newer.Time, MessageID: newer.MessageID}
+		mockMessageRepo.On("GetMessagesBefore", mock.Anything, chatID, cursor, domain.DefaultMessagePageSize+1).
+			Return([]domain.Message{oldest, older}, nil)
+
+		page, err := messageUsecase.GetMessagesBefore(context.Background(), userID, chatID, newer.MessageID.Hex(), 0)
+
+		assert.NoError(t, err)
+		assert.Equal(t, []domain.Message{oldest, older}, page.Messages)
+		assert.False(t, page.HasMore)
+		mockMessageRepo.AssertExpectations(t)
+	})
+
+	t.Run("Invalid cursor", func(t *testing.T) {
+		mockMessageRepo := new(mocks.MockMessageRepository)
+		mockChatRepo := new(mocks.MockChatRepository)
+		messageUsecase := usecase.NewMessageUsecase(mockMessageRepo, mockChatRepo, 1*time.Second)
+
+		mockChatRepo.On("GetChat", mock.Anything, chatID).Return(chatWith(chatID, userID), nil)
+
+		_, err := messageUsecase.GetMessagesBefore(context.Background(), userID, chatID, "yesterday", 10)
+
+		assert.ErrorIs(t, err, domain.ErrInvalidCursor)
+		mockMessageRepo.AssertNotCalled(t, "GetMessagesBefore", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("Not a participant", func(t *testing.T) {
+		mockMessageRepo := new(mocks.MockMessageRepository)
+		mockChatRepo := new(mocks.MockChatRepository)
+		messageUsecase := usecase.NewMessageUsecase(mockMessageRepo, mockChatRepo, 1*time.Second)
+
+		mockChatRepo.On("GetChat", mock.Anything, chatID).Return(chatWith(chatID, primitive.NewObjectID()), nil)
+
+		_, err := messageUsecase.GetMessagesBefore(context.Background(), userID, chatID, "", 10)
+
+		assert.ErrorIs(t, err, domain.ErrForbidden)
+	})
+}
+
+func TestGetMessagesAfter(t *testing.T) {
+	chatID := primitive.NewObjectID()
+	userID := primitive.NewObjectID()
+	since := time.Date(2025, 1, 2, 15, 4, 5, 0, time.UTC)
+	first := domain.Message{MessageID: primitive.NewObjectID(), Content: "first", Time: since.Add(time.Minute)}
+	second := domain.Message{MessageID: primitive.NewObjectID(), Content: "second", Time: since.Add(2 * time.Minute)}
+
+	t.Run("Timestamp cursor, page size capped", func(t *testing.T) {
+		mockMessageRepo := new(mocks.MockMessageRepository)
+		mockChatRepo := new(mocks.MockChatRepository)
+		messageUsecase := usecase.NewMessageUsecase(mockMessageRepo, mockChatRepo, 1*time.Second)
+
+		mockChatRepo.On("GetChat", mock.Anything, chatID).Return(chatWith(chatID, userID), nil)
+		mockMessageRepo.On("GetMessagesAfter", mock.Anything, chatID, domain.MessageCursor{Time: since}, domain.MaxMessagePageSize+1).
+			Return([]domain.Message{first, second}, nil)
+
+		page, err := messageUsecase.GetMessagesAfter(context.Background(), userID, chatID, since.Format(time.RFC3339), 1000)
+
+		assert.NoError(t, err)
+		assert.Equal(t, []domain.Message{first, second}, page.Messages)
+		assert.False(t, page.HasMore)
+		assert.Equal(t, second.MessageID.Hex(), page.NextCursor)
+		mockMessageRepo.AssertExpectations(t)
+	})
+
+	t.Run("More messages than the page", func(t *testing.T) {
+		mockMessageRepo := new(mocks.MockMessageRepository)
+		mockChatRepo := new(mocks.MockChatRepository)
+		messageUsecase := usecase.NewMessageUsecase(mockMessageRepo, mockChatRepo, 1*time.Second)
+
+		mockChatRepo.On("GetChat", mock.Anything, chatID).Return(chatWith(chatID, userID), nil)
+		mockMessageRepo.On("GetMessagesAfter", mock.Anything, chatID, domain.MessageCursor{Time: since}, 2).
+			Return([]domain.Message{first, second}, nil)
+
+		page, err := messageUsecase.GetMessagesAfter(context.Background(), userID, chatID, since.Format(time.RFC3339), 1)
+
+		// The extra, newest message is left for the next page
+		assert.NoError(t, err)
+		assert.Equal(t, []domain.Message{first}, page.Messages)
+		assert.True(t, page.HasMore)
+		assert.Equal(t, first.MessageID.Hex(), page.NextCursor)
+	})
+
+	t.Run("Cursor from another chat", func(t *testing.T) {
+		mockMessageRepo := new(mocks.MockMessageRepository)
+		mockChatRepo := new(mocks.MockChatRepository)
+		messageUsecase := usecase.NewMessageUsecase(mockMessageRepo, mockChatRepo, 1*time.Second)
+
+		foreignID := primitive.NewObjectID()
+		mockChatRepo.On("GetChat", mock.Anything, chatID).Return(chatWith(chatID, userID), nil)
+		mockMessageRepo.On("GetMessage", mock.Anything, chatID, foreignID).Return(domain.Message{}, errors.New("message not found"))
+
+		_, err := messageUsecase.GetMessagesAfter(context.Background(), userID, chatID, foreignID.Hex(), 10)
+
+		assert.ErrorIs(t, err, domain.ErrInvalidCursor)
+	})
+}
+
 func TestGetMessage(t *testing.T) {
 	// Setup
 	mockMessageRepo := new(mocks.MockMessageRepository)
-	messageUsecase := usecase.NewMessageUsecase(mockMessageRepo, 1*time.Second)
+	mockChatRepo := new(mocks.MockChatRepository)
+	messageUsecase := usecase.NewMessageUsecase(mockMessageRepo, mockChatRepo, 1*time.Second)
 
 	chatID := primitive.NewObjectID()
+	userID := primitive.NewObjectID()
 	messageID := primitive.NewObjectID()
 	message := domain.Message{
 		MessageID: messageID,
@@ -81,10 +311,11 @@ func TestGetMessage(t *testing.T) {
 	}
 
 	// Mock the repository layer
+	mockChatRepo.On("GetChat", mock.Anything, chatID).Return(chatWith(chatID, userID), nil)
 	mockMessageRepo.On("GetMessage", mock.Anything, chatID, messageID).Return(message, nil)
 
 	// Call the usecase layer
-	receivedMessage, err := messageUsecase.GetMessage(context.Background(), chatID, messageID)	
+	receivedMessage, err := messageUsecase.GetMessage(context.Background(), userID, chatID, messageID)
 
 	// Assert
 	assert.NoError(t, err)
@@ -95,40 +326,182 @@ func TestGetMessage(t *testing.T) {
 func TestUpdateMessage(t *testing.T) {
 	// Setup
 	mockMessageRepo := new(mocks.MockMessageRepository)
-	messageUsecase := usecase.NewMessageUsecase(mockMessageRepo, 1*time.Second)
+	mockChatRepo := new(mocks.MockChatRepository)
+	messageUsecase := usecase.NewMessageUsecase(mockMessageRepo, mockChatRepo, 1*time.Second)
 
 	chatID := primitive.NewObjectID()
-	messageID := primitive.NewObjectID()	
+	userID := primitive.NewObjectID()
+	messageID := primitive.NewObjectID()
 	newContent := "Updated message"
 
 	// Mock the repository layer
+	mockChatRepo.On("GetChat", mock.Anything, chatID).Return(chatWith(chatID, userID), nil)
+	mockMessageRepo.On("GetMessage", mock.Anything, chatID, messageID).Return(domain.Message{MessageID: messageID, SenderID: userID}, nil)
 	mockMessageRepo.On("UpdateMessage", mock.Anything, chatID, messageID, newContent).Return(nil)
 
 	// Call the usecase layer
-	err := messageUsecase.UpdateMessage(context.Background(), chatID, messageID, newContent)	
+	message, err := messageUsecase.UpdateMessage(context.Background(), userID, chatID, messageID, newContent)
 
-	// Assert
+	// Assert the edited message is returned
 	assert.NoError(t, err)
+	assert.Equal(t, domain.Message{MessageID: messageID, SenderID: userID, Content: newContent, Edited: true}, message)
 	mockMessageRepo.AssertExpectations(t)
 }
 
+func TestUpdateMessageNotSender(t *testing.T) {
+	// Setup
+	mockMessageRepo := new(mocks.MockMessageRepository)
+	mockChatRepo := new(mocks.MockChatRepository)
+	messageUsecase := usecase.NewMessageUsecase(mockMessageRepo, mockChatRepo, 1*time.Second)
+
+	chatID := primitive.NewObjectID()
+	userID := primitive.NewObjectID()
+	senderID := primitive.NewObjectID()
+	messageID := primitive.NewObjectID()
+
+	// The caller is in the chat but did not write the message
+	mockChatRepo.On("GetChat", mock.Anything, chatID).Return(chatWith(chatID, userID, senderID), nil)
+	mockMessageRepo.On("GetMessage", mock.Anything, chatID, messageID).Return(domain.Message{MessageID: messageID, SenderID: senderID}, nil)
+
+	// Call the usecase layer
+	_, err := messageUsecase.UpdateMessage(context.Background(), userID, chatID, messageID, "Updated message")
+
+	// Assert
+	assert.ErrorIs(t, err, domain.ErrForbidden)
+	mockMessageRepo.AssertNotCalled(t, "UpdateMessage", mock.Anything, chatID, messageID, "Updated message")
+}
+
+func TestUpdateSystemMessage(t *testing.T) {
+	// Setup
+	mockMessageRepo := new(mocks.MockMessageRepository)
+	mockChatRepo := new(mocks.MockChatRepository)
+	messageUsecase := usecase.NewMessageUsecase(mockMessageRepo, mockChatRepo, 1*time.Second)
+
+	chatID := primitive.NewObjectID()
+	userID := primitive.NewObjectID()
+	messageID := primitive.NewObjectID()
+
+	// Even the user who caused a membership change cannot rewrite its record
+	system := domain.NewSystemMessage(userID, domain.SystemChatCreated, nil, "created the group")
+	system.MessageID = messageID
+	mockChatRepo.On("GetChat", mock.Anything, chatID).Return(chatWith(chatID, userID), nil)
+	mockMessageRepo.On("GetMessage", mock.Anything, chatID, messageID).Return(system, nil)
+
+	// Call the usecase layer
+	_, err := messageUsecase.UpdateMessage(context.Background(), userID, chatID, messageID, "Rewritten")
+
+	// Assert
+	assert.ErrorIs(t, err, domain.ErrForbidden)
+	mockMessageRepo.AssertNotCalled(t, "UpdateMessage", mock.Anything, chatID, messageID, "Rewritten")
+}
 
 func TestDeleteMessage(t *testing.T) {
 	// Setup
 	mockMessageRepo := new(mocks.MockMessageRepository)
-	messageUsecase := usecase.NewMessageUsecase(mockMessageRepo, 1*time.Second)	
+	mockChatRepo := new(mocks.MockChatRepository)
+	messageUsecase := usecase.NewMessageUsecase(mockMessageRepo, mockChatRepo, 1*time.Second)
 
 	chatID := primitive.NewObjectID()
+	userID := primitive.NewObjectID()
 	messageID := primitive.NewObjectID()
 
 	// Mock the repository layer
-	mockMessageRepo.On("DeleteMessage", mock.Anything, chatID, messageID).Return(nil)	
+	mockChatRepo.On("GetChat", mock.Anything, chatID).Return(chatWith(chatID, userID), nil)
+	mockMessageRepo.On("GetMessage", mock.Anything, chatID, messageID).Return(domain.Message{MessageID: messageID, SenderID: userID}, nil)
+	mockMessageRepo.On("DeleteMessage", mock.Anything, chatID, messageID).Return(nil)
 
 	// Call the usecase layer
-	err := messageUsecase.DeleteMessage(context.Background(), chatID, messageID)
+	err := messageUsecase.DeleteMessage(context.Background(), userID, chatID, messageID)
 
 	// Assert
 	assert.NoError(t, err)
 	mockMessageRepo.AssertExpectations(t)
-}	
+}
+
+func TestDeleteMessageNotSender(t *testing.T) {
+	// Setup
+	mockMessageRepo := new(mocks.MockMessageRepository)
+	mockChatRepo := new(mocks.MockChatRepository)
+	messageUsecase := usecase.NewMessageUsecase(mockMessageRepo, mockChatRepo, 1*time.Second)
 
+	chatID := primitive.NewObjectID()
+	userID := primitive.NewObjectID()
+	messageID := primitive.NewObjectID()
+
+	mockChatRepo.On("GetChat", mock.Anything, chatID).Return(chatWith(chatID, userID), nil)
+	mockMessageRepo.On("GetMessage", mock.Anything, chatID, messageID).Return(domain.Message{MessageID: messageID, SenderID: primitive.NewObjectID()}, nil)
+
+	// Call the usecase layer
+	err := messageUsecase.DeleteMessage(context.Background(), userID, chatID, messageID)
+
+	// Assert
+	assert.ErrorIs(t, err, domain.ErrForbidden)
+	mockMessageRepo.AssertNotCalled(t, "DeleteMessage", mock.Anything, chatID, messageID)
+}
+
+func TestSendMessageRoles(t *testing.T) {
+	chatID := primitive.NewObjectID()
+	ownerID := primitive.NewObjectID()
+	memberID := primitive.NewObjectID()
+
+	send := func(group *domain.Chat, senderID primitive.ObjectID) (*mocks.MockMessageRepository, error) {
+		mockMessageRepo := new(mocks.MockMessageRepository)
+		mockChatRepo := new(mocks.MockChatRepository)
+		messageUsecase := usecase.NewMessageUsecase(mockMessageRepo, mockChatRepo, 1*time.Second)
+
+		mockChatRepo.On("GetChat", mock.Anything, chatID).Return(group, nil)
+		mockMessageRepo.On("SendMessage", mock.Anything, chatID, mock.AnythingOfType("*domain.Message")).Return(nil)
+
+		return mockMessageRepo, messageUsecase.SendMessage(context.Background(), chatID, &domain.Message{SenderID: senderID, Content: "Hello"})
+	}
+
+	t.Run("Read-only member", func(t *testing.T) {
+		group := groupWith(chatID, ownerID, memberID)
+		group.Roles = map[string]string{memberID.Hex(): domain.RoleReadOnly}
+
+		mockMessageRepo, err := send(group, memberID)
+
+		assert.ErrorIs(t, err, domain.ErrForbidden)
+		mockMessageRepo.AssertNotCalled(t, "SendMessage", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("Announcement-only group", func(t *testing.T) {
+		group := groupWith(chatID, ownerID, memberID)
+		group.AnnouncementOnly = true
+
+		// Plain members cannot post, the owner can
+		_, err := send(group, memberID)
+		assert.ErrorIs(t, err, domain.ErrForbidden)
+
+		_, err = send(group, ownerID)
+		assert.NoError(t, err)
+	})
+}
+
+func TestDeleteMessageByAdmin(t *testing.T) {
+	// Setup
+	mockMessageRepo := new(mocks.MockMessageRepository)
+	mockChatRepo := new(mocks.MockChatRepository)
+	messageUsecase := usecase.NewMessageUsecase(mockMessageRepo, mockChatRepo, 1*time.Second)
+
+	chatID := primitive.NewObjectID()
+	adminID := primitive.NewObjectID()
+	memberID := primitive.NewObjectID()
+	messageID := primitive.NewObjectID()
+
+	// Admins of a group can delete the messages of others, but not edit them
+	group := groupWith(chatID, primitive.NewObjectID(), adminID, memberID)
+	group.Roles = map[string]string{adminID.Hex(): domain.RoleAdmin}
+	mockChatRepo.On("GetChat", mock.Anything, chatID).Return(group, nil)
+	mockMessageRepo.On("GetMessage", mock.Anything, chatID, messageID).Return(domain.Message{MessageID: messageID, SenderID: memberID}, nil)
+	mockMessageRepo.On("DeleteMessage", mock.Anything, chatID, messageID).Return(nil)
+
+	// Call the usecase layer
+	err := messageUsecase.DeleteMessage(context.Background(), adminID, chatID, messageID)
+	_, updateErr := messageUsecase.UpdateMessage(context.Background(), adminID, chatID, messageID, "Edited")
+
+	// Assert
+	assert.NoError(t, err)
+	assert.ErrorIs(t, updateErr, domain.ErrForbidden)
+	mockMessageRepo.AssertExpectations(t)
+}
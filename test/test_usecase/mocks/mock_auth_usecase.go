@@ -0,0 +1,99 @@
+package mocks
+
+import (
+	"Real-Time-Chat-Application/domain"
+	"context"
+
+	"github.com/stretchr/testify/mock"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type MockAuthUsecase struct {
+	mock.Mock
+}
+
+func (m *MockAuthUsecase) Login(ctx context.Context, email string, password string, device domain.DeviceInfo) (*domain.LoginResult, error) {
+	args := m.Called(ctx, email, password, device)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.LoginResult), args.Error(1)
+}
+
+func (m *MockAuthUsecase) RefreshToken(ctx context.Context, refreshToken string, device domain.DeviceInfo) (*domain.TokenPair, error) {
+	args := m.Called(ctx, refreshToken, device)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.TokenPair), args.Error(1)
+}
+
+func (m *MockAuthUsecase) RequestPasswordReset(ctx context.Context, email string) error {
+	args := m.Called(ctx, email)
+	return args.Error(0)
+}
+
+func (m *MockAuthUsecase) ResetPassword(ctx context.Context, token, newPassword string) (primitive.ObjectID, error) {
+	args := m.Called(ctx, token, newPassword)
+	return args.Get(0).(primitive.ObjectID), args.Error(1)
+}
+
+func (m *MockAuthUsecase) CheckSession(ctx context.Context, userID, sessionID primitive.ObjectID) error {
+	args := m.Called(ctx, userID, sessionID)
+	return args.Error(0)
+}
+
+func (m *MockAuthUsecase) ListSessions(ctx context.Context, userID, currentSessionID primitive.ObjectID) ([]domain.Session, error) {
+	args := m.Called(ctx, userID, currentSessionID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]domain.Session), args.Error(1)
+}
+
+func (m *MockAuthUsecase) RevokeSession(ctx context.Context, userID, sessionID primitive.ObjectID) error {
+	args := m.Called(ctx, userID, sessionID)
+	return args.Error(0)
+}
+
+func (m *MockAuthUsecase) RevokeAllSessions(ctx context.Context, userID primitive.ObjectID) error {
+	args := m.Called(ctx, userID)
+	return args.Error(0)
+}
+
+func (m *MockAuthUsecase) LoginTwoFactor(ctx context.Context, challenge string, code string, device domain.DeviceInfo) (*domain.TokenPair, error) {
+	args := m.Called(ctx, challenge, code, device)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.TokenPair), args.Error(1)
+}
+
+func (m *MockAuthUsecase) SetupTwoFactor(ctx context.Context, userID primitive.ObjectID) (*domain.TwoFactorSetup, error) {
+	args := m.Called(ctx, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.TwoFactorSetup), args.Error(1)
+}
+
+func (m *MockAuthUsecase) ConfirmTwoFactor(ctx context.Context, userID primitive.ObjectID, code string) ([]string, error) {
+	args := m.Called(ctx, userID, code)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]string), args.Error(1)
+}
+
+func (m *MockAuthUsecase) DisableTwoFactor(ctx context.Context, userID primitive.ObjectID, code string) error {
+	args := m.Called(ctx, userID, code)
+	return args.Error(0)
+}
+
+func (m *MockAuthUsecase) TwoFactorStatus(ctx context.Context, callerID primitive.ObjectID, userID primitive.ObjectID) (*domain.TwoFactorStatus, error) {
+	args := m.Called(ctx, callerID, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.TwoFactorStatus), args.Error(1)
+}
@@ -11,13 +11,13 @@ type MockChatUsecase struct {
 	mock.Mock
 }
 
-func (m *MockChatUsecase) CreateChat(ctx context.Context, SenderID primitive.ObjectID, ReceiverID primitive.ObjectID) (primitive.ObjectID, error) {
+func (m *MockChatUsecase) CreateChat(ctx context.Context, SenderID primitive.ObjectID, ReceiverID primitive.ObjectID) (primitive.ObjectID, bool, error) {
 	args := m.Called(ctx, SenderID, ReceiverID)
-	return args.Get(0).(primitive.ObjectID), args.Error(1)
+	return args.Get(0).(primitive.ObjectID), args.Bool(1), args.Error(2)
 }
 
-func (m *MockChatUsecase) GetChat(ctx context.Context, chatID primitive.ObjectID) (*domain.Chat, error) {
-	args := m.Called(ctx, chatID)
+func (m *MockChatUsecase) GetChat(ctx context.Context, userID, chatID primitive.ObjectID) (*domain.Chat, error) {
+	args := m.Called(ctx, userID, chatID)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
@@ -32,13 +32,16 @@ func (m *MockChatUsecase) GetChatsByUserID(ctx context.Context, userID primitive
 	return args.Get(0).([]domain.Chat), args.Error(1)
 }
 
-func (m *MockChatUsecase) UpdateChat(ctx context.Context, chatID primitive.ObjectID, chat *domain.Chat) error {
-	args := m.Called(ctx, chatID, chat)
-	return args.Error(0)
+func (m *MockChatUsecase) UpdateChat(ctx context.Context, userID, chatID primitive.ObjectID, settings domain.ChatSettings) (*domain.Chat, error) {
+	args := m.Called(ctx, userID, chatID, settings)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.Chat), args.Error(1)
 }
 
-func (m *MockChatUsecase) DeleteChat(ctx context.Context, chatID primitive.ObjectID) error {
-	args := m.Called(ctx, chatID)
+func (m *MockChatUsecase) DeleteChat(ctx context.Context, userID, chatID primitive.ObjectID) error {
+	args := m.Called(ctx, userID, chatID)
 	return args.Error(0)
 }
 
@@ -49,3 +52,61 @@ func (m *MockChatUsecase) GetChatByParticipants(ctx context.Context, SenderID pr
 	}
 	return args.Get(0).(*domain.Chat), args.Error(1)
 }
+
+func (m *MockChatUsecase) AuthorizeParticipant(ctx context.Context, userID, chatID primitive.ObjectID) error {
+	args := m.Called(ctx, userID, chatID)
+	return args.Error(0)
+}
+
+func (m *MockChatUsecase) MarkRead(ctx context.Context, userID, chatID, messageID primitive.ObjectID) (domain.ReadMarker, bool, error) {
+	args := m.Called(ctx, userID, chatID, messageID)
+	return args.Get(0).(domain.ReadMarker), args.Bool(1), args.Error(2)
+}
+
+func (m *MockChatUsecase) ListChats(ctx context.Context, userID primitive.ObjectID) ([]domain.ChatSummary, error) {
+	args := m.Called(ctx, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]domain.ChatSummary), args.Error(1)
+}
+
+func (m *MockChatUsecase) CreateGroupChat(ctx context.Context, creatorID primitive.ObjectID, memberIDs []primitive.ObjectID, title, avatar string) (*domain.Chat, *domain.Message, error) {
+	args := m.Called(ctx, creatorID, memberIDs, title, avatar)
+	if args.Get(0) == nil {
+		return nil, nil, args.Error(2)
+	}
+	return args.Get(0).(*domain.Chat), args.Get(1).(*domain.Message), args.Error(2)
+}
+
+func (m *MockChatUsecase) AddMembers(ctx context.Context, userID, chatID primitive.ObjectID, memberIDs []primitive.ObjectID) (*domain.Message, error) {
+	args := m.Called(ctx, userID, chatID, memberIDs)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.Message), args.Error(1)
+}
+
+func (m *MockChatUsecase) RemoveMember(ctx context.Context, userID, chatID, memberID primitive.ObjectID) (*domain.Message, error) {
+	args := m.Called(ctx, userID, chatID, memberID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.Message), args.Error(1)
+}
+
+func (m *MockChatUsecase) LeaveChat(ctx context.Context, userID, chatID primitive.ObjectID) (*domain.Message, error) {
+	args := m.Called(ctx, userID, chatID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.Message), args.Error(1)
+}
+
+func (m *MockChatUsecase) SetMemberRole(ctx context.Context, userID, chatID, memberID primitive.ObjectID, role string) (*domain.Message, error) {
+	args := m.Called(ctx, userID, chatID, memberID, role)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.Message), args.Error(1)
+}
@@ -17,28 +17,38 @@ func (m *MockMessageUsecase) SendMessage(ctx context.Context, chatID primitive.O
 	return args.Error(0)
 }
 
-func (m *MockMessageUsecase) GetMessage(ctx context.Context, chatID, messageID primitive.ObjectID) (domain.Message, error) {
-	args := m.Called(ctx, chatID, messageID)
+func (m *MockMessageUsecase) GetMessage(ctx context.Context, userID, chatID, messageID primitive.ObjectID) (domain.Message, error) {
+	args := m.Called(ctx, userID, chatID, messageID)
 	if args.Get(0) == nil {
 		return domain.Message{}, args.Error(1)
 	}
 	return args.Get(0).(domain.Message), args.Error(1)
 }
 
-func (m *MockMessageUsecase) GetMessages(ctx context.Context, chatID primitive.ObjectID) ([]domain.Message, error) {
-	args := m.Called(ctx, chatID)
+func (m *MockMessageUsecase) GetMessages(ctx context.Context, userID, chatID primitive.ObjectID) ([]domain.Message, error) {
+	args := m.Called(ctx, userID, chatID)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
 	return args.Get(0).([]domain.Message), args.Error(1)
 }
 
-func (m *MockMessageUsecase) UpdateMessage(ctx context.Context, chatID, messageID primitive.ObjectID, newContent string) error {
-	args := m.Called(ctx, chatID, messageID, newContent)
-	return args.Error(0)
+func (m *MockMessageUsecase) UpdateMessage(ctx context.Context, userID, chatID, messageID primitive.ObjectID, newContent string) (domain.Message, error) {
+	args := m.Called(ctx, userID, chatID, messageID, newContent)
+	return args.Get(0).(domain.Message), args.Error(1)
 }
 
-func (m *MockMessageUsecase) DeleteMessage(ctx context.Context, chatID, messageID primitive.ObjectID) error {
-	args := m.Called(ctx, chatID, messageID)
+func (m *MockMessageUsecase) DeleteMessage(ctx context.Context, userID, chatID, messageID primitive.ObjectID) error {
+	args := m.Called(ctx, userID, chatID, messageID)
 	return args.Error(0)
 }
+
+func (m *MockMessageUsecase) GetMessagesBefore(ctx context.Context, userID, chatID primitive.ObjectID, cursor string, limit int) (domain.MessagePage, error) {
+	args := m.Called(ctx, userID, chatID, cursor, limit)
+	return args.Get(0).(domain.MessagePage), args.Error(1)
+}
+
+func (m *MockMessageUsecase) GetMessagesAfter(ctx context.Context, userID, chatID primitive.ObjectID, cursor string, limit int) (domain.MessagePage, error) {
+	args := m.Called(ctx, userID, chatID, cursor, limit)
+	return args.Get(0).(domain.MessagePage), args.Error(1)
+}
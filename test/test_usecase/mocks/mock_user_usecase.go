@@ -3,6 +3,7 @@ package mocks
 import (
 	"Real-Time-Chat-Application/domain"
 	"context"
+	"time"
 
 	"github.com/stretchr/testify/mock"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -50,3 +51,31 @@ func (m *MockUserUsecase) DeleteUser(ctx context.Context, userID primitive.Objec
 	args := m.Called(ctx, userID)
 	return args.Error(0)
 }
+
+func (m *MockUserUsecase) GetUsersByIDs(ctx context.Context, userIDs []primitive.ObjectID) ([]domain.User, error) {
+	args := m.Called(ctx, userIDs)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]domain.User), args.Error(1)
+}
+
+func (m *MockUserUsecase) UpdateLastSeen(ctx context.Context, userID primitive.ObjectID, lastSeen time.Time) error {
+	args := m.Called(ctx, userID, lastSeen)
+	return args.Error(0)
+}
+
+func (m *MockUserUsecase) ChangePassword(ctx context.Context, userID, sessionID primitive.ObjectID, currentPassword, newPassword string) error {
+	args := m.Called(ctx, userID, sessionID, currentPassword, newPassword)
+	return args.Error(0)
+}
+
+func (m *MockUserUsecase) VerifyEmail(ctx context.Context, token string) error {
+	args := m.Called(ctx, token)
+	return args.Error(0)
+}
+
+func (m *MockUserUsecase) ResendVerification(ctx context.Context, userID primitive.ObjectID) error {
+	args := m.Called(ctx, userID)
+	return args.Error(0)
+}
@@ -0,0 +1,378 @@
+package test_usecase
+
+import (
+	"Real-Time-Chat-Application/domain"
+	"Real-Time-Chat-Application/infrastructure"
+	"Real-Time-Chat-Application/test/test_repository/mocks"
+	"Real-Time-Chat-Application/usecase"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// testTOTPSecret is the SHA-1 key of the RFC 6238 test vectors, "12345678901234567890" in base32
+const testTOTPSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// At testTOTPTime the code of testTOTPSecret is testTOTPCode, in time step testTOTPStep
+var testTOTPTime = time.Unix(1111111109, 0)
+
+const (
+	testTOTPCode = "081804"
+	testTOTPStep = int64(1111111109 / 30)
+)
+
+func fixedClock() time.Time {
+	return testTOTPTime
+}
+
+func newTwoFactorUsecase(userRepository domain.UserRepository, userTokenRepository domain.UserTokenRepository, sessionRepository domain.SessionRepository) domain.AuthUsecase {
+	return usecase.NewAuthUsecase(userRepository, userTokenRepository, sessionRepository,
+		infrastructure.NewJWTService("secret", time.Minute, time.Hour), infrastructure.NewBcryptHasher(bcrypt.MinCost),
+		infrastructure.NewTOTPGenerator("Test", fixedClock), infrastructure.NewMemoryMailer(), 1*time.Second)
+}
+
+func sha256Hex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestTOTPGenerator(t *testing.T) {
+	totp := infrastructure.NewTOTPGenerator("Real-Time Chat", fixedClock)
+
+	t.Run("RFC 6238 test vectors", func(t *testing.T) {
+		for unix, expected := range map[int64]string{
+			59:          "287082",
+			1111111109:  "081804",
+			1111111111:  "050471",
+			1234567890:  "005924",
+			2000000000:  "279037",
+			20000000000: "353130",
+		} {
+			code, err := totp.Code(testTOTPSecret, time.Unix(unix, 0))
+			assert.NoError(t, err)
+			assert.Equal(t, expected, code, "code at %d", unix)
+		}
+	})
+
+	t.Run("allows one step of drift", func(t *testing.T) {
+		for _, offset := range []int64{-1, 0, 1} {
+			code, _ := totp.Code(testTOTPSecret, testTOTPTime.Add(time.Duration(offset)*domain.TOTPPeriod))
+			step, ok := totp.Validate(testTOTPSecret, code)
+			assert.True(t, ok, "offset %d", offset)
+			assert.Equal(t, testTOTPStep+offset, step)
+		}
+		for _, offset := range []int64{-2, 2} {
+			code, _ := totp.Code(testTOTPSecret, testTOTPTime.Add(time.Duration(offset)*domain.TOTPPeriod))
+			_, ok := totp.Validate(testTOTPSecret, code)
+			assert.False(t, ok, "offset %d", offset)
+		}
+	})
+
+	t.Run("rejects malformed input", func(t *testing.T) {
+		_, ok := totp.Validate(testTOTPSecret, "81804")
+		assert.False(t, ok)
+		_, ok = totp.Validate("not base32!", testTOTPCode)
+		assert.False(t, ok)
+	})
+
+	t.Run("generated secrets", func(t *testing.T) {
+		secret, err := totp.GenerateSecret()
+		assert.NoError(t, err)
+		assert.Regexp(t, regexp.MustCompile(`^[A-Z2-7]{32}$`), secret)
+		other, _ := totp.GenerateSecret()
+		assert.NotEqual(t, secret, other)
+	})
+
+	t.Run("URI", func(t *testing.T) {
+		assert.Equal(t,
+			"otpauth://totp/Real-Time%20Chat:jane@example.com?algorithm=SHA1&digits=6&issuer=Real-Time%20Chat&period=30&secret="+testTOTPSecret,
+			totp.URI(testTOTPSecret, "jane@example.com"))
+	})
+}
+
+func TestSetupTwoFactor(t *testing.T) {
+	user := &domain.User{UserID: primitive.NewObjectID(), Email: "test@example.com"}
+
+	t.Run("success", func(t *testing.T) {
+		mockUserRepository := new(mocks.MockUserRepository)
+		authUsecase := newTwoFactorUsecase(mockUserRepository, new(mocks.MockUserTokenRepository), new(mocks.MockSessionRepository))
+		mockUserRepository.On("GetUserByID", mock.Anything, user.UserID).Return(user, nil)
+		var stored *domain.TwoFactor
+		mockUserRepository.On("SetTwoFactor", mock.Anything, user.UserID, mock.AnythingOfType("*domain.TwoFactor")).Return(nil).Run(func(args mock.Arguments) {
+			stored = args.Get(2).(*domain.TwoFactor)
+		})
+
+		setup, err := authUsecase.SetupTwoFactor(context.Background(), user.UserID)
+		assert.NoError(t, err)
+		assert.Equal(t, stored.Secret, setup.Secret)
+		assert.False(t, stored.Enabled, "two-factor authentication should wait for a confirmation")
+		assert.Contains(t, setup.URI, "secret="+setup.Secret)
+		assert.Contains(t, setup.URI, "test@example.com")
+		mockUserRepository.AssertExpectations(t)
+	})
+
+	t.Run("already enabled", func(t *testing.T) {
+		mockUserRepository := new(mocks.MockUserRepository)
+		authUsecase := newTwoFactorUsecase(mockUserRepository, new(mocks.MockUserTokenRepository), new(mocks.MockSessionRepository))
+		enabled := *user
+		enabled.TwoFactor = &domain.TwoFactor{Secret: testTOTPSecret, Enabled: true}
+		mockUserRepository.On("GetUserByID", mock.Anything, user.UserID).Return(&enabled, nil)
+
+		_, err := authUsecase.SetupTwoFactor(context.Background(), user.UserID)
+		assert.ErrorIs(t, err, domain.ErrTwoFactorAlreadyEnabled)
+		mockUserRepository.AssertNotCalled(t, "SetTwoFactor", mock.Anything, mock.Anything, mock.Anything)
+	})
+}
+
+func TestConfirmTwoFactor(t *testing.T) {
+	pending := &domain.User{UserID: primitive.NewObjectID(), TwoFactor: &domain.TwoFactor{Secret: testTOTPSecret}}
+
+	t.Run("success", func(t *testing.T) {
+		mockUserRepository := new(mocks.MockUserRepository)
+		authUsecase := newTwoFactorUsecase(mockUserRepository, new(mocks.MockUserTokenRepository), new(mocks.MockSessionRepository))
+		mockUserRepository.On("GetUserByID", mock.Anything, pending.UserID).Return(pending, nil)
+		var stored *domain.TwoFactor
+		mockUserRepository.On("SetTwoFactor", mock.Anything, pending.UserID, mock.AnythingOfType("*domain.TwoFactor")).Return(nil).Run(func(args mock.Arguments) {
+			stored = args.Get(2).(*domain.TwoFactor)
+		})
+
+		codes, err := authUsecase.ConfirmTwoFactor(context.Background(), pending.UserID, testTOTPCode)
+		assert.NoError(t, err)
+		assert.Len(t, codes, domain.RecoveryCodeCount)
+		for _, code := range codes {
+			assert.Regexp(t, regexp.MustCompile(`^[a-z2-7]{5}-[a-z2-7]{5}$`), code)
+		}
+
+		assert.True(t, stored.Enabled)
+		assert.NotNil(t, stored.EnabledAt)
+		assert.Equal(t, testTOTPSecret, stored.Secret)
+		// The confirmation code is used up, and only hashes of the recovery codes are stored
+		assert.Equal(t, testTOTPStep, stored.LastUsedStep)
+		assert.Len(t, stored.RecoveryCodes, domain.RecoveryCodeCount)
+		assert.Equal(t, sha256Hex(strings.ReplaceAll(codes[0], "-", "")), stored.RecoveryCodes[0])
+		assert.NotContains(t, stored.RecoveryCodes, codes[0])
+	})
+
+	t.Run("wrong code", func(t *testing.T) {
+		mockUserRepository := new(mocks.MockUserRepository)
+		authUsecase := newTwoFactorUsecase(mockUserRepository, new(mocks.MockUserTokenRepository), new(mocks.MockSessionRepository))
+		mockUserRepository.On("GetUserByID", mock.Anything, pending.UserID).Return(pending, nil)
+
+		_, err := authUsecase.ConfirmTwoFactor(context.Background(), pending.UserID, "000000")
+		var validationErr *domain.ValidationError
+		assert.ErrorAs(t, err, &validationErr)
+		assert.Equal(t, "code", validationErr.Fields[0].Field)
+		mockUserRepository.AssertNotCalled(t, "SetTwoFactor", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("not set up", func(t *testing.T) {
+		mockUserRepository := new(mocks.MockUserRepository)
+		authUsecase := newTwoFactorUsecase(mockUserRepository, new(mocks.MockUserTokenRepository), new(mocks.MockSessionRepository))
+		mockUserRepository.On("GetUserByID", mock.Anything, pending.UserID).Return(&domain.User{UserID: pending.UserID}, nil)
+
+		_, err := authUsecase.ConfirmTwoFactor(context.Background(), pending.UserID, testTOTPCode)
+		assert.ErrorIs(t, err, domain.ErrTwoFactorNotEnabled)
+	})
+
+	t.Run("missing code", func(t *testing.T) {
+		authUsecase := newTwoFactorUsecase(new(mocks.MockUserRepository), new(mocks.MockUserTokenRepository), new(mocks.MockSessionRepository))
+
+		_, err := authUsecase.ConfirmTwoFactor(context.Background(), pending.UserID, " ")
+		var validationErr *domain.ValidationError
+		assert.ErrorAs(t, err, &validationErr)
+	})
+}
+
+func TestDisableTwoFactor(t *testing.T) {
+	user := &domain.User{UserID: primitive.NewObjectID(), TwoFactor: &domain.TwoFactor{Secret: testTOTPSecret, Enabled: true}}
+
+	t.Run("with a TOTP code", func(t *testing.T) {
+		mockUserRepository := new(mocks.MockUserRepository)
+		authUsecase := newTwoFactorUsecase(mockUserRepository, new(mocks.MockUserTokenRepository), new(mocks.MockSessionRepository))
+		mockUserRepository.On("GetUserByID", mock.Anything, user.UserID).Return(user, nil)
+		mockUserRepository.On("UseTOTPStep", mock.Anything, user.UserID, testTOTPStep).Return(nil)
+		mockUserRepository.On("SetTwoFactor", mock.Anything, user.UserID, (*domain.TwoFactor)(nil)).Return(nil)
+
+		err := authUsecase.DisableTwoFactor(context.Background(), user.UserID, testTOTPCode)
+		assert.NoError(t, err)
+		mockUserRepository.AssertExpectations(t)
+	})
+
+	t.Run("reused code", func(t *testing.T) {
+		mockUserRepository := new(mocks.MockUserRepository)
+		authUsecase := newTwoFactorUsecase(mockUserRepository, new(mocks.MockUserTokenRepository), new(mocks.MockSessionRepository))
+		mockUserRepository.On("GetUserByID", mock.Anything, user.UserID).Return(user, nil)
+		mockUserRepository.On("UseTOTPStep", mock.Anything, user.UserID, testTOTPStep).Return(domain.ErrInvalidTwoFactorCode)
+
+		err := authUsecase.DisableTwoFactor(context.Background(), user.UserID, testTOTPCode)
+		var validationErr *domain.ValidationError
+		assert.ErrorAs(t, err, &validationErr)
+		assert.Equal(t, "code", validationErr.Fields[0].Field)
+		mockUserRepository.AssertNotCalled(t, "SetTwoFactor", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("not enabled", func(t *testing.T) {
+		mockUserRepository := new(mocks.MockUserRepository)
+		authUsecase := newTwoFactorUsecase(mockUserRepository, new(mocks.MockUserTokenRepository), new(mocks.MockSessionRepository))
+		mockUserRepository.On("GetUserByID", mock.Anything, user.UserID).Return(&domain.User{UserID: user.UserID}, nil)
+
+		err := authUsecase.DisableTwoFactor(context.Background(), user.UserID, testTOTPCode)
+		assert.ErrorIs(t, err, domain.ErrTwoFactorNotEnabled)
+	})
+}
+
+func TestLoginTwoFactor(t *testing.T) {
+	user := &domain.User{UserID: primitive.NewObjectID(), TwoFactor: &domain.TwoFactor{Secret: testTOTPSecret, Enabled: true}}
+	device := domain.DeviceInfo{Name: "Phone"}
+	challengeHash := sha256Hex("challenge")
+
+	// challenged returns mocks with the challenge of user ready to be consumed
+	challenged := func() (*mocks.MockUserRepository, *mocks.MockUserTokenRepository, *mocks.MockSessionRepository) {
+		mockUserRepository := new(mocks.MockUserRepository)
+		mockUserTokenRepository := new(mocks.MockUserTokenRepository)
+		mockUserTokenRepository.On("ConsumeToken", mock.Anything, domain.TokenTwoFactorLogin, challengeHash, mock.Anything).
+			Return(&domain.UserToken{UserID: user.UserID, Purpose: domain.TokenTwoFactorLogin, Hash: challengeHash}, nil)
+		mockUserRepository.On("GetUserByID", mock.Anything, user.UserID).Return(user, nil)
+		return mockUserRepository, mockUserTokenRepository, new(mocks.MockSessionRepository)
+	}
+
+	t.Run("with a TOTP code", func(t *testing.T) {
+		mockUserRepository, mockUserTokenRepository, mockSessionRepository := challenged()
+		authUsecase := newTwoFactorUsecase(mockUserRepository, mockUserTokenRepository, mockSessionRepository)
+		mockUserRepository.On("UseTOTPStep", mock.Anything, user.UserID, testTOTPStep).Return(nil)
+		mockSessionRepository.On("CreateSession", mock.Anything, mock.MatchedBy(func(session *domain.Session) bool {
+			return session.UserID == user.UserID && session.DeviceName == "Phone"
+		})).Return(nil)
+
+		tokens, err := authUsecase.LoginTwoFactor(context.Background(), "challenge", testTOTPCode, device)
+		assert.NoError(t, err)
+		assert.NotEmpty(t, tokens.AccessToken)
+		mockUserRepository.AssertExpectations(t)
+		mockSessionRepository.AssertExpectations(t)
+	})
+
+	t.Run("with a recovery code", func(t *testing.T) {
+		mockUserRepository, mockUserTokenRepository, mockSessionRepository := challenged()
+		authUsecase := newTwoFactorUsecase(mockUserRepository, mockUserTokenRepository, mockSessionRepository)
+		// Case and dashes do not matter
+		mockUserRepository.On("UseRecoveryCode", mock.Anything, user.UserID, sha256Hex("abcdefghij")).Return(nil)
+		mockSessionRepository.On("CreateSession", mock.Anything, mock.AnythingOfType("*domain.Session")).Return(nil)
+
+		_, err := authUsecase.LoginTwoFactor(context.Background(), "challenge", "ABCDE-FGHIJ", device)
+		assert.NoError(t, err)
+		mockUserRepository.AssertExpectations(t)
+	})
+
+	t.Run("reused TOTP code", func(t *testing.T) {
+		mockUserRepository, mockUserTokenRepository, mockSessionRepository := challenged()
+		authUsecase := newTwoFactorUsecase(mockUserRepository, mockUserTokenRepository, mockSessionRepository)
+		mockUserRepository.On("UseTOTPStep", mock.Anything, user.UserID, testTOTPStep).Return(domain.ErrInvalidTwoFactorCode)
+
+		_, err := authUsecase.LoginTwoFactor(context.Background(), "challenge", testTOTPCode, device)
+		assert.ErrorIs(t, err, domain.ErrInvalidTwoFactorCode)
+		mockSessionRepository.AssertNotCalled(t, "CreateSession", mock.Anything, mock.Anything)
+	})
+
+	t.Run("wrong TOTP code", func(t *testing.T) {
+		mockUserRepository, mockUserTokenRepository, mockSessionRepository := challenged()
+		authUsecase := newTwoFactorUsecase(mockUserRepository, mockUserTokenRepository, mockSessionRepository)
+
+		_, err := authUsecase.LoginTwoFactor(context.Background(), "challenge", "000000", device)
+		assert.ErrorIs(t, err, domain.ErrInvalidTwoFactorCode)
+		mockUserRepository.AssertNotCalled(t, "UseTOTPStep", mock.Anything, mock.Anything, mock.Anything)
+		mockSessionRepository.AssertNotCalled(t, "CreateSession", mock.Anything, mock.Anything)
+	})
+
+	t.Run("used or expired challenge", func(t *testing.T) {
+		mockUserRepository := new(mocks.MockUserRepository)
+		mockUserTokenRepository := new(mocks.MockUserTokenRepository)
+		authUsecase := newTwoFactorUsecase(mockUserRepository, mockUserTokenRepository, new(mocks.MockSessionRepository))
+		mockUserTokenRepository.On("ConsumeToken", mock.Anything, domain.TokenTwoFactorLogin, challengeHash, mock.Anything).Return(nil, domain.ErrInvalidUserToken)
+
+		_, err := authUsecase.LoginTwoFactor(context.Background(), "challenge", testTOTPCode, device)
+		assert.ErrorIs(t, err, domain.ErrInvalidUserToken)
+		mockUserRepository.AssertNotCalled(t, "GetUserByID", mock.Anything, mock.Anything)
+	})
+
+	t.Run("disabled since the first step", func(t *testing.T) {
+		mockUserRepository := new(mocks.MockUserRepository)
+		mockUserTokenRepository := new(mocks.MockUserTokenRepository)
+		authUsecase := newTwoFactorUsecase(mockUserRepository, mockUserTokenRepository, new(mocks.MockSessionRepository))
+		mockUserTokenRepository.On("ConsumeToken", mock.Anything, domain.TokenTwoFactorLogin, challengeHash, mock.Anything).
+			Return(&domain.UserToken{UserID: user.UserID}, nil)
+		mockUserRepository.On("GetUserByID", mock.Anything, user.UserID).Return(&domain.User{UserID: user.UserID}, nil)
+
+		_, err := authUsecase.LoginTwoFactor(context.Background(), "challenge", testTOTPCode, device)
+		assert.ErrorIs(t, err, domain.ErrInvalidUserToken)
+	})
+
+	t.Run("missing fields", func(t *testing.T) {
+		authUsecase := newTwoFactorUsecase(new(mocks.MockUserRepository), new(mocks.MockUserTokenRepository), new(mocks.MockSessionRepository))
+
+		_, err := authUsecase.LoginTwoFactor(context.Background(), "", "", device)
+		var validationErr *domain.ValidationError
+		assert.ErrorAs(t, err, &validationErr)
+		assert.Len(t, validationErr.Fields, 2)
+	})
+}
+
+func TestTwoFactorStatus(t *testing.T) {
+	enabledAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	user := &domain.User{UserID: primitive.NewObjectID(), TwoFactor: &domain.TwoFactor{
+		Secret: testTOTPSecret, Enabled: true, EnabledAt: &enabledAt, RecoveryCodes: []string{"a", "b"},
+	}}
+	expected := &domain.TwoFactorStatus{Enabled: true, EnabledAt: &enabledAt, RecoveryCodesLeft: 2}
+
+	t.Run("own status", func(t *testing.T) {
+		mockUserRepository := new(mocks.MockUserRepository)
+		authUsecase := newTwoFactorUsecase(mockUserRepository, new(mocks.MockUserTokenRepository), new(mocks.MockSessionRepository))
+		mockUserRepository.On("GetUserByID", mock.Anything, user.UserID).Return(user, nil)
+
+		status, err := authUsecase.TwoFactorStatus(context.Background(), user.UserID, user.UserID)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, status)
+	})
+
+	t.Run("admin", func(t *testing.T) {
+		admin := &domain.User{UserID: primitive.NewObjectID(), IsAdmin: true}
+		mockUserRepository := new(mocks.MockUserRepository)
+		authUsecase := newTwoFactorUsecase(mockUserRepository, new(mocks.MockUserTokenRepository), new(mocks.MockSessionRepository))
+		mockUserRepository.On("GetUserByID", mock.Anything, admin.UserID).Return(admin, nil)
+		mockUserRepository.On("GetUserByID", mock.Anything, user.UserID).Return(user, nil)
+
+		status, err := authUsecase.TwoFactorStatus(context.Background(), admin.UserID, user.UserID)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, status)
+	})
+
+	t.Run("other user", func(t *testing.T) {
+		other := &domain.User{UserID: primitive.NewObjectID()}
+		mockUserRepository := new(mocks.MockUserRepository)
+		authUsecase := newTwoFactorUsecase(mockUserRepository, new(mocks.MockUserTokenRepository), new(mocks.MockSessionRepository))
+		mockUserRepository.On("GetUserByID", mock.Anything, other.UserID).Return(other, nil)
+
+		_, err := authUsecase.TwoFactorStatus(context.Background(), other.UserID, user.UserID)
+		assert.ErrorIs(t, err, domain.ErrForbidden)
+		mockUserRepository.AssertNotCalled(t, "GetUserByID", mock.Anything, user.UserID)
+	})
+
+	t.Run("pending setup", func(t *testing.T) {
+		pending := &domain.User{UserID: primitive.NewObjectID(), TwoFactor: &domain.TwoFactor{Secret: testTOTPSecret}}
+		mockUserRepository := new(mocks.MockUserRepository)
+		authUsecase := newTwoFactorUsecase(mockUserRepository, new(mocks.MockUserTokenRepository), new(mocks.MockSessionRepository))
+		mockUserRepository.On("GetUserByID", mock.Anything, pending.UserID).Return(pending, nil)
+
+		status, err := authUsecase.TwoFactorStatus(context.Background(), pending.UserID, pending.UserID)
+		assert.NoError(t, err)
+		assert.False(t, status.Enabled)
+	})
+}
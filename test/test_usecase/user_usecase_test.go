@@ -2,49 +2,125 @@ package test_usecase
 
 import (
 	"Real-Time-Chat-Application/domain"
+	"Real-Time-Chat-Application/infrastructure"
 	"Real-Time-Chat-Application/test/test_repository/mocks"
 	"Real-Time-Chat-Application/usecase"
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log"
+	"os"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"golang.org/x/crypto/bcrypt"
 )
 
 func TestCreateUser(t *testing.T) {
 	mockUserRepository := new(mocks.MockUserRepository)
-	userUsecase := usecase.NewUserUsecase(mockUserRepository, 1*time.Second)
+	mockUserTokenRepository := new(mocks.MockUserTokenRepository)
+	mailer := infrastructure.NewMemoryMailer()
+	userUsecase := usecase.NewUserUsecase(mockUserRepository, mockUserTokenRepository, new(mocks.MockSessionRepository), infrastructure.NewBcryptHasher(bcrypt.MinCost), mailer, 1*time.Second)
 
 	user := &domain.User{
-		UserID:    primitive.NewObjectID(),
-		Email:     "test@example.com",
-		Username:  "testuser",
-		Password:  "password",
-		Chats:     []primitive.ObjectID{},
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
+		UserID:        primitive.NewObjectID(),
+		Email:         "test@example.com",
+		Username:      "testuser",
+		Password:      "password123",
+		Chats:         []primitive.ObjectID{},
+		CreatedAt:     time.Now(),
+		UpdatedAt:     time.Now(),
+		EmailVerified: true, // clients cannot skip verification
 	}
 
 	mockUserRepository.On("CreateUser", mock.Anything, user).Return(user.UserID, nil)
+	mockUserTokenRepository.On("DeleteTokens", mock.Anything, user.UserID, domain.TokenEmailVerification).Return(nil)
+	mockUserTokenRepository.On("CreateToken", mock.Anything, mock.MatchedBy(func(token *domain.UserToken) bool {
+		return token.UserID == user.UserID && token.Purpose == domain.TokenEmailVerification
+	})).Return(nil)
 
 	userID, err := userUsecase.CreateUser(context.Background(), user)
 	assert.NoError(t, err)
 	assert.Equal(t, user.UserID, userID)
+	assert.False(t, user.EmailVerified)
+	assert.NotEqual(t, "password123", user.Password)
+	assert.True(t, infrastructure.NewBcryptHasher(bcrypt.MinCost).Compare(user.Password, "password123"))
+	_, sent := mailer.Last(user.Email)
+	assert.True(t, sent)
 	mockUserRepository.AssertExpectations(t)
+	mockUserTokenRepository.AssertExpectations(t)
+}
+
+func TestCreateUserVerificationFailure(t *testing.T) {
+	mockUserRepository := new(mocks.MockUserRepository)
+	mockUserTokenRepository := new(mocks.MockUserTokenRepository)
+	userUsecase := usecase.NewUserUsecase(mockUserRepository, mockUserTokenRepository, new(mocks.MockSessionRepository), infrastructure.NewBcryptHasher(bcrypt.MinCost), infrastructure.NewMemoryMailer(), 1*time.Second)
+	user := &domain.User{UserID: primitive.NewObjectID(), Email: "test@example.com", Username: "testuser", Password: "password123"}
+	mockUserRepository.On("CreateUser", mock.Anything, user).Return(user.UserID, nil)
+	mockUserTokenRepository.On("DeleteTokens", mock.Anything, user.UserID, domain.TokenEmailVerification).Return(errors.New("connection lost"))
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	// The user is signed up anyway and can ask for another mail, but the failure is logged
+	userID, err := userUsecase.CreateUser(context.Background(), user)
+	assert.NoError(t, err)
+	assert.Equal(t, user.UserID, userID)
+	assert.Contains(t, logs.String(), user.UserID.Hex())
+	assert.Contains(t, logs.String(), "connection lost")
+}
+
+func TestCreateUserValidation(t *testing.T) {
+	tests := []struct {
+		name   string
+		user   domain.User
+		fields []string
+	}{
+		{name: "missing everything", user: domain.User{}, fields: []string{"email", "username", "password"}},
+		{name: "email without domain", user: domain.User{Email: "test", Username: "testuser", Password: "password123"}, fields: []string{"email"}},
+		{name: "email with display name", user: domain.User{Email: "Test <test@example.com>", Username: "testuser", Password: "password123"}, fields: []string{"email"}},
+		{name: "short username", user: domain.User{Email: "test@example.com", Username: "ab", Password: "password123"}, fields: []string{"username"}},
+		{name: "username with spaces", user: domain.User{Email: "test@example.com", Username: "test user", Password: "password123"}, fields: []string{"username"}},
+		{name: "username starting with a dot", user: domain.User{Email: "test@example.com", Username: ".testuser", Password: "password123"}, fields: []string{"username"}},
+		{name: "short password", user: domain.User{Email: "test@example.com", Username: "testuser", Password: "pass1"}, fields: []string{"password"}},
+		{name: "password without digits", user: domain.User{Email: "test@example.com", Username: "testuser", Password: "password"}, fields: []string{"password"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockUserRepository := new(mocks.MockUserRepository)
+			userUsecase := usecase.NewUserUsecase(mockUserRepository, new(mocks.MockUserTokenRepository), new(mocks.MockSessionRepository), infrastructure.NewBcryptHasher(bcrypt.MinCost), infrastructure.NewMemoryMailer(), 1*time.Second)
+
+			_, err := userUsecase.CreateUser(context.Background(), &tt.user)
+
+			var validationErr *domain.ValidationError
+			assert.ErrorAs(t, err, &validationErr)
+			var fields []string
+			for _, field := range validationErr.Fields {
+				fields = append(fields, field.Field)
+			}
+			assert.Equal(t, tt.fields, fields)
+			mockUserRepository.AssertNotCalled(t, "CreateUser", mock.Anything, mock.Anything)
+		})
+	}
 }
 
 func TestGetUserByID(t *testing.T) {
 	mockUserRepository := new(mocks.MockUserRepository)
-	userUsecase := usecase.NewUserUsecase(mockUserRepository, 1*time.Second)
+	userUsecase := usecase.NewUserUsecase(mockUserRepository, new(mocks.MockUserTokenRepository), new(mocks.MockSessionRepository), infrastructure.NewBcryptHasher(bcrypt.MinCost), infrastructure.NewMemoryMailer(), 1*time.Second)
 
 	userID := primitive.NewObjectID()
 	expectedUser := &domain.User{
 		UserID:    userID,
 		Email:     "test@example.com",
 		Username:  "testuser",
-		Password:  "password",
+		Password:  "password123",
 		Chats:     []primitive.ObjectID{},
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
@@ -60,14 +136,14 @@ func TestGetUserByID(t *testing.T) {
 
 func TestGetUserByEmail(t *testing.T) {
 	mockUserRepository := new(mocks.MockUserRepository)
-	userUsecase := usecase.NewUserUsecase(mockUserRepository, 1*time.Second)
+	userUsecase := usecase.NewUserUsecase(mockUserRepository, new(mocks.MockUserTokenRepository), new(mocks.MockSessionRepository), infrastructure.NewBcryptHasher(bcrypt.MinCost), infrastructure.NewMemoryMailer(), 1*time.Second)
 
 	email := "test@example.com"
 	expectedUser := &domain.User{
 		UserID:    primitive.NewObjectID(),
 		Email:     email,
 		Username:  "testuser",
-		Password:  "password",
+		Password:  "password123",
 		Chats:     []primitive.ObjectID{},
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
@@ -83,14 +159,14 @@ func TestGetUserByEmail(t *testing.T) {
 
 func TestGetUserByUsername(t *testing.T) {
 	mockUserRepository := new(mocks.MockUserRepository)
-	userUsecase := usecase.NewUserUsecase(mockUserRepository, 1*time.Second)
+	userUsecase := usecase.NewUserUsecase(mockUserRepository, new(mocks.MockUserTokenRepository), new(mocks.MockSessionRepository), infrastructure.NewBcryptHasher(bcrypt.MinCost), infrastructure.NewMemoryMailer(), 1*time.Second)
 
 	username := "testuser"
 	expectedUser := &domain.User{
 		UserID:    primitive.NewObjectID(),
 		Email:     "test@example.com",
 		Username:  username,
-		Password:  "password",
+		Password:  "password123",
 		Chats:     []primitive.ObjectID{},
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
@@ -106,14 +182,14 @@ func TestGetUserByUsername(t *testing.T) {
 
 func TestUpdateUser(t *testing.T) {
 	mockUserRepository := new(mocks.MockUserRepository)
-	userUsecase := usecase.NewUserUsecase(mockUserRepository, 1*time.Second)
+	userUsecase := usecase.NewUserUsecase(mockUserRepository, new(mocks.MockUserTokenRepository), new(mocks.MockSessionRepository), infrastructure.NewBcryptHasher(bcrypt.MinCost), infrastructure.NewMemoryMailer(), 1*time.Second)
 
 	userID := primitive.NewObjectID()
 	updatedUser := &domain.User{
 		UserID:    userID,
 		Email:     "updated@example.com",
 		Username:  "updateduser",
-		Password:  "newpassword",
+		Password:  "newpassword1",
 		Chats:     []primitive.ObjectID{},
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
@@ -126,9 +202,57 @@ func TestUpdateUser(t *testing.T) {
 	mockUserRepository.AssertExpectations(t)
 }
 
+func TestChangePassword(t *testing.T) {
+	passwordHasher := infrastructure.NewBcryptHasher(bcrypt.MinCost)
+	userID := primitive.NewObjectID()
+	currentHash, _ := passwordHasher.Hash("password123")
+	user := &domain.User{UserID: userID, Password: currentHash}
+	sessionID := primitive.NewObjectID()
+
+	t.Run("success", func(t *testing.T) {
+		mockUserRepository := new(mocks.MockUserRepository)
+		mockSessionRepository := new(mocks.MockSessionRepository)
+		userUsecase := usecase.NewUserUsecase(mockUserRepository, new(mocks.MockUserTokenRepository), mockSessionRepository, passwordHasher, infrastructure.NewMemoryMailer(), 1*time.Second)
+		mockUserRepository.On("GetUserByID", mock.Anything, userID).Return(user, nil)
+		mockUserRepository.On("UpdateUser", mock.Anything, userID, mock.MatchedBy(func(update *domain.User) bool {
+			return update.Username == "" && passwordHasher.Compare(update.Password, "newpassword1")
+		})).Return(nil)
+		// The caller's session is kept, every other one is signed out
+		mockSessionRepository.On("DeleteOtherSessions", mock.Anything, userID, sessionID).Return(nil)
+
+		err := userUsecase.ChangePassword(context.Background(), userID, sessionID, "password123", "newpassword1")
+		assert.NoError(t, err)
+		mockUserRepository.AssertExpectations(t)
+		mockSessionRepository.AssertExpectations(t)
+	})
+
+	t.Run("wrong current password", func(t *testing.T) {
+		mockUserRepository := new(mocks.MockUserRepository)
+		userUsecase := usecase.NewUserUsecase(mockUserRepository, new(mocks.MockUserTokenRepository), new(mocks.MockSessionRepository), passwordHasher, infrastructure.NewMemoryMailer(), 1*time.Second)
+		mockUserRepository.On("GetUserByID", mock.Anything, userID).Return(user, nil)
+
+		err := userUsecase.ChangePassword(context.Background(), userID, sessionID, "password124", "newpassword1")
+		var validationErr *domain.ValidationError
+		assert.ErrorAs(t, err, &validationErr)
+		assert.Equal(t, "current_password", validationErr.Fields[0].Field)
+		mockUserRepository.AssertNotCalled(t, "UpdateUser", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("same password", func(t *testing.T) {
+		mockUserRepository := new(mocks.MockUserRepository)
+		userUsecase := usecase.NewUserUsecase(mockUserRepository, new(mocks.MockUserTokenRepository), new(mocks.MockSessionRepository), passwordHasher, infrastructure.NewMemoryMailer(), 1*time.Second)
+
+		err := userUsecase.ChangePassword(context.Background(), userID, sessionID, "password123", "password123")
+		var validationErr *domain.ValidationError
+		assert.ErrorAs(t, err, &validationErr)
+		assert.Equal(t, "new_password", validationErr.Fields[0].Field)
+		mockUserRepository.AssertNotCalled(t, "GetUserByID", mock.Anything, mock.Anything)
+	})
+}
+
 func TestDeleteUser(t *testing.T) {
 	mockUserRepository := new(mocks.MockUserRepository)
-	userUsecase := usecase.NewUserUsecase(mockUserRepository, 1*time.Second)
+	userUsecase := usecase.NewUserUsecase(mockUserRepository, new(mocks.MockUserTokenRepository), new(mocks.MockSessionRepository), infrastructure.NewBcryptHasher(bcrypt.MinCost), infrastructure.NewMemoryMailer(), 1*time.Second)
 
 	userID := primitive.NewObjectID()
 	mockUserRepository.On("DeleteUser", mock.Anything, userID).Return(nil)
@@ -137,3 +261,103 @@ func TestDeleteUser(t *testing.T) {
 	assert.NoError(t, err)
 	mockUserRepository.AssertExpectations(t)
 }
+
+func TestGetUsersByIDs(t *testing.T) {
+	mockUserRepository := new(mocks.MockUserRepository)
+	userUsecase := usecase.NewUserUsecase(mockUserRepository, new(mocks.MockUserTokenRepository), new(mocks.MockSessionRepository), infrastructure.NewBcryptHasher(bcrypt.MinCost), infrastructure.NewMemoryMailer(), 1*time.Second)
+
+	userIDs := []primitive.ObjectID{primitive.NewObjectID(), primitive.NewObjectID()}
+	users := []domain.User{{UserID: userIDs[0]}, {UserID: userIDs[1]}}
+	mockUserRepository.On("GetUsersByIDs", mock.Anything, userIDs).Return(users, nil)
+
+	result, err := userUsecase.GetUsersByIDs(context.Background(), userIDs)
+	assert.NoError(t, err)
+	assert.Equal(t, users, result)
+	mockUserRepository.AssertExpectations(t)
+}
+
+func TestUpdateLastSeen(t *testing.T) {
+	mockUserRepository := new(mocks.MockUserRepository)
+	userUsecase := usecase.NewUserUsecase(mockUserRepository, new(mocks.MockUserTokenRepository), new(mocks.MockSessionRepository), infrastructure.NewBcryptHasher(bcrypt.MinCost), infrastructure.NewMemoryMailer(), 1*time.Second)
+
+	userID := primitive.NewObjectID()
+	lastSeen := time.Now()
+	mockUserRepository.On("UpdateLastSeen", mock.Anything, userID, lastSeen).Return(nil)
+
+	err := userUsecase.UpdateLastSeen(context.Background(), userID, lastSeen)
+	assert.NoError(t, err)
+	mockUserRepository.AssertExpectations(t)
+}
+
+func TestVerifyEmail(t *testing.T) {
+	userID := primitive.NewObjectID()
+	sum := sha256.Sum256([]byte("verify-token"))
+	hash := hex.EncodeToString(sum[:])
+
+	t.Run("success", func(t *testing.T) {
+		mockUserRepository := new(mocks.MockUserRepository)
+		mockUserTokenRepository := new(mocks.MockUserTokenRepository)
+		userUsecase := usecase.NewUserUsecase(mockUserRepository, mockUserTokenRepository, new(mocks.MockSessionRepository), infrastructure.NewBcryptHasher(bcrypt.MinCost), infrastructure.NewMemoryMailer(), 1*time.Second)
+		mockUserTokenRepository.On("ConsumeToken", mock.Anything, domain.TokenEmailVerification, hash, mock.Anything).
+			Return(&domain.UserToken{UserID: userID, Purpose: domain.TokenEmailVerification, Hash: hash}, nil)
+		mockUserRepository.On("MarkEmailVerified", mock.Anything, userID).Return(nil)
+
+		err := userUsecase.VerifyEmail(context.Background(), "verify-token")
+		assert.NoError(t, err)
+		mockUserRepository.AssertExpectations(t)
+	})
+
+	t.Run("invalid token", func(t *testing.T) {
+		mockUserRepository := new(mocks.MockUserRepository)
+		mockUserTokenRepository := new(mocks.MockUserTokenRepository)
+		userUsecase := usecase.NewUserUsecase(mockUserRepository, mockUserTokenRepository, new(mocks.MockSessionRepository), infrastructure.NewBcryptHasher(bcrypt.MinCost), infrastructure.NewMemoryMailer(), 1*time.Second)
+		mockUserTokenRepository.On("ConsumeToken", mock.Anything, domain.TokenEmailVerification, hash, mock.Anything).Return(nil, domain.ErrInvalidUserToken)
+
+		err := userUsecase.VerifyEmail(context.Background(), "verify-token")
+		assert.ErrorIs(t, err, domain.ErrInvalidUserToken)
+		mockUserRepository.AssertNotCalled(t, "MarkEmailVerified", mock.Anything, mock.Anything)
+	})
+}
+
+func TestResendVerification(t *testing.T) {
+	user := &domain.User{UserID: primitive.NewObjectID(), Email: "test@example.com", Username: "testuser"}
+
+	t.Run("success", func(t *testing.T) {
+		mockUserRepository := new(mocks.MockUserRepository)
+		mockUserTokenRepository := new(mocks.MockUserTokenRepository)
+		mailer := infrastructure.NewMemoryMailer()
+		userUsecase := usecase.NewUserUsecase(mockUserRepository, mockUserTokenRepository, new(mocks.MockSessionRepository), infrastructure.NewBcryptHasher(bcrypt.MinCost), mailer, 1*time.Second)
+		mockUserRepository.On("GetUserByID", mock.Anything, user.UserID).Return(user, nil)
+		mockUserTokenRepository.On("LatestTokenTime", mock.Anything, user.UserID, domain.TokenEmailVerification).
+			Return(time.Now().Add(-domain.VerificationResendCooldown-time.Second), nil)
+		mockUserTokenRepository.On("DeleteTokens", mock.Anything, user.UserID, domain.TokenEmailVerification).Return(nil)
+		mockUserTokenRepository.On("CreateToken", mock.Anything, mock.AnythingOfType("*domain.UserToken")).Return(nil)
+
+		err := userUsecase.ResendVerification(context.Background(), user.UserID)
+		assert.NoError(t, err)
+		assert.Len(t, mailer.Sent(), 1)
+		mockUserTokenRepository.AssertExpectations(t)
+	})
+
+	t.Run("too soon", func(t *testing.T) {
+		mockUserRepository := new(mocks.MockUserRepository)
+		mockUserTokenRepository := new(mocks.MockUserTokenRepository)
+		mailer := infrastructure.NewMemoryMailer()
+		userUsecase := usecase.NewUserUsecase(mockUserRepository, mockUserTokenRepository, new(mocks.MockSessionRepository), infrastructure.NewBcryptHasher(bcrypt.MinCost), mailer, 1*time.Second)
+		mockUserRepository.On("GetUserByID", mock.Anything, user.UserID).Return(user, nil)
+		mockUserTokenRepository.On("LatestTokenTime", mock.Anything, user.UserID, domain.TokenEmailVerification).Return(time.Now().Add(-time.Second), nil)
+
+		err := userUsecase.ResendVerification(context.Background(), user.UserID)
+		assert.ErrorIs(t, err, domain.ErrResendTooSoon)
+		assert.Empty(t, mailer.Sent())
+	})
+
+	t.Run("already verified", func(t *testing.T) {
+		mockUserRepository := new(mocks.MockUserRepository)
+		userUsecase := usecase.NewUserUsecase(mockUserRepository, new(mocks.MockUserTokenRepository), new(mocks.MockSessionRepository), infrastructure.NewBcryptHasher(bcrypt.MinCost), infrastructure.NewMemoryMailer(), 1*time.Second)
+		mockUserRepository.On("GetUserByID", mock.Anything, user.UserID).Return(&domain.User{UserID: user.UserID, EmailVerified: true}, nil)
+
+		err := userUsecase.ResendVerification(context.Background(), user.UserID)
+		assert.ErrorIs(t, err, domain.ErrEmailAlreadyVerified)
+	})
+}
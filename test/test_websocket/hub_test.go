@@ -0,0 +1,608 @@
+package test
+
+import (
+	"Real-Time-Chat-Application/domain"
+	"Real-Time-Chat-Application/test/test_usecase/mocks"
+	"Real-Time-Chat-Application/websocket"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	gorilla "github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestHubStop(t *testing.T) {
+	hub := websocket.NewHub(nil, nil, nil)
+	go hub.Run()
+
+	client := websocket.NewClient(nil, "user", "chat")
+	hub.Register <- client
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	assert.NoError(t, hub.Stop(ctx))
+
+	_, open := <-client.SendChan
+	assert.False(t, open, "client send channel should be closed on shutdown")
+	assert.Empty(t, hub.Clients)
+
+	// Stopping twice is a no-op
+	assert.NoError(t, hub.Stop(ctx))
+}
+
+func TestHandleWebSocketRefusesNonParticipant(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockChatUsecase := new(mocks.MockChatUsecase)
+	hub := websocket.NewHub(mockChatUsecase, nil, nil)
+
+	userID := primitive.NewObjectID()
+	chatID := primitive.NewObjectID()
+	mockChatUsecase.On("AuthorizeParticipant", mock.Anything, userID, chatID).Return(domain.ErrForbidden)
+
+	r := gin.New()
+	r.GET("/ws", func(c *gin.Context) {
+		websocket.HandleWebSocket(c, hub, userID.Hex(), "")
+	})
+
+	t.Run("not a participant", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, "/ws?chat_id="+chatID.Hex(), nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.JSONEq(t, `{"error": "forbidden", "code": "forbidden"}`, w.Body.String())
+		assert.Empty(t, hub.Clients)
+		mockChatUsecase.AssertExpectations(t)
+	})
+
+	t.Run("invalid chat ID", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, "/ws?chat_id=invalid", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), `"code":"invalid_request"`)
+	})
+
+	t.Run("failure loading the chats", func(t *testing.T) {
+		mockChatUsecase.On("GetChatsByUserID", mock.Anything, userID).Return(nil, errors.New("mongo: connection refused")).Once()
+
+		req, _ := http.NewRequest(http.MethodGet, "/ws", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		// The cause is logged, not sent to the client
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+		assert.JSONEq(t, `{"error": "Internal server error", "code": "internal"}`, w.Body.String())
+	})
+}
+
+func TestHubRoutesMessagesByChat(t *testing.T) {
+	hub := websocket.NewHub(nil, nil, nil)
+	go hub.Run()
+	defer hub.Stop(context.Background())
+
+	member := websocket.NewClient(nil, "member", "chat-1")
+	outsider := websocket.NewClient(nil, "outsider", "chat-2")
+	hub.Register <- member
+	hub.Register <- outsider
+
+	// Run handles the registrations before the broadcast
+	hub.Broadcast <- websocket.ChatMessage{ChatID: "chat-1", Data: []byte("from the read pump")}
+	hub.BroadcastToChat("chat-1", websocket.EventMessageCreated, "from a controller")
+
+	assert.Equal(t, []byte("from the read pump"), <-member.SendChan)
+	assert.Contains(t, string(<-member.SendChan), `"payload":"from a controller"`)
+	assert.Empty(t, outsider.SendChan, "clients of other chats must not receive the message")
+}
+
+func TestHubSubscriptions(t *testing.T) {
+	hub := websocket.NewHub(nil, nil, nil)
+	go hub.Run()
+	defer hub.Stop(context.Background())
+
+	client := websocket.NewClient(nil, "user", "chat-1")
+	hub.Register <- client
+
+	hub.Subscribe(client, "chat-2")
+	hub.Unsubscribe(client, "chat-1")
+	assert.Equal(t, []string{"chat-2"}, hub.Subscriptions(client))
+
+	hub.BroadcastToChat("chat-1", websocket.EventMessageCreated, "unsubscribed")
+	hub.BroadcastToChat("chat-2", websocket.EventMessageCreated, "subscribed")
+
+	assert.Contains(t, string(<-client.SendChan), `"payload":"subscribed"`)
+	assert.Empty(t, client.SendChan)
+}
+
+func TestHubSubscribeUser(t *testing.T) {
+	hub := websocket.NewHub(nil, nil, nil)
+	go hub.Run()
+	defer hub.Stop(context.Background())
+
+	phone := websocket.NewClient(nil, "user")
+	laptop := websocket.NewClient(nil, "user", "chat-1")
+	other := websocket.NewClient(nil, "other")
+	hub.Register <- phone
+	hub.Register <- laptop
+	hub.Register <- other
+	// Run handles one request at a time, so once this is accepted every client is registered
+	hub.Broadcast <- websocket.ChatMessage{ChatID: "sync"}
+
+	// Every connection of the user follows a group they joined, and none after they leave
+	hub.SubscribeUser("user", "group")
+	assert.Equal(t, []string{"group"}, hub.Subscriptions(phone))
+	assert.Equal(t, []string{"chat-1", "group"}, hub.Subscriptions(laptop))
+	assert.Empty(t, hub.Subscriptions(other))
+
+	hub.UnsubscribeUser("user", "group")
+	assert.Empty(t, hub.Subscriptions(phone))
+	assert.Equal(t, []string{"chat-1"}, hub.Subscriptions(laptop))
+}
+
+func TestHubDisconnectSession(t *testing.T) {
+	hub := websocket.NewHub(nil, nil, nil)
+	go hub.Run()
+	defer hub.Stop(context.Background())
+
+	phone := websocket.NewClient(nil, "user")
+	phone.SessionID = "phone"
+	laptopTab := websocket.NewClient(nil, "user")
+	laptopTab.SessionID = "laptop"
+	laptopWindow := websocket.NewClient(nil, "user")
+	laptopWindow.SessionID = "laptop"
+	other := websocket.NewClient(nil, "other")
+	other.SessionID = "other"
+	for _, client := range []*websocket.Client{phone, laptopTab, laptopWindow, other} {
+		hub.Register <- client
+	}
+	hub.Broadcast <- websocket.ChatMessage{ChatID: "sync"}
+
+	// Revoking a session closes every connection opened with it
+	hub.DisconnectSession("laptop")
+	for _, client := range []*websocket.Client{laptopTab, laptopWindow} {
+		_, open := <-client.SendChan
+		assert.False(t, open, "connections of a revoked session should be closed")
+	}
+	assert.Len(t, hub.Clients, 2)
+
+	// Signing out everywhere closes the remaining connections of the user only
+	hub.DisconnectUser("user")
+	_, open := <-phone.SendChan
+	assert.False(t, open)
+	assert.True(t, hub.Clients[other])
+	assert.Len(t, hub.Clients, 1)
+}
+
+func TestHubDisconnectOtherSessions(t *testing.T) {
+	hub := websocket.NewHub(nil, nil, nil)
+	go hub.Run()
+	defer hub.Stop(context.Background())
+
+	current := websocket.NewClient(nil, "user")
+	current.SessionID = "current"
+	phone := websocket.NewClient(nil, "user")
+	phone.SessionID = "phone"
+	other := websocket.NewClient(nil, "other")
+	other.SessionID = "other"
+	for _, client := range []*websocket.Client{current, phone, other} {
+		hub.Register <- client
+	}
+	hub.Broadcast <- websocket.ChatMessage{ChatID: "sync"}
+
+	hub.DisconnectOtherSessions("user", "current")
+	_, open := <-phone.SendChan
+	assert.False(t, open, "connections of the other sessions should be closed")
+	assert.True(t, hub.Clients[current])
+	assert.True(t, hub.Clients[other])
+}
+
+// dial connects a websocket client for userID to a test server running HandleWebSocket
+func dial(t *testing.T, hub *websocket.Hub, userID primitive.ObjectID) *gorilla.Conn {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/ws", func(c *gin.Context) {
+		websocket.HandleWebSocket(c, hub, userID.Hex(), "")
+	})
+	server := httptest.NewServer(r)
+	t.Cleanup(server.Close)
+
+	conn, _, err := gorilla.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws", nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func readEnvelope(t *testing.T, conn *gorilla.Conn) websocket.Envelope {
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	var envelope websocket.Envelope
+	if err := conn.ReadJSON(&envelope); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	return envelope
+}
+
+func TestWebSocketMultiChatSubscriptions(t *testing.T) {
+	mockChatUsecase := new(mocks.MockChatUsecase)
+	hub := websocket.NewHub(mockChatUsecase, nil, nil)
+	go hub.Run()
+	defer hub.Stop(context.Background())
+
+	userID := primitive.NewObjectID()
+	firstChat := primitive.NewObjectID()
+	secondChat := primitive.NewObjectID()
+	laterChat := primitive.NewObjectID()
+	foreignChat := primitive.NewObjectID()
+
+	// The connection follows every chat of the user from the start
+	mockChatUsecase.On("GetChatsByUserID", mock.Anything, userID).
+		Return([]domain.Chat{{ChatID: firstChat}, {ChatID: secondChat}}, nil)
+	mockChatUsecase.On("AuthorizeParticipant", mock.Anything, userID, laterChat).Return(nil)
+	mockChatUsecase.On("AuthorizeParticipant", mock.Anything, userID, foreignChat).Return(domain.ErrForbidden)
+
+	conn := dial(t, hub, userID)
+
+	// Chats can be followed later on, once authorized
+	assert.NoError(t, conn.WriteJSON(websocket.Envelope{Type: websocket.CommandSubscribe, ChatID: laterChat.Hex()}))
+	envelope := readEnvelope(t, conn)
+	assert.Equal(t, websocket.EventAck, envelope.Type)
+	assert.Equal(t, laterChat.Hex(), envelope.ChatID)
+
+	assert.NoError(t, conn.WriteJSON(websocket.Envelope{Type: websocket.CommandSubscribe, ChatID: foreignChat.Hex()}))
+	envelope = readEnvelope(t, conn)
+	assert.Equal(t, websocket.EventError, envelope.Type)
+	assert.Equal(t, foreignChat.Hex(), envelope.ChatID)
+
+	// Every followed chat is delivered over the single connection
+	for _, chatID := range []primitive.ObjectID{firstChat, secondChat, laterChat} {
+		hub.BroadcastToChat(chatID.Hex(), websocket.EventMessageCreated, nil)
+		assert.Equal(t, chatID.Hex(), readEnvelope(t, conn).ChatID)
+	}
+
+	// After unsubscribing, posting to the chat is refused
+	assert.NoError(t, conn.WriteJSON(websocket.Envelope{Type: websocket.CommandUnsubscribe, ChatID: firstChat.Hex()}))
+	assert.Equal(t, websocket.EventAck, readEnvelope(t, conn).Type)
+
+	assert.NoError(t, conn.WriteJSON(websocket.Envelope{Type: websocket.CommandSendMessage, ChatID: firstChat.Hex(), Payload: []byte(`{"content":"hi"}`)}))
+	assert.Equal(t, websocket.EventError, readEnvelope(t, conn).Type)
+
+	mockChatUsecase.AssertExpectations(t)
+}
+
+func TestWebSocketPersistsMessages(t *testing.T) {
+	mockChatUsecase := new(mocks.MockChatUsecase)
+	mockMessageUsecase := new(mocks.MockMessageUsecase)
+	hub := websocket.NewHub(mockChatUsecase, mockMessageUsecase, nil)
+	go hub.Run()
+	defer hub.Stop(context.Background())
+
+	userID := primitive.NewObjectID()
+	chatID := primitive.NewObjectID()
+	storedID := primitive.NewObjectID()
+	mockChatUsecase.On("GetChatsByUserID", mock.Anything, userID).Return([]domain.Chat{{ChatID: chatID}}, nil)
+
+	// The sender is the authenticated user, whatever the command claims
+	mockMessageUsecase.On("SendMessage", mock.Anything, chatID, mock.MatchedBy(func(m *domain.Message) bool {
+		return m.SenderID == userID && m.Content == "hello"
+	})).Return(nil).Run(func(args mock.Arguments) {
+		message := args.Get(2).(*domain.Message)
+		message.MessageID = storedID
+		message.ChatID = chatID
+		message.Time = time.Now()
+	})
+	mockMessageUsecase.On("SendMessage", mock.Anything, chatID, mock.MatchedBy(func(m *domain.Message) bool {
+		return m.Content == "fails"
+	})).Return(errors.New("database error"))
+
+	conn := dial(t, hub, userID)
+
+	spoofed := `{"content":"hello","sender_id":"` + primitive.NewObjectID().Hex() + `"}`
+	assert.NoError(t, conn.WriteJSON(websocket.Envelope{V: websocket.ProtocolVersion, Type: websocket.CommandSendMessage, ID: "client-1", ChatID: chatID.Hex(), Payload: []byte(spoofed)}))
+
+	// The command is acknowledged under its own ID, then the message is broadcast
+	envelope := readEnvelope(t, conn)
+	assert.Equal(t, websocket.EventAck, envelope.Type)
+	assert.Equal(t, "client-1", envelope.ID)
+
+	envelope = readEnvelope(t, conn)
+	assert.Equal(t, websocket.EventMessageCreated, envelope.Type)
+	assert.Equal(t, websocket.ProtocolVersion, envelope.V)
+	assert.NotEmpty(t, envelope.ID)
+	var message domain.Message
+	assert.NoError(t, json.Unmarshal(envelope.Payload, &message))
+	assert.Equal(t, storedID, message.MessageID)
+	assert.Equal(t, userID, message.SenderID)
+
+	// A failed write is reported to the sender and never broadcast
+	assert.NoError(t, conn.WriteJSON(websocket.Envelope{Type: websocket.CommandSendMessage, ChatID: chatID.Hex(), Payload: []byte(`{"content":"fails"}`)}))
+	envelope = readEnvelope(t, conn)
+	assert.Equal(t, websocket.EventError, envelope.Type)
+	assert.Contains(t, string(envelope.Payload), "failed to send message")
+
+	mockMessageUsecase.AssertExpectations(t)
+}
+
+func TestWebSocketRejectsUnknownVersion(t *testing.T) {
+	mockChatUsecase := new(mocks.MockChatUsecase)
+	hub := websocket.NewHub(mockChatUsecase, nil, nil)
+	go hub.Run()
+	defer hub.Stop(context.Background())
+
+	userID := primitive.NewObjectID()
+	mockChatUsecase.On("GetChatsByUserID", mock.Anything, userID).Return([]domain.Chat{}, nil)
+
+	conn := dial(t, hub, userID)
+
+	assert.NoError(t, conn.WriteJSON(websocket.Envelope{V: websocket.ProtocolVersion + 1, Type: websocket.CommandSubscribe, ID: "client-1"}))
+	envelope := readEnvelope(t, conn)
+	assert.Equal(t, websocket.EventError, envelope.Type)
+	assert.Equal(t, "client-1", envelope.ID)
+
+	assert.NoError(t, conn.WriteMessage(gorilla.TextMessage, []byte("not json")))
+	assert.Equal(t, websocket.EventError, readEnvelope(t, conn).Type)
+}
+
+func TestWebSocketTypingIndicators(t *testing.T) {
+	mockChatUsecase := new(mocks.MockChatUsecase)
+	hub := websocket.NewHub(mockChatUsecase, nil, nil)
+	hub.TypingTimeout = 200 * time.Millisecond
+	go hub.Run()
+	defer hub.Stop(context.Background())
+
+	typist := primitive.NewObjectID()
+	reader := primitive.NewObjectID()
+	chatID := primitive.NewObjectID()
+	mockChatUsecase.On("GetChatsByUserID", mock.Anything, mock.Anything).Return([]domain.Chat{{ChatID: chatID}}, nil)
+
+	// Make sure both connections are registered before typing
+	typistConn := dial(t, hub, typist)
+	assert.NoError(t, typistConn.WriteJSON(websocket.Envelope{Type: websocket.CommandUnsubscribe, ChatID: "none"}))
+	assert.Equal(t, websocket.EventAck, readEnvelope(t, typistConn).Type)
+	readerConn := dial(t, hub, reader)
+	assert.NoError(t, readerConn.WriteJSON(websocket.Envelope{Type: websocket.CommandUnsubscribe, ChatID: "none"}))
+	assert.Equal(t, websocket.EventAck, readEnvelope(t, readerConn).Type)
+	assert.Equal(t, websocket.EventPresence, readEnvelope(t, typistConn).Type)
+
+	typing := func(envelope websocket.Envelope) websocket.TypingPayload {
+		assert.Equal(t, websocket.EventTyping, envelope.Type)
+		assert.Equal(t, chatID.Hex(), envelope.ChatID)
+		var payload websocket.TypingPayload
+		assert.NoError(t, json.Unmarshal(envelope.Payload, &payload))
+		assert.Equal(t, typist.Hex(), payload.UserID)
+		return payload
+	}
+
+	// Starting and stopping are relayed to the other participant
+	assert.NoError(t, typistConn.WriteJSON(websocket.Envelope{Type: websocket.CommandTypingStart, ChatID: chatID.Hex()}))
+	assert.True(t, typing(readEnvelope(t, readerConn)).Typing)
+	assert.NoError(t, typistConn.WriteJSON(websocket.Envelope{Type: websocket.CommandTypingStop, ChatID: chatID.Hex()}))
+	assert.False(t, typing(readEnvelope(t, readerConn)).Typing)
+
+	// An indicator that is not refreshed expires on its own
+	assert.NoError(t, typistConn.WriteJSON(websocket.Envelope{Type: websocket.CommandTypingStart, ChatID: chatID.Hex()}))
+	assert.True(t, typing(readEnvelope(t, readerConn)).Typing)
+	started := time.Now()
+	assert.False(t, typing(readEnvelope(t, readerConn)).Typing)
+	assert.GreaterOrEqual(t, time.Since(started), 100*time.Millisecond)
+
+	// The typist never hears about their own typing, only about the next command's answer
+	assert.NoError(t, typistConn.WriteJSON(websocket.Envelope{Type: websocket.CommandUnsubscribe, ChatID: "none", ID: "sync"}))
+	assert.Equal(t, "sync", readEnvelope(t, typistConn).ID)
+}
+
+func TestWebSocketTypingRateLimit(t *testing.T) {
+	mockChatUsecase := new(mocks.MockChatUsecase)
+	hub := websocket.NewHub(mockChatUsecase, nil, nil)
+	go hub.Run()
+	defer hub.Stop(context.Background())
+
+	userID := primitive.NewObjectID()
+	chatID := primitive.NewObjectID()
+	mockChatUsecase.On("GetChatsByUserID", mock.Anything, userID).Return([]domain.Chat{{ChatID: chatID}}, nil)
+
+	conn := dial(t, hub, userID)
+
+	// Flood the hub, then check a single error came back before the next ack
+	for i := 0; i < 20; i++ {
+		assert.NoError(t, conn.WriteJSON(websocket.Envelope{Type: websocket.CommandTypingStart, ChatID: chatID.Hex(), ID: "typing"}))
+	}
+	assert.NoError(t, conn.WriteJSON(websocket.Envelope{Type: websocket.CommandUnsubscribe, ChatID: "none", ID: "sync"}))
+
+	envelope := readEnvelope(t, conn)
+	assert.Equal(t, websocket.EventError, envelope.Type)
+	assert.Equal(t, "typing", envelope.ID)
+	assert.Equal(t, "sync", readEnvelope(t, conn).ID)
+}
+
+func TestWebSocketMarkRead(t *testing.T) {
+	mockChatUsecase := new(mocks.MockChatUsecase)
+	hub := websocket.NewHub(mockChatUsecase, nil, nil)
+	go hub.Run()
+	defer hub.Stop(context.Background())
+
+	userID := primitive.NewObjectID()
+	chatID := primitive.NewObjectID()
+	messageID := primitive.NewObjectID()
+	marker := domain.ReadMarker{MessageID: messageID, MessageTime: time.Now(), ReadAt: time.Now()}
+	mockChatUsecase.On("GetChatsByUserID", mock.Anything, userID).Return([]domain.Chat{{ChatID: chatID}}, nil)
+	mockChatUsecase.On("MarkRead", mock.Anything, userID, chatID, messageID).Return(marker, true, nil)
+
+	conn := dial(t, hub, userID)
+
+	payload := []byte(`{"message_id":"` + messageID.Hex() + `"}`)
+	assert.NoError(t, conn.WriteJSON(websocket.Envelope{Type: websocket.CommandMarkRead, ID: "read-1", ChatID: chatID.Hex(), Payload: payload}))
+
+	envelope := readEnvelope(t, conn)
+	assert.Equal(t, websocket.EventAck, envelope.Type)
+	assert.Equal(t, "read-1", envelope.ID)
+
+	// The receipt reaches every device following the chat
+	envelope = readEnvelope(t, conn)
+	assert.Equal(t, websocket.EventReceipt, envelope.Type)
+	var receipt websocket.ReceiptPayload
+	assert.NoError(t, json.Unmarshal(envelope.Payload, &receipt))
+	assert.Equal(t, messageID.Hex(), receipt.MessageID)
+	mockChatUsecase.AssertExpectations(t)
+}
+
+func TestWebSocketPresence(t *testing.T) {
+	mockChatUsecase := new(mocks.MockChatUsecase)
+	mockUserUsecase := new(mocks.MockUserUsecase)
+	hub := websocket.NewHub(mockChatUsecase, nil, mockUserUsecase)
+	go hub.Run()
+	defer hub.Stop(context.Background())
+
+	watcher := primitive.NewObjectID()
+	user := primitive.NewObjectID()
+	chatID := primitive.NewObjectID()
+	mockChatUsecase.On("GetChatsByUserID", mock.Anything, mock.Anything).Return([]domain.Chat{{ChatID: chatID}}, nil)
+	mockUserUsecase.On("UpdateLastSeen", mock.Anything, user, mock.Anything).Return(nil).Once()
+	mockUserUsecase.On("UpdateLastSeen", mock.Anything, watcher, mock.Anything).Return(nil).Once()
+
+	sync := func(conn *gorilla.Conn) {
+		assert.NoError(t, conn.WriteJSON(websocket.Envelope{Type: websocket.CommandUnsubscribe, ChatID: "none", ID: "sync"}))
+		assert.Equal(t, "sync", readEnvelope(t, conn).ID)
+	}
+	presence := func(envelope websocket.Envelope) websocket.PresencePayload {
+		assert.Equal(t, websocket.EventPresence, envelope.Type)
+		var payload websocket.PresencePayload
+		assert.NoError(t, json.Unmarshal(envelope.Payload, &payload))
+		assert.Equal(t, user.Hex(), payload.UserID)
+		return payload
+	}
+
+	watcherConn := dial(t, hub, watcher)
+	sync(watcherConn)
+
+	// The first connection of a user brings them online; a second device changes nothing
+	phone := dial(t, hub, user)
+	sync(phone)
+	assert.Equal(t, domain.PresenceOnline, presence(readEnvelope(t, watcherConn)).Status)
+	laptop := dial(t, hub, user)
+	sync(laptop)
+	assert.Equal(t, domain.PresenceOnline, hub.Status(user.Hex()))
+
+	// The user is away once every device is idle
+	assert.NoError(t, phone.WriteJSON(websocket.Envelope{Type: websocket.CommandSetPresence, Payload: []byte(`{"status":"away"}`)}))
+	assert.Equal(t, websocket.EventAck, readEnvelope(t, phone).Type)
+	assert.NoError(t, laptop.WriteJSON(websocket.Envelope{Type: websocket.CommandSetPresence, Payload: []byte(`{"status":"away"}`)}))
+	assert.Equal(t, websocket.EventAck, readEnvelope(t, laptop).Type)
+	assert.Equal(t, domain.PresenceAway, presence(readEnvelope(t, watcherConn)).Status)
+
+	assert.NoError(t, phone.WriteJSON(websocket.Envelope{Type: websocket.CommandSetPresence, Payload: []byte(`{"status":"busy"}`)}))
+	assert.Equal(t, websocket.EventError, readEnvelope(t, phone).Type)
+
+	// Closing the last device takes the user offline and records when they were last seen
+	phone.Close()
+	laptop.Close()
+	offline := presence(readEnvelope(t, watcherConn))
+	assert.Equal(t, domain.PresenceOffline, offline.Status)
+	assert.NotNil(t, offline.LastSeen)
+
+	assert.NoError(t, hub.Stop(context.Background()))
+	mockUserUsecase.AssertExpectations(t)
+}
+
+func TestHubPresence(t *testing.T) {
+	mockUserUsecase := new(mocks.MockUserUsecase)
+	hub := websocket.NewHub(nil, nil, mockUserUsecase)
+	go hub.Run()
+	defer hub.Stop(context.Background())
+
+	online := primitive.NewObjectID()
+	offline := primitive.NewObjectID()
+	lastSeen := time.Now().Add(-time.Hour)
+	mockUserUsecase.On("GetUsersByIDs", mock.Anything, []primitive.ObjectID{online, offline}).
+		Return([]domain.User{{UserID: online, LastSeen: &lastSeen}, {UserID: offline, LastSeen: &lastSeen}}, nil)
+	mockUserUsecase.On("UpdateLastSeen", mock.Anything, online, mock.Anything).Return(nil)
+
+	hub.Register <- websocket.NewClient(nil, online.Hex())
+	hub.Broadcast <- websocket.ChatMessage{} // wait for the registration
+
+	presence, err := hub.Presence(context.Background(), []primitive.ObjectID{online, offline})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []domain.Presence{
+		{UserID: online, Status: domain.PresenceOnline},
+		{UserID: offline, Status: domain.PresenceOffline, LastSeen: &lastSeen},
+	}, presence)
+}
+
+func TestWebSocketHeartbeat(t *testing.T) {
+	mockChatUsecase := new(mocks.MockChatUsecase)
+	hub := websocket.NewHub(mockChatUsecase, nil, nil)
+	hub.PingInterval = 50 * time.Millisecond
+	hub.PongWait = 150 * time.Millisecond
+	go hub.Run()
+	defer hub.Stop(context.Background())
+
+	alive := primitive.NewObjectID()
+	silent := primitive.NewObjectID()
+	mockChatUsecase.On("GetChatsByUserID", mock.Anything, mock.Anything).Return([]domain.Chat{}, nil)
+
+	// Reading lets the client answer pings with pongs, which keeps the connection open
+	aliveConn := dial(t, hub, alive)
+	pinged := make(chan struct{}, 1)
+	aliveConn.SetPingHandler(func(data string) error {
+		select {
+		case pinged <- struct{}{}:
+		default:
+		}
+		return aliveConn.WriteControl(gorilla.PongMessage, []byte(data), time.Now().Add(time.Second))
+	})
+	go func() {
+		for {
+			if _, _, err := aliveConn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	// A client that never reads never answers, like a half-open connection
+	dial(t, hub, silent)
+
+	select {
+	case <-pinged:
+	case <-time.After(time.Second):
+		t.Fatal("the server never pinged")
+	}
+
+	assert.Eventually(t, func() bool {
+		return hub.Status(silent.Hex()) == domain.PresenceOffline
+	}, 2*time.Second, 10*time.Millisecond, "silent connections are dropped")
+	time.Sleep(3 * hub.PongWait)
+	assert.Equal(t, domain.PresenceOnline, hub.Status(alive.Hex()))
+}
+
+func TestWebSocketMaxMessageSize(t *testing.T) {
+	mockChatUsecase := new(mocks.MockChatUsecase)
+	hub := websocket.NewHub(mockChatUsecase, nil, nil)
+	hub.MaxMessageSize = 128
+	go hub.Run()
+	defer hub.Stop(context.Background())
+
+	userID := primitive.NewObjectID()
+	mockChatUsecase.On("GetChatsByUserID", mock.Anything, userID).Return([]domain.Chat{}, nil)
+
+	conn := dial(t, hub, userID)
+	assert.NoError(t, conn.WriteMessage(gorilla.TextMessage, []byte(strings.Repeat("x", 256))))
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, _, err := conn.ReadMessage()
+	assert.True(t, gorilla.IsCloseError(err, gorilla.CloseMessageTooBig), "unexpected error: %v", err)
+	assert.Eventually(t, func() bool {
+		return hub.Status(userID.Hex()) == domain.PresenceOffline
+	}, time.Second, 10*time.Millisecond)
+}
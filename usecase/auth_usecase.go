@@ -0,0 +1,175 @@
+package usecase
+
+import (
+	"Real-Time-Chat-Application/domain"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type AuthUsecase struct {
+	userRepository      domain.UserRepository
+	userTokenRepository domain.UserTokenRepository
+	sessionRepository   domain.SessionRepository
+	tokenService        domain.TokenService
+	passwordHasher      domain.PasswordHasher
+	totp                domain.TOTP
+	mailer              domain.Mailer
+	contextTimeout      time.Duration
+}
+
+func NewAuthUsecase(userRepository domain.UserRepository, userTokenRepository domain.UserTokenRepository, sessionRepository domain.SessionRepository, tokenService domain.TokenService, passwordHasher domain.PasswordHasher, totp domain.TOTP, mailer domain.Mailer, contextTimeout time.Duration) domain.AuthUsecase {
+	return &AuthUsecase{
+		userRepository:      userRepository,
+		userTokenRepository: userTokenRepository,
+		sessionRepository:   sessionRepository,
+		tokenService:        tokenService,
+		passwordHasher:      passwordHasher,
+		totp:                totp,
+		mailer:              mailer,
+		contextTimeout:      contextTimeout,
+	}
+}
+
+// Login checks the email and password against the stored hash and starts a session for the device.
+// Users with two-factor authentication get a challenge for LoginTwoFactor instead.
+func (authUsecase *AuthUsecase) Login(ctx context.Context, email string, password string, device domain.DeviceInfo) (*domain.LoginResult, error) {
+	if err := validateDevice(device); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, authUsecase.contextTimeout)
+	defer cancel()
+
+	user, err := authUsecase.userRepository.GetUserByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, domain.ErrUserNotFound) {
+			return nil, domain.ErrInvalidCredentials
+		}
+		return nil, err
+	}
+
+	if !authUsecase.passwordHasher.Compare(user.Password, password) {
+		return nil, domain.ErrInvalidCredentials
+	}
+
+	// The password is only known here, so this is the moment to upgrade an old hash. Failing to
+	// does not stop the login; the next one tries again.
+	if authUsecase.passwordHasher.NeedsRehash(user.Password) {
+		if hash, err := authUsecase.passwordHasher.Hash(password); err == nil {
+			authUsecase.userRepository.UpdateUser(ctx, user.UserID, &domain.User{Password: hash})
+		}
+	}
+
+	if user.TwoFactorEnabled() {
+		challenge, err := issueUserToken(ctx, authUsecase.userTokenRepository, user.UserID, domain.TokenTwoFactorLogin, domain.TwoFactorChallengeTTL)
+		if err != nil {
+			return nil, err
+		}
+		return &domain.LoginResult{Challenge: challenge}, nil
+	}
+
+	tokens, err := authUsecase.startSession(ctx, user.UserID, device)
+	if err != nil {
+		return nil, err
+	}
+	return &domain.LoginResult{Tokens: tokens}, nil
+}
+
+// RefreshToken exchanges a valid refresh token for a new token pair, as long as the user and
+// the session still exist
+func (authUsecase *AuthUsecase) RefreshToken(ctx context.Context, refreshToken string, device domain.DeviceInfo) (*domain.TokenPair, error) {
+	ctx, cancel := context.WithTimeout(ctx, authUsecase.contextTimeout)
+	defer cancel()
+
+	claims, err := authUsecase.tokenService.ValidateToken(refreshToken, domain.RefreshToken)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := authUsecase.userRepository.GetUserByID(ctx, claims.UserID); err != nil {
+		if errors.Is(err, domain.ErrUserNotFound) {
+			return nil, domain.ErrInvalidToken
+		}
+		return nil, err
+	}
+
+	return authUsecase.rotateSession(ctx, claims, refreshToken, device)
+}
+
+func (authUsecase *AuthUsecase) RequestPasswordReset(ctx context.Context, email string) error {
+	ctx, cancel := context.WithTimeout(ctx, authUsecase.contextTimeout)
+	defer cancel()
+
+	user, err := authUsecase.userRepository.GetUserByEmail(ctx, email)
+	if errors.Is(err, domain.ErrUserNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// Quietly drop requests within the cooldown, so the endpoint cannot be used to flood an
+	// inbox and still does not reveal which emails have accounts
+	sentAt, err := authUsecase.userTokenRepository.LatestTokenTime(ctx, user.UserID, domain.TokenPasswordReset)
+	if err != nil {
+		return err
+	}
+	if time.Since(sentAt) < domain.PasswordResetCooldown {
+		return nil
+	}
+
+	token, err := issueUserToken(ctx, authUsecase.userTokenRepository, user.UserID, domain.TokenPasswordReset, domain.PasswordResetTTL)
+	if err != nil {
+		return err
+	}
+
+	return authUsecase.mailer.Send(ctx, domain.Mail{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hi %s,\n\nUse this token to choose a new password:\n\n%s\n\n"+
+			"It expires in %d minutes. If you did not ask to reset your password, ignore this mail.\n",
+			user.Username, token, int(domain.PasswordResetTTL.Minutes())),
+	})
+}
+
+// ResetPassword checks the new password before using up the token, so a rejected password can be retried
+func (authUsecase *AuthUsecase) ResetPassword(ctx context.Context, token, newPassword string) (primitive.ObjectID, error) {
+	errs := &domain.ValidationError{}
+	if token == "" {
+		errs.Add("token", "is required")
+	}
+	checkPassword(errs, "new_password", newPassword)
+	if err := errs.Err(); err != nil {
+		return primitive.NilObjectID, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, authUsecase.contextTimeout)
+	defer cancel()
+
+	record, err := authUsecase.userTokenRepository.ConsumeToken(ctx, domain.TokenPasswordReset, hashUserToken(token), time.Now())
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+
+	hash, err := authUsecase.passwordHasher.Hash(newPassword)
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+	if err := authUsecase.userRepository.UpdateUser(ctx, record.UserID, &domain.User{Password: hash}); err != nil {
+		return primitive.NilObjectID, err
+	}
+
+	// A reset is how users take back a stolen account, so whoever had it is signed out
+	if err := authUsecase.sessionRepository.DeleteSessions(ctx, record.UserID); err != nil {
+		return primitive.NilObjectID, err
+	}
+	// Other reset mails still in flight should not work once the password was reset
+	if err := authUsecase.userTokenRepository.DeleteTokens(ctx, record.UserID, domain.TokenPasswordReset); err != nil {
+		return primitive.NilObjectID, err
+	}
+	return record.UserID, nil
+}
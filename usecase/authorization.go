@@ -0,0 +1,23 @@
+package usecase
+
+import (
+	"Real-Time-Chat-Application/domain"
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// authorizeParticipant loads the chat and returns domain.ErrForbidden unless userID is one of its participants
+func authorizeParticipant(ctx context.Context, chatRepository domain.ChatRepository, userID, chatID primitive.ObjectID) (*domain.Chat, error) {
+	chat, err := chatRepository.GetChat(ctx, chatID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !chat.HasParticipant(userID) {
+		return nil, fmt.Errorf("user is not a participant of this chat: %w", domain.ErrForbidden)
+	}
+
+	return chat, nil
+}
@@ -3,39 +3,70 @@ package usecase
 import (
 	"Real-Time-Chat-Application/domain"
 	"context"
+	"errors"
+	"fmt"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type ChatUsecase struct {
-	chatRepository domain.ChatRepository
-	contextTimeout time.Duration
+	chatRepository    domain.ChatRepository
+	messageRepository domain.MessageRepository
+	userRepository    domain.UserRepository
+	contextTimeout    time.Duration
 }
 
-func NewChatUsecase(chatRepository domain.ChatRepository, timeout time.Duration) domain.ChatUsecase {
+func NewChatUsecase(chatRepository domain.ChatRepository, messageRepository domain.MessageRepository, userRepository domain.UserRepository, timeout time.Duration) domain.ChatUsecase {
 	return &ChatUsecase{
-		chatRepository: chatRepository,
-		contextTimeout: timeout,
+		chatRepository:    chatRepository,
+		messageRepository: messageRepository,
+		userRepository:    userRepository,
+		contextTimeout:    timeout,
 	}
 }
 
-func (chatusecase *ChatUsecase) CreateChat(ctx context.Context, SenderID primitive.ObjectID, ReceiverID primitive.ObjectID) (primitive.ObjectID, error) {
+// CreateChat looks the chat up before creating it. Requests racing past the lookup are
+// stopped by the repository, and then find the chat the winner created. Only a sender with a
+// verified email can create a chat, but anyone can get back one that exists.
+func (chatusecase *ChatUsecase) CreateChat(ctx context.Context, SenderID primitive.ObjectID, ReceiverID primitive.ObjectID) (primitive.ObjectID, bool, error) {
+	if err := validateParticipants(SenderID, ReceiverID); err != nil {
+		return primitive.NilObjectID, false, err
+	}
+
 	ctx, cancel := context.WithTimeout(ctx, chatusecase.contextTimeout)
 	defer cancel()
 
+	existing, err := chatusecase.chatRepository.GetChatByParticipants(ctx, SenderID, ReceiverID)
+	if err == nil {
+		return existing.ChatID, false, nil
+	}
+	if !errors.Is(err, domain.ErrChatNotFound) {
+		return primitive.NilObjectID, false, err
+	}
+	if err := chatusecase.requireVerified(ctx, SenderID); err != nil {
+		return primitive.NilObjectID, false, err
+	}
+
 	chatID, err := chatusecase.chatRepository.CreateChat(ctx, SenderID, ReceiverID)
+	if errors.Is(err, domain.ErrChatExists) {
+		existing, err := chatusecase.chatRepository.GetChatByParticipants(ctx, SenderID, ReceiverID)
+		if err != nil {
+			return primitive.NilObjectID, false, err
+		}
+		return existing.ChatID, false, nil
+	}
 	if err != nil {
-		return primitive.NilObjectID, err
+		return primitive.NilObjectID, false, err
 	}
-	return chatID, nil
+	return chatID, true, nil
 }
 
-func (chatusecase *ChatUsecase) GetChat(ctx context.Context, chatID primitive.ObjectID) (*domain.Chat, error) {
+func (chatusecase *ChatUsecase) GetChat(ctx context.Context, userID, chatID primitive.ObjectID) (*domain.Chat, error) {
 	ctx, cancel := context.WithTimeout(ctx, chatusecase.contextTimeout)
 	defer cancel()
 
-	chat, err := chatusecase.chatRepository.GetChat(ctx, chatID)
+	chat, err := authorizeParticipant(ctx, chatusecase.chatRepository, userID, chatID)
 	if err != nil {
 		return nil, err
 	}
@@ -53,26 +84,51 @@ func (chatusecase *ChatUsecase) GetChatsByUserID(ctx context.Context, userID pri
 	return chats, nil
 }
 
-func (chatusecase *ChatUsecase) UpdateChat(ctx context.Context, chatID primitive.ObjectID, chat *domain.Chat) error {
+// UpdateChat applies the settings to a group; its members and roles are left alone
+func (chatusecase *ChatUsecase) UpdateChat(ctx context.Context, userID, chatID primitive.ObjectID, settings domain.ChatSettings) (*domain.Chat, error) {
+	if err := validateChatSettings(settings); err != nil {
+		return nil, err
+	}
+
 	ctx, cancel := context.WithTimeout(ctx, chatusecase.contextTimeout)
 	defer cancel()
 
-	err := chatusecase.chatRepository.UpdateChat(ctx, chatID, chat)
+	stored, err := authorizeGroupMember(ctx, chatusecase.chatRepository, userID, chatID)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	return nil
+	if !stored.CanManage(userID) {
+		return nil, fmt.Errorf("only admins can change this group: %w", domain.ErrForbidden)
+	}
+
+	err = chatusecase.chatRepository.UpdateChatSettings(ctx, chatID, settings)
+	if err != nil {
+		return nil, err
+	}
+	return chatusecase.chatRepository.GetChat(ctx, chatID)
 }
 
-func (chatusecase *ChatUsecase) DeleteChat(ctx context.Context, chatID primitive.ObjectID) error {
+func (chatusecase *ChatUsecase) DeleteChat(ctx context.Context, userID, chatID primitive.ObjectID) error {
 	ctx, cancel := context.WithTimeout(ctx, chatusecase.contextTimeout)
 	defer cancel()
 
-	err := chatusecase.chatRepository.DeleteChat(ctx, chatID)
+	chat, err := authorizeParticipant(ctx, chatusecase.chatRepository, userID, chatID)
 	if err != nil {
 		return err
 	}
-	return nil
+
+	// Either participant may delete a direct chat, but a group belongs to its owner
+	if chat.IsGroup() && !chat.IsOwner(userID) {
+		return fmt.Errorf("only the owner can delete this group: %w", domain.ErrForbidden)
+	}
+
+	err = chatusecase.chatRepository.DeleteChat(ctx, chatID)
+	if err != nil {
+		return err
+	}
+
+	// The history lives in its own collection and goes with the chat
+	return chatusecase.messageRepository.DeleteMessagesByChat(ctx, chatID)
 }
 
 func (chatusecase *ChatUsecase) GetChatByParticipants(ctx context.Context, SenderID primitive.ObjectID, ReceiverID primitive.ObjectID) (*domain.Chat, error) {
@@ -86,8 +142,321 @@ func (chatusecase *ChatUsecase) GetChatByParticipants(ctx context.Context, Sende
 	return chat, nil
 }
 
+// AuthorizeParticipant returns domain.ErrForbidden unless userID is a participant of the chat
+func (chatusecase *ChatUsecase) AuthorizeParticipant(ctx context.Context, userID, chatID primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(ctx, chatusecase.contextTimeout)
+	defer cancel()
+
+	_, err := authorizeParticipant(ctx, chatusecase.chatRepository, userID, chatID)
+	return err
+}
+
+func (chatusecase *ChatUsecase) MarkRead(ctx context.Context, userID, chatID, messageID primitive.ObjectID) (domain.ReadMarker, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, chatusecase.contextTimeout)
+	defer cancel()
+
+	if _, err := authorizeParticipant(ctx, chatusecase.chatRepository, userID, chatID); err != nil {
+		return domain.ReadMarker{}, false, err
+	}
+
+	// The message must belong to the chat
+	message, err := chatusecase.messageRepository.GetMessage(ctx, chatID, messageID)
+	if err != nil {
+		return domain.ReadMarker{}, false, err
+	}
+
+	marker := domain.ReadMarker{
+		MessageID:   message.MessageID,
+		MessageTime: message.Time,
+		ReadAt:      time.Now(),
+	}
+
+	advanced, err := chatusecase.chatRepository.UpdateReadMarker(ctx, chatID, userID, marker)
+	if err != nil {
+		return domain.ReadMarker{}, false, err
+	}
+	return marker, advanced, nil
+}
+
+// ListChats builds the chat list from the chat documents and one unread count query, without
+// reading any history. Unread messages are the ones others sent after the user's read marker.
+func (chatusecase *ChatUsecase) ListChats(ctx context.Context, userID primitive.ObjectID) ([]domain.ChatSummary, error) {
+	ctx, cancel := context.WithTimeout(ctx, chatusecase.contextTimeout)
+	defer cancel()
+
+	chats, err := chatusecase.chatRepository.GetRecentChats(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	since := make(map[primitive.ObjectID]*domain.MessageCursor, len(chats))
+	for _, chat := range chats {
+		since[chat.ChatID] = nil
+		if marker, ok := chat.ReadMarkers[userID.Hex()]; ok {
+			since[chat.ChatID] = &domain.MessageCursor{Time: marker.MessageTime, MessageID: marker.MessageID}
+		}
+	}
+
+	unread, err := chatusecase.messageRepository.CountUnread(ctx, userID, since)
+	if err != nil {
+		return nil, err
+	}
+
+	summaries := make([]domain.ChatSummary, 0, len(chats))
+	for _, chat := range chats {
+		others := []primitive.ObjectID{}
+		for _, participant := range chat.Participants {
+			if participant != userID {
+				others = append(others, participant)
+			}
+		}
+
+		chatType := chat.Type
+		if chatType == "" {
+			chatType = domain.ChatTypeDirect
+		}
+
+		summaries = append(summaries, domain.ChatSummary{
+			ChatID:       chat.ChatID,
+			Type:         chatType,
+			Title:        chat.Title,
+			Avatar:       chat.Avatar,
+			Participants: others,
+			LastMessage:  chat.LastMessage,
+			LastActivity: chat.UpdatedAt,
+			UnreadCount:  unread[chat.ChatID],
+		})
+	}
+	return summaries, nil
+}
+
+// CreateGroupChat creates a group of the creator and the given members, ignoring duplicates,
+// and records its creation as the first message of the group
+func (chatusecase *ChatUsecase) CreateGroupChat(ctx context.Context, creatorID primitive.ObjectID, memberIDs []primitive.ObjectID, title, avatar string) (*domain.Chat, *domain.Message, error) {
+	members := newMembers(&domain.Chat{Participants: []primitive.ObjectID{creatorID}}, memberIDs)
+	if err := validateNewGroup(len(members), title, avatar); err != nil {
+		return nil, nil, err
+	}
 
+	ctx, cancel := context.WithTimeout(ctx, chatusecase.contextTimeout)
+	defer cancel()
 
+	if err := chatusecase.requireVerified(ctx, creatorID); err != nil {
+		return nil, nil, err
+	}
 
+	chat := &domain.Chat{
+		Participants: append([]primitive.ObjectID{creatorID}, members...),
+		Title:        title,
+		Avatar:       avatar,
+		CreatedBy:    creatorID,
+		Roles:        map[string]string{creatorID.Hex(): domain.RoleOwner},
+	}
+	if _, err := chatusecase.chatRepository.CreateGroupChat(ctx, chat); err != nil {
+		return nil, nil, err
+	}
 
+	message, err := chatusecase.recordSystemMessage(ctx, chat.ChatID, creatorID, domain.SystemChatCreated, members, "created the group")
+	if err != nil {
+		return nil, nil, err
+	}
+	return chat, message, nil
+}
+
+// AddMembers lets the managers of a group add users to it, as plain members
+func (chatusecase *ChatUsecase) AddMembers(ctx context.Context, userID, chatID primitive.ObjectID, memberIDs []primitive.ObjectID) (*domain.Message, error) {
+	ctx, cancel := context.WithTimeout(ctx, chatusecase.contextTimeout)
+	defer cancel()
+
+	chat, err := authorizeGroupMember(ctx, chatusecase.chatRepository, userID, chatID)
+	if err != nil {
+		return nil, err
+	}
+	if !chat.CanManage(userID) {
+		return nil, fmt.Errorf("only admins can add members: %w", domain.ErrForbidden)
+	}
+
+	members := newMembers(chat, memberIDs)
+	if len(members) == 0 {
+		return nil, nil
+	}
+	if err := validateGroupSize("user_ids", len(chat.Participants)+len(members)); err != nil {
+		return nil, err
+	}
 
+	if err := chatusecase.chatRepository.AddParticipants(ctx, chatID, members); err != nil {
+		return nil, err
+	}
+
+	return chatusecase.recordSystemMessage(ctx, chatID, userID, domain.SystemMembersAdded, members, "added members")
+}
+
+// RemoveMember lets a manager of a group remove a member ranked below them. Removing oneself is leaving.
+func (chatusecase *ChatUsecase) RemoveMember(ctx context.Context, userID, chatID, memberID primitive.ObjectID) (*domain.Message, error) {
+	if memberID == userID {
+		return chatusecase.LeaveChat(ctx, userID, chatID)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, chatusecase.contextTimeout)
+	defer cancel()
+
+	chat, err := authorizeGroupMember(ctx, chatusecase.chatRepository, userID, chatID)
+	if err != nil {
+		return nil, err
+	}
+	if !chat.HasParticipant(memberID) {
+		return nil, fmt.Errorf("user is not a member of this group: %w", domain.ErrInvalidMembers)
+	}
+	if !chat.CanRemove(userID, memberID) {
+		return nil, fmt.Errorf("cannot remove a member of the same or a higher role: %w", domain.ErrForbidden)
+	}
+
+	if err := chatusecase.chatRepository.RemoveParticipant(ctx, chatID, memberID); err != nil {
+		return nil, err
+	}
+
+	return chatusecase.recordSystemMessage(ctx, chatID, userID, domain.SystemMemberRemoved, []primitive.ObjectID{memberID}, "removed a member")
+}
+
+// LeaveChat takes the user out of a group. The last member leaving deletes the group and its
+// history; an owner leaving hands the group over to an admin, or else to the longest standing member.
+func (chatusecase *ChatUsecase) LeaveChat(ctx context.Context, userID, chatID primitive.ObjectID) (*domain.Message, error) {
+	ctx, cancel := context.WithTimeout(ctx, chatusecase.contextTimeout)
+	defer cancel()
+
+	chat, err := authorizeGroupMember(ctx, chatusecase.chatRepository, userID, chatID)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(chat.Participants) == 1 {
+		if err := chatusecase.chatRepository.DeleteChat(ctx, chatID); err != nil {
+			return nil, err
+		}
+		return nil, chatusecase.messageRepository.DeleteMessagesByChat(ctx, chatID)
+	}
+
+	if chat.IsOwner(userID) {
+		successor := successorOf(chat, userID)
+		if err := chatusecase.chatRepository.SetRoles(ctx, chatID, map[primitive.ObjectID]string{successor: domain.RoleOwner}); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := chatusecase.chatRepository.RemoveParticipant(ctx, chatID, userID); err != nil {
+		return nil, err
+	}
+
+	return chatusecase.recordSystemMessage(ctx, chatID, userID, domain.SystemMemberLeft, []primitive.ObjectID{userID}, "left the group")
+}
+
+// SetMemberRole records every role change in the group's history
+func (chatusecase *ChatUsecase) SetMemberRole(ctx context.Context, userID, chatID, memberID primitive.ObjectID, role string) (*domain.Message, error) {
+	ctx, cancel := context.WithTimeout(ctx, chatusecase.contextTimeout)
+	defer cancel()
+
+	if !domain.ValidRole(role) {
+		return nil, fmt.Errorf("unknown role %q: %w", role, domain.ErrInvalidRole)
+	}
+
+	chat, err := authorizeGroupMember(ctx, chatusecase.chatRepository, userID, chatID)
+	if err != nil {
+		return nil, err
+	}
+	if !chat.IsOwner(userID) {
+		return nil, fmt.Errorf("only the owner can change roles: %w", domain.ErrForbidden)
+	}
+	if !chat.HasParticipant(memberID) {
+		return nil, fmt.Errorf("user is not a member of this group: %w", domain.ErrInvalidMembers)
+	}
+	// The group always has an owner, so the owner can only give the role away
+	if memberID == userID {
+		return nil, fmt.Errorf("the owner's role changes by handing the group over: %w", domain.ErrInvalidRole)
+	}
+	if chat.RoleOf(memberID) == role {
+		return nil, nil
+	}
+
+	roles := map[primitive.ObjectID]string{memberID: role}
+	if role == domain.RoleOwner {
+		roles[userID] = domain.RoleAdmin
+	}
+	if err := chatusecase.chatRepository.SetRoles(ctx, chatID, roles); err != nil {
+		return nil, err
+	}
+
+	message := domain.NewSystemMessage(userID, domain.SystemRoleChanged, []primitive.ObjectID{memberID}, "changed a role")
+	message.System.Role = role
+	if err := chatusecase.messageRepository.SendMessage(ctx, chatID, &message); err != nil {
+		return nil, err
+	}
+	return &message, nil
+}
+
+// recordSystemMessage stores a membership change in the chat's history
+func (chatusecase *ChatUsecase) recordSystemMessage(ctx context.Context, chatID, actorID primitive.ObjectID, action string, userIDs []primitive.ObjectID, content string) (*domain.Message, error) {
+	message := domain.NewSystemMessage(actorID, action, userIDs, content)
+	if err := chatusecase.messageRepository.SendMessage(ctx, chatID, &message); err != nil {
+		return nil, err
+	}
+	return &message, nil
+}
+
+// authorizeGroupMember loads a chat the user participates in and returns domain.ErrNotGroup for direct chats
+func authorizeGroupMember(ctx context.Context, chatRepository domain.ChatRepository, userID, chatID primitive.ObjectID) (*domain.Chat, error) {
+	chat, err := authorizeParticipant(ctx, chatRepository, userID, chatID)
+	if err != nil {
+		return nil, err
+	}
+	if !chat.IsGroup() {
+		return nil, domain.ErrNotGroup
+	}
+	return chat, nil
+}
+
+// successorOf picks the next owner of a group: its first admin, or else its first member
+func successorOf(chat *domain.Chat, ownerID primitive.ObjectID) primitive.ObjectID {
+	successor := primitive.NilObjectID
+	for _, participant := range chat.Participants {
+		if participant == ownerID {
+			continue
+		}
+		if chat.RoleOf(participant) == domain.RoleAdmin {
+			return participant
+		}
+		if successor.IsZero() {
+			successor = participant
+		}
+	}
+	return successor
+}
+
+// newMembers returns the given users who are not participants of the chat yet, without duplicates
+func newMembers(chat *domain.Chat, userIDs []primitive.ObjectID) []primitive.ObjectID {
+	seen := make(map[primitive.ObjectID]bool, len(chat.Participants)+len(userIDs))
+	for _, participant := range chat.Participants {
+		seen[participant] = true
+	}
+
+	members := []primitive.ObjectID{}
+	for _, userID := range userIDs {
+		if userID.IsZero() || seen[userID] {
+			continue
+		}
+		seen[userID] = true
+		members = append(members, userID)
+	}
+	return members
+}
+
+// requireVerified returns domain.ErrEmailNotVerified unless the user has verified their email
+func (chatusecase *ChatUsecase) requireVerified(ctx context.Context, userID primitive.ObjectID) error {
+	user, err := chatusecase.userRepository.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if !user.EmailVerified {
+		return domain.ErrEmailNotVerified
+	}
+	return nil
+}
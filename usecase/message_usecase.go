@@ -3,6 +3,7 @@ package usecase
 import (
 	"Real-Time-Chat-Application/domain"
 	"context"
+	"fmt"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -10,22 +11,40 @@ import (
 
 type MessageUsecase struct {
 	messageRepo domain.MessageRepository
+	chatRepo    domain.ChatRepository
 	contextTimeout time.Duration
 }
 
-func NewMessageUsecase(messageRepo domain.MessageRepository, contextTimeout time.Duration) domain.MessageUsecase {
+func NewMessageUsecase(messageRepo domain.MessageRepository, chatRepo domain.ChatRepository, contextTimeout time.Duration) domain.MessageUsecase {
 	return &MessageUsecase{
 		messageRepo: messageRepo,
+		chatRepo:    chatRepo,
 		contextTimeout: contextTimeout,
 	}
 }
 func(messageUsecase MessageUsecase) SendMessage(ctx context.Context, chatID primitive.ObjectID, message *domain.Message) error{
+	if err := validateContent(message.Content); err != nil {
+		return err
+	}
+
 	// Create a context with timeout
 	ctx, cancel := context.WithTimeout(ctx, messageUsecase.contextTimeout)
 	defer cancel()
 
+	// Only participants of the chat whose role allows it can post in it
+	chat, err := authorizeParticipant(ctx, messageUsecase.chatRepo, message.SenderID, chatID)
+	if err != nil {
+		return err
+	}
+	if !chat.CanPost(message.SenderID) {
+		return fmt.Errorf("cannot post in this chat: %w", domain.ErrForbidden)
+	}
+
+	// System messages are only recorded by the server
+	message.System = nil
+
 	// Call the repository layer to send the message
-	err := messageUsecase.messageRepo.SendMessage(ctx, chatID, message)
+	err = messageUsecase.messageRepo.SendMessage(ctx, chatID, message)
 	if err != nil {
 		return err
 	}
@@ -33,11 +52,15 @@ func(messageUsecase MessageUsecase) SendMessage(ctx context.Context, chatID prim
 	return nil
 
 }
-func(messageUsecase MessageUsecase) GetMessages(ctx context.Context, chatID primitive.ObjectID) ([]domain.Message, error) {
+func(messageUsecase MessageUsecase) GetMessages(ctx context.Context, userID, chatID primitive.ObjectID) ([]domain.Message, error) {
 	// Create a context with timeout
 	ctx, cancel := context.WithTimeout(ctx, messageUsecase.contextTimeout)
 	defer cancel()
 
+	if _, err := authorizeParticipant(ctx, messageUsecase.chatRepo, userID, chatID); err != nil {
+		return []domain.Message{}, err
+	}
+
 	// Call the repository layer to get the messages
 	messages, err := messageUsecase.messageRepo.GetMessages(ctx,chatID)
 	if err != nil{
@@ -46,11 +69,89 @@ func(messageUsecase MessageUsecase) GetMessages(ctx context.Context, chatID prim
 
 	return messages, nil
 }
-func(messageUsecase MessageUsecase) GetMessage(ctx context.Context, chatID, messageID primitive.ObjectID) (domain.Message, error) {
+func(messageUsecase MessageUsecase) GetMessagesBefore(ctx context.Context, userID, chatID primitive.ObjectID, cursor string, limit int) (domain.MessagePage, error) {
+	// Create a context with timeout
+	ctx, cancel := context.WithTimeout(ctx, messageUsecase.contextTimeout)
+	defer cancel()
+
+	if _, err := authorizeParticipant(ctx, messageUsecase.chatRepo, userID, chatID); err != nil {
+		return domain.MessagePage{}, err
+	}
+
+	// An empty cursor starts from the latest message
+	var position *domain.MessageCursor
+	if cursor != "" {
+		parsed, err := messageUsecase.parseCursor(ctx, chatID, cursor)
+		if err != nil {
+			return domain.MessagePage{}, err
+		}
+		position = &parsed
+	}
+
+	// Fetch one extra message to know whether there is another page
+	limit = pageSize(limit)
+	messages, err := messageUsecase.messageRepo.GetMessagesBefore(ctx, chatID, position, limit+1)
+	if err != nil {
+		return domain.MessagePage{}, err
+	}
+
+	hasMore := len(messages) > limit
+	if hasMore {
+		// the extra message is the oldest one
+		messages = messages[1:]
+	}
+
+	page := domain.MessagePage{Messages: messages, HasMore: hasMore}
+	if len(messages) > 0 {
+		page.NextCursor = messages[0].MessageID.Hex()
+	}
+
+	return page, nil
+}
+func(messageUsecase MessageUsecase) GetMessagesAfter(ctx context.Context, userID, chatID primitive.ObjectID, cursor string, limit int) (domain.MessagePage, error) {
 	// Create a context with timeout
 	ctx, cancel := context.WithTimeout(ctx, messageUsecase.contextTimeout)
 	defer cancel()
 
+	if _, err := authorizeParticipant(ctx, messageUsecase.chatRepo, userID, chatID); err != nil {
+		return domain.MessagePage{}, err
+	}
+
+	position, err := messageUsecase.parseCursor(ctx, chatID, cursor)
+	if err != nil {
+		return domain.MessagePage{}, err
+	}
+
+	// Fetch one extra message to know whether there is another page
+	limit = pageSize(limit)
+	messages, err := messageUsecase.messageRepo.GetMessagesAfter(ctx, chatID, position, limit+1)
+	if err != nil {
+		return domain.MessagePage{}, err
+	}
+
+	hasMore := len(messages) > limit
+	if hasMore {
+		// the extra message is the newest one
+		messages = messages[:limit]
+	}
+
+	// Keep the cursor where it was when there is nothing new, so clients can poll with it
+	page := domain.MessagePage{Messages: messages, HasMore: hasMore, NextCursor: cursor}
+	if len(messages) > 0 {
+		page.NextCursor = messages[len(messages)-1].MessageID.Hex()
+	}
+
+	return page, nil
+}
+func(messageUsecase MessageUsecase) GetMessage(ctx context.Context, userID, chatID, messageID primitive.ObjectID) (domain.Message, error) {
+	// Create a context with timeout
+	ctx, cancel := context.WithTimeout(ctx, messageUsecase.contextTimeout)
+	defer cancel()
+
+	if _, err := authorizeParticipant(ctx, messageUsecase.chatRepo, userID, chatID); err != nil {
+		return domain.Message{}, err
+	}
+
 	// Call the repository layer to get the message
 	message, err := messageUsecase.messageRepo.GetMessage(ctx, chatID, messageID)
 	if err != nil{
@@ -59,11 +160,16 @@ func(messageUsecase MessageUsecase) GetMessage(ctx context.Context, chatID, mess
 
 	return message, nil
 } 
-func(messageUsecase MessageUsecase) DeleteMessage(ctx context.Context, chatID, messageID primitive.ObjectID) error {
+func(messageUsecase MessageUsecase) DeleteMessage(ctx context.Context, userID, chatID, messageID primitive.ObjectID) error {
 	// Create a context with timeout
 	ctx, cancel := context.WithTimeout(ctx, messageUsecase.contextTimeout)
 	defer cancel()
 
+	// Group managers may delete the messages of others
+	if _, err := messageUsecase.authorizeSender(ctx, userID, chatID, messageID, true); err != nil {
+		return err
+	}
+
 	// Call the repository layer to delete the message
 	err := messageUsecase.messageRepo.DeleteMessage(ctx, chatID, messageID)
 	if err != nil{
@@ -73,17 +179,81 @@ func(messageUsecase MessageUsecase) DeleteMessage(ctx context.Context, chatID, m
 	return nil
 
 }
-func(messageUsecase MessageUsecase) UpdateMessage(ctx context.Context, chatID, messageID primitive.ObjectID, newContent string) error {
+func(messageUsecase MessageUsecase) UpdateMessage(ctx context.Context, userID, chatID, messageID primitive.ObjectID, newContent string) (domain.Message, error) {
+	if err := validateContent(newContent); err != nil {
+		return domain.Message{}, err
+	}
+
 	// Create a context with timeout
 	ctx, cancel := context.WithTimeout(ctx, messageUsecase.contextTimeout)
 	defer cancel()
 
+	message, err := messageUsecase.authorizeSender(ctx, userID, chatID, messageID, false)
+	if err != nil {
+		return domain.Message{}, err
+	}
+
 	// Call the repository layer to update the message
-	err := messageUsecase.messageRepo.UpdateMessage(ctx, chatID, messageID, newContent)
+	err = messageUsecase.messageRepo.UpdateMessage(ctx, chatID, messageID, newContent)
 	if err != nil{
-		return err
+		return domain.Message{}, err
 	}
 
-	return nil
+	message.Content = newContent
+	message.Edited = true
+	return message, nil
+
+}
 
+// authorizeSender only lets the original sender, who must still be a participant, modify a message,
+// along with the managers of a group when allowManagers is set. It returns the message as currently stored.
+func (messageUsecase MessageUsecase) authorizeSender(ctx context.Context, userID, chatID, messageID primitive.ObjectID, allowManagers bool) (domain.Message, error) {
+	chat, err := authorizeParticipant(ctx, messageUsecase.chatRepo, userID, chatID)
+	if err != nil {
+		return domain.Message{}, err
+	}
+
+	message, err := messageUsecase.messageRepo.GetMessage(ctx, chatID, messageID)
+	if err != nil {
+		return domain.Message{}, err
+	}
+
+	if message.SenderID != userID && !(allowManagers && chat.CanManage(userID)) {
+		return domain.Message{}, fmt.Errorf("only the sender can modify this message: %w", domain.ErrForbidden)
+	}
+	if message.System != nil {
+		return domain.Message{}, fmt.Errorf("system messages cannot be modified: %w", domain.ErrForbidden)
+	}
+
+	return message, nil
+}
+
+// parseCursor resolves a cursor that is either the ID of a message of the chat or an RFC 3339 timestamp
+func (messageUsecase MessageUsecase) parseCursor(ctx context.Context, chatID primitive.ObjectID, cursor string) (domain.MessageCursor, error) {
+	if messageID, err := primitive.ObjectIDFromHex(cursor); err == nil {
+		message, err := messageUsecase.messageRepo.GetMessage(ctx, chatID, messageID)
+		if err != nil {
+			return domain.MessageCursor{}, fmt.Errorf("cursor does not point at a message of this chat: %w", domain.ErrInvalidCursor)
+		}
+		return domain.MessageCursor{Time: message.Time, MessageID: message.MessageID}, nil
+	}
+
+	timestamp, err := time.Parse(time.RFC3339Nano, cursor)
+	if err != nil {
+		return domain.MessageCursor{}, fmt.Errorf("cursor must be a message ID or an RFC 3339 timestamp: %w", domain.ErrInvalidCursor)
+	}
+
+	return domain.MessageCursor{Time: timestamp}, nil
+}
+
+// pageSize clamps a requested page size to the allowed range
+func pageSize(limit int) int {
+	switch {
+	case limit <= 0:
+		return domain.DefaultMessagePageSize
+	case limit > domain.MaxMessagePageSize:
+		return domain.MaxMessagePageSize
+	default:
+		return limit
+	}
 }
@@ -0,0 +1,116 @@
+package usecase
+
+import (
+	"Real-Time-Chat-Application/domain"
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// startSession records a new session for the device and issues its first token pair
+func (authUsecase *AuthUsecase) startSession(ctx context.Context, userID primitive.ObjectID, device domain.DeviceInfo) (*domain.TokenPair, error) {
+	sessionID := primitive.NewObjectID()
+	tokens, err := authUsecase.tokenService.GenerateTokens(userID, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	err = authUsecase.sessionRepository.CreateSession(ctx, &domain.Session{
+		SessionID:        sessionID,
+		UserID:           userID,
+		DeviceName:       strings.TrimSpace(device.Name),
+		IP:               device.IP,
+		UserAgent:        truncate(device.UserAgent, domain.MaxUserAgentLength),
+		RefreshTokenHash: hashUserToken(tokens.RefreshToken),
+		CreatedAt:        now,
+		LastActiveAt:     now,
+		ExpiresAt:        tokens.RefreshExpiresAt,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// rotateSession issues a new token pair for the session of claims in exchange for refreshToken,
+// which stops working. Refresh tokens are hashed like user tokens, being just as random.
+func (authUsecase *AuthUsecase) rotateSession(ctx context.Context, claims *domain.TokenClaims, refreshToken string, device domain.DeviceInfo) (*domain.TokenPair, error) {
+	tokens, err := authUsecase.tokenService.GenerateTokens(claims.UserID, claims.SessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = authUsecase.sessionRepository.RotateSession(ctx, claims.SessionID, hashUserToken(refreshToken), &domain.Session{
+		IP:               device.IP,
+		UserAgent:        truncate(device.UserAgent, domain.MaxUserAgentLength),
+		RefreshTokenHash: hashUserToken(tokens.RefreshToken),
+		LastActiveAt:     time.Now(),
+		ExpiresAt:        tokens.RefreshExpiresAt,
+	})
+	if errors.Is(err, domain.ErrSessionNotFound) {
+		// Revoked, or the token was already exchanged
+		return nil, domain.ErrInvalidToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+func (authUsecase *AuthUsecase) CheckSession(ctx context.Context, userID, sessionID primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(ctx, authUsecase.contextTimeout)
+	defer cancel()
+
+	session, err := authUsecase.sessionRepository.GetSession(ctx, sessionID)
+	if errors.Is(err, domain.ErrSessionNotFound) {
+		return domain.ErrInvalidToken
+	}
+	if err != nil {
+		return err
+	}
+	if session.UserID != userID {
+		return domain.ErrInvalidToken
+	}
+	return nil
+}
+
+func (authUsecase *AuthUsecase) ListSessions(ctx context.Context, userID, currentSessionID primitive.ObjectID) ([]domain.Session, error) {
+	ctx, cancel := context.WithTimeout(ctx, authUsecase.contextTimeout)
+	defer cancel()
+
+	sessions, err := authUsecase.sessionRepository.GetSessionsByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range sessions {
+		sessions[i].Current = sessions[i].SessionID == currentSessionID
+	}
+	return sessions, nil
+}
+
+func (authUsecase *AuthUsecase) RevokeSession(ctx context.Context, userID, sessionID primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(ctx, authUsecase.contextTimeout)
+	defer cancel()
+
+	return authUsecase.sessionRepository.DeleteSession(ctx, userID, sessionID)
+}
+
+func (authUsecase *AuthUsecase) RevokeAllSessions(ctx context.Context, userID primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(ctx, authUsecase.contextTimeout)
+	defer cancel()
+
+	return authUsecase.sessionRepository.DeleteSessions(ctx, userID)
+}
+
+// truncate cuts s down to at most n characters
+func truncate(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n])
+}
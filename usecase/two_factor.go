@@ -0,0 +1,247 @@
+package usecase
+
+import (
+	"Real-Time-Chat-Application/domain"
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var recoveryCodeEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// SetupTwoFactor starts the setup with a new secret. Starting again before confirming replaces
+// the secret, so only the app set up last works.
+func (authUsecase *AuthUsecase) SetupTwoFactor(ctx context.Context, userID primitive.ObjectID) (*domain.TwoFactorSetup, error) {
+	ctx, cancel := context.WithTimeout(ctx, authUsecase.contextTimeout)
+	defer cancel()
+
+	user, err := authUsecase.userRepository.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.TwoFactorEnabled() {
+		return nil, domain.ErrTwoFactorAlreadyEnabled
+	}
+
+	secret, err := authUsecase.totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+	if err := authUsecase.userRepository.SetTwoFactor(ctx, userID, &domain.TwoFactor{Secret: secret}); err != nil {
+		return nil, err
+	}
+
+	return &domain.TwoFactorSetup{Secret: secret, URI: authUsecase.totp.URI(secret, user.Email)}, nil
+}
+
+// ConfirmTwoFactor enables two-factor authentication once the user proves their app shows the
+// right codes, and returns the recovery codes. They are only stored hashed, so this is the only
+// time they can be shown.
+func (authUsecase *AuthUsecase) ConfirmTwoFactor(ctx context.Context, userID primitive.ObjectID, code string) ([]string, error) {
+	if err := validateTwoFactorCode(code); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, authUsecase.contextTimeout)
+	defer cancel()
+
+	user, err := authUsecase.userRepository.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.TwoFactorEnabled() {
+		return nil, domain.ErrTwoFactorAlreadyEnabled
+	}
+	if user.TwoFactor == nil {
+		return nil, domain.ErrTwoFactorNotEnabled
+	}
+
+	step, ok := authUsecase.totp.Validate(user.TwoFactor.Secret, strings.TrimSpace(code))
+	if !ok {
+		return nil, incorrectCode()
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	err = authUsecase.userRepository.SetTwoFactor(ctx, userID, &domain.TwoFactor{
+		Secret:        user.TwoFactor.Secret,
+		Enabled:       true,
+		EnabledAt:     &now,
+		LastUsedStep:  step,
+		RecoveryCodes: hashes,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// DisableTwoFactor turns two-factor authentication off, given a current code or a recovery code
+func (authUsecase *AuthUsecase) DisableTwoFactor(ctx context.Context, userID primitive.ObjectID, code string) error {
+	if err := validateTwoFactorCode(code); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, authUsecase.contextTimeout)
+	defer cancel()
+
+	user, err := authUsecase.userRepository.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if !user.TwoFactorEnabled() {
+		return domain.ErrTwoFactorNotEnabled
+	}
+
+	if err := authUsecase.checkSecondFactor(ctx, user, code); err != nil {
+		// The caller is signed in, so a wrong code is a bad field rather than a failed login
+		if errors.Is(err, domain.ErrInvalidTwoFactorCode) {
+			return incorrectCode()
+		}
+		return err
+	}
+
+	return authUsecase.userRepository.SetTwoFactor(ctx, userID, nil)
+}
+
+// LoginTwoFactor completes a login with the challenge Login returned. The challenge can only be
+// answered once, so a wrong code means logging in again with the password.
+func (authUsecase *AuthUsecase) LoginTwoFactor(ctx context.Context, challenge, code string, device domain.DeviceInfo) (*domain.TokenPair, error) {
+	errs := &domain.ValidationError{}
+	if challenge == "" {
+		errs.Add("challenge_token", "is required")
+	}
+	if strings.TrimSpace(code) == "" {
+		errs.Add("code", "is required")
+	}
+	if err := errs.Err(); err != nil {
+		return nil, err
+	}
+	if err := validateDevice(device); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, authUsecase.contextTimeout)
+	defer cancel()
+
+	record, err := authUsecase.userTokenRepository.ConsumeToken(ctx, domain.TokenTwoFactorLogin, hashUserToken(challenge), time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := authUsecase.userRepository.GetUserByID(ctx, record.UserID)
+	if errors.Is(err, domain.ErrUserNotFound) {
+		return nil, domain.ErrInvalidUserToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !user.TwoFactorEnabled() {
+		// Turned off since the first step, which was not asked for a second factor then
+		return nil, domain.ErrInvalidUserToken
+	}
+
+	if err := authUsecase.checkSecondFactor(ctx, user, code); err != nil {
+		return nil, err
+	}
+
+	return authUsecase.startSession(ctx, user.UserID, device)
+}
+
+// TwoFactorStatus tells whether a user has two-factor authentication on. Only the user and
+// admins may ask.
+func (authUsecase *AuthUsecase) TwoFactorStatus(ctx context.Context, callerID, userID primitive.ObjectID) (*domain.TwoFactorStatus, error) {
+	ctx, cancel := context.WithTimeout(ctx, authUsecase.contextTimeout)
+	defer cancel()
+
+	if callerID != userID {
+		caller, err := authUsecase.userRepository.GetUserByID(ctx, callerID)
+		if err != nil {
+			return nil, err
+		}
+		if !caller.IsAdmin {
+			return nil, fmt.Errorf("only admins can see the two-factor status of other users: %w", domain.ErrForbidden)
+		}
+	}
+
+	user, err := authUsecase.userRepository.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &domain.TwoFactorStatus{}
+	if user.TwoFactorEnabled() {
+		status.Enabled = true
+		status.EnabledAt = user.TwoFactor.EnabledAt
+		status.RecoveryCodesLeft = len(user.TwoFactor.RecoveryCodes)
+	}
+	return status, nil
+}
+
+// checkSecondFactor accepts a TOTP code or a recovery code of a user with two-factor
+// authentication on, and uses it up. It returns domain.ErrInvalidTwoFactorCode for anything else.
+func (authUsecase *AuthUsecase) checkSecondFactor(ctx context.Context, user *domain.User, code string) error {
+	code = strings.TrimSpace(code)
+	if isTOTPCode(code) {
+		step, ok := authUsecase.totp.Validate(user.TwoFactor.Secret, code)
+		if !ok {
+			return domain.ErrInvalidTwoFactorCode
+		}
+		return authUsecase.userRepository.UseTOTPStep(ctx, user.UserID, step)
+	}
+	return authUsecase.userRepository.UseRecoveryCode(ctx, user.UserID, hashUserToken(normalizeRecoveryCode(code)))
+}
+
+// newRecoveryCodes returns RecoveryCodeCount random codes to show the user, such as
+// "k3q7m-x2p9a", and their hashes to store
+func newRecoveryCodes() (codes, hashes []string, err error) {
+	for i := 0; i < domain.RecoveryCodeCount; i++ {
+		random := make([]byte, 7)
+		if _, err := rand.Read(random); err != nil {
+			return nil, nil, fmt.Errorf("failed to generate recovery code: %w", err)
+		}
+		code := strings.ToLower(recoveryCodeEncoding.EncodeToString(random)[:10])
+		codes = append(codes, code[:5]+"-"+code[5:])
+		hashes = append(hashes, hashUserToken(code))
+	}
+	return codes, hashes, nil
+}
+
+// normalizeRecoveryCode ignores case, spaces and dashes, which users easily get wrong when typing a code
+func normalizeRecoveryCode(code string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '-' || unicode.IsSpace(r) {
+			return -1
+		}
+		return unicode.ToLower(r)
+	}, code)
+}
+
+// isTOTPCode reports whether code looks like a TOTP code rather than a recovery code
+func isTOTPCode(code string) bool {
+	if len(code) != domain.TOTPDigits {
+		return false
+	}
+	for _, r := range code {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func incorrectCode() error {
+	errs := &domain.ValidationError{}
+	errs.Add("code", "is incorrect")
+	return errs.Err()
+}
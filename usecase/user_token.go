@@ -0,0 +1,54 @@
+package usecase
+
+import (
+	"Real-Time-Chat-Application/domain"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// newUserToken returns a random token to send to the user, and the record of it to store
+func newUserToken(userID primitive.ObjectID, purpose string, now time.Time, ttl time.Duration) (string, *domain.UserToken, error) {
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return "", nil, fmt.Errorf("failed to generate token: %w", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(random)
+
+	return token, &domain.UserToken{
+		UserID:    userID,
+		Purpose:   purpose,
+		Hash:      hashUserToken(token),
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	}, nil
+}
+
+// issueUserToken stores a new token of purpose for the user and returns it to be mailed. Tokens
+// of purpose issued to the user before are deleted, so only the latest mail works.
+func issueUserToken(ctx context.Context, userTokenRepository domain.UserTokenRepository, userID primitive.ObjectID, purpose string, ttl time.Duration) (string, error) {
+	token, record, err := newUserToken(userID, purpose, time.Now(), ttl)
+	if err != nil {
+		return "", err
+	}
+	if err := userTokenRepository.DeleteTokens(ctx, userID, purpose); err != nil {
+		return "", err
+	}
+	if err := userTokenRepository.CreateToken(ctx, record); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// hashUserToken is the form a token is stored and looked up in. Tokens are random and long, so
+// a fast unsalted hash is enough to make a leaked database useless for using them.
+func hashUserToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -3,24 +3,47 @@ package usecase
 import (
 	"Real-Time-Chat-Application/domain"
 	"context"
+	"fmt"
+	"log"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type UserUsecase struct {
-	userRepository domain.UserRepository
-	contextTimeout time.Duration
+	userRepository      domain.UserRepository
+	userTokenRepository domain.UserTokenRepository
+	sessionRepository   domain.SessionRepository
+	passwordHasher      domain.PasswordHasher
+	mailer              domain.Mailer
+	contextTimeout      time.Duration
 }
 
-func NewUserUsecase(userRepository domain.UserRepository, contextTimeout time.Duration) domain.UserUsecase {
+func NewUserUsecase(userRepository domain.UserRepository, userTokenRepository domain.UserTokenRepository, sessionRepository domain.SessionRepository, passwordHasher domain.PasswordHasher, mailer domain.Mailer, contextTimeout time.Duration) domain.UserUsecase {
 	return &UserUsecase{
-		userRepository: userRepository,
-		contextTimeout: contextTimeout,
+		userRepository:      userRepository,
+		userTokenRepository: userTokenRepository,
+		sessionRepository:   sessionRepository,
+		passwordHasher:      passwordHasher,
+		mailer:              mailer,
+		contextTimeout:      contextTimeout,
 	}
 }
 
+// CreateUser stores the user unverified and mails them a verification token. A failure to send
+// the mail does not undo the sign up; the user can ask for another one with ResendVerification.
 func (userUsecase *UserUsecase) CreateUser(ctx context.Context, user *domain.User) (primitive.ObjectID, error) {
+	if err := validateNewUser(user); err != nil {
+		return primitive.NilObjectID, err
+	}
+
+	hash, err := userUsecase.passwordHasher.Hash(user.Password)
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+	user.Password = hash
+	user.EmailVerified = false
+
 	ctx, cancel := context.WithTimeout(ctx, userUsecase.contextTimeout)
 	defer cancel()
 
@@ -28,6 +51,11 @@ func (userUsecase *UserUsecase) CreateUser(ctx context.Context, user *domain.Use
 	if err != nil {
 		return primitive.NilObjectID, err
 	}
+
+	user.UserID = userID
+	if err := userUsecase.sendVerification(ctx, user); err != nil {
+		log.Printf("failed to send the verification mail to user %s: %v", userID.Hex(), err)
+	}
 	return userID, nil
 }
 
@@ -65,6 +93,18 @@ func (userUsecase *UserUsecase) GetUserByUsername(ctx context.Context, username
 }
 
 func (userUsecase *UserUsecase) UpdateUser(ctx context.Context, userID primitive.ObjectID, user *domain.User) error {
+	if err := validateUserUpdate(user); err != nil {
+		return err
+	}
+
+	if user.Password != "" {
+		hash, err := userUsecase.passwordHasher.Hash(user.Password)
+		if err != nil {
+			return err
+		}
+		user.Password = hash
+	}
+
 	ctx, cancel := context.WithTimeout(ctx, userUsecase.contextTimeout)
 	defer cancel()
 
@@ -85,3 +125,111 @@ func (userUsecase *UserUsecase) DeleteUser(ctx context.Context, userID primitive
 	}
 	return nil
 }
+
+func (userUsecase *UserUsecase) GetUsersByIDs(ctx context.Context, userIDs []primitive.ObjectID) ([]domain.User, error) {
+	ctx, cancel := context.WithTimeout(ctx, userUsecase.contextTimeout)
+	defer cancel()
+
+	users, err := userUsecase.userRepository.GetUsersByIDs(ctx, userIDs)
+	if err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+func (userUsecase *UserUsecase) UpdateLastSeen(ctx context.Context, userID primitive.ObjectID, lastSeen time.Time) error {
+	ctx, cancel := context.WithTimeout(ctx, userUsecase.contextTimeout)
+	defer cancel()
+
+	err := userUsecase.userRepository.UpdateLastSeen(ctx, userID, lastSeen)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (userUsecase *UserUsecase) ChangePassword(ctx context.Context, userID, sessionID primitive.ObjectID, currentPassword, newPassword string) error {
+	if err := validatePasswordChange(currentPassword, newPassword); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, userUsecase.contextTimeout)
+	defer cancel()
+
+	user, err := userUsecase.userRepository.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if !userUsecase.passwordHasher.Compare(user.Password, currentPassword) {
+		errs := &domain.ValidationError{}
+		errs.Add("current_password", "is incorrect")
+		return errs
+	}
+
+	hash, err := userUsecase.passwordHasher.Hash(newPassword)
+	if err != nil {
+		return err
+	}
+	if err := userUsecase.userRepository.UpdateUser(ctx, userID, &domain.User{Password: hash}); err != nil {
+		return err
+	}
+
+	// Other devices signed in with the old password are signed out; the caller's stays
+	return userUsecase.sessionRepository.DeleteOtherSessions(ctx, userID, sessionID)
+}
+
+func (userUsecase *UserUsecase) VerifyEmail(ctx context.Context, token string) error {
+	if token == "" {
+		errs := &domain.ValidationError{}
+		errs.Add("token", "is required")
+		return errs
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, userUsecase.contextTimeout)
+	defer cancel()
+
+	record, err := userUsecase.userTokenRepository.ConsumeToken(ctx, domain.TokenEmailVerification, hashUserToken(token), time.Now())
+	if err != nil {
+		return err
+	}
+	return userUsecase.userRepository.MarkEmailVerified(ctx, record.UserID)
+}
+
+func (userUsecase *UserUsecase) ResendVerification(ctx context.Context, userID primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(ctx, userUsecase.contextTimeout)
+	defer cancel()
+
+	user, err := userUsecase.userRepository.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user.EmailVerified {
+		return domain.ErrEmailAlreadyVerified
+	}
+
+	sentAt, err := userUsecase.userTokenRepository.LatestTokenTime(ctx, userID, domain.TokenEmailVerification)
+	if err != nil {
+		return err
+	}
+	if time.Since(sentAt) < domain.VerificationResendCooldown {
+		return domain.ErrResendTooSoon
+	}
+
+	return userUsecase.sendVerification(ctx, user)
+}
+
+// sendVerification mails the user a new email verification token
+func (userUsecase *UserUsecase) sendVerification(ctx context.Context, user *domain.User) error {
+	token, err := issueUserToken(ctx, userUsecase.userTokenRepository, user.UserID, domain.TokenEmailVerification, domain.EmailVerificationTTL)
+	if err != nil {
+		return err
+	}
+
+	return userUsecase.mailer.Send(ctx, domain.Mail{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Hi %s,\n\nUse this token to verify your email address:\n\n%s\n\n"+
+			"It expires in %d hours. If you did not sign up, ignore this mail.\n",
+			user.Username, token, int(domain.EmailVerificationTTL.Hours())),
+	})
+}
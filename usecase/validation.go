@@ -0,0 +1,195 @@
+package usecase
+
+import (
+	"Real-Time-Chat-Application/domain"
+	"fmt"
+	"net/mail"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// validateNewUser checks every field a user needs to sign up
+func validateNewUser(user *domain.User) error {
+	errs := &domain.ValidationError{}
+	checkEmail(errs, user.Email)
+	checkUsername(errs, user.Username)
+	checkPassword(errs, "password", user.Password)
+	return errs.Err()
+}
+
+// validateUserUpdate checks the fields of a user that an update changes; empty fields are left as they are
+func validateUserUpdate(user *domain.User) error {
+	errs := &domain.ValidationError{}
+	if user.Username != "" {
+		checkUsername(errs, user.Username)
+	}
+	if user.Password != "" {
+		checkPassword(errs, "password", user.Password)
+	}
+	return errs.Err()
+}
+
+// validatePasswordChange checks a new password, which must differ from the current one
+func validatePasswordChange(currentPassword, newPassword string) error {
+	errs := &domain.ValidationError{}
+	if currentPassword == "" {
+		errs.Add("current_password", "is required")
+	}
+	checkPassword(errs, "new_password", newPassword)
+	if newPassword != "" && newPassword == currentPassword {
+		errs.Add("new_password", "must differ from the current password")
+	}
+	return errs.Err()
+}
+
+// validateDevice checks the device name a client signs in with, which is optional
+func validateDevice(device domain.DeviceInfo) error {
+	errs := &domain.ValidationError{}
+	if utf8.RuneCountInString(device.Name) > domain.MaxDeviceNameLength {
+		errs.Add("device_name", fmt.Sprintf("must be at most %d characters", domain.MaxDeviceNameLength))
+	}
+	return errs.Err()
+}
+
+// validateTwoFactorCode checks a TOTP or recovery code was given
+func validateTwoFactorCode(code string) error {
+	errs := &domain.ValidationError{}
+	if strings.TrimSpace(code) == "" {
+		errs.Add("code", "is required")
+	}
+	return errs.Err()
+}
+
+// validateContent checks the content of a message sent or edited by a user
+func validateContent(content string) error {
+	errs := &domain.ValidationError{}
+	switch {
+	case strings.TrimSpace(content) == "":
+		errs.Add("content", "must not be empty")
+	case utf8.RuneCountInString(content) > domain.MaxMessageLength:
+		errs.Add("content", fmt.Sprintf("must be at most %d characters", domain.MaxMessageLength))
+	}
+	return errs.Err()
+}
+
+// validateParticipants checks the two users of a direct chat
+func validateParticipants(senderID, receiverID primitive.ObjectID) error {
+	errs := &domain.ValidationError{}
+	if senderID.IsZero() {
+		errs.Add("sender_id", "is required")
+	}
+	if receiverID.IsZero() {
+		errs.Add("receiver_id", "is required")
+	} else if receiverID == senderID {
+		errs.Add("receiver_id", "must be another user than the sender")
+	}
+	return errs.Err()
+}
+
+// validateNewGroup checks a group about to be created, memberCount counting the members besides its creator
+func validateNewGroup(memberCount int, title, avatar string) error {
+	errs := &domain.ValidationError{}
+	if memberCount == 0 {
+		errs.Add("member_ids", "must name at least one other user")
+	} else {
+		checkGroupSize(errs, "member_ids", memberCount+1)
+	}
+	checkChatTitle(errs, title)
+	checkAvatar(errs, avatar)
+	return errs.Err()
+}
+
+// validateChatSettings checks the settings an update of a group changes
+func validateChatSettings(settings domain.ChatSettings) error {
+	errs := &domain.ValidationError{}
+	if settings.Title != nil {
+		checkChatTitle(errs, *settings.Title)
+	}
+	if settings.Avatar != nil {
+		checkAvatar(errs, *settings.Avatar)
+	}
+	return errs.Err()
+}
+
+// validateGroupSize checks a group can grow to size members, blaming field for going over
+func validateGroupSize(field string, size int) error {
+	errs := &domain.ValidationError{}
+	checkGroupSize(errs, field, size)
+	return errs.Err()
+}
+
+// checkEmail accepts a bare address such as "jane@example.com", without a display name
+func checkEmail(errs *domain.ValidationError, email string) {
+	if email == "" {
+		errs.Add("email", "is required")
+		return
+	}
+	address, err := mail.ParseAddress(email)
+	if err != nil || address.Address != email || len(email) > domain.MaxEmailLength {
+		errs.Add("email", "must be a valid email address")
+	}
+}
+
+// checkUsername accepts letters, digits, dots, dashes and underscores, starting with a letter or digit
+func checkUsername(errs *domain.ValidationError, username string) {
+	length := utf8.RuneCountInString(username)
+	if length < domain.MinUsernameLength || length > domain.MaxUsernameLength {
+		errs.Add("username", fmt.Sprintf("must be between %d and %d characters", domain.MinUsernameLength, domain.MaxUsernameLength))
+		return
+	}
+	for i, r := range username {
+		alphanumeric := unicode.IsLetter(r) || unicode.IsDigit(r)
+		if i == 0 && !alphanumeric {
+			errs.Add("username", "must start with a letter or digit")
+			return
+		}
+		if !alphanumeric && r != '.' && r != '-' && r != '_' {
+			errs.Add("username", "may only contain letters, digits, dots, dashes and underscores")
+			return
+		}
+	}
+}
+
+// checkPassword requires a password long enough, and mixing letters and digits
+func checkPassword(errs *domain.ValidationError, field, password string) {
+	if utf8.RuneCountInString(password) < domain.MinPasswordLength {
+		errs.Add(field, fmt.Sprintf("must be at least %d characters", domain.MinPasswordLength))
+		return
+	}
+	if len(password) > domain.MaxPasswordLength {
+		errs.Add(field, fmt.Sprintf("must be at most %d bytes", domain.MaxPasswordLength))
+		return
+	}
+	var letter, digit bool
+	for _, r := range password {
+		letter = letter || unicode.IsLetter(r)
+		digit = digit || unicode.IsDigit(r)
+	}
+	if !letter || !digit {
+		errs.Add(field, "must contain at least one letter and one digit")
+	}
+}
+
+// checkGroupSize allows groups of up to MaxGroupSize members
+func checkGroupSize(errs *domain.ValidationError, field string, size int) {
+	if size > domain.MaxGroupSize {
+		errs.Add(field, fmt.Sprintf("a group has at most %d members", domain.MaxGroupSize))
+	}
+}
+
+// checkChatTitle limits the length of a group's title, which may be empty
+func checkChatTitle(errs *domain.ValidationError, title string) {
+	if utf8.RuneCountInString(title) > domain.MaxChatTitleLength {
+		errs.Add("title", fmt.Sprintf("must be at most %d characters", domain.MaxChatTitleLength))
+	}
+}
+
+// checkAvatar limits the length of a group's avatar URL, which may be empty
+func checkAvatar(errs *domain.ValidationError, avatar string) {
+	if len(avatar) > domain.MaxAvatarLength {
+		errs.Add("avatar", fmt.Sprintf("must be at most %d characters", domain.MaxAvatarLength))
+	}
+}
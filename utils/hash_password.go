@@ -1,19 +0,0 @@
-package utils
-
-import (
-	"fmt"
-
-	"golang.org/x/crypto/bcrypt"
-)
-
-func HashPassword(password string) (string, error) {
-	// Hash the password
-
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-
-	if err != nil{
-		return "", fmt.Errorf("Failed to hash the password")
-	}
-
-	return string(hashedPassword), nil
-}
\ No newline at end of file
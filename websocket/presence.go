@@ -0,0 +1,148 @@
+package websocket
+
+import (
+	"Real-Time-Chat-Application/domain"
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// statusOf works out a user's presence from their connections. The caller must hold the mutex.
+func (h *Hub) statusOf(userID string) string {
+	status := domain.PresenceOffline
+	for client := range h.users[userID] {
+		if !client.away {
+			return domain.PresenceOnline
+		}
+		status = domain.PresenceAway
+	}
+	return status
+}
+
+// peersOf returns the clients of other users following a chat that one of the user's
+// connections follows. The caller must hold the mutex.
+func (h *Hub) peersOf(userID string) map[*Client]bool {
+	peers := make(map[*Client]bool)
+	for client := range h.users[userID] {
+		for chatID := range client.chats {
+			for peer := range h.chats[chatID] {
+				if peer.UserID != userID {
+					peers[peer] = true
+				}
+			}
+		}
+	}
+	return peers
+}
+
+// presenceChanged tells peers about a user's new presence if it differs from before. A user
+// going offline also has their last seen time recorded. The caller must hold the mutex.
+func (h *Hub) presenceChanged(userID, before string, peers map[*Client]bool) {
+	status := h.statusOf(userID)
+	if status == before {
+		return
+	}
+
+	payload := PresencePayload{UserID: userID, Status: status}
+	if status == domain.PresenceOffline {
+		now := time.Now()
+		payload.LastSeen = &now
+		h.recordLastSeen(userID, now)
+	}
+
+	event, err := NewEvent(EventPresence, "", payload)
+	if err != nil {
+		log.Printf("error marshaling presence event: %v", err)
+		return
+	}
+	for peer := range peers {
+		h.send(peer, event)
+	}
+}
+
+// recordLastSeen stores a user's last seen time without holding up the hub. Stop waits for
+// the pending writes.
+func (h *Hub) recordLastSeen(userID string, lastSeen time.Time) {
+	if h.userUsecase == nil {
+		return
+	}
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return
+	}
+
+	h.persisting.Add(1)
+	go func() {
+		defer h.persisting.Done()
+		if err := h.userUsecase.UpdateLastSeen(context.Background(), userObjectID, lastSeen); err != nil {
+			log.Printf("error recording last seen time: %v", err)
+		}
+	}()
+}
+
+// setAway marks one connection of a user as idle or active again
+func (h *Hub) setAway(client *Client, away bool) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if !h.Clients[client] || client.away == away {
+		return
+	}
+	before := h.statusOf(client.UserID)
+	client.away = away
+	h.presenceChanged(client.UserID, before, h.peersOf(client.UserID))
+}
+
+// Status returns the presence status of a user from the connections of this hub
+func (h *Hub) Status(userID string) string {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	return h.statusOf(userID)
+}
+
+// Presence returns the presence of each user, in order. The status comes from the live
+// connections and the last seen time of users who are not online from the user store.
+func (h *Hub) Presence(ctx context.Context, userIDs []primitive.ObjectID) ([]domain.Presence, error) {
+	users, err := h.userUsecase.GetUsersByIDs(ctx, userIDs)
+	if err != nil {
+		return nil, err
+	}
+	lastSeen := make(map[primitive.ObjectID]*time.Time, len(users))
+	for _, user := range users {
+		lastSeen[user.UserID] = user.LastSeen
+	}
+
+	presence := make([]domain.Presence, 0, len(userIDs))
+	for _, userID := range userIDs {
+		entry := domain.Presence{UserID: userID, Status: h.Status(userID.Hex())}
+		if entry.Status != domain.PresenceOnline {
+			entry.LastSeen = lastSeen[userID]
+		}
+		presence = append(presence, entry)
+	}
+	return presence, nil
+}
+
+// handlePresence applies a presence.set command to this connection
+func (c *Client) handlePresence(hub *Hub, command Envelope) {
+	var payload SetPresencePayload
+	if err := json.Unmarshal(command.Payload, &payload); err != nil {
+		c.reject(hub, command, "invalid payload")
+		return
+	}
+
+	switch payload.Status {
+	case domain.PresenceOnline:
+		hub.setAway(c, false)
+	case domain.PresenceAway:
+		hub.setAway(c, true)
+	default:
+		c.reject(hub, command, "unknown presence status")
+		return
+	}
+	c.ack(hub, command, nil)
+}
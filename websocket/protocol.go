@@ -0,0 +1,129 @@
+package websocket
+
+import (
+	"Real-Time-Chat-Application/domain"
+	"encoding/json"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ProtocolVersion is the version of the envelope format below. Clients may omit it.
+const ProtocolVersion = 1
+
+// Commands a client sends to the server
+const (
+	// CommandSubscribe follows ChatID
+	CommandSubscribe = "subscribe"
+	// CommandUnsubscribe stops following ChatID
+	CommandUnsubscribe = "unsubscribe"
+	// CommandSendMessage posts a message to ChatID; the payload is a domain.Message
+	CommandSendMessage = "message.send"
+	// CommandTypingStart tells the other participants of ChatID the user is typing.
+	// Clients repeat it while the user keeps typing, or the indicator expires.
+	CommandTypingStart = "typing.start"
+	// CommandTypingStop clears the typing indicator right away
+	CommandTypingStop = "typing.stop"
+	// CommandMarkRead moves the user's read marker of ChatID; the payload is a ReadPayload
+	CommandMarkRead = "message.read"
+	// CommandSetPresence marks the connection as away or online again; the payload is a SetPresencePayload
+	CommandSetPresence = "presence.set"
+)
+
+// Events the server sends to clients
+const (
+	// EventMessageCreated carries a new domain.Message
+	EventMessageCreated = "message.created"
+	// EventMessageUpdated carries an edited domain.Message
+	EventMessageUpdated = "message.updated"
+	// EventMessageDeleted carries a MessageDeletedPayload
+	EventMessageDeleted = "message.deleted"
+	// EventTyping carries a TypingPayload
+	EventTyping = "typing"
+	// EventReceipt carries a ReceiptPayload
+	EventReceipt = "receipt"
+	// EventPresence carries a PresencePayload
+	EventPresence = "presence"
+	// EventError answers a command the server refused; the payload is an ErrorPayload
+	EventError = "error"
+	// EventAck answers a command the server accepted
+	EventAck = "ack"
+)
+
+// Envelope wraps everything sent over a websocket connection, in both directions.
+// ID is chosen by the client for commands and echoed back in the ack or error answering
+// them; events generated by the server get a unique ID of their own.
+type Envelope struct {
+	V       int             `json:"v"`
+	Type    string          `json:"type"`
+	ID      string          `json:"id,omitempty"`
+	ChatID  string          `json:"chat_id,omitempty"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// ErrorPayload is the payload of an error event
+type ErrorPayload struct {
+	Error string `json:"error"`
+}
+
+// MessageDeletedPayload is the payload of a message.deleted event
+type MessageDeletedPayload struct {
+	MessageID string `json:"message_id"`
+}
+
+// TypingPayload is the payload of a typing event
+type TypingPayload struct {
+	UserID string `json:"user_id"`
+	Typing bool   `json:"typing"`
+}
+
+// ReceiptPayload is the payload of a receipt event: the user has read the chat up to MessageID
+type ReceiptPayload struct {
+	UserID    string    `json:"user_id"`
+	MessageID string    `json:"message_id"`
+	ReadAt    time.Time `json:"read_at"`
+}
+
+// ReadPayload is the payload of a message.read command
+type ReadPayload struct {
+	MessageID string `json:"message_id"`
+}
+
+// NewReceiptPayload describes a user's read marker
+func NewReceiptPayload(userID primitive.ObjectID, marker domain.ReadMarker) ReceiptPayload {
+	return ReceiptPayload{
+		UserID:    userID.Hex(),
+		MessageID: marker.MessageID.Hex(),
+		ReadAt:    marker.ReadAt,
+	}
+}
+
+// PresencePayload is the payload of a presence event, sent when a user sharing a chat with
+// the client comes online, goes away or goes offline. LastSeen is set when going offline.
+type PresencePayload struct {
+	UserID   string     `json:"user_id"`
+	Status   string     `json:"status"`
+	LastSeen *time.Time `json:"last_seen,omitempty"`
+}
+
+// SetPresencePayload is the payload of a presence.set command: domain.PresenceOnline or domain.PresenceAway
+type SetPresencePayload struct {
+	Status string `json:"status"`
+}
+
+// NewEvent encodes a server event with a fresh ID. payload may be nil.
+func NewEvent(eventType, chatID string, payload interface{}) ([]byte, error) {
+	return encode(eventType, primitive.NewObjectID().Hex(), chatID, payload)
+}
+
+func encode(eventType, id, chatID string, payload interface{}) ([]byte, error) {
+	envelope := Envelope{V: ProtocolVersion, Type: eventType, ID: id, ChatID: chatID}
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return nil, err
+		}
+		envelope.Payload = data
+	}
+	return json.Marshal(envelope)
+}
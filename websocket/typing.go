@@ -0,0 +1,144 @@
+package websocket
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultTypingTimeout is how long a typing indicator lasts unless the client refreshes it
+	DefaultTypingTimeout = 5 * time.Second
+	// maxTypingCommandsPerSecond bounds the typing commands accepted from one connection
+	maxTypingCommandsPerSecond = 5
+)
+
+// typingKey identifies a user typing in a chat
+type typingKey struct {
+	chatID string
+	userID string
+}
+
+type typingEntry struct {
+	timer   *time.Timer
+	expires time.Time
+}
+
+// typingTracker remembers who is typing where, so indicators expire on their own when a
+// client stops refreshing them. Typing state is never persisted.
+type typingTracker struct {
+	mutex   sync.Mutex
+	entries map[typingKey]*typingEntry
+}
+
+func newTypingTracker() *typingTracker {
+	return &typingTracker{entries: make(map[typingKey]*typingEntry)}
+}
+
+// startTyping marks a user as typing in a chat until the typing timeout elapses. Only the
+// transition to typing is relayed; refreshing an indicator just pushes back its expiry.
+func (h *Hub) startTyping(chatID, userID string) {
+	key := typingKey{chatID: chatID, userID: userID}
+	expires := time.Now().Add(h.TypingTimeout)
+
+	h.typing.mutex.Lock()
+	if entry, ok := h.typing.entries[key]; ok {
+		entry.expires = expires
+		entry.timer.Reset(h.TypingTimeout)
+		h.typing.mutex.Unlock()
+		return
+	}
+
+	entry := &typingEntry{expires: expires}
+	entry.timer = time.AfterFunc(h.TypingTimeout, func() { h.expireTyping(key, entry) })
+	h.typing.entries[key] = entry
+	h.typing.mutex.Unlock()
+
+	h.relayTyping(chatID, userID, true)
+}
+
+// stopTyping clears a typing indicator, relaying the change if there was one
+func (h *Hub) stopTyping(chatID, userID string) {
+	key := typingKey{chatID: chatID, userID: userID}
+
+	h.typing.mutex.Lock()
+	entry, ok := h.typing.entries[key]
+	if ok {
+		entry.timer.Stop()
+		delete(h.typing.entries, key)
+	}
+	h.typing.mutex.Unlock()
+
+	if ok {
+		h.relayTyping(chatID, userID, false)
+	}
+}
+
+// expireTyping runs when an indicator's timer fires. The indicator may have been refreshed
+// or replaced in the meantime, in which case there is nothing to do.
+func (h *Hub) expireTyping(key typingKey, entry *typingEntry) {
+	h.typing.mutex.Lock()
+	if h.typing.entries[key] != entry || time.Now().Before(entry.expires) {
+		h.typing.mutex.Unlock()
+		return
+	}
+	delete(h.typing.entries, key)
+	h.typing.mutex.Unlock()
+
+	h.relayTyping(key.chatID, key.userID, false)
+}
+
+// relayTyping tells the other participants of a chat that a user started or stopped typing
+func (h *Hub) relayTyping(chatID, userID string, typing bool) {
+	event, err := NewEvent(EventTyping, chatID, TypingPayload{UserID: userID, Typing: typing})
+	if err != nil {
+		log.Printf("error marshaling typing event: %v", err)
+		return
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	for client := range h.chats[chatID] {
+		if client.UserID != userID {
+			h.send(client, event)
+		}
+	}
+}
+
+// handleTyping applies a typing.start or typing.stop command. Typing commands are not
+// acknowledged; commands over the rate limit are dropped, with a single error per second.
+func (c *Client) handleTyping(hub *Hub, command Envelope) {
+	if !hub.IsSubscribed(c, command.ChatID) {
+		c.reject(hub, command, "not subscribed to this chat")
+		return
+	}
+
+	now := time.Now()
+	if now.Sub(c.typingWindow) >= time.Second {
+		c.typingWindow = now
+		c.typingCount = 0
+	}
+	c.typingCount++
+	if c.typingCount > maxTypingCommandsPerSecond {
+		if c.typingCount == maxTypingCommandsPerSecond+1 {
+			c.reject(hub, command, "too many typing commands")
+		}
+		return
+	}
+
+	if command.Type == CommandTypingStart {
+		c.typingIn[command.ChatID] = true
+		hub.startTyping(command.ChatID, c.UserID)
+	} else {
+		delete(c.typingIn, command.ChatID)
+		hub.stopTyping(command.ChatID, c.UserID)
+	}
+}
+
+// clearTyping stops the indicators of a client that disconnects
+func (c *Client) clearTyping(hub *Hub) {
+	for chatID := range c.typingIn {
+		hub.stopTyping(chatID, c.UserID)
+	}
+}
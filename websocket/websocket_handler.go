@@ -0,0 +1,714 @@
+package websocket
+
+import (
+	"Real-Time-Chat-Application/domain"
+	"Real-Time-Chat-Application/httperr"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	CheckOrigin: func(r *http.Request) bool {
+		return true // Allow all origins for development, configure appropriately for production
+	},
+}
+
+var errInvalidID = domain.NewError(domain.ErrValidation, "invalid ID")
+
+// Heartbeat defaults. The server pings every connection and drops the ones that do not answer
+// with a pong, or send anything else, within the pong wait.
+const (
+	DefaultPingInterval   = 54 * time.Second
+	DefaultPongWait       = 60 * time.Second
+	DefaultWriteWait      = 10 * time.Second
+	DefaultMaxMessageSize = 64 * 1024
+)
+
+// Client represents a websocket client connection. One connection can follow many chats.
+type Client struct {
+	Conn      *websocket.Conn
+	UserID    string
+	SessionID string // session the connection was authenticated with, empty when unknown
+	SendChan  chan []byte
+	chats     map[string]bool // chats the client follows, guarded by the hub mutex
+	away      bool            // whether the user is idle on this connection, guarded by the hub mutex
+
+	// typing state, only touched by readPump
+	typingIn     map[string]bool // chats the client is typing in
+	typingWindow time.Time       // start of the current rate limiting window
+	typingCount  int             // typing commands received in the current window
+}
+
+// NewClient returns a client following the given chats
+func NewClient(conn *websocket.Conn, userID string, chatIDs ...string) *Client {
+	client := &Client{
+		Conn:     conn,
+		UserID:   userID,
+		SendChan: make(chan []byte, 256),
+		chats:    make(map[string]bool),
+		typingIn: make(map[string]bool),
+	}
+	for _, chatID := range chatIDs {
+		client.chats[chatID] = true
+	}
+	return client
+}
+
+// ChatMessage is an encoded event addressed to the clients of a single chat
+type ChatMessage struct {
+	ChatID string
+	Data   []byte
+}
+
+// Hub maintains the set of active clients and routes messages to the clients of each chat
+type Hub struct {
+	Clients        map[*Client]bool
+	chats          map[string]map[*Client]bool // chat ID -> clients following it
+	users          map[string]map[*Client]bool // user ID -> connections of the user
+	Broadcast      chan ChatMessage
+	Register       chan *Client
+	Unregister     chan *Client
+	mutex          sync.Mutex
+	chatUsecase    domain.ChatUsecase
+	messageUsecase domain.MessageUsecase
+	userUsecase    domain.UserUsecase
+	typing         *typingTracker
+	// TypingTimeout is how long a typing indicator lasts without being refreshed
+	TypingTimeout time.Duration
+	// PingInterval is how often connections are pinged; it must be shorter than PongWait
+	PingInterval time.Duration
+	// PongWait is how long a connection may stay silent before it is dropped
+	PongWait time.Duration
+	// WriteWait bounds every write to a connection
+	WriteWait time.Duration
+	// MaxMessageSize is the largest inbound message, in bytes; larger ones close the connection
+	MaxMessageSize int64
+	persisting     sync.WaitGroup // last seen times being written
+	done           chan struct{}  // closed by Stop to end Run
+	stopped        chan struct{}  // closed once Run has drained every client
+	stopOnce       sync.Once
+}
+
+func NewHub(chatUsecase domain.ChatUsecase, messageUsecase domain.MessageUsecase, userUsecase domain.UserUsecase) *Hub {
+	return &Hub{
+		chatUsecase:    chatUsecase,
+		messageUsecase: messageUsecase,
+		userUsecase:    userUsecase,
+		typing:         newTypingTracker(),
+		TypingTimeout:  DefaultTypingTimeout,
+		PingInterval:   DefaultPingInterval,
+		PongWait:       DefaultPongWait,
+		WriteWait:      DefaultWriteWait,
+		MaxMessageSize: DefaultMaxMessageSize,
+		Clients:        make(map[*Client]bool),
+		chats:          make(map[string]map[*Client]bool),
+		users:          make(map[string]map[*Client]bool),
+		Broadcast:      make(chan ChatMessage),
+		Register:       make(chan *Client),
+		Unregister:     make(chan *Client),
+		done:           make(chan struct{}),
+		stopped:        make(chan struct{}),
+	}
+}
+
+func (h *Hub) Run() {
+	defer close(h.stopped)
+
+	for {
+		select {
+		case <-h.done:
+			// Closing SendChan makes each writePump send a close frame and drop the connection
+			h.mutex.Lock()
+			for client := range h.Clients {
+				h.removeClient(client)
+			}
+			h.mutex.Unlock()
+			return
+
+		case client := <-h.Register:
+			h.mutex.Lock()
+			before := h.statusOf(client.UserID)
+			h.Clients[client] = true
+			h.addToUser(client)
+			for chatID := range client.chats {
+				h.addToChat(client, chatID)
+			}
+			h.presenceChanged(client.UserID, before, h.peersOf(client.UserID))
+			h.mutex.Unlock()
+
+		case client := <-h.Unregister:
+			h.mutex.Lock()
+			if _, ok := h.Clients[client]; ok {
+				h.removeClient(client)
+			}
+			h.mutex.Unlock()
+
+		case message := <-h.Broadcast:
+			h.mutex.Lock()
+			h.deliver(message.ChatID, message.Data)
+			h.mutex.Unlock()
+		}
+	}
+}
+
+// deliver sends a message to the clients of a chat, dropping the ones that cannot keep up.
+// The caller must hold the mutex.
+func (h *Hub) deliver(chatID string, message []byte) {
+	for client := range h.chats[chatID] {
+		select {
+		case client.SendChan <- message:
+		default:
+			h.removeClient(client)
+		}
+	}
+}
+
+// send queues a message for a single registered client, dropping the client if it cannot keep up.
+// The caller must hold the mutex.
+func (h *Hub) send(client *Client, message []byte) {
+	if !h.Clients[client] {
+		return
+	}
+	select {
+	case client.SendChan <- message:
+	default:
+		h.removeClient(client)
+	}
+}
+
+// removeClient forgets a registered client and closes its send channel, which ends its writePump.
+// The caller must hold the mutex.
+func (h *Hub) removeClient(client *Client) {
+	before := h.statusOf(client.UserID)
+	peers := h.peersOf(client.UserID)
+
+	delete(h.Clients, client)
+	h.removeFromUser(client)
+	for chatID := range client.chats {
+		h.removeFromChat(client, chatID)
+	}
+	close(client.SendChan)
+
+	h.presenceChanged(client.UserID, before, peers)
+}
+
+// addToUser and removeFromUser maintain the index of each user's connections. The caller must hold the mutex.
+func (h *Hub) addToUser(client *Client) {
+	if h.users[client.UserID] == nil {
+		h.users[client.UserID] = make(map[*Client]bool)
+	}
+	h.users[client.UserID][client] = true
+}
+
+func (h *Hub) removeFromUser(client *Client) {
+	if clients, ok := h.users[client.UserID]; ok {
+		delete(clients, client)
+		if len(clients) == 0 {
+			delete(h.users, client.UserID)
+		}
+	}
+}
+
+// addToChat and removeFromChat maintain the chat index. The caller must hold the mutex.
+func (h *Hub) addToChat(client *Client, chatID string) {
+	if h.chats[chatID] == nil {
+		h.chats[chatID] = make(map[*Client]bool)
+	}
+	h.chats[chatID][client] = true
+}
+
+func (h *Hub) removeFromChat(client *Client, chatID string) {
+	if clients, ok := h.chats[chatID]; ok {
+		delete(clients, client)
+		if len(clients) == 0 {
+			delete(h.chats, chatID)
+		}
+	}
+}
+
+// Subscribe makes a client follow a chat. The caller is responsible for authorizing the
+// subscription. Subscribing before the client is registered is fine: Run indexes the
+// client's chats when it registers it.
+func (h *Hub) Subscribe(client *Client, chatID string) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	client.chats[chatID] = true
+	if h.Clients[client] {
+		h.addToChat(client, chatID)
+	}
+}
+
+// Unsubscribe stops a client from following a chat
+func (h *Hub) Unsubscribe(client *Client, chatID string) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	delete(client.chats, chatID)
+	h.removeFromChat(client, chatID)
+}
+
+// SubscribeUser makes every connection of a user follow a chat, for users who just joined it
+func (h *Hub) SubscribeUser(userID, chatID string) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	for client := range h.users[userID] {
+		client.chats[chatID] = true
+		h.addToChat(client, chatID)
+	}
+}
+
+// UnsubscribeUser stops every connection of a user from following a chat they left
+func (h *Hub) UnsubscribeUser(userID, chatID string) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	for client := range h.users[userID] {
+		delete(client.chats, chatID)
+		h.removeFromChat(client, chatID)
+	}
+}
+
+// DisconnectSession closes every connection opened with a session, once it is revoked
+func (h *Hub) DisconnectSession(sessionID string) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	for client := range h.Clients {
+		if client.SessionID == sessionID {
+			h.removeClient(client)
+		}
+	}
+}
+
+// DisconnectUser closes every connection of a user, once all their sessions are revoked
+func (h *Hub) DisconnectUser(userID string) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	for client := range h.users[userID] {
+		h.removeClient(client)
+	}
+}
+
+// DisconnectOtherSessions closes every connection of a user but those of sessionID
+func (h *Hub) DisconnectOtherSessions(userID, sessionID string) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	for client := range h.users[userID] {
+		if client.SessionID != sessionID {
+			h.removeClient(client)
+		}
+	}
+}
+
+// IsSubscribed reports whether a client follows a chat
+func (h *Hub) IsSubscribed(client *Client, chatID string) bool {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	return client.chats[chatID]
+}
+
+// Subscriptions returns the chats a client follows, sorted
+func (h *Hub) Subscriptions(client *Client) []string {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	chatIDs := make([]string, 0, len(client.chats))
+	for chatID := range client.chats {
+		chatIDs = append(chatIDs, chatID)
+	}
+	sort.Strings(chatIDs)
+	return chatIDs
+}
+
+// Stop tells Run to disconnect every client and return. It blocks until the clients
+// have been drained and their last seen times written, or ctx expires. Stop is safe to
+// call more than once.
+func (h *Hub) Stop(ctx context.Context) error {
+	h.stopOnce.Do(func() {
+		close(h.done)
+	})
+
+	select {
+	case <-h.stopped:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	persisted := make(chan struct{})
+	go func() {
+		h.persisting.Wait()
+		close(persisted)
+	}()
+
+	select {
+	case <-persisted:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Authorize returns domain.ErrForbidden unless the user is a participant of the chat.
+// The hub only registers clients for chats they are allowed to read.
+func (h *Hub) Authorize(ctx context.Context, userID, chatID string) error {
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return fmt.Errorf("%w: user %q", errInvalidID, userID)
+	}
+	chatObjectID, err := primitive.ObjectIDFromHex(chatID)
+	if err != nil {
+		return fmt.Errorf("%w: chat %q", errInvalidID, chatID)
+	}
+
+	return h.chatUsecase.AuthorizeParticipant(ctx, userObjectID, chatObjectID)
+}
+
+// chatsOf returns the IDs of every chat the user participates in
+func (h *Hub) chatsOf(ctx context.Context, userID string) ([]string, error) {
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: user %q", errInvalidID, userID)
+	}
+
+	chats, err := h.chatUsecase.GetChatsByUserID(ctx, userObjectID)
+	if err != nil {
+		return nil, err
+	}
+
+	chatIDs := make([]string, 0, len(chats))
+	for _, chat := range chats {
+		chatIDs = append(chatIDs, chat.ChatID.Hex())
+	}
+	return chatIDs, nil
+}
+
+// HandleWebSocket upgrades HTTP connection to WebSocket and handles the connection.
+// userID and sessionID must come from an authenticated source, never from the request itself;
+// revoking the session closes the connection.
+//
+// The connection starts subscribed to every chat of the user; more chats can be followed
+// with subscribe commands. An optional chat_id query parameter is checked before upgrading.
+func HandleWebSocket(c *gin.Context, hub *Hub, userID, sessionID string) {
+	chatIDs, err := initialChats(c, hub, userID)
+	if err != nil {
+		httperr.Respond(c, err)
+		return
+	}
+
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		log.Printf("Failed to upgrade connection: %v", err)
+		return
+	}
+
+	client := NewClient(conn, userID, chatIDs...)
+	client.SessionID = sessionID
+
+	select {
+	case hub.Register <- client:
+	case <-hub.done:
+		conn.Close()
+		return
+	}
+
+	// Start goroutines for reading and writing messages
+	go client.writePump(hub)
+	go client.readPump(hub)
+}
+
+// initialChats returns the chats a new connection is subscribed to
+func initialChats(c *gin.Context, hub *Hub, userID string) ([]string, error) {
+	// Refuse the upgrade before any connection is registered for a chat the user is not in
+	chatID := c.Query("chat_id")
+	if chatID != "" {
+		if err := hub.Authorize(c.Request.Context(), userID, chatID); err != nil {
+			return nil, err
+		}
+	}
+
+	chatIDs, err := hub.chatsOf(c.Request.Context(), userID)
+	if err != nil {
+		return nil, err
+	}
+	if chatID != "" {
+		chatIDs = append(chatIDs, chatID)
+	}
+	return chatIDs, nil
+}
+
+// writePump sends queued events and pings the connection. A write that does not complete
+// within the write wait closes the connection, which ends readPump as well.
+func (c *Client) writePump(hub *Hub) {
+	ticker := time.NewTicker(hub.PingInterval)
+	defer func() {
+		ticker.Stop()
+		c.Conn.Close()
+	}()
+
+	for {
+		select {
+		case message, ok := <-c.SendChan:
+			c.Conn.SetWriteDeadline(time.Now().Add(hub.WriteWait))
+			if !ok {
+				c.Conn.WriteMessage(websocket.CloseMessage, []byte{})
+				return
+			}
+
+			w, err := c.Conn.NextWriter(websocket.TextMessage)
+			if err != nil {
+				return
+			}
+			w.Write(message)
+
+			if err := w.Close(); err != nil {
+				return
+			}
+
+		case <-ticker.C:
+			c.Conn.SetWriteDeadline(time.Now().Add(hub.WriteWait))
+			if err := c.Conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// readPump handles the commands of a connection until it closes or goes silent. Every pong
+// and every command pushes back the read deadline; a connection that misses it is unregistered.
+func (c *Client) readPump(hub *Hub) {
+	defer func() {
+		c.clearTyping(hub)
+		select {
+		case hub.Unregister <- c:
+		case <-hub.done:
+		}
+		c.Conn.Close()
+	}()
+
+	c.Conn.SetReadLimit(hub.MaxMessageSize)
+	c.Conn.SetReadDeadline(time.Now().Add(hub.PongWait))
+	c.Conn.SetPongHandler(func(string) error {
+		return c.Conn.SetReadDeadline(time.Now().Add(hub.PongWait))
+	})
+
+	for {
+		_, message, err := c.Conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
+				log.Printf("error: %v", err)
+			}
+			break
+		}
+		c.Conn.SetReadDeadline(time.Now().Add(hub.PongWait))
+
+		// Parse the envelope
+		var command Envelope
+		if err := json.Unmarshal(message, &command); err != nil {
+			c.reject(hub, Envelope{}, "invalid envelope")
+			continue
+		}
+		if command.V != 0 && command.V != ProtocolVersion {
+			c.reject(hub, command, "unsupported protocol version")
+			continue
+		}
+
+		switch command.Type {
+		case CommandSubscribe:
+			c.subscribe(hub, command)
+
+		case CommandUnsubscribe:
+			hub.Unsubscribe(c, command.ChatID)
+			c.ack(hub, command, nil)
+
+		case CommandSendMessage:
+			// Subscriptions are authorized, so they double as the right to post
+			if !hub.IsSubscribed(c, command.ChatID) {
+				c.reject(hub, command, "not subscribed to this chat")
+				continue
+			}
+
+			msg, ok := c.persist(hub, command)
+			if !ok {
+				continue
+			}
+			c.ack(hub, command, msg)
+
+			// Broadcast the stored message to the clients of the same chat only
+			event, err := NewEvent(EventMessageCreated, command.ChatID, msg)
+			if err != nil {
+				log.Printf("error marshaling broadcast message: %v", err)
+				continue
+			}
+
+			select {
+			case hub.Broadcast <- ChatMessage{ChatID: command.ChatID, Data: event}:
+			case <-hub.done:
+				return
+			}
+
+			// Sending a message ends the sender's typing indicator
+			if c.typingIn[command.ChatID] {
+				delete(c.typingIn, command.ChatID)
+				hub.stopTyping(command.ChatID, c.UserID)
+			}
+
+		case CommandTypingStart, CommandTypingStop:
+			c.handleTyping(hub, command)
+
+		case CommandMarkRead:
+			c.markRead(hub, command)
+
+		case CommandSetPresence:
+			c.handlePresence(hub, command)
+
+		default:
+			c.reject(hub, command, "unknown command type")
+		}
+	}
+}
+
+// persist stores a message.send command as a message of the authenticated user. Whatever the
+// client claims, the sender, time and ID are set by the server. On failure the client is sent
+// an error event and ok is false.
+func (c *Client) persist(hub *Hub, command Envelope) (msg domain.Message, ok bool) {
+	if err := json.Unmarshal(command.Payload, &msg); err != nil {
+		c.reject(hub, command, "invalid message")
+		return domain.Message{}, false
+	}
+
+	chatID, err := primitive.ObjectIDFromHex(command.ChatID)
+	if err != nil {
+		c.reject(hub, command, "invalid chat ID")
+		return domain.Message{}, false
+	}
+	senderID, err := primitive.ObjectIDFromHex(c.UserID)
+	if err != nil {
+		c.reject(hub, command, "invalid user ID")
+		return domain.Message{}, false
+	}
+
+	msg.SenderID = senderID
+	msg.Edited = false
+
+	if err := hub.messageUsecase.SendMessage(context.Background(), chatID, &msg); err != nil {
+		if errors.Is(err, domain.ErrForbidden) || errors.Is(err, domain.ErrValidation) {
+			c.reject(hub, command, err.Error())
+		} else {
+			log.Printf("error storing message: %v", err)
+			c.reject(hub, command, "failed to send message")
+		}
+		return domain.Message{}, false
+	}
+
+	return msg, true
+}
+
+// markRead moves the user's read marker and tells the chat when it advanced
+func (c *Client) markRead(hub *Hub, command Envelope) {
+	var payload ReadPayload
+	if err := json.Unmarshal(command.Payload, &payload); err != nil {
+		c.reject(hub, command, "invalid payload")
+		return
+	}
+
+	userID, err := primitive.ObjectIDFromHex(c.UserID)
+	if err != nil {
+		c.reject(hub, command, "invalid user ID")
+		return
+	}
+	chatID, err := primitive.ObjectIDFromHex(command.ChatID)
+	if err != nil {
+		c.reject(hub, command, "invalid chat ID")
+		return
+	}
+	messageID, err := primitive.ObjectIDFromHex(payload.MessageID)
+	if err != nil {
+		c.reject(hub, command, "invalid message ID")
+		return
+	}
+
+	marker, advanced, err := hub.chatUsecase.MarkRead(context.Background(), userID, chatID, messageID)
+	if err != nil {
+		if errors.Is(err, domain.ErrForbidden) {
+			c.reject(hub, command, err.Error())
+		} else {
+			log.Printf("error marking chat as read: %v", err)
+			c.reject(hub, command, "failed to mark as read")
+		}
+		return
+	}
+
+	c.ack(hub, command, marker)
+	if advanced {
+		hub.BroadcastToChat(command.ChatID, EventReceipt, NewReceiptPayload(userID, marker))
+	}
+}
+
+// subscribe follows a chat after checking the user participates in it
+func (c *Client) subscribe(hub *Hub, command Envelope) {
+	if err := hub.Authorize(context.Background(), c.UserID, command.ChatID); err != nil {
+		if errors.Is(err, domain.ErrForbidden) || errors.Is(err, errInvalidID) {
+			c.reject(hub, command, err.Error())
+		} else {
+			log.Printf("error authorizing subscription: %v", err)
+			c.reject(hub, command, "failed to subscribe")
+		}
+		return
+	}
+
+	hub.Subscribe(c, command.ChatID)
+	c.ack(hub, command, nil)
+}
+
+// ack and reject answer a command of this client only, echoing its ID
+func (c *Client) ack(hub *Hub, command Envelope, payload interface{}) {
+	c.reply(hub, EventAck, command, payload)
+}
+
+func (c *Client) reject(hub *Hub, command Envelope, message string) {
+	c.reply(hub, EventError, command, ErrorPayload{Error: message})
+}
+
+func (c *Client) reply(hub *Hub, eventType string, command Envelope, payload interface{}) {
+	data, err := encode(eventType, command.ID, command.ChatID, payload)
+	if err != nil {
+		log.Printf("error marshaling reply: %v", err)
+		return
+	}
+
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+	hub.send(c, data)
+}
+
+// BroadcastToChat sends an event to all clients in a specific chat
+func (h *Hub) BroadcastToChat(chatID, eventType string, payload interface{}) {
+	event, err := NewEvent(eventType, chatID, payload)
+	if err != nil {
+		log.Printf("error marshaling %s event: %v", eventType, err)
+		return
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.deliver(chatID, event)
+}